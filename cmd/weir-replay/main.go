@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tidb-incubator/weir/pkg/capture"
+	"github.com/tidb-incubator/weir/pkg/capture/replay"
+)
+
+var (
+	captureFilePath = flag.String("file", "", "capture file path")
+	addr            = flag.String("addr", "127.0.0.1:4000", "replay target address")
+	user            = flag.String("user", "", "replay user, the captured users are used if it is empty")
+	password        = flag.String("password", "", "replay password")
+	speed           = flag.Float64("speed", 1, "replay speed, 2 replays twice as fast as captured, 0 replays without waiting")
+	connectTimeout  = flag.Duration("connect-timeout", 5*time.Second, "replay connect timeout")
+)
+
+func main() {
+	flag.Parse()
+	if *captureFilePath == "" {
+		fmt.Println("capture file path is required")
+		os.Exit(1)
+	}
+	if *speed < 0 {
+		fmt.Println("speed must not be negative")
+		os.Exit(1)
+	}
+
+	f, err := os.Open(*captureFilePath)
+	if err != nil {
+		fmt.Printf("open capture file error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	r, err := capture.NewReader(f)
+	if err != nil {
+		fmt.Printf("read capture file error: %v\n", err)
+		os.Exit(1)
+	}
+	header := r.Header()
+	fmt.Printf("replay namespace %s captured at %s to %s\n", header.Namespace, header.StartTime.Format(time.RFC3339), *addr)
+
+	report, err := replay.Replay(r, &replay.Config{
+		Addr:           *addr,
+		User:           *user,
+		Password:       *password,
+		Speed:          *speed,
+		ConnectTimeout: *connectTimeout,
+	})
+	report.Print(os.Stdout)
+	if err != nil {
+		fmt.Printf("replay error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -48,6 +48,7 @@ func main() {
 		syscall.SIGQUIT,
 		syscall.SIGPIPE,
 		syscall.SIGUSR1,
+		syscall.SIGUSR2,
 	)
 
 	var wg sync.WaitGroup
@@ -56,13 +57,25 @@ func main() {
 	go func() {
 		defer wg.Done()
 		for {
-			sig := <-sc
-			if sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == syscall.SIGQUIT {
-				logutil.BgLogger().Warn("get os signal, close proxy server", zap.String("signal", sig.String()))
+			select {
+			case sig := <-sc:
+				if sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == syscall.SIGQUIT {
+					logutil.BgLogger().Warn("get os signal, close proxy server gracefully", zap.String("signal", sig.String()))
+					p.Close()
+					return
+				} else if sig == syscall.SIGUSR2 {
+					logutil.BgLogger().Warn("get os signal, upgrade proxy server", zap.String("signal", sig.String()))
+					if err := p.Upgrade(); err != nil {
+						logutil.BgLogger().Error("upgrade proxy server error", zap.Error(err))
+					}
+				} else {
+					logutil.BgLogger().Warn("ignore os signal", zap.String("signal", sig.String()))
+				}
+			case <-p.Upgraded():
+				// the upgrade may be triggered by the admin api too.
+				logutil.BgLogger().Warn("proxy server is upgraded, wait for the sessions to finish")
 				p.Close()
-				break
-			} else {
-				logutil.BgLogger().Warn("ignore os signal", zap.String("signal", sig.String()))
+				return
 			}
 		}
 	}()
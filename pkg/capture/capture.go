@@ -0,0 +1,377 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCaptureDir      = "capture"
+	defaultCaptureMaxBytes = 1 << 30
+
+	// the events are dropped if the writer falls behind by eventQueueSize.
+	eventQueueSize = 4096
+)
+
+var (
+	ErrCaptureRunning  = errors.New("capture is running")
+	ErrCaptureNotFound = errors.New("capture not found")
+	ErrFileTooLarge    = errors.New("capture file reaches max bytes")
+)
+
+// Session is the state of a conn before a command.
+type Session struct {
+	User      string
+	DB        string
+	Collation uint8
+	InTxn     bool
+}
+
+// Command is a command handled by the proxy.
+type Command struct {
+	Data      []byte
+	StartTime time.Time
+	Duration  time.Duration
+	ErrCode   uint16
+	StmtID    uint32
+}
+
+type Status struct {
+	Namespace string    `json:"namespace"`
+	File      string    `json:"file"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Running   bool      `json:"running"`
+	Events    int64     `json:"events"`
+	Dropped   int64     `json:"dropped"`
+	Bytes     int64     `json:"bytes"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Capture records the traffic of a namespace, the events are written to the file in background.
+type Capture struct {
+	namespace string
+	path      string
+	startTime time.Time
+	maxBytes  int64
+
+	file   *os.File
+	writer *Writer
+	bytes  countingWriter
+
+	connLock sync.Mutex
+	conns    map[uint32]struct{} // the conns whose EventConnOpen is recorded
+
+	events   chan *Event
+	dropped  int64
+	written  int64
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	doneCh   chan struct{}
+	timer    *time.Timer
+
+	statusLock sync.Mutex
+	endTime    time.Time
+	err        error
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func startCapture(namespace, path string, duration time.Duration, maxBytes int64) (*Capture, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c := &Capture{
+		namespace: namespace,
+		path:      path,
+		startTime: time.Now(),
+		maxBytes:  maxBytes,
+		file:      f,
+		conns:     make(map[uint32]struct{}),
+		events:    make(chan *Event, eventQueueSize),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	c.bytes.w = f
+	if c.writer, err = NewWriter(&c.bytes, &Header{Namespace: namespace, StartTime: c.startTime}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.timer = time.AfterFunc(duration, c.signalStop)
+	go c.run()
+	return c, nil
+}
+
+// RecordCommand records a command of the conn with the session state before the command,
+// the session is recorded as EventConnOpen if it is the first command of the conn in the capture.
+func (c *Capture) RecordCommand(connID uint32, session *Session, cmd *Command) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if _, ok := c.conns[connID]; !ok {
+		if !c.enqueue(&Event{
+			Type:      EventConnOpen,
+			ConnID:    connID,
+			Time:      c.sinceStart(cmd.StartTime),
+			User:      session.User,
+			DB:        session.DB,
+			Collation: session.Collation,
+			InTxn:     session.InTxn,
+		}) {
+			return
+		}
+		c.conns[connID] = struct{}{}
+	}
+	c.enqueue(&Event{
+		Type:   EventCommand,
+		ConnID: connID,
+		Time:   c.sinceStart(cmd.StartTime),
+		// the data is reused by the conn after the command.
+		Data:     append([]byte(nil), cmd.Data...),
+		Duration: cmd.Duration,
+		ErrCode:  cmd.ErrCode,
+		StmtID:   cmd.StmtID,
+	})
+}
+
+// RecordClose records the close of a conn, which is ignored if no command of the conn is recorded.
+func (c *Capture) RecordClose(connID uint32) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if _, ok := c.conns[connID]; !ok {
+		return
+	}
+	delete(c.conns, connID)
+	c.enqueue(&Event{Type: EventConnClose, ConnID: connID, Time: c.sinceStart(time.Now())})
+}
+
+func (c *Capture) sinceStart(t time.Time) time.Duration {
+	if t.Before(c.startTime) {
+		return 0
+	}
+	return t.Sub(c.startTime)
+}
+
+func (c *Capture) enqueue(e *Event) bool {
+	select {
+	case c.events <- e:
+		return true
+	default:
+		atomic.AddInt64(&c.dropped, 1)
+		return false
+	}
+}
+
+func (c *Capture) running() bool {
+	select {
+	case <-c.stopCh:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *Capture) signalStop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+}
+
+// Stop stops the capture and waits until the file is closed.
+func (c *Capture) Stop() {
+	c.signalStop()
+	<-c.doneCh
+}
+
+func (c *Capture) run() {
+	defer close(c.doneCh)
+	for {
+		select {
+		case e := <-c.events:
+			c.write(e)
+		case <-c.stopCh:
+			// the events recorded before stop are written.
+			for {
+				select {
+				case e := <-c.events:
+					c.write(e)
+				default:
+					c.finish()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *Capture) write(e *Event) {
+	if c.getErr() != nil {
+		return
+	}
+	err := c.writer.Write(e)
+	if err == nil && atomic.LoadInt64(&c.bytes.n) >= c.maxBytes {
+		err = ErrFileTooLarge
+	}
+	if err != nil {
+		c.setErr(err)
+		c.signalStop()
+		return
+	}
+	atomic.AddInt64(&c.written, 1)
+}
+
+func (c *Capture) finish() {
+	c.timer.Stop()
+	if err := c.writer.Close(); err != nil && c.getErr() == nil {
+		c.setErr(err)
+	}
+	if err := c.file.Close(); err != nil && c.getErr() == nil {
+		c.setErr(errors.Trace(err))
+	}
+	c.statusLock.Lock()
+	c.endTime = time.Now()
+	c.statusLock.Unlock()
+	status := c.Status()
+	logutil.BgLogger().Info("capture stopped", zap.String("namespace", c.namespace), zap.String("file", c.path),
+		zap.Int64("events", status.Events), zap.Int64("dropped", status.Dropped), zap.String("error", status.Error))
+}
+
+func (c *Capture) setErr(err error) {
+	c.statusLock.Lock()
+	c.err = err
+	c.statusLock.Unlock()
+}
+
+func (c *Capture) getErr() error {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	return c.err
+}
+
+func (c *Capture) Status() Status {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+	s := Status{
+		Namespace: c.namespace,
+		File:      c.path,
+		StartTime: c.startTime,
+		EndTime:   c.endTime,
+		Running:   c.endTime.IsZero(),
+		Events:    atomic.LoadInt64(&c.written),
+		Dropped:   atomic.LoadInt64(&c.dropped),
+		Bytes:     atomic.LoadInt64(&c.bytes.n),
+	}
+	if c.err != nil {
+		s.Error = c.err.Error()
+	}
+	return s
+}
+
+// Manager holds a capture for each namespace, the last stopped capture is kept for its status.
+type Manager struct {
+	dir      string
+	maxBytes int64
+
+	lock sync.Mutex
+	// captures is a map[string]*Capture copied on write, so that the sessions read it without lock.
+	captures atomic.Value
+}
+
+func NewManager(cfg *config.Capture) *Manager {
+	m := &Manager{
+		dir:      cfg.Dir,
+		maxBytes: cfg.MaxBytes,
+	}
+	if m.dir == "" {
+		m.dir = defaultCaptureDir
+	}
+	if m.maxBytes <= 0 {
+		m.maxBytes = defaultCaptureMaxBytes
+	}
+	m.captures.Store(make(map[string]*Capture))
+	return m
+}
+
+func (m *Manager) load() map[string]*Capture {
+	return m.captures.Load().(map[string]*Capture)
+}
+
+// Get returns the running capture of the namespace, or nil if there is none.
+func (m *Manager) Get(namespace string) *Capture {
+	c, ok := m.load()[namespace]
+	if !ok || !c.running() {
+		return nil
+	}
+	return c
+}
+
+// Start starts to capture the namespace for the duration, the file is named by the namespace and start time.
+func (m *Manager) Start(namespace string, duration time.Duration) (Status, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	captures := m.load()
+	if c, ok := captures[namespace]; ok && c.running() {
+		return c.Status(), ErrCaptureRunning
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return Status{}, errors.Trace(err)
+	}
+	path := filepath.Join(m.dir, fmt.Sprintf("%s-%s.cap", namespace, time.Now().Format("20060102150405")))
+	c, err := startCapture(namespace, path, duration, m.maxBytes)
+	if err != nil {
+		return Status{}, err
+	}
+
+	newCaptures := make(map[string]*Capture, len(captures)+1)
+	for ns, old := range captures {
+		newCaptures[ns] = old
+	}
+	newCaptures[namespace] = c
+	m.captures.Store(newCaptures)
+	logutil.BgLogger().Info("capture started", zap.String("namespace", namespace), zap.String("file", path), zap.Duration("duration", duration))
+	return c.Status(), nil
+}
+
+// Stop stops the capture of the namespace, it returns the status if the capture is stopped already.
+func (m *Manager) Stop(namespace string) (Status, error) {
+	c, ok := m.load()[namespace]
+	if !ok {
+		return Status{}, ErrCaptureNotFound
+	}
+	c.Stop()
+	return c.Status(), nil
+}
+
+func (m *Manager) GetStatus(namespace string) (Status, error) {
+	c, ok := m.load()[namespace]
+	if !ok {
+		return Status{}, ErrCaptureNotFound
+	}
+	return c.Status(), nil
+}
+
+// Close stops all the captures.
+func (m *Manager) Close() {
+	for _, c := range m.load() {
+		c.Stop()
+	}
+}
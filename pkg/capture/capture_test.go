@@ -0,0 +1,116 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func TestWriterAndReader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, &Header{Namespace: "test_ns"})
+	require.NoError(t, err)
+	events := []*Event{
+		{Type: EventConnOpen, ConnID: 1, User: "root", DB: "test", Collation: 46},
+		{Type: EventCommand, ConnID: 1, Time: time.Second, Data: []byte("\x03select 1"), Duration: time.Millisecond, ErrCode: 1105},
+		{Type: EventConnClose, ConnID: 1, Time: 2 * time.Second},
+	}
+	for _, e := range events {
+		require.NoError(t, w.Write(e))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "test_ns", r.Header().Namespace)
+	for _, expected := range events {
+		e, err := r.Next()
+		require.NoError(t, err)
+		require.Equal(t, expected, e)
+	}
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestManagerCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := NewManager(&config.Capture{Dir: dir})
+	require.Nil(t, m.Get("test_ns"))
+	_, err = m.Stop("test_ns")
+	require.Equal(t, ErrCaptureNotFound, err)
+
+	status, err := m.Start("test_ns", time.Minute)
+	require.NoError(t, err)
+	require.True(t, status.Running)
+	_, err = m.Start("test_ns", time.Minute)
+	require.Equal(t, ErrCaptureRunning, err)
+
+	c := m.Get("test_ns")
+	require.NotNil(t, c)
+	session := &Session{User: "root", DB: "test"}
+	data := []byte("\x03select 1")
+	c.RecordCommand(1, session, &Command{Data: data, StartTime: time.Now(), Duration: time.Millisecond})
+	// the data is copied when it is recorded
+	data[1] = 'S'
+	c.RecordCommand(1, session, &Command{Data: []byte("\x02test"), StartTime: time.Now()})
+	c.RecordClose(1)
+	// the conn without any recorded command is ignored
+	c.RecordClose(2)
+
+	status, err = m.Stop("test_ns")
+	require.NoError(t, err)
+	require.False(t, status.Running)
+	require.Equal(t, int64(4), status.Events)
+	require.Empty(t, status.Error)
+	require.Nil(t, m.Get("test_ns"))
+
+	f, err := os.Open(status.File)
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := NewReader(f)
+	require.NoError(t, err)
+	var types []EventType
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, e.Type)
+		if e.Type == EventConnOpen {
+			require.Equal(t, "root", e.User)
+			require.Equal(t, "test", e.DB)
+		}
+		if len(types) == 2 {
+			require.Equal(t, "\x03select 1", string(e.Data))
+		}
+	}
+	require.Equal(t, []EventType{EventConnOpen, EventCommand, EventCommand, EventConnClose}, types)
+}
+
+func TestCaptureMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := NewManager(&config.Capture{Dir: dir, MaxBytes: 1})
+	_, err = m.Start("test_ns", time.Minute)
+	require.NoError(t, err)
+	m.Get("test_ns").RecordCommand(1, &Session{}, &Command{Data: []byte("\x03select 1"), StartTime: time.Now()})
+
+	require.Eventually(t, func() bool {
+		return m.Get("test_ns") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	status, err := m.Stop("test_ns")
+	require.NoError(t, err)
+	require.Equal(t, ErrFileTooLarge.Error(), status.Error)
+}
@@ -0,0 +1,119 @@
+// Package capture records the client traffic of a namespace into a file, and replays it
+// against a MySQL protocol endpoint.
+//
+// A capture file is a gzip compressed gob stream, which starts with a Header and is followed by
+// the Events in the order they happened.
+package capture
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+const formatVersion = 1
+
+var ErrUnsupportedVersion = errors.New("unsupported capture file version")
+
+type EventType uint8
+
+const (
+	// EventConnOpen is recorded before the first command of a conn in the capture, it carries
+	// the session state, since the conn may be opened before the capture starts.
+	EventConnOpen EventType = iota + 1
+	EventConnClose
+	EventCommand
+)
+
+type Header struct {
+	Version   int
+	Namespace string
+	StartTime time.Time
+}
+
+// Event is a conn event or a command, the fields not used by the type are left empty.
+type Event struct {
+	Type   EventType
+	ConnID uint32
+	// Time is the time since the capture started.
+	Time time.Duration
+
+	// session state of EventConnOpen.
+	User      string
+	DB        string
+	Collation uint8
+	InTxn     bool
+
+	// Data is the command packet of EventCommand, the first byte is the command.
+	Data     []byte
+	Duration time.Duration
+	// ErrCode is the error code returned to the client, 0 means succeeded.
+	ErrCode uint16
+	// StmtID is the statement id returned by COM_STMT_PREPARE.
+	StmtID uint32
+}
+
+type Writer struct {
+	gz  *gzip.Writer
+	enc *gob.Encoder
+}
+
+func NewWriter(w io.Writer, header *Header) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	enc := gob.NewEncoder(gz)
+	header.Version = formatVersion
+	if err := enc.Encode(header); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &Writer{gz: gz, enc: enc}, nil
+}
+
+func (w *Writer) Write(e *Event) error {
+	return errors.Trace(w.enc.Encode(e))
+}
+
+// Close flushes the compressed data, the underlying writer is not closed.
+func (w *Writer) Close() error {
+	return errors.Trace(w.gz.Close())
+}
+
+type Reader struct {
+	header *Header
+	dec    *gob.Decoder
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	dec := gob.NewDecoder(gz)
+	header := &Header{}
+	if err := dec.Decode(header); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if header.Version != formatVersion {
+		return nil, errors.WithMessage(ErrUnsupportedVersion, fmt.Sprintf("version: %d", header.Version))
+	}
+	return &Reader{header: header, dec: dec}, nil
+}
+
+func (r *Reader) Header() *Header {
+	return r.header
+}
+
+// Next returns io.EOF after the last event, a file truncated by a crash returns io.ErrUnexpectedEOF.
+func (r *Reader) Next() (*Event, error) {
+	e := &Event{}
+	if err := r.dec.Decode(e); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, errors.Trace(err)
+	}
+	return e, nil
+}
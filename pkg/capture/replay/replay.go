@@ -0,0 +1,225 @@
+// Package replay replays a capture file against a MySQL protocol endpoint, and compares
+// the latency and errors with the captured ones.
+package replay
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/charset"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/util/logutil"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/capture"
+	"github.com/tidb-incubator/weir/pkg/proxy/backend/client"
+	"go.uber.org/zap"
+)
+
+// the events of a conn are queued while the conn is executing, the reader blocks if the queue is full.
+const connEventQueueSize = 1024
+
+type Config struct {
+	Addr string
+	// User replaces the captured users if it is set, the password is used by all the conns.
+	User     string
+	Password string
+	// Speed scales the intervals between the events, 2 replays twice as fast as captured,
+	// 0 replays the events without waiting.
+	Speed          float64
+	ConnectTimeout time.Duration
+}
+
+// Replay replays the events read from r, it returns after all the replayed conns are closed.
+func Replay(r *capture.Reader, cfg *Config) (*Report, error) {
+	report := newReport()
+	conns := make(map[uint32]*replayConn)
+	var wg sync.WaitGroup
+	closeConn := func(id uint32) {
+		close(conns[id].events)
+		delete(conns, id)
+	}
+	defer func() {
+		for id := range conns {
+			closeConn(id)
+		}
+		wg.Wait()
+		report.finish()
+	}()
+
+	startTime := time.Now()
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		if cfg.Speed > 0 {
+			if wait := time.Duration(float64(e.Time)/cfg.Speed) - time.Since(startTime); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		switch e.Type {
+		case capture.EventConnOpen:
+			if _, ok := conns[e.ConnID]; ok {
+				closeConn(e.ConnID)
+			}
+			conn := &replayConn{cfg: cfg, report: report, events: make(chan *capture.Event, connEventQueueSize)}
+			conns[e.ConnID] = conn
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn.run()
+			}()
+			conn.events <- e
+		case capture.EventConnClose:
+			if _, ok := conns[e.ConnID]; ok {
+				closeConn(e.ConnID)
+			}
+		case capture.EventCommand:
+			conn, ok := conns[e.ConnID]
+			if !ok {
+				// the open event is dropped by capture.
+				report.skip()
+				continue
+			}
+			conn.events <- e
+		default:
+			return report, errors.Errorf("unknown event type %d", e.Type)
+		}
+	}
+}
+
+type replayConn struct {
+	cfg    *Config
+	report *Report
+	events chan *capture.Event
+
+	conn *client.Conn
+	// stmts maps the captured stmt ids to the replayed ones.
+	stmts map[uint32]uint32
+}
+
+func (c *replayConn) run() {
+	defer func() {
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	}()
+	for e := range c.events {
+		if e.Type == capture.EventConnOpen {
+			c.open(e)
+			continue
+		}
+		// the commands of a broken conn are skipped.
+		if c.conn == nil {
+			c.report.skip()
+			continue
+		}
+		c.execute(e)
+	}
+}
+
+func (c *replayConn) open(e *capture.Event) {
+	user := c.cfg.User
+	if user == "" {
+		user = e.User
+	}
+	conn, err := client.ConnectWithTimeout(c.cfg.Addr, user, c.cfg.Password, e.DB, c.cfg.ConnectTimeout)
+	if err != nil {
+		c.report.connError()
+		logutil.BgLogger().Warn("replay connect error", zap.Uint32("conn", e.ConnID), zap.String("user", user), zap.Error(err))
+		return
+	}
+	if e.Collation != 0 {
+		if cs, _, err := charset.GetCharsetInfoByID(int(e.Collation)); err == nil {
+			if err := conn.SetCharset(cs); err != nil {
+				logutil.BgLogger().Warn("replay set charset error", zap.Uint32("conn", e.ConnID), zap.String("charset", cs), zap.Error(err))
+			}
+		}
+	}
+	c.conn = conn
+	c.stmts = make(map[uint32]uint32)
+	c.report.connOpened()
+}
+
+func (c *replayConn) execute(e *capture.Event) {
+	if len(e.Data) == 0 {
+		c.report.skip()
+		return
+	}
+	cmd, data := e.Data[0], e.Data[1:]
+	startTime := time.Now()
+	var err error
+	switch cmd {
+	case mysql.ComQuery:
+		_, err = c.conn.Execute(string(data))
+	case mysql.ComInitDB:
+		err = c.conn.UseDB(string(data))
+	case mysql.ComStmtPrepare:
+		var stmt *client.Stmt
+		if stmt, err = c.conn.Prepare(string(data)); err == nil {
+			c.stmts[e.StmtID] = uint32(stmt.ID())
+		}
+	case mysql.ComStmtExecute:
+		data, ok := c.replaceStmtID(data)
+		if !ok {
+			c.report.skip()
+			return
+		}
+		_, err = c.conn.StmtExecuteForward(data)
+	case mysql.ComStmtClose:
+		data, ok := c.replaceStmtID(data)
+		if !ok {
+			c.report.skip()
+			return
+		}
+		delete(c.stmts, binary.LittleEndian.Uint32(e.Data[1:]))
+		err = c.conn.StmtClosePrepare(int(binary.LittleEndian.Uint32(data)))
+	case mysql.ComResetConnection:
+		err = c.conn.ResetConnection()
+		c.stmts = make(map[uint32]uint32)
+	default:
+		c.report.skip()
+		return
+	}
+	duration := time.Since(startTime)
+
+	var sql string
+	if cmd == mysql.ComQuery || cmd == mysql.ComStmtPrepare {
+		sql = string(data)
+	}
+	myErr, isMyErr := errors.Cause(err).(*gomysql.MyError)
+	if err != nil && !isMyErr {
+		c.report.record(cmd, e, duration, &gomysql.MyError{Code: mysql.ErrUnknown, Message: err.Error()}, sql)
+		c.broken(e, err)
+		return
+	}
+	c.report.record(cmd, e, duration, myErr, sql)
+}
+
+// replaceStmtID returns a copy of the command data with the replayed stmt id.
+func (c *replayConn) replaceStmtID(data []byte) ([]byte, bool) {
+	if len(data) < 4 {
+		return nil, false
+	}
+	id, ok := c.stmts[binary.LittleEndian.Uint32(data)]
+	if !ok {
+		return nil, false
+	}
+	replaced := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(replaced, id)
+	return replaced, true
+}
+
+// broken closes the conn on network errors, the rest commands of the conn are skipped.
+func (c *replayConn) broken(e *capture.Event, err error) {
+	logutil.BgLogger().Warn("replay conn is broken", zap.Uint32("conn", e.ConnID), zap.Error(err))
+	c.conn.Close()
+	c.conn = nil
+}
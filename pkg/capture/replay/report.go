@@ -0,0 +1,187 @@
+package replay
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/capture"
+)
+
+// only the first maxErrorDiffSamples error diffs are kept in the report.
+const maxErrorDiffSamples = 20
+
+var commandNames = map[byte]string{
+	mysql.ComQuery:           "Query",
+	mysql.ComInitDB:          "InitDB",
+	mysql.ComStmtPrepare:     "StmtPrepare",
+	mysql.ComStmtExecute:     "StmtExecute",
+	mysql.ComStmtClose:       "StmtClose",
+	mysql.ComResetConnection: "ResetConnection",
+}
+
+// ErrorDiff is a command whose replayed error code differs from the captured one.
+type ErrorDiff struct {
+	ConnID       uint32
+	Command      string
+	SQL          string
+	CapturedCode uint16
+	ReplayedCode uint16
+	ReplayedMsg  string
+}
+
+type commandStats struct {
+	captured []time.Duration
+	replayed []time.Duration
+}
+
+// Report is the result of a replay, it is safe to be updated by the replayed conns concurrently.
+type Report struct {
+	lock      sync.Mutex
+	startTime time.Time
+	duration  time.Duration
+
+	Conns          int64
+	ConnErrors     int64
+	Commands       int64
+	Skipped        int64
+	CapturedErrors int64
+	ReplayedErrors int64
+	ErrorDiffs     int64
+	DiffSamples    []ErrorDiff
+
+	stats map[string]*commandStats
+}
+
+func newReport() *Report {
+	return &Report{
+		startTime: time.Now(),
+		stats:     make(map[string]*commandStats),
+	}
+}
+
+func (r *Report) finish() {
+	r.lock.Lock()
+	r.duration = time.Since(r.startTime)
+	r.lock.Unlock()
+}
+
+func (r *Report) skip() {
+	r.lock.Lock()
+	r.Skipped++
+	r.lock.Unlock()
+}
+
+func (r *Report) connOpened() {
+	r.lock.Lock()
+	r.Conns++
+	r.lock.Unlock()
+}
+
+func (r *Report) connError() {
+	r.lock.Lock()
+	r.ConnErrors++
+	r.lock.Unlock()
+}
+
+// record records a replayed command, myErr is nil if the command succeeded.
+func (r *Report) record(cmd byte, e *capture.Event, duration time.Duration, myErr *gomysql.MyError, sql string) {
+	var replayedCode uint16
+	var replayedMsg string
+	if myErr != nil {
+		replayedCode, replayedMsg = myErr.Code, myErr.Message
+	}
+	name := commandNames[cmd]
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.Commands++
+	if e.ErrCode != 0 {
+		r.CapturedErrors++
+	}
+	if replayedCode != 0 {
+		r.ReplayedErrors++
+	}
+	if e.ErrCode != replayedCode {
+		r.ErrorDiffs++
+		if len(r.DiffSamples) < maxErrorDiffSamples {
+			r.DiffSamples = append(r.DiffSamples, ErrorDiff{
+				ConnID:       e.ConnID,
+				Command:      name,
+				SQL:          sql,
+				CapturedCode: e.ErrCode,
+				ReplayedCode: replayedCode,
+				ReplayedMsg:  replayedMsg,
+			})
+		}
+	}
+
+	stats, ok := r.stats[name]
+	if !ok {
+		stats = &commandStats{}
+		r.stats[name] = stats
+	}
+	stats.captured = append(stats.captured, e.Duration)
+	stats.replayed = append(stats.replayed, duration)
+}
+
+// Print writes the report in a human readable format.
+func (r *Report) Print(w io.Writer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	fmt.Fprintf(w, "replay duration: %s\n", r.duration)
+	fmt.Fprintf(w, "conns: %d, conn errors: %d\n", r.Conns, r.ConnErrors)
+	fmt.Fprintf(w, "commands: %d, skipped: %d\n", r.Commands, r.Skipped)
+	fmt.Fprintf(w, "captured errors: %d, replayed errors: %d, error diffs: %d\n", r.CapturedErrors, r.ReplayedErrors, r.ErrorDiffs)
+
+	names := make([]string, 0, len(r.stats))
+	for name := range r.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "\n%-16s %8s %-9s %12s %12s %12s %12s\n", "command", "count", "", "p50", "p90", "p99", "max")
+	for _, name := range names {
+		stats := r.stats[name]
+		printLatency(w, name, "captured", stats.captured)
+		printLatency(w, "", "replayed", stats.replayed)
+	}
+
+	if len(r.DiffSamples) > 0 {
+		fmt.Fprintf(w, "\nerror diffs (first %d):\n", len(r.DiffSamples))
+		for _, d := range r.DiffSamples {
+			fmt.Fprintf(w, "conn %d %s captured: %d, replayed: %d %s, sql: %s\n",
+				d.ConnID, d.Command, d.CapturedCode, d.ReplayedCode, d.ReplayedMsg, d.SQL)
+		}
+	}
+}
+
+func printLatency(w io.Writer, name, kind string, durations []time.Duration) {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	count := ""
+	if name != "" {
+		count = fmt.Sprint(len(sorted))
+	}
+	fmt.Fprintf(w, "%-16s %8s %-9s %12s %12s %12s %12s\n", name, count, kind,
+		percentile(sorted, 0.5), percentile(sorted, 0.9), percentile(sorted, 0.99), percentile(sorted, 1))
+}
+
+// percentile returns the p-th percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/capture"
+)
+
+func TestReportRecord(t *testing.T) {
+	r := newReport()
+	r.record(mysql.ComQuery, &capture.Event{ConnID: 1, Duration: time.Millisecond}, 2*time.Millisecond, nil, "select 1")
+	r.record(mysql.ComQuery, &capture.Event{ConnID: 1, ErrCode: mysql.ErrNoSuchTable}, time.Millisecond,
+		&gomysql.MyError{Code: mysql.ErrNoSuchTable}, "select * from t")
+	r.record(mysql.ComQuery, &capture.Event{ConnID: 2}, time.Millisecond,
+		&gomysql.MyError{Code: mysql.ErrDupEntry, Message: "duplicate"}, "insert into t values (1)")
+	r.skip()
+	r.finish()
+
+	require.Equal(t, int64(3), r.Commands)
+	require.Equal(t, int64(1), r.Skipped)
+	require.Equal(t, int64(1), r.CapturedErrors)
+	require.Equal(t, int64(2), r.ReplayedErrors)
+	require.Equal(t, int64(1), r.ErrorDiffs)
+	require.Equal(t, []ErrorDiff{{
+		ConnID:       2,
+		Command:      "Query",
+		SQL:          "insert into t values (1)",
+		ReplayedCode: mysql.ErrDupEntry,
+		ReplayedMsg:  "duplicate",
+	}}, r.DiffSamples)
+
+	var buf bytes.Buffer
+	r.Print(&buf)
+	require.Contains(t, buf.String(), "error diffs: 1")
+}
+
+func TestPercentile(t *testing.T) {
+	require.Equal(t, time.Duration(0), percentile(nil, 0.5))
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	require.Equal(t, time.Duration(50), percentile(sorted, 0.5))
+	require.Equal(t, time.Duration(99), percentile(sorted, 0.99))
+	require.Equal(t, time.Duration(100), percentile(sorted, 1))
+}
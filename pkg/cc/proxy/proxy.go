@@ -1,15 +1,23 @@
 package proxy
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/pingcap/tidb/util/logutil"
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/tidb-incubator/weir/pkg/util/requests"
 	"go.uber.org/zap"
+	"net/http"
 	"net/url"
 	"time"
 )
 
+type commonJsonResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
 // Stats proxy stats
 type Stats struct {
 	Host     string `json:"host"`
@@ -51,22 +59,22 @@ func GetStats(p *config.ProxyMonitorMetric, cfg *config.CCConfig, timeout time.D
 func pingCheck(host, user, password string) error {
 	URL := EncodeURL(host, "namespace/ping")
 	if _, err := requests.SendGet(URL, user, password); err != nil {
-		logutil.BgLogger().Fatal("call rpc xping to proxy failed")
+		logutil.BgLogger().Warn("call rpc xping to proxy failed", zap.String("host", host), zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-// PrepareConfig prepare phase of config change
-func PrepareConfig(host, name string, cfg *config.CCConfig) error {
+// PrepareConfig prepare phase of config change, the namespace config is carried in request body
+func PrepareConfig(host string, namespace *config.Namespace, cfg *config.CCConfig) error {
 	err := pingCheck(host, cfg.CCProxyServer.User, cfg.CCProxyServer.Password)
 	if err != nil {
 		return err
 	}
-	URL := EncodeURL(host, "namespace/reload/prepare/%s", name)
-	err = requests.SendPut(URL, cfg.CCProxyServer.User, cfg.CCProxyServer.Password)
+	URL := EncodeURL(host, "namespace/reload/prepare/%s", namespace.Namespace)
+	err = sendPut(URL, config.Encode(namespace), cfg)
 	if err != nil {
-		logutil.BgLogger().Fatal("prepare proxy config failed", zap.Error(err))
+		logutil.BgLogger().Warn("prepare proxy config failed", zap.String("name", namespace.Namespace), zap.String("host", host), zap.Error(err))
 		return err
 	}
 	return nil
@@ -79,9 +87,20 @@ func CommitConfig(host, name string, cfg *config.CCConfig) error {
 		return err
 	}
 	URL := EncodeURL(host, "namespace/reload/commit/%s", name)
-	err = requests.SendPut(URL, cfg.CCProxyServer.User, cfg.CCProxyServer.Password)
+	err = sendPut(URL, nil, cfg)
+	if err != nil {
+		logutil.BgLogger().Warn("commit proxy config failed", zap.String("name", name), zap.String("host", host), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// AbortConfig discard the prepared config
+func AbortConfig(host, name string, cfg *config.CCConfig) error {
+	URL := EncodeURL(host, "namespace/reload/abort/%s", name)
+	err := sendPut(URL, nil, cfg)
 	if err != nil {
-		logutil.BgLogger().Fatal("commit proxy config failed", zap.Error(err))
+		logutil.BgLogger().Warn("abort proxy config failed", zap.String("name", name), zap.String("host", host), zap.Error(err))
 		return err
 	}
 	return nil
@@ -94,7 +113,7 @@ func DelNamespace(host, name string, cfg *config.CCConfig) error {
 		return err
 	}
 	URL := EncodeURL(host, "namespace/remove/%s", name)
-	err = requests.SendPut(URL, cfg.CCProxyServer.User, cfg.CCProxyServer.Password)
+	err = sendPut(URL, nil, cfg)
 	if err != nil {
 		logutil.BgLogger().Warn("delete namespace in proxy failed", zap.String("name", name), zap.String("host", host), zap.Error(err))
 		return err
@@ -102,6 +121,30 @@ func DelNamespace(host, name string, cfg *config.CCConfig) error {
 	return nil
 }
 
+// sendPut send put request to proxy, and check the code in response body,
+// since proxy always responds http status 200.
+func sendPut(URL string, body []byte, cfg *config.CCConfig) error {
+	req := requests.NewRequest(URL, requests.Put, nil, nil, body)
+	req.SetBasicAuth(cfg.CCProxyServer.User, cfg.CCProxyServer.Password)
+
+	resp, err := requests.Send(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(string(resp.Body))
+	}
+
+	jsonResp := &commonJsonResp{}
+	if err := json.Unmarshal(resp.Body, jsonResp); err != nil {
+		return err
+	}
+	if jsonResp.Code != http.StatusOK {
+		return errors.New(jsonResp.Msg)
+	}
+	return nil
+}
+
 func EncodeURL(host string, format string, args ...interface{}) string {
 	var u url.URL
 	u.Scheme = "http"
@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -47,7 +48,11 @@ func (s *Server) registerURL() {
 	api.GET("/namespace/list", s.listNamespace)
 	api.GET("/namespace/detail/:name",s.detailNamespace)
 	api.PUT("/namespace/modify", s.modifyNamespace)
+	api.PUT("/namespace/validate", s.validateNamespace)
 	api.PUT("/namespace/delete/:name", s.delNamespace)
+	api.GET("/namespace/history/:name", s.listNamespaceHistory)
+	api.GET("/namespace/diff/:name", s.diffNamespace)
+	api.PUT("/namespace/rollback/:name", s.rollbackNamespace)
 }
 
 type ListNamespaceResp struct {
@@ -96,26 +101,64 @@ func (s *Server) detailNamespace(c *gin.Context) {
 	return
 }
 
+type ModifyNamespaceResp struct {
+	Header *CommonJsonResp         `json:"header"`
+	Data   []*service.ReloadResult `json:"data"`
+}
+
 func (s *Server) modifyNamespace(c *gin.Context) {
 	var namespace config.Namespace
-	err := c.BindJSON(&namespace)
+	err := c.ShouldBindJSON(&namespace)
 	errMsg := "modify namespace failed"
 	if err != nil {
 		logutil.BgLogger().Warn(errMsg, zap.Error(err))
-		c.JSON(http.StatusBadRequest, CreateFailureJsonResp(errMsg))
+		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg+": "+err.Error()))
 		return
 	}
 	cluster := c.DefaultQuery("cluster", config.DefaultClusterName)
-	err = service.ModifyNamespace(&namespace, s.cfg, cluster)
+	data, err := service.ModifyNamespace(&namespace, s.cfg, cluster, c.GetString(gin.AuthUserKey))
 	if err != nil {
 		logutil.BgLogger().Warn(errMsg, zap.Error(err))
-		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg))
+		header := CreateFailureJsonResp(errMsg + ": " + err.Error())
+		c.JSON(http.StatusOK, &ModifyNamespaceResp{Data: data, Header: &header})
 		return
 	}
-	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+	header := CreateSuccessJsonResp()
+	if len(data) == 0 {
+		header.Warning = service.NoProxyWarning(cluster)
+	}
+	c.JSON(http.StatusOK, &ModifyNamespaceResp{Data: data, Header: &header})
 	return
 }
 
+type ValidateNamespaceResp struct {
+	Header *CommonJsonResp `json:"header"`
+	Data   []string        `json:"data"`
+}
+
+func (s *Server) validateNamespace(c *gin.Context) {
+	var namespace config.Namespace
+	err := c.ShouldBindJSON(&namespace)
+	errMsg := "validate namespace failed"
+	if err != nil {
+		logutil.BgLogger().Warn(errMsg, zap.Error(err))
+		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg+": "+err.Error()))
+		return
+	}
+	cluster := c.DefaultQuery("cluster", config.DefaultClusterName)
+	data, err := service.ValidateNamespace(&namespace, s.cfg, cluster)
+	if err != nil {
+		logutil.BgLogger().Warn(errMsg, zap.Error(err))
+		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg))
+		return
+	}
+	header := CreateSuccessJsonResp()
+	if len(data) != 0 {
+		header = CreateFailureJsonResp("invalid namespace config")
+	}
+	c.JSON(http.StatusOK, &ValidateNamespaceResp{Data: data, Header: &header})
+}
+
 func (s *Server) delNamespace(c *gin.Context) {
 	name := strings.TrimSpace(c.Param("name"))
 	if name == "" {
@@ -123,19 +166,108 @@ func (s *Server) delNamespace(c *gin.Context) {
 		return
 	}
 	cluster := c.DefaultQuery("cluster", config.DefaultClusterName)
-	err := service.DelNamespace(name, s.cfg, cluster)
+	hosts, err := service.DelNamespace(name, s.cfg, cluster, c.GetString(gin.AuthUserKey))
 	if err != nil {
 		errMsg := "delete namespace failed"
 		logutil.BgLogger().Warn(errMsg, zap.Error(err))
 		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg))
 		return
 	}
-	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+	resp := CreateSuccessJsonResp()
+	if len(hosts) == 0 {
+		resp.Warning = service.NoProxyWarning(cluster)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type NamespaceHistoryResp struct {
+	Header *CommonJsonResp             `json:"header"`
+	Data   []*config.NamespaceRevision `json:"data"`
+}
+
+func (s *Server) listNamespaceHistory(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		c.JSON(http.StatusOK, CreateFailureJsonResp("input name is empty"))
+		return
+	}
+	cluster := c.DefaultQuery("cluster", config.DefaultClusterName)
+	data, err := service.ListNamespaceHistory(name, s.cfg, cluster)
+	if err != nil {
+		errMsg := "list namespace history failed"
+		logutil.BgLogger().Warn(errMsg, zap.Error(err))
+		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg))
+		return
+	}
+	header := CreateSuccessJsonResp()
+	c.JSON(http.StatusOK, &NamespaceHistoryResp{Data: data, Header: &header})
+}
+
+type DiffNamespaceResp struct {
+	Header *CommonJsonResp `json:"header"`
+	Data   string          `json:"data"`
+}
+
+func (s *Server) diffNamespace(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		c.JSON(http.StatusOK, CreateFailureJsonResp("input name is empty"))
+		return
+	}
+	from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, CreateFailureJsonResp("invalid from version"))
+		return
+	}
+	to, err := strconv.ParseInt(c.Query("to"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, CreateFailureJsonResp("invalid to version"))
+		return
+	}
+	cluster := c.DefaultQuery("cluster", config.DefaultClusterName)
+	data, err := service.DiffNamespace(name, from, to, s.cfg, cluster)
+	if err != nil {
+		errMsg := "diff namespace failed"
+		logutil.BgLogger().Warn(errMsg, zap.Error(err))
+		c.JSON(http.StatusOK, CreateFailureJsonResp(errMsg))
+		return
+	}
+	header := CreateSuccessJsonResp()
+	c.JSON(http.StatusOK, &DiffNamespaceResp{Data: data, Header: &header})
+}
+
+func (s *Server) rollbackNamespace(c *gin.Context) {
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		c.JSON(http.StatusOK, CreateFailureJsonResp("input name is empty"))
+		return
+	}
+	version, err := strconv.ParseInt(c.Query("version"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, CreateFailureJsonResp("invalid version"))
+		return
+	}
+	cluster := c.DefaultQuery("cluster", config.DefaultClusterName)
+	data, err := service.RollbackNamespace(name, version, s.cfg, cluster, c.GetString(gin.AuthUserKey))
+	if err != nil {
+		errMsg := "rollback namespace failed"
+		logutil.BgLogger().Warn(errMsg, zap.Error(err))
+		header := CreateFailureJsonResp(errMsg + ": " + err.Error())
+		c.JSON(http.StatusOK, &ModifyNamespaceResp{Data: data, Header: &header})
+		return
+	}
+	header := CreateSuccessJsonResp()
+	if len(data) == 0 {
+		header.Warning = service.NoProxyWarning(cluster)
+	}
+	c.JSON(http.StatusOK, &ModifyNamespaceResp{Data: data, Header: &header})
 }
 
 type CommonJsonResp struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
+	// Warning is set if the request succeeds but needs attention, e.g. the config is not pushed to any proxy.
+	Warning string `json:"warning,omitempty"`
 }
 
 func CreateSuccessJsonResp() CommonJsonResp {
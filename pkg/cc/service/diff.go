@@ -0,0 +1,38 @@
+package service
+
+import (
+	"strconv"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+// diffNamespace return the unified diff of two namespace configs, a nil config is treated as empty.
+func diffNamespace(from, to *config.Namespace) string {
+	var fromLines, toLines []string
+	if from != nil {
+		fromLines = difflib.SplitLines(string(config.Encode(from)))
+	}
+	if to != nil {
+		toLines = difflib.SplitLines(string(config.Encode(to)))
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        fromLines,
+		B:        toLines,
+		FromFile: revisionName(from),
+		ToFile:   revisionName(to),
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+func revisionName(ns *config.Namespace) string {
+	if ns == nil {
+		return "empty"
+	}
+	return ns.Namespace + "@" + strconv.FormatInt(ns.Revision, 10)
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func TestDiffNamespace(t *testing.T) {
+	from := &config.Namespace{Namespace: "test_ns", Revision: 1, RateLimiter: config.RateLimiterInfo{Scope: "db", QPS: 100}}
+	to := &config.Namespace{Namespace: "test_ns", Revision: 2, RateLimiter: config.RateLimiterInfo{Scope: "db", QPS: 200}}
+
+	diff := diffNamespace(from, to)
+	require.True(t, strings.HasPrefix(diff, "--- test_ns@1\n+++ test_ns@2\n"))
+	require.Contains(t, diff, `-        "qps": 100`)
+	require.Contains(t, diff, `+        "qps": 200`)
+
+	require.Equal(t, "", diffNamespace(from, from))
+	require.Contains(t, diffNamespace(nil, to), "--- empty\n")
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/cc/proxy"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"go.uber.org/zap"
+)
+
+const (
+	ReloadPhasePrepare  = "prepare"
+	ReloadPhaseCommit   = "commit"
+	ReloadPhaseAbort    = "abort"
+	ReloadPhaseRollback = "rollback"
+)
+
+var (
+	ErrInvalidNamespace = errors.New("invalid namespace config")
+	ErrReloadAborted    = errors.New("prepare namespace failed, reload is aborted")
+	ErrReloadRolledBack = errors.New("commit namespace failed, reload is rolled back")
+)
+
+// ReloadResult is the reload result of one proxy, Phase is the last phase executed on the proxy.
+type ReloadResult struct {
+	Host    string `json:"host"`
+	Phase   string `json:"phase"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (r *ReloadResult) setResult(phase string, err error) {
+	r.Phase = phase
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Error = ""
+	}
+}
+
+func createReloadResults(proxies map[string]*config.ProxyMonitorMetric) []*ReloadResult {
+	var hosts []string
+	for _, v := range proxies {
+		hosts = append(hosts, v.IP+":"+v.AdminPort)
+	}
+	sort.Strings(hosts)
+
+	results := make([]*ReloadResult, 0, len(hosts))
+	for _, host := range hosts {
+		results = append(results, &ReloadResult{Host: host})
+	}
+	return results
+}
+
+func prepareNamespace(results []*ReloadResult, namespace *config.Namespace, cfg *config.CCConfig) bool {
+	allSuccess := true
+	for _, r := range results {
+		err := proxy.PrepareConfig(r.Host, namespace, cfg)
+		r.setResult(ReloadPhasePrepare, err)
+		if err != nil {
+			allSuccess = false
+		}
+	}
+	return allSuccess
+}
+
+func commitNamespace(results []*ReloadResult, name string, cfg *config.CCConfig) bool {
+	allSuccess := true
+	for _, r := range results {
+		err := proxy.CommitConfig(r.Host, name, cfg)
+		r.setResult(ReloadPhaseCommit, err)
+		if err != nil {
+			allSuccess = false
+		}
+	}
+	return allSuccess
+}
+
+// abortNamespace discards the prepared config on all proxies.
+// The result of a proxy failed to prepare is kept, since there is nothing to abort on it in most cases.
+func abortNamespace(results []*ReloadResult, name string, cfg *config.CCConfig) {
+	for _, r := range results {
+		err := proxy.AbortConfig(r.Host, name, cfg)
+		if !r.Success {
+			continue
+		}
+		r.setResult(ReloadPhaseAbort, err)
+	}
+}
+
+// rollbackNamespace reloads the old config on the committed proxies, or removes the namespace
+// if it is newly created, and discards the prepared config on the proxies failed to commit.
+func rollbackNamespace(results []*ReloadResult, name string, oldNamespace *config.Namespace, cfg *config.CCConfig) {
+	for _, r := range results {
+		if !r.Success {
+			if err := proxy.AbortConfig(r.Host, name, cfg); err != nil {
+				logutil.BgLogger().Warn("abort namespace failed", zap.String("namespace", name), zap.String("host", r.Host), zap.Error(err))
+			}
+			continue
+		}
+
+		var err error
+		if oldNamespace == nil {
+			err = proxy.DelNamespace(r.Host, name, cfg)
+		} else if err = proxy.PrepareConfig(r.Host, oldNamespace, cfg); err == nil {
+			err = proxy.CommitConfig(r.Host, name, cfg)
+		}
+		r.setResult(ReloadPhaseRollback, err)
+	}
+}
@@ -1,17 +1,23 @@
 package service
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/util/logutil"
 	"github.com/tidb-incubator/weir/pkg/cc/proxy"
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/tidb-incubator/weir/pkg/configcenter"
+	"github.com/tidb-incubator/weir/pkg/validation"
 	"go.uber.org/zap"
 )
 
 func ListNamespace(cfg *config.CCConfig, cluster string) ([]string, error) {
-	center, err := configcenter.CreateEtcdConfigCenter(cfg.CCEtcdConfig)
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
 	if err != nil {
-		logutil.BgLogger().Warn("create etcd config center failed", zap.Error(err))
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
 		return nil, err
 	}
 	defer center.Close()
@@ -20,9 +26,9 @@ func ListNamespace(cfg *config.CCConfig, cluster string) ([]string, error) {
 }
 
 func QueryNamespace(names []string, cfg *config.CCConfig, cluster string) (data []*config.Namespace, err error) {
-	center, err := configcenter.CreateEtcdConfigCenter(cfg.CCEtcdConfig)
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
 	if err != nil {
-		logutil.BgLogger().Warn("create etcd config center failed", zap.Error(err))
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
 		return nil, err
 	}
 	defer center.Close()
@@ -42,63 +48,248 @@ func QueryNamespace(names []string, cfg *config.CCConfig, cluster string) (data
 	return data, nil
 }
 
-func ModifyNamespace(namespace *config.Namespace, cfg *config.CCConfig, cluster string) (err error) {
-	center, err := configcenter.CreateEtcdConfigCenter(cfg.CCEtcdConfig)
+// ModifyNamespace reload namespace on all proxies in two phases, and write the namespace config
+// to etcd only after all proxies have committed. If any proxy fails to prepare, the prepared
+// config is aborted on all proxies. If any proxy fails to commit, the committed proxies are
+// rolled back to the config in etcd. Every change is saved as a new revision, and if the revision
+// is taken by a concurrent modification, the proxies are rolled back to the config in etcd as well.
+func ModifyNamespace(namespace *config.Namespace, cfg *config.CCConfig, cluster string, author string) ([]*ReloadResult, error) {
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
 	if err != nil {
-		logutil.BgLogger().Warn("create etcd config center failed", zap.Error(err))
-		return err
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
+		return nil, err
 	}
 	defer center.Close()
 
-	bytes := config.Encode(namespace)
-	err = center.SetNamespace(namespace.Namespace, string(bytes), cluster)
+	errs, err := validateNamespaceInCluster(center, namespace, cluster, cfg.CCProxyServer.GetBoundNamespaces())
 	if err != nil {
-		logutil.BgLogger().Warn("update namespace failed", zap.Error(err))
-		return err
+		return nil, err
+	}
+	if len(errs) != 0 {
+		return nil, errors.WithMessage(ErrInvalidNamespace, strings.Join(errorMessages(errs), "; "))
+	}
+
+	oldNamespace, err := getNamespaceIfExists(center, namespace.Namespace, cluster)
+	if err != nil {
+		return nil, err
+	}
+	latestVersion, err := center.GetNamespaceLatestVersion(namespace.Namespace, cluster)
+	if err != nil {
+		logutil.BgLogger().Warn("get namespace latest version failed", zap.String("namespace", namespace.Namespace), zap.Error(err))
+		return nil, err
 	}
+	namespace.Revision = latestVersion + 1
+
 	proxies, err := center.ListProxyMonitorMetrics(cluster)
 	if err != nil {
 		logutil.BgLogger().Warn("list proxies failed", zap.Error(err))
-		return err
+		return nil, err
 	}
-	for _, v := range proxies {
-		err := proxy.PrepareConfig(v.IP+":"+v.AdminPort, namespace.Namespace, cfg)
-		if err != nil {
-			return err
+
+	if len(proxies) == 0 {
+		logutil.BgLogger().Warn("no proxy is registered, the namespace is not pushed to any proxy", zap.String("namespace", namespace.Namespace), zap.String("cluster", cluster))
+	}
+	results := createReloadResults(proxies)
+	if !prepareNamespace(results, namespace, cfg) {
+		abortNamespace(results, namespace.Namespace, cfg)
+		return results, ErrReloadAborted
+	}
+	if !commitNamespace(results, namespace.Namespace, cfg) {
+		rollbackNamespace(results, namespace.Namespace, oldNamespace, cfg)
+		return results, ErrReloadRolledBack
+	}
+
+	revision := &config.NamespaceRevision{
+		Version:   namespace.Revision,
+		Author:    author,
+		Timestamp: time.Now().Unix(),
+		Diff:      diffNamespace(oldNamespace, namespace),
+		Namespace: namespace,
+	}
+	bytes := config.Encode(namespace)
+	err = center.SetNamespaceWithRevision(namespace.Namespace, string(bytes), cluster, revision)
+	if err != nil {
+		logutil.BgLogger().Warn("update namespace failed", zap.Error(err))
+		// the proxies have committed the config not in etcd, roll them back to the one in etcd,
+		// which is written by the concurrent modification if the revision conflicts
+		current, getErr := getNamespaceIfExists(center, namespace.Namespace, cluster)
+		if getErr != nil {
+			current = oldNamespace
 		}
+		rollbackNamespace(results, namespace.Namespace, current, cfg)
+		return results, err
 	}
-	for _, v := range proxies {
-		err := proxy.CommitConfig(v.IP+":"+v.AdminPort, namespace.Namespace, cfg)
-		if err != nil {
-			return err
+	return results, nil
+}
+
+// getNamespaceIfExists returns nil if the namespace does not exist.
+func getNamespaceIfExists(center configcenter.WritableConfigCenter, name string, cluster string) (*config.Namespace, error) {
+	namespace, err := center.GetNamespace(name, cluster)
+	if err != nil {
+		if errors.Cause(err) != configcenter.ErrNamespaceNotFound {
+			logutil.BgLogger().Warn("load namespace failed", zap.String("namespace", name), zap.Error(err))
+			return nil, err
 		}
+		return nil, nil
 	}
-	return nil
+	return namespace, nil
 }
 
-// DelNamespace delete namespace
-func DelNamespace(name string, cfg *config.CCConfig, cluster string) error {
-	center, err := configcenter.CreateEtcdConfigCenter(cfg.CCEtcdConfig)
+// ValidateNamespace checks the namespace config together with other namespaces in the cluster,
+// in which the namespace with the same name is replaced, without modifying etcd or proxies.
+// It returns the error messages found.
+func ValidateNamespace(namespace *config.Namespace, cfg *config.CCConfig, cluster string) ([]string, error) {
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
 	if err != nil {
-		logutil.BgLogger().Warn("create etcd config center failed", zap.Error(err))
-		return err
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
+		return nil, err
+	}
+	defer center.Close()
+
+	errs, err := validateNamespaceInCluster(center, namespace, cluster, cfg.CCProxyServer.GetBoundNamespaces())
+	if err != nil {
+		return nil, err
+	}
+	return errorMessages(errs), nil
+}
+
+func errorMessages(errs []error) []string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return msgs
+}
+
+func validateNamespaceInCluster(center configcenter.WritableConfigCenter, namespace *config.Namespace, cluster string,
+	boundNamespaces map[string]struct{}) ([]error, error) {
+	namespaces, err := center.ListAllNamespace(cluster)
+	if err != nil {
+		logutil.BgLogger().Warn("list namespaces failed", zap.Error(err))
+		return nil, err
+	}
+
+	cfgs := []*config.Namespace{namespace}
+	for _, ns := range namespaces {
+		if ns.Namespace != namespace.Namespace {
+			cfgs = append(cfgs, ns)
+		}
+	}
+	return validation.ValidateNamespaces(cfgs, boundNamespaces), nil
+}
+
+// ListNamespaceHistory list all revisions of namespace
+func ListNamespaceHistory(name string, cfg *config.CCConfig, cluster string) ([]*config.NamespaceRevision, error) {
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
+	if err != nil {
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
+		return nil, err
+	}
+	defer center.Close()
+
+	return center.ListNamespaceRevisions(name, cluster)
+}
+
+// DiffNamespace diff two revisions of namespace
+func DiffNamespace(name string, fromVersion, toVersion int64, cfg *config.CCConfig, cluster string) (string, error) {
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
+	if err != nil {
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
+		return "", err
 	}
 	defer center.Close()
 
-	if err := center.DelNamespace(name, cluster); err != nil {
+	from, err := center.GetNamespaceRevision(name, cluster, fromVersion)
+	if err != nil {
+		logutil.BgLogger().Warn("get namespace revision failed", zap.String("namespace", name), zap.Int64("version", fromVersion), zap.Error(err))
+		return "", err
+	}
+	to, err := center.GetNamespaceRevision(name, cluster, toVersion)
+	if err != nil {
+		logutil.BgLogger().Warn("get namespace revision failed", zap.String("namespace", name), zap.Int64("version", toVersion), zap.Error(err))
+		return "", err
+	}
+	return diffNamespace(from.Namespace, to.Namespace), nil
+}
+
+// RollbackNamespace push the config of the given revision to all proxies as a new revision
+func RollbackNamespace(name string, version int64, cfg *config.CCConfig, cluster string, author string) ([]*ReloadResult, error) {
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
+	if err != nil {
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
+		return nil, err
+	}
+	rev, err := center.GetNamespaceRevision(name, cluster, version)
+	center.Close()
+	if err != nil {
+		logutil.BgLogger().Warn("get namespace revision failed", zap.String("namespace", name), zap.Int64("version", version), zap.Error(err))
+		return nil, err
+	}
+	if rev.Namespace == nil {
+		return nil, errors.Errorf("namespace config of revision %d is empty", version)
+	}
+
+	return ModifyNamespace(rev.Namespace, cfg, cluster, author)
+}
+
+// DelNamespace delete namespace, it returns the proxies which the namespace is removed from.
+// The deletion is saved as a tombstone revision with an empty namespace config.
+func DelNamespace(name string, cfg *config.CCConfig, cluster string, author string) ([]string, error) {
+	center, err := configcenter.CreateWritableConfigCenter(cfg.GetConfigCenter())
+	if err != nil {
+		logutil.BgLogger().Warn("create config center failed", zap.Error(err))
+		return nil, err
+	}
+	defer center.Close()
+
+	oldNamespace, err := getNamespaceIfExists(center, name, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if oldNamespace == nil {
+		// nothing to record, but the namespace may still be left on the proxies
+		err = center.DelNamespace(name, cluster)
+	} else {
+		err = delNamespaceWithRevision(center, oldNamespace, cluster, author)
+	}
+	if err != nil {
 		logutil.BgLogger().Warn("delete namespace failed", zap.String("name", name), zap.Error(err))
-		return err
+		return nil, err
 	}
 	proxies, err := center.ListProxyMonitorMetrics(cluster)
 	if err != nil {
 		logutil.BgLogger().Warn("list proxies failed", zap.Error(err))
-		return err
+		return nil, err
 	}
+	var hosts []string
 	for _, v := range proxies {
-		err := proxy.DelNamespace(v.IP+":"+v.AdminPort, name, cfg)
+		host := v.IP + ":" + v.AdminPort
+		err := proxy.DelNamespace(host, name, cfg)
 		if err != nil {
-			return err
+			return hosts, err
 		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+func delNamespaceWithRevision(center configcenter.WritableConfigCenter, oldNamespace *config.Namespace, cluster string, author string) error {
+	latestVersion, err := center.GetNamespaceLatestVersion(oldNamespace.Namespace, cluster)
+	if err != nil {
+		return err
 	}
-	return nil
+	revision := &config.NamespaceRevision{
+		Version:   latestVersion + 1,
+		Author:    author,
+		Timestamp: time.Now().Unix(),
+		Diff:      diffNamespace(oldNamespace, nil),
+	}
+	return center.DelNamespaceWithRevision(oldNamespace.Namespace, cluster, revision)
+}
+
+// NoProxyWarning is returned to the client of cc if no proxy is registered in the cluster,
+// in which case the config is saved but not pushed to any proxy.
+func NoProxyWarning(cluster string) string {
+	return fmt.Sprintf("no proxy is registered in cluster %s, the config takes effect when the proxies start, "+
+		"enable registry in the proxy config so that the changes are pushed to it", cluster)
 }
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/configcenter"
+	"github.com/tidb-incubator/weir/pkg/util/etcdtest"
+	"github.com/tidb-incubator/weir/pkg/validation"
+)
+
+// startFakeProxy starts a proxy admin server which accepts all the reloads, and registers it to etcd.
+func startFakeProxy(t *testing.T, center *configcenter.EtcdConfigCenter, cluster string) func() {
+	return startFakeProxyWithHandler(t, center, cluster, func(r *http.Request) {})
+}
+
+// startFakeProxyWithHandler is the same as startFakeProxy, but the requests are passed to onRequest before responding.
+func startFakeProxyWithHandler(t *testing.T, center *configcenter.EtcdConfigCenter, cluster string, onRequest func(r *http.Request)) func() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		onRequest(r)
+		w.Write([]byte(`{"code":200,"msg":"success"}`))
+	}))
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(u.Host)
+	require.NoError(t, err)
+	p := &config.ProxyMonitorMetric{Token: u.Host, IP: host, AdminPort: port}
+	require.NoError(t, center.RegisterProxy(cluster, p))
+	return func() {
+		center.DeregisterProxy(cluster, p)
+		server.Close()
+	}
+}
+
+func TestNamespaceHistoryDiffAndRollback(t *testing.T) {
+	const cluster = "test_cluster"
+	_, client, closeFn := etcdtest.StartEmbedEtcd(t)
+	defer closeFn()
+	closeProxy := startFakeProxy(t, configcenter.NewEtcdConfigCenter(client, "/weir", false), cluster)
+	defer closeProxy()
+
+	cfg := &config.CCConfig{CCConfigCenter: config.ConfigCenter{
+		Type:       configcenter.ConfigCenterTypeEtcd,
+		ConfigEtcd: config.ConfigEtcd{Addrs: client.Endpoints(), BasePath: "/weir"},
+	}}
+	newNamespace := func(qps int) *config.Namespace {
+		return &config.Namespace{
+			Namespace:   "test_ns",
+			Frontend:    config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+			Backend:     config.BackendNamespace{SelectorType: "random"},
+			RateLimiter: config.RateLimiterInfo{Scope: "db", QPS: qps},
+		}
+	}
+
+	for _, qps := range []int{100, 200} {
+		results, err := ModifyNamespace(newNamespace(qps), cfg, cluster, "alice")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		require.True(t, results[0].Success)
+	}
+
+	diff, err := DiffNamespace("test_ns", 1, 2, cfg, cluster)
+	require.NoError(t, err)
+	require.Contains(t, diff, "--- test_ns@1\n+++ test_ns@2\n")
+	require.Contains(t, diff, `+        "qps": 200`)
+	_, err = DiffNamespace("test_ns", 1, 3, cfg, cluster)
+	require.Equal(t, configcenter.ErrKeyNotFound, err)
+
+	// rollback pushes the config of version 1 as a new revision rather than removing the later ones
+	_, err = RollbackNamespace("test_ns", 1, cfg, cluster, "bob")
+	require.NoError(t, err)
+	revs, err := ListNamespaceHistory("test_ns", cfg, cluster)
+	require.NoError(t, err)
+	require.Len(t, revs, 3)
+	for i, author := range []string{"alice", "alice", "bob"} {
+		require.Equal(t, int64(i+1), revs[i].Version)
+		require.Equal(t, author, revs[i].Author)
+	}
+	require.Equal(t, 100, revs[2].Namespace.RateLimiter.QPS)
+	require.Contains(t, revs[2].Diff, "--- test_ns@2\n+++ test_ns@3\n")
+	require.Contains(t, revs[2].Diff, `+        "qps": 100`)
+
+	current, err := QueryNamespace([]string{"test_ns"}, cfg, cluster)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), current[0].Revision)
+	require.Equal(t, 100, current[0].RateLimiter.QPS)
+
+	_, err = RollbackNamespace("test_ns", 4, cfg, cluster, "bob")
+	require.Equal(t, configcenter.ErrKeyNotFound, err)
+}
+
+func TestModifyNamespaceWithoutProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir_file_config_center")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfg := &config.CCConfig{CCConfigCenter: config.ConfigCenter{
+		Type:       configcenter.ConfigCenterTypeFile,
+		ConfigFile: config.ConfigFile{Path: dir},
+	}}
+
+	// all the errors are reported
+	invalid := &config.Namespace{
+		Namespace: "test_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}, {Username: "hello"}}},
+		Backend:   config.BackendNamespace{SelectorType: "unknown"},
+	}
+	_, err = ModifyNamespace(invalid, cfg, "test_cluster", "alice")
+	require.Equal(t, ErrInvalidNamespace, errors.Cause(err))
+	require.Contains(t, err.Error(), validation.ErrInvalidSelectorType.Error())
+	require.Contains(t, err.Error(), validation.ErrDuplicatedUser.Error())
+
+	// the config is saved for the proxies to start with, and the empty results tell that nothing is pushed
+	ns := &config.Namespace{
+		Namespace: "test_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+		Backend:   config.BackendNamespace{SelectorType: "random"},
+	}
+	results, err := ModifyNamespace(ns, cfg, "test_cluster", "alice")
+	require.NoError(t, err)
+	require.Len(t, results, 0)
+	current, err := QueryNamespace([]string{"test_ns"}, cfg, "test_cluster")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), current[0].Revision)
+
+	hosts, err := DelNamespace("test_ns", cfg, "test_cluster", "bob")
+	require.NoError(t, err)
+	require.Len(t, hosts, 0)
+
+	// the deletion is recorded as a tombstone revision, which can not be rolled back to
+	revs, err := ListNamespaceHistory("test_ns", cfg, "test_cluster")
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	require.Equal(t, int64(2), revs[1].Version)
+	require.Equal(t, "bob", revs[1].Author)
+	require.Nil(t, revs[1].Namespace)
+	require.Contains(t, revs[1].Diff, "--- test_ns@1\n+++ empty\n")
+	_, err = RollbackNamespace("test_ns", 2, cfg, "test_cluster", "bob")
+	require.Error(t, err)
+	_, err = QueryNamespace([]string{"test_ns"}, cfg, "test_cluster")
+	require.Equal(t, configcenter.ErrNamespaceNotFound, err)
+}
+
+func TestModifyNamespaceConflict(t *testing.T) {
+	const cluster = "test_cluster"
+	_, client, closeFn := etcdtest.StartEmbedEtcd(t)
+	defer closeFn()
+	center := configcenter.NewEtcdConfigCenter(client, "/weir", false)
+	newNamespace := func(qps int) *config.Namespace {
+		return &config.Namespace{
+			Namespace:   "test_ns",
+			Frontend:    config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+			Backend:     config.BackendNamespace{SelectorType: "random"},
+			RateLimiter: config.RateLimiterInfo{Scope: "db", QPS: qps},
+		}
+	}
+
+	// another modification takes the revision after the proxy prepares the config and before it commits
+	var prepared []*config.Namespace
+	closeProxy := startFakeProxyWithHandler(t, center, cluster, func(r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "prepare"):
+			ns := &config.Namespace{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(ns))
+			prepared = append(prepared, ns)
+		case strings.Contains(r.URL.Path, "commit") && len(prepared) == 1:
+			concurrent := newNamespace(200)
+			concurrent.Revision = 1
+			require.NoError(t, center.SetNamespaceWithRevision("test_ns", string(config.Encode(concurrent)), cluster,
+				&config.NamespaceRevision{Version: 1, Namespace: concurrent}))
+		}
+	})
+	defer closeProxy()
+
+	cfg := &config.CCConfig{CCConfigCenter: config.ConfigCenter{
+		Type:       configcenter.ConfigCenterTypeEtcd,
+		ConfigEtcd: config.ConfigEtcd{Addrs: client.Endpoints(), BasePath: "/weir"},
+	}}
+	results, err := ModifyNamespace(newNamespace(100), cfg, cluster, "alice")
+	require.Equal(t, configcenter.ErrRevisionConflict, err)
+	require.Len(t, results, 1)
+	require.Equal(t, ReloadPhaseRollback, results[0].Phase)
+	require.True(t, results[0].Success)
+
+	// the proxy is rolled back to the config in etcd rather than the old one
+	require.Len(t, prepared, 2)
+	require.Equal(t, 200, prepared[1].RateLimiter.QPS)
+	current, err := QueryNamespace([]string{"test_ns"}, cfg, cluster)
+	require.NoError(t, err)
+	require.Equal(t, 200, current[0].RateLimiter.QPS)
+}
@@ -9,12 +9,33 @@ import (
 type CCConfig struct {
 	CCProxyServer  CCProxyServer `yaml:"proxy_server"`
 	CCAdminServer  CCAdminServer `yaml:"admin_server"`
-	CCEtcdConfig   ConfigEtcd  `yaml:"config_etcd"`
+	CCEtcdConfig   ConfigEtcd    `yaml:"config_etcd"`
+	CCConfigCenter ConfigCenter  `yaml:"config_center"`
+}
+
+// GetConfigCenter return config_center, or etcd config center with config_etcd if type is not set,
+// which is compatible with the old cc config.
+func (c *CCConfig) GetConfigCenter() ConfigCenter {
+	if c.CCConfigCenter.Type != "" {
+		return c.CCConfigCenter
+	}
+	return ConfigCenter{
+		Type:       "etcd",
+		ConfigEtcd: c.CCEtcdConfig,
+	}
 }
 
 type CCProxyServer struct {
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
+	// BoundNamespaces are the namespaces bound to the listeners of proxies,
+	// a user owned by several namespaces is only allowed in them.
+	BoundNamespaces []string `yaml:"bound_namespaces"`
+}
+
+// GetBoundNamespaces returns the set of BoundNamespaces.
+func (c *CCProxyServer) GetBoundNamespaces() map[string]struct{} {
+	return namespaceSet(c.BoundNamespaces)
 }
 
 type CCAdminServer struct {
@@ -37,6 +58,15 @@ type ProxyMonitorMetric struct {
 	Sys string `json:"sys"`
 }
 
+// NamespaceRevision a versioned revision of namespace config
+type NamespaceRevision struct {
+	Version   int64      `json:"version"`
+	Author    string     `json:"author"`
+	Timestamp int64      `json:"timestamp"`
+	Diff      string     `json:"diff"`
+	Namespace *Namespace `json:"namespace"`
+}
+
 func Encode(v interface{}) []byte {
 	b, err := json.MarshalIndent(v, "", "    ")
 	if err != nil {
@@ -1,12 +1,15 @@
 package config
 
 type Namespace struct {
-	Version     string            `yaml:"version" json:"version"`
-	Namespace   string            `yaml:"namespace" json:"namespace"`
-	Frontend    FrontendNamespace `yaml:"frontend" json:"frontend"`
-	Backend     BackendNamespace  `yaml:"backend" json:"backend"`
-	Breaker     BreakerInfo       `yaml:"breaker" json:"breaker"`
-	RateLimiter RateLimiterInfo   `yaml:"rate_limiter" json:"rate_limiter"`
+	Version            string                 `yaml:"version" json:"version"`
+	Revision           int64                  `yaml:"revision" json:"revision"`
+	Namespace          string                 `yaml:"namespace" json:"namespace"`
+	Frontend           FrontendNamespace      `yaml:"frontend" json:"frontend"`
+	Backend            BackendNamespace       `yaml:"backend" json:"backend"`
+	Breaker            BreakerInfo            `yaml:"breaker" json:"breaker"`
+	RateLimiter        RateLimiterInfo        `yaml:"rate_limiter" json:"rate_limiter"`
+	ConcurrencyLimiter ConcurrencyLimiterInfo `yaml:"concurrency_limiter" json:"concurrency_limiter"`
+	Shadow             ShadowInfo             `yaml:"shadow" json:"shadow"`
 }
 
 type FrontendNamespace struct {
@@ -17,11 +20,22 @@ type FrontendNamespace struct {
 	Users        []FrontendUserInfo `yaml:"users" json:"users"`
 	SQLBlackList []SQLInfo          `yaml:"sql_blacklist" json:"sql_blacklist"`
 	SQLWhiteList []SQLInfo          `yaml:"sql_whitelist" json:"sql_whitelist"`
+	// LOAD DATA LOCAL INFILE is denied unless AllowLocalInfile is set,
+	// LocalInfileMaxSize is the max bytes of a file, 0 means no limit.
+	AllowLocalInfile   bool  `yaml:"allow_local_infile" json:"allow_local_infile"`
+	LocalInfileMaxSize int64 `yaml:"local_infile_max_size" json:"local_infile_max_size"`
+	// MaxConnections limits the client conns of the namespace, 0 means unlimited. The users can be limited too.
+	// The conns over the limits wait in a queue of ConnectionQueueSize for ConnectionQueueTimeoutMs before rejected.
+	MaxConnections           int   `yaml:"max_connections" json:"max_connections"`
+	ConnectionQueueSize      int   `yaml:"connection_queue_size" json:"connection_queue_size"`
+	ConnectionQueueTimeoutMs int64 `yaml:"connection_queue_timeout_ms" json:"connection_queue_timeout_ms"`
 }
 
 type FrontendUserInfo struct {
 	Username string `yaml:"username" json:"username"`
 	Password string `yaml:"password" json:"password"`
+	// MaxConnections limits the client conns of the user in the namespace, 0 means unlimited.
+	MaxConnections int `yaml:"max_connections" json:"max_connections"`
 }
 
 type SQLInfo struct {
@@ -33,13 +47,69 @@ type RateLimiterInfo struct {
 	QPS   int    `yaml:"qps" json:"qps"`
 }
 
+type ConcurrencyLimiterInfo struct {
+	Scope              string `yaml:"scope" json:"scope"`
+	MaxConcurrency     int    `yaml:"max_concurrency" json:"max_concurrency"`
+	MaxQueueSize       int    `yaml:"max_queue_size" json:"max_queue_size"`
+	QueueTimeoutMs     int64  `yaml:"queue_timeout_ms" json:"queue_timeout_ms"`
+	Adaptive           bool   `yaml:"adaptive" json:"adaptive"`
+	MinConcurrency     int    `yaml:"min_concurrency" json:"min_concurrency"`
+	LatencyThresholdMs int64  `yaml:"latency_threshold_ms" json:"latency_threshold_ms"`
+}
+
 type BackendNamespace struct {
-	Username     string   `yaml:"username" json:"username"`
-	Password     string   `yaml:"password" json:"password"`
-	Instances    []string `yaml:"instances" json:"instances"`
-	SelectorType string   `yaml:"selector_type" json:"selector_type"`
-	PoolSize     int      `yaml:"pool_size" json:"pool_size"`
-	IdleTimeout  int      `yaml:"idle_timeout" json:"idle_timeout"`
+	Username         string        `yaml:"username" json:"username"`
+	Password         string        `yaml:"password" json:"password"`
+	Instances        []string      `yaml:"instances" json:"instances"`
+	SelectorType     string        `yaml:"selector_type" json:"selector_type"`
+	PoolSize         int           `yaml:"pool_size" json:"pool_size"`
+	IdleTimeout      int           `yaml:"idle_timeout" json:"idle_timeout"`
+	ConnectTimeoutMs int           `yaml:"connect_timeout_ms" json:"connect_timeout_ms"`
+	MinIdle          int           `yaml:"min_idle" json:"min_idle"`
+	MaxLifetime      int           `yaml:"max_lifetime" json:"max_lifetime"`
+	MaxWaitMs        int           `yaml:"max_wait_ms" json:"max_wait_ms"`
+	Discovery        DiscoveryInfo `yaml:"discovery" json:"discovery"`
+	// EnableCompression uses the compressed protocol between proxy and backend.
+	EnableCompression bool `yaml:"enable_compression" json:"enable_compression"`
+	// CompressionAlgorithm is zlib or zstd, zlib is used if it is empty or the backend does not support zstd.
+	CompressionAlgorithm string `yaml:"compression_algorithm" json:"compression_algorithm"`
+	// Groups splits the traffic between several backend clusters by weight, e.g. to migrate to a new cluster
+	// gradually. The instances and discovery are configured in each group, the rest is shared by the groups.
+	Groups []BackendGroup `yaml:"groups" json:"groups"`
+}
+
+// BackendGroup is a backend cluster of the namespace, the transactions are routed to the groups by weight.
+type BackendGroup struct {
+	Name      string        `yaml:"name" json:"name"`
+	Weight    int           `yaml:"weight" json:"weight"`
+	Instances []string      `yaml:"instances" json:"instances"`
+	Discovery DiscoveryInfo `yaml:"discovery" json:"discovery"`
+}
+
+// ShadowInfo mirrors a sampled share of the statements to a shadow backend cluster, e.g. a cluster
+// of a new TiDB version, after the primary backend responds. The results are not returned to clients.
+type ShadowInfo struct {
+	Enable bool `yaml:"enable" json:"enable"`
+	// SampleRate is the ratio of statements to mirror, in (0, 1].
+	SampleRate float64 `yaml:"sample_rate" json:"sample_rate"`
+	// Only the reads are mirrored unless AllowWrite is set.
+	AllowWrite bool `yaml:"allow_write" json:"allow_write"`
+	// CompareResult compares the row count and checksum of the resultset, or the affected rows.
+	CompareResult bool `yaml:"compare_result" json:"compare_result"`
+	// QueueSize is the max statements waiting to be mirrored, the statements are dropped if the queue is full.
+	QueueSize int              `yaml:"queue_size" json:"queue_size"`
+	TimeoutMs int64            `yaml:"timeout_ms" json:"timeout_ms"`
+	Backend   BackendNamespace `yaml:"backend" json:"backend"`
+}
+
+type DiscoveryInfo struct {
+	// Type is one of static (default, use instances), pd (tidb topology in PD etcd),
+	// dns (A/AAAA records of name with port) and srv (SRV records of name).
+	Type              string   `yaml:"type" json:"type"`
+	Addrs             []string `yaml:"addrs" json:"addrs"`
+	Name              string   `yaml:"name" json:"name"`
+	Port              int      `yaml:"port" json:"port"`
+	RefreshIntervalMs int      `yaml:"refresh_interval_ms" json:"refresh_interval_ms"`
 }
 
 type StrategyInfo struct {
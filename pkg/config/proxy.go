@@ -20,9 +20,73 @@ type Proxy struct {
 }
 
 type ProxyServer struct {
+	// Addr is the tcp address to listen on if Listeners is empty.
 	Addr           string `yaml:"addr"`
 	MaxConnections uint32 `yaml:"max_connections"`
 	SessionTimeout int    `yaml:"session_timeout"`
+	// NamespaceCloseTimeout is the max seconds to wait for the in-flight sessions when closing an old namespace.
+	NamespaceCloseTimeout int `yaml:"namespace_close_timeout"`
+	// GracefulShutdownTimeout is the max seconds to wait for the sessions in transaction on shutdown or upgrade.
+	GracefulShutdownTimeout int `yaml:"graceful_shutdown_timeout"`
+	// MaxResultBufferSize is the max bytes of result rows buffered by a session while the client is reading them slowly.
+	MaxResultBufferSize int `yaml:"max_result_buffer_size"`
+	// EnableCompression allows clients to use the compressed protocol (zlib) between client and proxy.
+	EnableCompression bool `yaml:"enable_compression"`
+	// ProxyProtocol reads the client address from the PROXY protocol header sent by a load balancer.
+	ProxyProtocol ProxyProtocol `yaml:"proxy_protocol"`
+	// Listeners replaces Addr to listen on several tcp addresses or unix sockets.
+	Listeners []Listener `yaml:"listeners"`
+	// Capture records the traffic of a namespace into a file, it is started by the admin api.
+	Capture Capture `yaml:"capture"`
+}
+
+type Capture struct {
+	// Dir is the directory of the capture files, default "capture".
+	Dir string `yaml:"dir"`
+	// MaxBytes stops a capture when its file reaches the size, default 1GiB.
+	MaxBytes int64 `yaml:"max_bytes"`
+}
+
+// GetBoundNamespaces returns the namespaces bound to the listeners.
+func (p *ProxyServer) GetBoundNamespaces() map[string]struct{} {
+	namespaces := make([]string, 0, len(p.Listeners))
+	for _, l := range p.Listeners {
+		if l.Namespace != "" {
+			namespaces = append(namespaces, l.Namespace)
+		}
+	}
+	return namespaceSet(namespaces)
+}
+
+func namespaceSet(namespaces []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(namespaces))
+	for _, ns := range namespaces {
+		set[ns] = struct{}{}
+	}
+	return set
+}
+
+type Listener struct {
+	// Network is tcp (default) or unix.
+	Network string `yaml:"network"`
+	Addr    string `yaml:"addr"`
+	// Namespace binds the listener to a namespace, the users are only looked up in it,
+	// so a username owned by several namespaces can only connect to the bound listeners.
+	Namespace string `yaml:"namespace"`
+	// MaxConnections limits the connections of the listener, 0 means unlimited.
+	MaxConnections uint32      `yaml:"max_connections"`
+	TLS            ListenerTLS `yaml:"tls"`
+}
+
+type ListenerTLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+type ProxyProtocol struct {
+	Enable bool `yaml:"enable"`
+	// TrustedCIDRs are the addresses of the load balancers, only they can send the header and they must send it.
+	TrustedCIDRs []string `yaml:"trusted_cidrs"`
 }
 
 type AdminServer struct {
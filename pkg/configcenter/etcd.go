@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -17,6 +18,13 @@ import (
 
 const (
 	DefaultEtcdDialTimeout = 3 * time.Second
+	// proxyRegistryTTL is the seconds a proxy stays registered after it stops keeping alive.
+	proxyRegistryTTL = 10
+)
+
+var (
+	ErrKeyNotFound      = errors.New("key not found")
+	ErrRevisionConflict = errors.New("namespace revision conflict")
 )
 
 type EtcdConfigCenter struct {
@@ -24,6 +32,9 @@ type EtcdConfigCenter struct {
 	kv          clientv3.KV
 	basePath    string
 	strictParse bool
+
+	leaseLock sync.Mutex
+	leases    map[string]clientv3.LeaseID // key: proxy registry key
 }
 
 func CreateEtcdConfigCenter(cfg config.ConfigEtcd) (*EtcdConfigCenter, error) {
@@ -48,6 +59,7 @@ func NewEtcdConfigCenter(etcdClient *clientv3.Client, basePath string, strictPar
 		kv:          clientv3.NewKV(etcdClient),
 		basePath:    basePath,
 		strictParse: strictParse,
+		leases:      make(map[string]clientv3.LeaseID),
 	}
 }
 
@@ -57,7 +69,7 @@ func (e *EtcdConfigCenter) get(ctx context.Context, key string, cluster string)
 		return nil, err
 	}
 	if len(resp.Kvs) == 0 {
-		return nil, fmt.Errorf("key not found")
+		return nil, ErrKeyNotFound
 	}
 	return resp.Kvs[0], nil
 }
@@ -75,6 +87,9 @@ func (e *EtcdConfigCenter) GetNamespace(ns string, cluster string) (*config.Name
 	ctx := context.Background()
 	etcdKeyValue, err := e.get(ctx, ns, cluster)
 	if err != nil {
+		if err == ErrKeyNotFound {
+			return nil, ErrNamespaceNotFound
+		}
 		return nil, err
 	}
 	n := &config.Namespace{}
@@ -138,18 +153,161 @@ func (e *EtcdConfigCenter) ListProxyMonitorMetrics(cluster string) (map[string]*
 	return proxy, nil
 }
 
+// RegisterProxy puts the proxy with a lease kept alive, so that a crashed proxy is removed after the ttl.
+func (e *EtcdConfigCenter) RegisterProxy(cluster string, p *config.ProxyMonitorMetric) error {
+	ctx := context.Background()
+	lease, err := e.etcdClient.Grant(ctx, proxyRegistryTTL)
+	if err != nil {
+		return err
+	}
+	key := path.Join(e.basePath, "proxy", cluster, proxyRegistryKey(p))
+	if _, err := e.kv.Put(ctx, key, string(config.Encode(p)), clientv3.WithLease(lease.ID)); err != nil {
+		return err
+	}
+	ch, err := e.etcdClient.KeepAlive(context.Background(), lease.ID)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for range ch {
+		}
+	}()
+
+	e.leaseLock.Lock()
+	e.leases[key] = lease.ID
+	e.leaseLock.Unlock()
+	return nil
+}
+
+func (e *EtcdConfigCenter) DeregisterProxy(cluster string, p *config.ProxyMonitorMetric) error {
+	ctx := context.Background()
+	key := path.Join(e.basePath, "proxy", cluster, proxyRegistryKey(p))
+	e.leaseLock.Lock()
+	lease, ok := e.leases[key]
+	delete(e.leases, key)
+	e.leaseLock.Unlock()
+	if ok {
+		_, err := e.etcdClient.Revoke(ctx, lease)
+		return err
+	}
+	_, err := e.kv.Delete(ctx, key)
+	return err
+}
+
 func (e *EtcdConfigCenter) SetNamespace(ns string, value string, cluster string) error {
 	ctx := context.Background()
 	_, err := e.kv.Put(ctx, path.Join(e.basePath, "namespace", cluster, ns), value)
 	return err
 }
 
+// SetNamespaceWithRevision set namespace and save the revision to history in a transaction.
+func (e *EtcdConfigCenter) SetNamespaceWithRevision(ns string, value string, cluster string, rev *config.NamespaceRevision) error {
+	ctx := context.Background()
+	revValue, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	historyKey := e.getHistoryKey(ns, cluster, rev.Version)
+	resp, err := e.kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(historyKey), "=", 0)).
+		Then(clientv3.OpPut(path.Join(e.basePath, "namespace", cluster, ns), value), clientv3.OpPut(historyKey, string(revValue))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRevisionConflict
+	}
+	return nil
+}
+
+// GetNamespaceLatestVersion return the version of the latest revision, 0 if there is no revision.
+func (e *EtcdConfigCenter) GetNamespaceLatestVersion(ns string, cluster string) (int64, error) {
+	ctx := context.Background()
+	resp, err := e.kv.Get(ctx, e.getHistoryPrefix(ns, cluster), clientv3.WithLastKey()...)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	rev := &config.NamespaceRevision{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, rev); err != nil {
+		return 0, err
+	}
+	return rev.Version, nil
+}
+
+func (e *EtcdConfigCenter) GetNamespaceRevision(ns string, cluster string, version int64) (*config.NamespaceRevision, error) {
+	ctx := context.Background()
+	resp, err := e.kv.Get(ctx, e.getHistoryKey(ns, cluster, version))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	rev := &config.NamespaceRevision{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// ListNamespaceRevisions return all revisions of namespace in ascending order of version.
+func (e *EtcdConfigCenter) ListNamespaceRevisions(ns string, cluster string) ([]*config.NamespaceRevision, error) {
+	ctx := context.Background()
+	resp, err := e.kv.Get(ctx, e.getHistoryPrefix(ns, cluster), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var ret []*config.NamespaceRevision
+	for _, kv := range resp.Kvs {
+		rev := &config.NamespaceRevision{}
+		if err := json.Unmarshal(kv.Value, rev); err != nil {
+			return nil, err
+		}
+		ret = append(ret, rev)
+	}
+	return ret, nil
+}
+
+func (e *EtcdConfigCenter) getHistoryPrefix(ns string, cluster string) string {
+	return path.Join(e.basePath, "history", cluster, ns) + "/"
+}
+
+// the version is padded with zeros, so that the keys are sorted by version
+func (e *EtcdConfigCenter) getHistoryKey(ns string, cluster string, version int64) string {
+	return e.getHistoryPrefix(ns, cluster) + fmt.Sprintf("%020d", version)
+}
+
 func (e *EtcdConfigCenter) DelNamespace(ns string, cluster string) error {
 	ctx := context.Background()
 	_, err := e.kv.Delete(ctx, path.Join(e.basePath, "namespace", cluster, ns))
 	return err
 }
 
+// DelNamespaceWithRevision delete namespace and save the tombstone revision to history in a transaction.
+func (e *EtcdConfigCenter) DelNamespaceWithRevision(ns string, cluster string, rev *config.NamespaceRevision) error {
+	ctx := context.Background()
+	revValue, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	historyKey := e.getHistoryKey(ns, cluster, rev.Version)
+	resp, err := e.kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(historyKey), "=", 0)).
+		Then(clientv3.OpDelete(path.Join(e.basePath, "namespace", cluster, ns)), clientv3.OpPut(historyKey, string(revValue))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrRevisionConflict
+	}
+	return nil
+}
+
 func (e *EtcdConfigCenter) Close() {
 	if err := e.etcdClient.Close(); err != nil {
 		logutil.BgLogger().Error("close etcd client error", zap.Error(err))
@@ -0,0 +1,66 @@
+package configcenter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/util/etcdtest"
+)
+
+func TestEtcdConfigCenter_Revision(t *testing.T) {
+	_, client, closeFn := etcdtest.StartEmbedEtcd(t)
+	defer closeFn()
+	center := NewEtcdConfigCenter(client, "/weir", false)
+
+	version, err := center.GetNamespaceLatestVersion("test_ns", "test_cluster")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), version)
+
+	// more than 9 revisions, so that the order of version 10 is checked
+	for i := int64(1); i <= 11; i++ {
+		ns := &config.Namespace{Namespace: "test_ns", Revision: i}
+		rev := &config.NamespaceRevision{Version: i, Author: "tester", Namespace: ns}
+		require.NoError(t, center.SetNamespaceWithRevision("test_ns", string(config.Encode(ns)), "test_cluster", rev))
+	}
+	// the revisions of another namespace with the same prefix are not listed
+	other := &config.Namespace{Namespace: "test_ns2", Revision: 1}
+	require.NoError(t, center.SetNamespaceWithRevision("test_ns2", string(config.Encode(other)), "test_cluster",
+		&config.NamespaceRevision{Version: 1, Namespace: other}))
+
+	revs, err := center.ListNamespaceRevisions("test_ns", "test_cluster")
+	require.NoError(t, err)
+	require.Len(t, revs, 11)
+	for i, rev := range revs {
+		require.Equal(t, int64(i+1), rev.Version)
+		require.Equal(t, int64(i+1), rev.Namespace.Revision)
+	}
+	version, err = center.GetNamespaceLatestVersion("test_ns", "test_cluster")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), version)
+
+	rev, err := center.GetNamespaceRevision("test_ns", "test_cluster", 10)
+	require.NoError(t, err)
+	require.Equal(t, "tester", rev.Author)
+	_, err = center.GetNamespaceRevision("test_ns", "test_cluster", 12)
+	require.Equal(t, ErrKeyNotFound, err)
+
+	// a revision can not be overwritten, and the namespace is not changed by the conflicted one
+	conflict := &config.Namespace{Namespace: "test_ns", Revision: 100}
+	require.Equal(t, ErrRevisionConflict, center.SetNamespaceWithRevision("test_ns", string(config.Encode(conflict)), "test_cluster",
+		&config.NamespaceRevision{Version: 11, Namespace: conflict}))
+	ns, err := center.GetNamespace("test_ns", "test_cluster")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), ns.Revision)
+
+	// the same for the tombstone revision
+	require.Equal(t, ErrRevisionConflict, center.DelNamespaceWithRevision("test_ns", "test_cluster", &config.NamespaceRevision{Version: 11}))
+	_, err = center.GetNamespace("test_ns", "test_cluster")
+	require.NoError(t, err)
+	require.NoError(t, center.DelNamespaceWithRevision("test_ns", "test_cluster", &config.NamespaceRevision{Version: 12}))
+	_, err = center.GetNamespace("test_ns", "test_cluster")
+	require.Equal(t, ErrNamespaceNotFound, err)
+	rev, err = center.GetNamespaceRevision("test_ns", "test_cluster", 12)
+	require.NoError(t, err)
+	require.Nil(t, rev.Namespace)
+}
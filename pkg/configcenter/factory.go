@@ -1,6 +1,8 @@
 package configcenter
 
 import (
+	"fmt"
+
 	"github.com/pingcap/errors"
 	"github.com/tidb-incubator/weir/pkg/config"
 )
@@ -13,6 +15,36 @@ const (
 type ConfigCenter interface {
 	GetNamespace(ns string, cluster string) (*config.Namespace, error)
 	ListAllNamespace(cluster string) ([]*config.Namespace, error)
+	// RegisterProxy and DeregisterProxy maintain the proxies listed by cc.
+	RegisterProxy(cluster string, p *config.ProxyMonitorMetric) error
+	DeregisterProxy(cluster string, p *config.ProxyMonitorMetric) error
+}
+
+// WritableConfigCenter is used by cc to manage namespaces and revisions.
+type WritableConfigCenter interface {
+	ConfigCenter
+	ListAllNamespaceStringArray(cluster string) ([]string, error)
+	ListProxyMonitorMetrics(cluster string) (map[string]*config.ProxyMonitorMetric, error)
+	SetNamespace(ns string, value string, cluster string) error
+	SetNamespaceWithRevision(ns string, value string, cluster string, rev *config.NamespaceRevision) error
+	GetNamespaceLatestVersion(ns string, cluster string) (int64, error)
+	GetNamespaceRevision(ns string, cluster string, version int64) (*config.NamespaceRevision, error)
+	ListNamespaceRevisions(ns string, cluster string) ([]*config.NamespaceRevision, error)
+	DelNamespace(ns string, cluster string) error
+	// DelNamespaceWithRevision deletes the namespace and saves the tombstone revision, whose Namespace is nil.
+	DelNamespaceWithRevision(ns string, cluster string, rev *config.NamespaceRevision) error
+	Close()
+}
+
+func CreateWritableConfigCenter(cfg config.ConfigCenter) (WritableConfigCenter, error) {
+	switch cfg.Type {
+	case ConfigCenterTypeFile:
+		return CreateFileConfigCenter(cfg.ConfigFile.Path)
+	case ConfigCenterTypeEtcd:
+		return CreateEtcdConfigCenter(cfg.ConfigEtcd)
+	default:
+		return nil, errors.New("invalid config center type")
+	}
 }
 
 func CreateConfigCenter(cfg config.ConfigCenter) (ConfigCenter, error) {
@@ -25,3 +57,9 @@ func CreateConfigCenter(cfg config.ConfigCenter) (ConfigCenter, error) {
 		return nil, errors.New("invalid config center type")
 	}
 }
+
+// proxyRegistryKey includes the pid, so that the old and new processes on the same address
+// are registered separately during upgrade, and the old one does not remove the new one.
+func proxyRegistryKey(p *config.ProxyMonitorMetric) string {
+	return fmt.Sprintf("%s_%s_%d", p.IP, p.AdminPort, p.Pid)
+}
@@ -1,44 +1,45 @@
 package configcenter
 
 import (
-	"github.com/pingcap/errors"
-	"github.com/tidb-incubator/weir/pkg/config"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/pingcap/errors"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+const (
+	fileConfigCenterLockFile   = ".lock"
+	fileConfigCenterHistoryDir = "history"
+	fileConfigCenterProxyDir   = "proxy"
 )
 
 var (
 	ErrNamespaceNotFound = errors.New("namespace not found")
 )
 
-// FileConfigCenter is only for test use,
-// please do not use it in production environment.
+// FileConfigCenter stores namespace configs as yaml files in a directory, one file per namespace.
+// The revisions are stored in the history sub directory, and the proxies are listed from
+// the json files in the proxy/<cluster> sub directory. The cluster is ignored for namespaces.
+// Writes are atomic and guarded by a file lock, so that cc and proxies can share the directory.
 type FileConfigCenter struct {
 	dir    string
+	lock   sync.RWMutex
 	cfgs   map[string]*config.Namespace // key: namespace
 	nspath map[string]string            // key: namespace, value: config file path
 }
 
 func CreateFileConfigCenter(nsdir string) (*FileConfigCenter, error) {
-	yamlFiles, err := listAllYamlFiles(nsdir)
-	if err != nil {
-		return nil, err
-	}
-
 	c := newFileConfigCenter(nsdir)
-
-	for _, yamlFile := range yamlFiles {
-		fileData, err := ioutil.ReadFile(yamlFile)
-		if err != nil {
-			return nil, err
-		}
-		cfg, err := config.UnmarshalNamespaceConfig(fileData)
-		if err != nil {
-			return nil, err
-		}
-		c.cfgs[cfg.Namespace] = cfg
-		c.nspath[cfg.Namespace] = yamlFile
+	if err := c.load(); err != nil {
+		return nil, err
 	}
 	return c, nil
 }
@@ -60,7 +61,7 @@ func listAllYamlFiles(dir string) ([]string, error) {
 	var ret []string
 	for _, info := range infos {
 		fileName := info.Name()
-		if path.Ext(fileName) == ".yaml" {
+		if !info.IsDir() && path.Ext(fileName) == ".yaml" {
 			ret = append(ret, filepath.Join(dir, fileName))
 		}
 	}
@@ -68,7 +69,42 @@ func listAllYamlFiles(dir string) ([]string, error) {
 	return ret, nil
 }
 
+// load reads all the namespace config files, so that the changes made by other processes are visible.
+func (f *FileConfigCenter) load() error {
+	yamlFiles, err := listAllYamlFiles(f.dir)
+	if err != nil {
+		return err
+	}
+
+	cfgs := make(map[string]*config.Namespace)
+	nspath := make(map[string]string)
+	for _, yamlFile := range yamlFiles {
+		fileData, err := ioutil.ReadFile(yamlFile)
+		if err != nil {
+			return err
+		}
+		cfg, err := config.UnmarshalNamespaceConfig(fileData)
+		if err != nil {
+			return err
+		}
+		cfgs[cfg.Namespace] = cfg
+		nspath[cfg.Namespace] = yamlFile
+	}
+
+	f.lock.Lock()
+	f.cfgs = cfgs
+	f.nspath = nspath
+	f.lock.Unlock()
+	return nil
+}
+
 func (f *FileConfigCenter) GetNamespace(ns string, cluster string) (*config.Namespace, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
 	cfg, ok := f.cfgs[ns]
 	if !ok {
 		return nil, ErrNamespaceNotFound
@@ -77,9 +113,297 @@ func (f *FileConfigCenter) GetNamespace(ns string, cluster string) (*config.Name
 }
 
 func (f *FileConfigCenter) ListAllNamespace(cluster string) ([]*config.Namespace, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	f.lock.RLock()
+	defer f.lock.RUnlock()
 	var ret []*config.Namespace
 	for _, cfg := range f.cfgs {
 		ret = append(ret, cfg)
 	}
 	return ret, nil
 }
+
+func (f *FileConfigCenter) ListAllNamespaceStringArray(cluster string) ([]string, error) {
+	cfgs, err := f.ListAllNamespace(cluster)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, cfg := range cfgs {
+		ret = append(ret, string(config.Encode(cfg)))
+	}
+	return ret, nil
+}
+
+func (f *FileConfigCenter) ListProxyMonitorMetrics(cluster string) (map[string]*config.ProxyMonitorMetric, error) {
+	files, err := listFiles(filepath.Join(f.dir, fileConfigCenterProxyDir, cluster))
+	if err != nil {
+		return nil, err
+	}
+	proxy := make(map[string]*config.ProxyMonitorMetric)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		p := &config.ProxyMonitorMetric{}
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, err
+		}
+		proxy[p.Token] = p
+	}
+	return proxy, nil
+}
+
+func (f *FileConfigCenter) RegisterProxy(cluster string, p *config.ProxyMonitorMetric) error {
+	proxyFile := f.getProxyFile(cluster, p)
+	if err := os.MkdirAll(filepath.Dir(proxyFile), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(proxyFile, config.Encode(p))
+}
+
+func (f *FileConfigCenter) DeregisterProxy(cluster string, p *config.ProxyMonitorMetric) error {
+	if err := os.Remove(f.getProxyFile(cluster, p)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *FileConfigCenter) getProxyFile(cluster string, p *config.ProxyMonitorMetric) string {
+	return filepath.Join(f.dir, fileConfigCenterProxyDir, cluster, proxyRegistryKey(p)+".json")
+}
+
+// SetNamespace writes the namespace config in json to yaml file.
+func (f *FileConfigCenter) SetNamespace(ns string, value string, cluster string) error {
+	unlock, err := f.lockDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return f.setNamespace(ns, value)
+}
+
+func (f *FileConfigCenter) SetNamespaceWithRevision(ns string, value string, cluster string, rev *config.NamespaceRevision) error {
+	unlock, err := f.lockDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := f.writeRevision(ns, rev); err != nil {
+		return err
+	}
+	return f.setNamespace(ns, value)
+}
+
+func (f *FileConfigCenter) GetNamespaceLatestVersion(ns string, cluster string) (int64, error) {
+	revs, err := f.ListNamespaceRevisions(ns, cluster)
+	if err != nil {
+		return 0, err
+	}
+	if len(revs) == 0 {
+		return 0, nil
+	}
+	return revs[len(revs)-1].Version, nil
+}
+
+func (f *FileConfigCenter) GetNamespaceRevision(ns string, cluster string, version int64) (*config.NamespaceRevision, error) {
+	data, err := ioutil.ReadFile(f.getHistoryFile(ns, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	rev := &config.NamespaceRevision{}
+	if err := json.Unmarshal(data, rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// ListNamespaceRevisions return all revisions of namespace in ascending order of version.
+func (f *FileConfigCenter) ListNamespaceRevisions(ns string, cluster string) ([]*config.NamespaceRevision, error) {
+	files, err := listFiles(filepath.Join(f.dir, fileConfigCenterHistoryDir, ns))
+	if err != nil {
+		return nil, err
+	}
+	var ret []*config.NamespaceRevision
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rev := &config.NamespaceRevision{}
+		if err := json.Unmarshal(data, rev); err != nil {
+			return nil, err
+		}
+		ret = append(ret, rev)
+	}
+	return ret, nil
+}
+
+func (f *FileConfigCenter) DelNamespace(ns string, cluster string) error {
+	unlock, err := f.lockDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return f.delNamespace(ns)
+}
+
+func (f *FileConfigCenter) DelNamespaceWithRevision(ns string, cluster string, rev *config.NamespaceRevision) error {
+	unlock, err := f.lockDir()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := f.writeRevision(ns, rev); err != nil {
+		return err
+	}
+	return f.delNamespace(ns)
+}
+
+func (f *FileConfigCenter) Close() {
+}
+
+// writeRevision must be called with the directory locked.
+func (f *FileConfigCenter) writeRevision(ns string, rev *config.NamespaceRevision) error {
+	historyFile := f.getHistoryFile(ns, rev.Version)
+	if _, err := os.Stat(historyFile); err == nil {
+		return ErrRevisionConflict
+	}
+	revValue, err := json.Marshal(rev)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(historyFile), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(historyFile, revValue)
+}
+
+// delNamespace must be called with the directory locked.
+func (f *FileConfigCenter) delNamespace(ns string) error {
+	if err := f.load(); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	nspath, ok := f.nspath[ns]
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(nspath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(f.cfgs, ns)
+	delete(f.nspath, ns)
+	return nil
+}
+
+// setNamespace must be called with the directory locked.
+func (f *FileConfigCenter) setNamespace(ns string, value string) error {
+	cfg := &config.Namespace{}
+	if err := json.Unmarshal([]byte(value), cfg); err != nil {
+		return err
+	}
+	if cfg.Namespace != ns {
+		return errors.Errorf("namespace mismatch: %s", cfg.Namespace)
+	}
+	data, err := config.MarshalNamespaceConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := f.load(); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	nspath, ok := f.nspath[ns]
+	if !ok {
+		nspath = filepath.Join(f.dir, ns+".yaml")
+	}
+	if err := writeFileAtomic(nspath, data); err != nil {
+		return err
+	}
+	f.cfgs[ns] = cfg
+	f.nspath[ns] = nspath
+	return nil
+}
+
+// lockDir acquires an exclusive file lock of the directory, which is shared by processes.
+func (f *FileConfigCenter) lockDir() (func(), error) {
+	lockFile, err := os.OpenFile(filepath.Join(f.dir, fileConfigCenterLockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
+
+// the version is padded with zeros, so that the files are sorted by version
+func (f *FileConfigCenter) getHistoryFile(ns string, version int64) string {
+	return filepath.Join(f.dir, fileConfigCenterHistoryDir, ns, fmt.Sprintf("%020d.json", version))
+}
+
+// listFiles return the sorted json files in dir, and nil if dir does not exist.
+func listFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ret []string
+	for _, info := range infos {
+		if !info.IsDir() && path.Ext(info.Name()) == ".json" {
+			ret = append(ret, filepath.Join(dir, info.Name()))
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// writeFileAtomic writes data to a temp file in the same directory and renames it to filename,
+// so that readers never see a partially written file.
+func writeFileAtomic(filename string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filename)
+}
@@ -0,0 +1,118 @@
+package configcenter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func TestFileConfigCenter_SetAndDelNamespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir_file_config_center")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	center, err := CreateFileConfigCenter(dir)
+	require.NoError(t, err)
+	_, err = center.GetNamespace("test_ns", "")
+	require.Equal(t, ErrNamespaceNotFound, err)
+
+	ns := &config.Namespace{Version: "v1", Namespace: "test_ns", Backend: config.BackendNamespace{SelectorType: "random"}}
+	require.NoError(t, center.SetNamespace("test_ns", string(config.Encode(ns)), ""))
+	require.Error(t, center.SetNamespace("other_ns", string(config.Encode(ns)), ""))
+
+	// the change is visible to another config center sharing the directory
+	other, err := CreateFileConfigCenter(dir)
+	require.NoError(t, err)
+	cfg, err := other.GetNamespace("test_ns", "")
+	require.NoError(t, err)
+	require.Equal(t, "random", cfg.Backend.SelectorType)
+	_, err = os.Stat(filepath.Join(dir, "test_ns.yaml"))
+	require.NoError(t, err)
+
+	require.NoError(t, center.DelNamespace("test_ns", ""))
+	_, err = other.GetNamespace("test_ns", "")
+	require.Equal(t, ErrNamespaceNotFound, err)
+	cfgs, err := other.ListAllNamespace("")
+	require.NoError(t, err)
+	require.Len(t, cfgs, 0)
+}
+
+func TestFileConfigCenter_Revision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir_file_config_center")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	center, err := CreateFileConfigCenter(dir)
+	require.NoError(t, err)
+	version, err := center.GetNamespaceLatestVersion("test_ns", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), version)
+
+	for i := int64(1); i <= 2; i++ {
+		ns := &config.Namespace{Namespace: "test_ns", Revision: i}
+		rev := &config.NamespaceRevision{Version: i, Namespace: ns}
+		require.NoError(t, center.SetNamespaceWithRevision("test_ns", string(config.Encode(ns)), "", rev))
+	}
+	rev := &config.NamespaceRevision{Version: 2}
+	require.Equal(t, ErrRevisionConflict, center.SetNamespaceWithRevision("test_ns", "", "", rev))
+
+	version, err = center.GetNamespaceLatestVersion("test_ns", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), version)
+	revs, err := center.ListNamespaceRevisions("test_ns", "")
+	require.NoError(t, err)
+	require.Len(t, revs, 2)
+	require.Equal(t, int64(1), revs[0].Namespace.Revision)
+	cfg, err := center.GetNamespace("test_ns", "")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), cfg.Revision)
+}
+
+func TestFileConfigCenter_ListProxyMonitorMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir_file_config_center")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	center, err := CreateFileConfigCenter(dir)
+	require.NoError(t, err)
+	proxies, err := center.ListProxyMonitorMetrics("default")
+	require.NoError(t, err)
+	require.Len(t, proxies, 0)
+
+	proxyDir := filepath.Join(dir, "proxy", "default")
+	require.NoError(t, os.MkdirAll(proxyDir, 0755))
+	p := &config.ProxyMonitorMetric{Token: "127.0.0.1:6001", IP: "127.0.0.1", AdminPort: "6001"}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(proxyDir, "127.0.0.1_6001.json"), config.Encode(p), 0644))
+	proxies, err = center.ListProxyMonitorMetrics("default")
+	require.NoError(t, err)
+	require.Equal(t, "6001", proxies["127.0.0.1:6001"].AdminPort)
+}
+
+func TestFileConfigCenter_RegisterProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir_file_config_center")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	center, err := CreateFileConfigCenter(dir)
+	require.NoError(t, err)
+	oldProxy := &config.ProxyMonitorMetric{Token: "127.0.0.1:6001", IP: "127.0.0.1", AdminPort: "6001", Pid: 100}
+	newProxy := &config.ProxyMonitorMetric{Token: "127.0.0.1:6001", IP: "127.0.0.1", AdminPort: "6001", Pid: 101}
+	require.NoError(t, center.RegisterProxy("default", oldProxy))
+	require.NoError(t, center.RegisterProxy("default", newProxy))
+
+	// the old process of upgrade does not remove the new one on the same address
+	require.NoError(t, center.DeregisterProxy("default", oldProxy))
+	proxies, err := center.ListProxyMonitorMetrics("default")
+	require.NoError(t, err)
+	require.Equal(t, 101, proxies["127.0.0.1:6001"].Pid)
+
+	require.NoError(t, center.DeregisterProxy("default", newProxy))
+	require.NoError(t, center.DeregisterProxy("default", newProxy))
+	proxies, err = center.ListProxyMonitorMetrics("default")
+	require.NoError(t, err)
+	require.Len(t, proxies, 0)
+}
@@ -1,25 +1,43 @@
 package proxy
 
 import (
+	"context"
+	"encoding/json"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/util/logutil"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tidb-incubator/weir/pkg/capture"
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/tidb-incubator/weir/pkg/configcenter"
+	"github.com/tidb-incubator/weir/pkg/proxy/backend"
 	"github.com/tidb-incubator/weir/pkg/proxy/namespace"
 	"github.com/tidb-incubator/weir/pkg/proxy/server"
+	"github.com/tidb-incubator/weir/pkg/util/upgrade"
 	"go.uber.org/zap"
 )
 
+const (
+	httpApiServerShutdownTimeout = 5 * time.Second
+)
+
 const (
 	ParamNamespace = "namespace"
 	ParamBreaker   = "breaker"
+	ParamAddr      = "addr"
+	ParamDuration  = "duration"
+	ParamGroup     = "group"
+	ParamTimeout   = "timeout"
 )
 
+const defaultCaptureDuration = time.Minute
+
 type HttpApiServer struct {
 	cfg         *config.Proxy
 	proxyServer *server.Server
@@ -27,6 +45,8 @@ type HttpApiServer struct {
 	cfgCenter   configcenter.ConfigCenter
 	listener    net.Listener
 	closeCh     chan struct{}
+	closeOnce   sync.Once
+	upgrade     func() error
 
 	engine *gin.Engine
 }
@@ -42,6 +62,29 @@ type CommonJsonResp struct {
 	Msg  string `json:"msg"`
 }
 
+type BackendStatusJsonResp struct {
+	CommonJsonResp
+	Instances []*backend.InstanceStatus `json:"instances"`
+	// Weights is set if the backend is split into groups.
+	Weights map[string]int `json:"weights,omitempty"`
+}
+
+type CaptureStatusJsonResp struct {
+	CommonJsonResp
+	Capture capture.Status `json:"capture"`
+}
+
+type PauseStatusJsonResp struct {
+	CommonJsonResp
+	Pause namespace.PauseStatus `json:"pause"`
+}
+
+// PingJsonResp carries the config revisions of running namespaces
+type PingJsonResp struct {
+	CommonJsonResp
+	Namespaces map[string]int64 `json:"namespaces"`
+}
+
 func NewNamespaceHttpHandler(nsmgr *namespace.NamespaceManager, cfgCenter configcenter.ConfigCenter, cluster string) *NamespaceHttpHandler {
 	return &NamespaceHttpHandler{
 		nsmgr:     nsmgr,
@@ -61,10 +104,15 @@ func CreateHttpApiServer(proxyServer *server.Server, nsmgr *namespace.NamespaceM
 		closeCh:     make(chan struct{}),
 	}
 
-	listener, err := net.Listen("tcp", apiServer.cfg.AdminServer.Addr)
+	listener, err := upgrade.Inherit("tcp", apiServer.cfg.AdminServer.Addr)
 	if err != nil {
 		return nil, err
 	}
+	if listener == nil {
+		if listener, err = net.Listen("tcp", apiServer.cfg.AdminServer.Addr); err != nil {
+			return nil, err
+		}
+	}
 	apiServer.listener = listener
 
 	engine := gin.New()
@@ -75,6 +123,13 @@ func CreateHttpApiServer(proxyServer *server.Server, nsmgr *namespace.NamespaceM
 	namespaceHttpHandler := NewNamespaceHttpHandler(apiServer.nsmgr, apiServer.cfgCenter, cfg.Cluster)
 	namespaceHttpHandler.AddHandlersToRouteGroup(namespaceRouteGroup)
 
+	adminRouteGroup := engine.Group("/admin")
+	apiServer.wrapBasicAuthGinMiddleware(adminRouteGroup)
+	adminRouteGroup.PUT("/upgrade", apiServer.HandleUpgrade)
+	adminRouteGroup.PUT("/capture/start/:namespace", apiServer.HandleStartCapture)
+	adminRouteGroup.PUT("/capture/stop/:namespace", apiServer.HandleStopCapture)
+	adminRouteGroup.GET("/capture/:namespace", apiServer.HandleGetCaptureStatus)
+
 	metricsRouteGroup := engine.Group("/metrics")
 	metricsRouteGroup.GET("/", gin.WrapF(promhttp.Handler().ServeHTTP))
 
@@ -104,36 +159,119 @@ func (h *HttpApiServer) wrapBasicAuthGinMiddleware(group *gin.RouterGroup) {
 }
 
 func (h *HttpApiServer) Run() {
-	defer func() {
-		if err := h.listener.Close(); err != nil {
-			logutil.BgLogger().Warn("close http api server listener error", zap.Error(err))
-		}
-	}()
+	mux := http.NewServeMux()
+	mux.Handle("/", h.engine)
+	srv := &http.Server{Handler: mux}
 
-	errCh := make(chan error)
+	errCh := make(chan error, 1)
 	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/", h.engine)
-		errCh <- http.Serve(h.listener, mux)
+		errCh <- srv.Serve(h.listener)
 	}()
 
 	select {
 	case <-h.closeCh:
 		logutil.BgLogger().Info("closing http api server")
+		// the keep-alive conns are closed too, so that the requests are sent to the new process after upgrade.
+		ctx, cancel := context.WithTimeout(context.Background(), httpApiServerShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logutil.BgLogger().Warn("close http api server error", zap.Error(err))
+		}
 	case err := <-errCh:
 		logutil.BgLogger().Fatal("http api server exit on error", zap.Error(err))
 	}
 }
 
 func (h *HttpApiServer) Close() {
-	close(h.closeCh)
+	h.closeOnce.Do(func() {
+		close(h.closeCh)
+	})
+}
+
+func (h *HttpApiServer) listenerFile() (upgrade.ListenerFile, error) {
+	ln, ok := h.listener.(*net.TCPListener)
+	if !ok {
+		return upgrade.ListenerFile{}, errors.New("http api server listener can not be passed to new process")
+	}
+	f, err := ln.File()
+	if err != nil {
+		return upgrade.ListenerFile{}, err
+	}
+	return upgrade.ListenerFile{Network: "tcp", Addr: h.cfg.AdminServer.Addr, File: f}, nil
+}
+
+// HandleUpgrade returns after the new process is serving, the sessions are still served by this process until
+// they finish their transactions.
+func (h *HttpApiServer) HandleUpgrade(c *gin.Context) {
+	if err := h.upgrade(); err != nil {
+		errMsg := "upgrade error: " + err.Error()
+		logutil.BgLogger().Error(errMsg)
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusInternalServerError, errMsg))
+		return
+	}
+
+	logutil.BgLogger().Info("upgrade success")
+	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+}
+
+// HandleStartCapture starts to record the traffic of a namespace into a file for the duration, default 1m.
+func (h *HttpApiServer) HandleStartCapture(c *gin.Context) {
+	ns := c.Param(ParamNamespace)
+	if _, ok := h.nsmgr.GetBackend(ns); !ok {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "namespace not found"))
+		return
+	}
+	duration := defaultCaptureDuration
+	if d := c.Query(ParamDuration); d != "" {
+		var err error
+		if duration, err = time.ParseDuration(d); err != nil || duration <= 0 {
+			c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "bad duration parameter"))
+			return
+		}
+	}
+
+	status, err := h.proxyServer.Captures().Start(ns, duration)
+	if err != nil {
+		errMsg := "start capture error: " + err.Error()
+		logutil.BgLogger().Error(errMsg, zap.String("namespace", ns))
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusInternalServerError, errMsg))
+		return
+	}
+	c.JSON(http.StatusOK, &CaptureStatusJsonResp{CommonJsonResp: CreateSuccessJsonResp(), Capture: status})
+}
+
+// HandleStopCapture returns after the capture file is closed.
+func (h *HttpApiServer) HandleStopCapture(c *gin.Context) {
+	h.handleCapture(c, h.proxyServer.Captures().Stop)
+}
+
+func (h *HttpApiServer) HandleGetCaptureStatus(c *gin.Context) {
+	h.handleCapture(c, h.proxyServer.Captures().GetStatus)
+}
+
+func (h *HttpApiServer) handleCapture(c *gin.Context, handle func(namespace string) (capture.Status, error)) {
+	status, err := handle(c.Param(ParamNamespace))
+	if err != nil {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, &CaptureStatusJsonResp{CommonJsonResp: CreateSuccessJsonResp(), Capture: status})
 }
 
 func (n *NamespaceHttpHandler) AddHandlersToRouteGroup(group *gin.RouterGroup) {
 	group.PUT("/remove/:namespace", n.HandleRemoveNamespace)
 	group.PUT("/reload/prepare/:namespace", n.HandlePrepareReload)
 	group.PUT("/reload/commit/:namespace", n.HandleCommitReload)
+	group.PUT("/reload/abort/:namespace", n.HandleAbortReload)
 	group.GET("/ping", n.ping)
+	group.GET("/backend/:namespace", n.HandleGetBackendStatus)
+	group.PUT("/backend/add/:namespace", n.HandleAddBackendInstance)
+	group.PUT("/backend/remove/:namespace", n.HandleRemoveBackendInstance)
+	group.PUT("/backend/drain/:namespace", n.HandleDrainBackendInstance)
+	group.PUT("/backend/weights/:namespace", n.HandleSetBackendGroupWeights)
+	group.PUT("/pause/:namespace", n.HandlePauseNamespace)
+	group.PUT("/resume/:namespace", n.HandleResumeNamespace)
+	group.GET("/pause/:namespace", n.HandleGetPauseStatus)
 }
 
 func (n *NamespaceHttpHandler) HandleRemoveNamespace(c *gin.Context) {
@@ -156,10 +294,10 @@ func (n *NamespaceHttpHandler) HandlePrepareReload(c *gin.Context) {
 		return
 	}
 
-	nscfg, err := n.cfgCenter.GetNamespace(ns, n.cluster)
+	nscfg, err := n.getPrepareNamespaceConfig(c, ns)
 	if err != nil {
-		errMsg := "get namespace value from configcenter error"
-		logutil.BgLogger().Error(errMsg, zap.Error(err))
+		errMsg := "get namespace config error"
+		logutil.BgLogger().Error(errMsg, zap.Error(err), zap.String("namespace", ns))
 		c.JSON(http.StatusOK, CreateJsonResp(http.StatusInternalServerError, errMsg))
 		return
 	}
@@ -192,10 +330,201 @@ func (n *NamespaceHttpHandler) HandleCommitReload(c *gin.Context) {
 	c.JSON(http.StatusOK, CreateSuccessJsonResp())
 }
 
-func (s *NamespaceHttpHandler) ping(c *gin.Context) {
+func (n *NamespaceHttpHandler) HandleAbortReload(c *gin.Context) {
+	ns := c.Param(ParamNamespace)
+	if ns == "" {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "bad namespace parameter"))
+		return
+	}
+
+	if err := n.nsmgr.AbortReloadNamespace(ns); err != nil {
+		errMsg := "abort reload namespace error"
+		logutil.BgLogger().Error(errMsg, zap.Error(err), zap.String("namespace", ns))
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusInternalServerError, errMsg))
+		return
+	}
+
+	logutil.BgLogger().Info("abort reload success", zap.String("namespace", ns))
 	c.JSON(http.StatusOK, CreateSuccessJsonResp())
 }
 
+// HandlePauseNamespace holds the new statements of the namespace, each for at most the timeout, default 30s.
+// The backend can be swapped by reloading the namespace after the in-flight transactions are done.
+func (n *NamespaceHttpHandler) HandlePauseNamespace(c *gin.Context) {
+	ns := c.Param(ParamNamespace)
+	var timeout time.Duration
+	if t := c.Query(ParamTimeout); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil || timeout <= 0 {
+			c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "bad timeout parameter"))
+			return
+		}
+	}
+
+	if err := n.nsmgr.PauseNamespace(ns, timeout); err != nil {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	logutil.BgLogger().Info("pause namespace success", zap.String("namespace", ns), zap.Duration("timeout", timeout))
+	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+}
+
+// HandleResumeNamespace runs the held statements on current namespace.
+func (n *NamespaceHttpHandler) HandleResumeNamespace(c *gin.Context) {
+	ns := c.Param(ParamNamespace)
+	if err := n.nsmgr.ResumeNamespace(ns); err != nil {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	logutil.BgLogger().Info("resume namespace success", zap.String("namespace", ns))
+	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+}
+
+func (n *NamespaceHttpHandler) HandleGetPauseStatus(c *gin.Context) {
+	status, err := n.nsmgr.GetPauseStatus(c.Param(ParamNamespace))
+	if err != nil {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, &PauseStatusJsonResp{CommonJsonResp: CreateSuccessJsonResp(), Pause: status})
+}
+
+func (n *NamespaceHttpHandler) HandleGetBackendStatus(c *gin.Context) {
+	ns := c.Param(ParamNamespace)
+	b, ok := n.nsmgr.GetBackend(ns)
+	if !ok {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "namespace not found"))
+		return
+	}
+
+	resp := &BackendStatusJsonResp{
+		CommonJsonResp: CreateSuccessJsonResp(),
+		Instances:      b.GetInstanceStatus(),
+	}
+	if gb, ok := b.(*backend.GroupBackend); ok {
+		resp.Weights = gb.GetWeights()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (n *NamespaceHttpHandler) HandleAddBackendInstance(c *gin.Context) {
+	n.handleChangeBackendInstance(c, "add backend instance", namespace.Backend.AddInstance)
+}
+
+func (n *NamespaceHttpHandler) HandleRemoveBackendInstance(c *gin.Context) {
+	n.handleChangeBackendInstance(c, "remove backend instance", namespace.Backend.RemoveInstance)
+}
+
+func (n *NamespaceHttpHandler) HandleDrainBackendInstance(c *gin.Context) {
+	n.handleChangeBackendInstance(c, "drain backend instance", namespace.Backend.DrainInstance)
+}
+
+// HandleSetBackendGroupWeights sets the weights of the backend groups carried in request body,
+// e.g. {"old": 90, "new": 10}. The groups not in the body keep their weights.
+// The change is not written to configcenter, and is lost when the namespace is reloaded.
+func (n *NamespaceHttpHandler) HandleSetBackendGroupWeights(c *gin.Context) {
+	ns := c.Param(ParamNamespace)
+	weights := make(map[string]int)
+	body, err := c.GetRawData()
+	if err == nil {
+		err = json.Unmarshal(body, &weights)
+	}
+	if err != nil || len(weights) == 0 {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "bad weights"))
+		return
+	}
+	b, ok := n.nsmgr.GetBackend(ns)
+	if !ok {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "namespace not found"))
+		return
+	}
+	gb, ok := b.(*backend.GroupBackend)
+	if !ok {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "backend is not split into groups"))
+		return
+	}
+
+	if err := gb.SetWeights(weights); err != nil {
+		errMsg := "set backend group weights error: " + err.Error()
+		logutil.BgLogger().Error(errMsg, zap.String("namespace", ns))
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusInternalServerError, errMsg))
+		return
+	}
+
+	logutil.BgLogger().Info("set backend group weights success", zap.String("namespace", ns), zap.Any("weights", weights))
+	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+}
+
+// handleChangeBackendInstance changes the instances of running namespace in place, without rebuilding it.
+// The group parameter is required to add an instance if the backend is split into groups.
+// The change is not written to configcenter, and is lost when the namespace is reloaded.
+func (n *NamespaceHttpHandler) handleChangeBackendInstance(c *gin.Context, action string, change func(namespace.Backend, string) error) {
+	ns := c.Param(ParamNamespace)
+	addr := c.Query(ParamAddr)
+	if addr == "" {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "bad addr parameter"))
+		return
+	}
+	b, ok := n.nsmgr.GetBackend(ns)
+	if !ok {
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "namespace not found"))
+		return
+	}
+	if group := c.Query(ParamGroup); group != "" {
+		gb, ok := b.(*backend.GroupBackend)
+		if !ok {
+			c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, "backend is not split into groups"))
+			return
+		}
+		groupBackend, err := gb.GetGroup(group)
+		if err != nil {
+			c.JSON(http.StatusOK, CreateJsonResp(http.StatusBadRequest, err.Error()))
+			return
+		}
+		b = groupBackend
+	}
+
+	if err := change(b, addr); err != nil {
+		errMsg := action + " error: " + err.Error()
+		logutil.BgLogger().Error(errMsg, zap.String("namespace", ns), zap.String("addr", addr))
+		c.JSON(http.StatusOK, CreateJsonResp(http.StatusInternalServerError, errMsg))
+		return
+	}
+
+	logutil.BgLogger().Info(action+" success", zap.String("namespace", ns), zap.String("addr", addr))
+	c.JSON(http.StatusOK, CreateSuccessJsonResp())
+}
+
+// getPrepareNamespaceConfig uses the namespace config carried in request body if present,
+// so that cc can prepare a config which is not written to configcenter yet.
+func (n *NamespaceHttpHandler) getPrepareNamespaceConfig(c *gin.Context, ns string) (*config.Namespace, error) {
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return n.cfgCenter.GetNamespace(ns, n.cluster)
+	}
+
+	nscfg := &config.Namespace{}
+	if err := json.Unmarshal(body, nscfg); err != nil {
+		return nil, err
+	}
+	if nscfg.Namespace != ns {
+		return nil, errors.Errorf("namespace mismatch: %s", nscfg.Namespace)
+	}
+	return nscfg, nil
+}
+
+func (s *NamespaceHttpHandler) ping(c *gin.Context) {
+	c.JSON(http.StatusOK, &PingJsonResp{
+		CommonJsonResp: CreateSuccessJsonResp(),
+		Namespaces:     s.nsmgr.GetNamespaceRevisions(),
+	})
+}
+
 func CreateJsonResp(code int, msg string) CommonJsonResp {
 	return CommonJsonResp{
 		Code: code,
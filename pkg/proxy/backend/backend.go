@@ -3,6 +3,7 @@ package backend
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,36 +16,73 @@ import (
 )
 
 var (
-	ErrNoBackendAddr   = errors.New("no backend addr")
-	ErrBackendClosed   = errors.New("backend is closed")
-	ErrBackendNotFound = errors.New("backend not found")
+	ErrNoBackendAddr    = errors.New("no backend addr")
+	ErrBackendClosed    = errors.New("backend is closed")
+	ErrBackendNotFound  = errors.New("backend not found")
+	ErrBackendExists    = errors.New("backend already exists")
+	ErrLastBackend      = errors.New("can not remove the last backend")
+	ErrNeedRebuild      = errors.New("backend config can not be updated in place")
+	ErrDiscoveryEnabled = errors.New("backend instances are managed by discovery")
 )
 
+const (
+	discoveryInitTimeout = 5 * time.Second
+	drainCheckInterval   = 100 * time.Millisecond
+)
+
+const (
+	InstanceStatusOnline   = "online"
+	InstanceStatusDraining = "draining"
+)
+
+// InstanceStatus is the routing status and conn pool usage of an instance.
+type InstanceStatus struct {
+	Addr   string `json:"addr"`
+	Status string `json:"status"`
+	InUse  int64  `json:"in_use"`
+	// Group is set if the backend is split into groups.
+	Group string `json:"group,omitempty"`
+}
+
 type BackendConfig struct {
-	Addrs        map[string]struct{}
-	UserName     string
-	Password     string
-	Capacity     int
-	IdleTimeout  time.Duration
-	SelectorType int
+	Addrs          map[string]struct{}
+	UserName       string
+	Password       string
+	Capacity       int
+	IdleTimeout    time.Duration
+	ConnectTimeout time.Duration
+	MinIdle        int
+	MaxLifetime    time.Duration
+	MaxWait        time.Duration
+	SelectorType   int
+	// EnableCompression uses the compressed protocol between proxy and backend if the backend supports it.
+	EnableCompression bool
+	// CompressionAlgorithm is CompressionZlib or CompressionZstd, CompressionZlib is used if it is empty.
+	CompressionAlgorithm string
+	// Discovery discovers instances dynamically, Addrs is ignored if it is set.
+	Discovery Discovery
 }
 
 type BackendImpl struct {
 	ns        string
 	cfg       *BackendConfig
 	connPools map[string]*ConnPool // key: addr
-	instances []*Instance
+	instances []*Instance          // copy on write, guarded by lock
+	draining  map[string]struct{}  // key: addr, the conn pools are kept in connPools until idle
 	selector  Selector
 
 	lock   sync.RWMutex
 	closed sync2.AtomicBool
+
+	discoveryCancel context.CancelFunc
 }
 
 func NewBackendImpl(ns string, cfg *BackendConfig) *BackendImpl {
 	return &BackendImpl{
-		cfg:    cfg,
-		closed: sync2.NewAtomicBool(false),
-		ns:     ns,
+		cfg:      cfg,
+		closed:   sync2.NewAtomicBool(false),
+		ns:       ns,
+		draining: make(map[string]struct{}),
 	}
 }
 
@@ -62,6 +100,7 @@ func (b *BackendImpl) Init() error {
 	if err := b.initConnPools(); err != nil {
 		return err
 	}
+	b.startDiscovery()
 
 	metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventInited).Inc()
 	return nil
@@ -77,7 +116,21 @@ func (b *BackendImpl) initSelector() error {
 }
 
 func (b *BackendImpl) initInstances() error {
-	instances, err := createInstances(b.cfg)
+	addrs := b.cfg.Addrs
+	if b.cfg.Discovery != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), discoveryInitTimeout)
+		discoveredAddrs, err := b.cfg.Discovery.GetInstances(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+		addrs = make(map[string]struct{})
+		for _, addr := range discoveredAddrs {
+			addrs[addr] = struct{}{}
+		}
+	}
+
+	instances, err := createInstances(addrs)
 	if err != nil {
 		return err
 	}
@@ -87,14 +140,8 @@ func (b *BackendImpl) initInstances() error {
 
 func (b *BackendImpl) initConnPools() error {
 	connPools := make(map[string]*ConnPool)
-	for addr := range b.cfg.Addrs {
-		poolCfg := &ConnPoolConfig{
-			Config:      Config{Addr: addr, UserName: b.cfg.UserName, Password: b.cfg.Password},
-			Capacity:    b.cfg.Capacity,
-			IdleTimeout: b.cfg.IdleTimeout,
-		}
-		connPool := NewConnPool(b.ns, poolCfg)
-		connPools[addr] = connPool
+	for _, instance := range b.instances {
+		connPools[instance.Addr()] = b.newConnPool(instance.Addr())
 	}
 
 	successfulInitConnPoolAddrs := make(map[string]struct{})
@@ -120,12 +167,323 @@ func (b *BackendImpl) initConnPools() error {
 	return nil
 }
 
+func (b *BackendImpl) newConnPool(addr string) *ConnPool {
+	return NewConnPool(b.ns, b.newConnPoolConfig(addr))
+}
+
+func (b *BackendImpl) newConnPoolConfig(addr string) *ConnPoolConfig {
+	return &ConnPoolConfig{
+		Config: Config{
+			Addr:              addr,
+			UserName:          b.cfg.UserName,
+			Password:          b.cfg.Password,
+			ConnectTimeout:    b.cfg.ConnectTimeout,
+			EnableCompression: b.cfg.EnableCompression,
+
+			CompressionAlgorithm: b.cfg.CompressionAlgorithm,
+		},
+		Capacity:    b.cfg.Capacity,
+		IdleTimeout: b.cfg.IdleTimeout,
+		MinIdle:     b.cfg.MinIdle,
+		MaxLifetime: b.cfg.MaxLifetime,
+		MaxWait:     b.cfg.MaxWait,
+	}
+}
+
+func (b *BackendImpl) startDiscovery() {
+	if b.cfg.Discovery == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.discoveryCancel = cancel
+	go b.cfg.Discovery.Watch(ctx, b.updateInstances)
+}
+
+// updateInstances adds the conn pools of new instances and closes the removed ones.
+// An empty instance list is ignored, since it is more likely a discovery error than all instances down.
+func (b *BackendImpl) updateInstances(addrs []string) {
+	if len(addrs) == 0 {
+		logutil.BgLogger().Warn("discovered no backend instance, ignore it", zap.String("namespace", b.ns))
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed.Get() {
+		return
+	}
+	b.updateInstancesLocked(addrs)
+}
+
+func (b *BackendImpl) updateInstancesLocked(addrs []string) {
+	addrSet := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		addrSet[addr] = struct{}{}
+	}
+
+	instances := make([]*Instance, 0, len(addrs))
+	for _, addr := range addrs {
+		if _, ok := b.draining[addr]; ok {
+			continue
+		}
+		instances = append(instances, &Instance{addr: addr})
+		if _, ok := b.connPools[addr]; ok {
+			continue
+		}
+		connPool := b.newConnPool(addr)
+		if err := connPool.Init(); err != nil {
+			logutil.BgLogger().Error("init conn pool error", zap.String("namespace", b.ns), zap.String("addr", addr), zap.Error(err))
+			instances = instances[:len(instances)-1]
+			continue
+		}
+		b.connPools[addr] = connPool
+		metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventInstanceAdded).Inc()
+		logutil.BgLogger().Info("backend instance added", zap.String("namespace", b.ns), zap.String("addr", addr))
+	}
+
+	for addr, connPool := range b.connPools {
+		if _, ok := addrSet[addr]; ok {
+			continue
+		}
+		b.removeConnPool(addr, connPool)
+	}
+
+	b.instances = instances
+}
+
+// UpdateConfig applies the new config to the live backend. The conn pools are resized in place,
+// and the instances are added or removed if they are not discovered dynamically.
+// The discovery can not be changed in place, so cfg.Discovery is ignored.
+// It returns ErrNeedRebuild if the credentials are changed.
+func (b *BackendImpl) UpdateConfig(cfg *BackendConfig) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.checkConfigLocked(cfg); err != nil {
+		return err
+	}
+
+	if cfg.SelectorType != b.cfg.SelectorType {
+		selector, err := CreateSelector(cfg.SelectorType)
+		if err != nil {
+			return err
+		}
+		b.selector = selector
+	}
+
+	newCfg := *cfg
+	newCfg.Discovery = b.cfg.Discovery
+	b.cfg = &newCfg
+
+	for addr, connPool := range b.connPools {
+		if connPool.Reconfigure(b.newConnPoolConfig(addr)) {
+			continue
+		}
+		newConnPool := b.newConnPool(addr)
+		if err := newConnPool.Init(); err != nil {
+			logutil.BgLogger().Error("replace conn pool error", zap.String("namespace", b.ns), zap.String("addr", addr), zap.Error(err))
+			continue
+		}
+		b.connPools[addr] = newConnPool
+		go closeConnPool(addr, connPool)
+	}
+
+	if b.cfg.Discovery == nil {
+		addrs := make([]string, 0, len(cfg.Addrs))
+		for addr := range cfg.Addrs {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		b.updateInstancesLocked(addrs)
+	}
+	return nil
+}
+
+// checkConfig returns the error UpdateConfig would return, without changing the backend.
+func (b *BackendImpl) checkConfig(cfg *BackendConfig) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.checkConfigLocked(cfg)
+}
+
+func (b *BackendImpl) checkConfigLocked(cfg *BackendConfig) error {
+	if b.closed.Get() {
+		return ErrBackendClosed
+	}
+	if cfg.UserName != b.cfg.UserName || cfg.Password != b.cfg.Password {
+		return ErrNeedRebuild
+	}
+	if cfg.SelectorType != b.cfg.SelectorType {
+		if _, err := CreateSelector(cfg.SelectorType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkManualChangeLocked checks whether the instances can be changed by hand.
+// The instances found by discovery are not, since the change would be undone by the next update.
+func (b *BackendImpl) checkManualChangeLocked() error {
+	if b.closed.Get() {
+		return ErrBackendClosed
+	}
+	if b.cfg.Discovery != nil {
+		return ErrDiscoveryEnabled
+	}
+	return nil
+}
+
+// AddInstance adds an instance to routing in place. A draining instance is brought back online.
+func (b *BackendImpl) AddInstance(addr string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.checkManualChangeLocked(); err != nil {
+		return err
+	}
+
+	if _, ok := b.draining[addr]; ok {
+		delete(b.draining, addr)
+		if _, ok := b.connPools[addr]; ok {
+			b.instances = appendInstance(b.instances, addr)
+			logutil.BgLogger().Info("backend instance is online again", zap.String("namespace", b.ns), zap.String("addr", addr))
+			return nil
+		}
+	}
+	if _, ok := b.connPools[addr]; ok {
+		return ErrBackendExists
+	}
+
+	connPool := b.newConnPool(addr)
+	if err := connPool.Init(); err != nil {
+		return err
+	}
+	b.connPools[addr] = connPool
+	b.instances = appendInstance(b.instances, addr)
+	metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventInstanceAdded).Inc()
+	logutil.BgLogger().Info("backend instance added", zap.String("namespace", b.ns), zap.String("addr", addr))
+	return nil
+}
+
+// RemoveInstance removes an instance from routing and closes its conn pool at once.
+// The borrowed conns are closed when they are put back.
+func (b *BackendImpl) RemoveInstance(addr string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.checkManualChangeLocked(); err != nil {
+		return err
+	}
+
+	connPool, ok := b.connPools[addr]
+	if !ok {
+		return ErrBackendNotFound
+	}
+	if _, ok := b.draining[addr]; !ok && len(b.instances) <= 1 {
+		return ErrLastBackend
+	}
+
+	b.instances = removeInstance(b.instances, addr)
+	b.removeConnPool(addr, connPool)
+	return nil
+}
+
+// DrainInstance stops routing to an instance, while the in-flight transactions on it go on.
+// The conn pool is closed once all the borrowed conns are put back.
+func (b *BackendImpl) DrainInstance(addr string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.checkManualChangeLocked(); err != nil {
+		return err
+	}
+
+	connPool, ok := b.connPools[addr]
+	if !ok {
+		return ErrBackendNotFound
+	}
+	if _, ok := b.draining[addr]; ok {
+		return nil
+	}
+	if len(b.instances) <= 1 {
+		return ErrLastBackend
+	}
+
+	b.draining[addr] = struct{}{}
+	b.instances = removeInstance(b.instances, addr)
+	metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventInstanceDraining).Inc()
+	logutil.BgLogger().Info("backend instance draining", zap.String("namespace", b.ns), zap.String("addr", addr))
+	go b.waitForDrained(addr, connPool)
+	return nil
+}
+
+// GetInstanceStatus returns the status of all instances, including the draining ones.
+func (b *BackendImpl) GetInstanceStatus() []*InstanceStatus {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	ret := make([]*InstanceStatus, 0, len(b.connPools))
+	for addr, connPool := range b.connPools {
+		status := InstanceStatusOnline
+		if _, ok := b.draining[addr]; ok {
+			status = InstanceStatusDraining
+		}
+		ret = append(ret, &InstanceStatus{Addr: addr, Status: status, InUse: connPool.InUse()})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Addr < ret[j].Addr
+	})
+	return ret
+}
+
+// waitForDrained closes the conn pool once it is idle, unless the instance is online again or removed.
+func (b *BackendImpl) waitForDrained(addr string, connPool *ConnPool) {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.lock.Lock()
+		_, isDraining := b.draining[addr]
+		if b.closed.Get() || !isDraining || b.connPools[addr] != connPool {
+			b.lock.Unlock()
+			return
+		}
+		if connPool.InUse() == 0 {
+			delete(b.draining, addr)
+			delete(b.connPools, addr)
+			b.lock.Unlock()
+			closeConnPool(addr, connPool)
+			metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventInstanceDrained).Inc()
+			logutil.BgLogger().Info("backend instance drained", zap.String("namespace", b.ns), zap.String("addr", addr))
+			return
+		}
+		b.lock.Unlock()
+	}
+}
+
+// removeConnPool must be called with lock held.
+func (b *BackendImpl) removeConnPool(addr string, connPool *ConnPool) {
+	delete(b.connPools, addr)
+	// a draining instance added back later gets a new conn pool
+	delete(b.draining, addr)
+	// closing conn pool waits for the borrowed conns to be put back, so do not block here
+	go closeConnPool(addr, connPool)
+	metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventInstanceRemoved).Inc()
+	logutil.BgLogger().Info("backend instance removed", zap.String("namespace", b.ns), zap.String("addr", addr))
+}
+
+// GetInstances returns the addresses of current instances.
+func (b *BackendImpl) GetInstances() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	addrs := make([]string, 0, len(b.instances))
+	for _, instance := range b.instances {
+		addrs = append(addrs, instance.Addr())
+	}
+	return addrs
+}
+
 func (b *BackendImpl) GetConn(ctx context.Context) (driver.SimpleBackendConn, error) {
 	if b.closed.Get() {
 		return nil, ErrBackendClosed
 	}
 
+	b.lock.RLock()
 	instance, err := b.route(b.instances)
+	b.lock.RUnlock()
 	if err != nil {
 		return nil, err
 	}
@@ -139,12 +497,12 @@ func (b *BackendImpl) GetPooledConn(ctx context.Context) (driver.PooledBackendCo
 		return nil, ErrBackendClosed
 	}
 
+	b.lock.RLock()
 	instance, err := b.route(b.instances)
 	if err != nil {
+		b.lock.RUnlock()
 		return nil, err
 	}
-
-	b.lock.RLock()
 	connPool, ok := b.connPools[instance.Addr()]
 	b.lock.RUnlock()
 	if !ok {
@@ -160,20 +518,27 @@ func (b *BackendImpl) Close() {
 		return
 	}
 
+	if b.discoveryCancel != nil {
+		b.discoveryCancel()
+		b.cfg.Discovery.Close()
+	}
+
 	b.lock.Lock()
-	defer b.lock.Unlock()
+	connPools := b.connPools
+	b.connPools = make(map[string]*ConnPool)
+	b.lock.Unlock()
 
-	for addr, connPool := range b.connPools {
-		if err := connPool.Close(); err != nil {
-			logutil.BgLogger().Error("close conn pool error, addr: %s, err: %v", zap.String("addr", addr), zap.Error(err))
+	// closing conn pool waits for the borrowed conns to be put back, so close them without lock and do not block here
+	go func() {
+		for addr, connPool := range connPools {
+			closeConnPool(addr, connPool)
 		}
-	}
-
-	metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventClosed).Inc()
+		metrics.BackendEventCounter.WithLabelValues(b.ns, metrics.BackendEventClosed).Inc()
+	}()
 }
 
 func (b *BackendImpl) route(instances []*Instance) (*Instance, error) {
-	instance, err := b.selector.Select(b.instances)
+	instance, err := b.selector.Select(instances)
 	if err != nil {
 		return nil, err
 	}
@@ -181,13 +546,40 @@ func (b *BackendImpl) route(instances []*Instance) (*Instance, error) {
 	return instance, nil
 }
 
-func createInstances(cfg *BackendConfig) ([]*Instance, error) {
-	if len(cfg.Addrs) == 0 {
+// closeConnPool closes the idle conns at once, and the borrowed conns when they are put back,
+// so the sessions on the removed instance are drained gracefully.
+func closeConnPool(addr string, connPool *ConnPool) {
+	if err := connPool.Close(); err != nil {
+		logutil.BgLogger().Error("close conn pool error", zap.String("addr", addr), zap.Error(err))
+		return
+	}
+	logutil.BgLogger().Info("backend conn pool drained", zap.String("addr", addr))
+}
+
+// appendInstance and removeInstance return a new slice, since instances is copy on write.
+func appendInstance(instances []*Instance, addr string) []*Instance {
+	ret := make([]*Instance, 0, len(instances)+1)
+	ret = append(ret, instances...)
+	return append(ret, &Instance{addr: addr})
+}
+
+func removeInstance(instances []*Instance, addr string) []*Instance {
+	ret := make([]*Instance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.Addr() != addr {
+			ret = append(ret, instance)
+		}
+	}
+	return ret
+}
+
+func createInstances(addrs map[string]struct{}) ([]*Instance, error) {
+	if len(addrs) == 0 {
 		return nil, ErrNoBackendAddr
 	}
 
 	var ret []*Instance
-	for addr := range cfg.Addrs {
+	for addr := range addrs {
 		ins := &Instance{addr: addr}
 		ret = append(ret, ins)
 	}
@@ -0,0 +1,203 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/util/pool"
+)
+
+type fakeResource struct{}
+
+func (r *fakeResource) Close() {}
+
+func createTestBackend(t *testing.T, addrs ...string) *BackendImpl {
+	addrSet := make(map[string]struct{})
+	for _, addr := range addrs {
+		addrSet[addr] = struct{}{}
+	}
+	b := NewBackendImpl("test_ns", &BackendConfig{
+		Addrs:        addrSet,
+		Capacity:     1,
+		SelectorType: SelectorTypeRandom,
+	})
+	require.NoError(t, b.Init())
+	return b
+}
+
+func getInstanceStatus(b *BackendImpl, addr string) (*InstanceStatus, bool) {
+	for _, status := range b.GetInstanceStatus() {
+		if status.Addr == addr {
+			return status, true
+		}
+	}
+	return nil, false
+}
+
+func TestBackendImpl_AddAndRemoveInstance(t *testing.T) {
+	b := createTestBackend(t, "127.0.0.1:4000")
+	defer b.Close()
+
+	require.Equal(t, ErrLastBackend, b.RemoveInstance("127.0.0.1:4000"))
+	require.Equal(t, ErrBackendNotFound, b.RemoveInstance("127.0.0.1:4001"))
+
+	require.NoError(t, b.AddInstance("127.0.0.1:4001"))
+	require.Equal(t, ErrBackendExists, b.AddInstance("127.0.0.1:4001"))
+	require.ElementsMatch(t, []string{"127.0.0.1:4000", "127.0.0.1:4001"}, b.GetInstances())
+
+	require.NoError(t, b.RemoveInstance("127.0.0.1:4000"))
+	require.Equal(t, []string{"127.0.0.1:4001"}, b.GetInstances())
+	_, ok := getInstanceStatus(b, "127.0.0.1:4000")
+	require.False(t, ok)
+}
+
+func TestBackendImpl_DrainInstance(t *testing.T) {
+	b := createTestBackend(t, "127.0.0.1:4000", "127.0.0.1:4001")
+	defer b.Close()
+
+	// borrow a conn to simulate an in-flight transaction
+	b.lock.Lock()
+	connPool := b.connPools["127.0.0.1:4000"]
+	connPool.pool = pool.NewResourcePool(func(context.Context) (pool.Resource, error) {
+		return &fakeResource{}, nil
+	}, 1, 1, 0, 0, nil)
+	b.lock.Unlock()
+	rs, err := connPool.pool.Get(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, b.DrainInstance("127.0.0.1:4000"))
+	require.Equal(t, ErrLastBackend, b.DrainInstance("127.0.0.1:4001"))
+	require.Equal(t, []string{"127.0.0.1:4001"}, b.GetInstances())
+
+	time.Sleep(3 * drainCheckInterval)
+	status, ok := getInstanceStatus(b, "127.0.0.1:4000")
+	require.True(t, ok)
+	require.Equal(t, InstanceStatusDraining, status.Status)
+	require.Equal(t, int64(1), status.InUse)
+
+	connPool.pool.Put(rs)
+	require.Eventually(t, func() bool {
+		_, ok := getInstanceStatus(b, "127.0.0.1:4000")
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"127.0.0.1:4001"}, b.GetInstances())
+}
+
+func TestBackendImpl_AddDrainingInstance(t *testing.T) {
+	b := createTestBackend(t, "127.0.0.1:4000", "127.0.0.1:4001")
+	defer b.Close()
+
+	b.lock.Lock()
+	connPool := b.connPools["127.0.0.1:4000"]
+	connPool.pool = pool.NewResourcePool(func(context.Context) (pool.Resource, error) {
+		return &fakeResource{}, nil
+	}, 1, 1, 0, 0, nil)
+	b.lock.Unlock()
+	rs, err := connPool.pool.Get(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, b.DrainInstance("127.0.0.1:4000"))
+	require.NoError(t, b.AddInstance("127.0.0.1:4000"))
+	connPool.pool.Put(rs)
+
+	time.Sleep(3 * drainCheckInterval)
+	status, ok := getInstanceStatus(b, "127.0.0.1:4000")
+	require.True(t, ok)
+	require.Equal(t, InstanceStatusOnline, status.Status)
+	require.ElementsMatch(t, []string{"127.0.0.1:4000", "127.0.0.1:4001"}, b.GetInstances())
+}
+
+func TestBackendImpl_RemoveDrainingInstance(t *testing.T) {
+	b := createTestBackend(t, "127.0.0.1:4000", "127.0.0.1:4001")
+	defer b.Close()
+
+	b.lock.Lock()
+	connPool := b.connPools["127.0.0.1:4000"]
+	connPool.pool = pool.NewResourcePool(func(context.Context) (pool.Resource, error) {
+		return &fakeResource{}, nil
+	}, 1, 1, 0, 0, nil)
+	b.lock.Unlock()
+	rs, err := connPool.pool.Get(context.Background())
+	require.NoError(t, err)
+	defer connPool.pool.Put(rs)
+
+	// the draining instance is removed from the config, and then added back
+	require.NoError(t, b.DrainInstance("127.0.0.1:4000"))
+	cfg := *b.cfg
+	cfg.Addrs = map[string]struct{}{"127.0.0.1:4001": {}}
+	require.NoError(t, b.UpdateConfig(&cfg))
+	_, ok := getInstanceStatus(b, "127.0.0.1:4000")
+	require.False(t, ok)
+
+	require.NoError(t, b.AddInstance("127.0.0.1:4000"))
+	status, ok := getInstanceStatus(b, "127.0.0.1:4000")
+	require.True(t, ok)
+	require.Equal(t, InstanceStatusOnline, status.Status)
+	b.lock.RLock()
+	require.NotSame(t, connPool, b.connPools["127.0.0.1:4000"])
+	b.lock.RUnlock()
+
+	// the same with the config updated
+	require.NoError(t, b.DrainInstance("127.0.0.1:4000"))
+	require.NoError(t, b.UpdateConfig(&cfg))
+	cfg.Addrs = map[string]struct{}{"127.0.0.1:4000": {}, "127.0.0.1:4001": {}}
+	require.NoError(t, b.UpdateConfig(&cfg))
+	require.ElementsMatch(t, []string{"127.0.0.1:4000", "127.0.0.1:4001"}, b.GetInstances())
+}
+
+func TestBackendImpl_UpdateConfig(t *testing.T) {
+	b := createTestBackend(t, "127.0.0.1:4000", "127.0.0.1:4001")
+	defer b.Close()
+	b.lock.RLock()
+	unchangedPool := b.connPools["127.0.0.1:4001"]
+	b.lock.RUnlock()
+
+	cfg := *b.cfg
+	cfg.Capacity = 2
+	cfg.MaxWait = time.Second
+	cfg.Addrs = map[string]struct{}{"127.0.0.1:4001": {}, "127.0.0.1:4002": {}}
+	require.NoError(t, b.UpdateConfig(&cfg))
+	require.Equal(t, []string{"127.0.0.1:4001", "127.0.0.1:4002"}, b.GetInstances())
+
+	b.lock.RLock()
+	require.Same(t, unchangedPool, b.connPools["127.0.0.1:4001"])
+	require.Len(t, b.connPools, 2)
+	for _, connPool := range b.connPools {
+		require.Equal(t, 2, connPool.getConfig().Capacity)
+		require.Equal(t, time.Second, connPool.getConfig().MaxWait)
+	}
+	b.lock.RUnlock()
+	require.Eventually(t, func() bool {
+		return unchangedPool.pool.Capacity() == 2
+	}, time.Second, 10*time.Millisecond)
+
+	cfg.Password = "123456"
+	require.Equal(t, ErrNeedRebuild, b.UpdateConfig(&cfg))
+}
+
+func TestBackendImpl_CloseWithBorrowedConn(t *testing.T) {
+	b := createTestBackend(t, "127.0.0.1:4000")
+
+	b.lock.Lock()
+	connPool := b.connPools["127.0.0.1:4000"]
+	connPool.pool = pool.NewResourcePool(func(context.Context) (pool.Resource, error) {
+		return &fakeResource{}, nil
+	}, 1, 1, 0, 0, nil)
+	b.lock.Unlock()
+	rs, err := connPool.pool.Get(context.Background())
+	require.NoError(t, err)
+
+	// neither Close nor the readers wait for the borrowed conn
+	b.Close()
+	require.Equal(t, []string{"127.0.0.1:4000"}, b.GetInstances())
+	require.Len(t, b.GetInstanceStatus(), 0)
+	_, err = b.GetPooledConn(context.Background())
+	require.Equal(t, ErrBackendClosed, err)
+
+	connPool.pool.Put(rs)
+	require.Eventually(t, func() bool {
+		return connPool.pool.IsClosed()
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/pingcap/errors"
 	. "github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/packet"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
 )
 
 const defaultAuthPluginName = AUTH_NATIVE_PASSWORD
@@ -142,12 +143,18 @@ func (c *Conn) writeAuthHandshake() error {
 	}
 	// Adjust client capability flags based on server support
 	capability := CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONNECTION |
-		CLIENT_LONG_PASSWORD | CLIENT_TRANSACTIONS | CLIENT_PLUGIN_AUTH | c.capability&CLIENT_LONG_FLAG
+		CLIENT_LONG_PASSWORD | CLIENT_TRANSACTIONS | CLIENT_PLUGIN_AUTH | c.capability&CLIENT_LONG_FLAG |
+		c.capability&CLIENT_LOCAL_FILES
 
 	// To enable TLS / SSL
 	if c.tlsConfig != nil {
 		capability |= CLIENT_SSL
 	}
+	if c.useZstdCompression() {
+		capability |= compress.ClientZstdCompressionAlgorithm
+	} else if c.useCompression() {
+		capability |= CLIENT_COMPRESS
+	}
 
 	auth, addNull, err := c.genAuthResponse(c.salt)
 	if err != nil {
@@ -177,6 +184,10 @@ func (c *Conn) writeAuthHandshake() error {
 	if addNull {
 		length++
 	}
+	// zstd compression level
+	if c.useZstdCompression() {
+		length++
+	}
 	// db name
 	if len(c.db) > 0 {
 		capability |= CLIENT_CONNECT_WITH_DB
@@ -251,6 +262,12 @@ func (c *Conn) writeAuthHandshake() error {
 	// Assume native client during response
 	pos += copy(data[pos:], c.authPluginName)
 	data[pos] = 0x00
+	pos++
+
+	// zstd compression level [1 byte]
+	if c.useZstdCompression() {
+		data[pos] = byte(c.zstdLevel)
+	}
 
 	return c.WritePacket(data)
 }
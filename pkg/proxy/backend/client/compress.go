@@ -0,0 +1,77 @@
+package client
+
+import (
+	"bufio"
+	"net"
+
+	. "github.com/siddontang/go-mysql/mysql"
+	"github.com/siddontang/go-mysql/packet"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
+)
+
+// WithCompression requests the compressed protocol in the handshake, it is not used if the server does not support it.
+// stats observes the bytes before and after compression, it can be nil.
+func WithCompression(stats compress.Stats) func(*Conn) {
+	return func(c *Conn) {
+		c.compress = true
+		c.compressStats = stats
+	}
+}
+
+// WithZstdCompression is the same as WithCompression but requests zstd at level,
+// zlib is used if the server does not support zstd.
+func WithZstdCompression(level int, stats compress.Stats) func(*Conn) {
+	return func(c *Conn) {
+		c.compress = true
+		c.zstdLevel = level
+		c.compressStats = stats
+	}
+}
+
+// compressedConn replaces the reading and writing of the net.Conn, so that packet.Conn reads and writes
+// the packets inside the compressed packets. Every packet written is sent in a compressed packet.
+type compressedConn struct {
+	net.Conn
+	io *compress.IO
+}
+
+func (c *compressedConn) Read(p []byte) (int, error) {
+	return c.io.Read(p)
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	return c.io.Write(p)
+}
+
+// enableCompression is called after the handshake if the compressed protocol is negotiated.
+func (c *Conn) enableCompression() error {
+	conn := c.Conn.Conn
+	r := bufio.NewReaderSize(conn, 16*1024)
+	if c.useZstdCompression() {
+		compressed, err := compress.NewZstdIO(r, conn, c.zstdLevel, c.compressStats)
+		if err != nil {
+			return err
+		}
+		c.compressed = compressed
+	} else {
+		c.compressed = compress.NewIO(r, conn, c.compressStats)
+	}
+	// the decompressed packets are buffered by compress.IO, so the reader of packet.Conn needs no buffer.
+	c.Conn = packet.NewTLSConn(&compressedConn{Conn: conn, io: c.compressed})
+	return nil
+}
+
+func (c *Conn) ResetSequence() {
+	c.Conn.ResetSequence()
+	if c.compressed != nil {
+		c.compressed.ResetSequence()
+	}
+}
+
+func (c *Conn) useCompression() bool {
+	return c.useZstdCompression() || c.compress && c.capability&CLIENT_COMPRESS > 0
+}
+
+func (c *Conn) useZstdCompression() bool {
+	return c.compress && c.zstdLevel > 0 && c.capability&compress.ClientZstdCompressionAlgorithm > 0
+}
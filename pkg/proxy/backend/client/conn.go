@@ -11,6 +11,12 @@ import (
 	. "github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/packet"
 	"github.com/tidb-incubator/weir/pkg/proxy/constant"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
+)
+
+const (
+	DefaultConnectTimeout = 10 * time.Second
 )
 
 type Conn struct {
@@ -25,6 +31,8 @@ type Conn struct {
 	capability uint32
 
 	status uint16
+	// warnings is the warning count of the last command.
+	warnings uint16
 
 	charset string
 
@@ -32,6 +40,13 @@ type Conn struct {
 	authPluginName string
 
 	connectionID uint32
+
+	stmts *stmtCache
+
+	compress      bool
+	zstdLevel     int // zstd is requested if it is set
+	compressStats compress.Stats
+	compressed    *compress.IO
 }
 
 func getNetProto(addr string) string {
@@ -45,15 +60,24 @@ func getNetProto(addr string) string {
 // Connect to a MySQL server, addr can be ip:port, or a unix socket domain like /var/sock.
 // Accepts a series of configuration functions as a variadic argument.
 func Connect(addr string, user string, password string, dbName string, options ...func(*Conn)) (*Conn, error) {
+	return ConnectWithTimeout(addr, user, password, dbName, DefaultConnectTimeout, options...)
+}
+
+// ConnectWithTimeout is the same as Connect, and the timeout covers both dial and handshake.
+func ConnectWithTimeout(addr string, user string, password string, dbName string, timeout time.Duration, options ...func(*Conn)) (*Conn, error) {
 	proto := getNetProto(addr)
 
 	c := new(Conn)
 
 	var err error
-	conn, err := net.DialTimeout(proto, addr, 10*time.Second)
+	conn, err := net.DialTimeout(proto, addr, timeout)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, errors.Trace(err)
+	}
 
 	if c.tlsConfig != nil {
 		c.Conn = packet.NewTLSConn(conn)
@@ -77,6 +101,10 @@ func Connect(addr string, user string, password string, dbName string, options .
 	if err = c.handshake(); err != nil {
 		return nil, errors.Trace(err)
 	}
+	if err = conn.SetDeadline(time.Time{}); err != nil {
+		c.Close()
+		return nil, errors.Trace(err)
+	}
 
 	return c, nil
 }
@@ -99,6 +127,13 @@ func (c *Conn) handshake() error {
 		return errors.Trace(err)
 	}
 
+	if c.useCompression() {
+		if err := c.enableCompression(); err != nil {
+			c.Close()
+			return errors.Trace(err)
+		}
+	}
+
 	return nil
 }
 
@@ -118,6 +153,19 @@ func (c *Conn) Ping() error {
 	return nil
 }
 
+// ResetConnection clears the session state with COM_RESET_CONNECTION.
+func (c *Conn) ResetConnection() error {
+	if err := c.writeCommand(COM_RESET_CONNECTION); err != nil {
+		return errors.Trace(err)
+	}
+
+	if _, err := c.readOK(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
 // UseSSL: use default SSL
 // pass to options when connect
 func (c *Conn) UseSSL(insecureSkipVerify bool) {
@@ -166,6 +214,43 @@ func (c *Conn) Execute(command string, args ...interface{}) (*Result, error) {
 	}
 }
 
+// ExecuteStream executes the query and passes the rows to w as they are read from the backend,
+// the returned result only contains the fields and status of the resultset.
+func (c *Conn) ExecuteStream(command string, w driver.ResultWriter) (*Result, error) {
+	if err := c.writeCommandStr(COM_QUERY, command); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return c.readResultStream(w)
+}
+
+// ExecuteLoadData executes LOAD DATA LOCAL INFILE, the file requested by the backend is read from r.
+func (c *Conn) ExecuteLoadData(command string, r driver.LocalFileReader) (*Result, error) {
+	if err := c.writeCommandStr(COM_QUERY, command); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	data, err := c.ReadPacket()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	switch data[0] {
+	case OK_HEADER:
+		return c.handleOKPacket(data)
+	case ERR_HEADER:
+		return nil, c.handleErrorPacket(data)
+	case LocalInFile_HEADER:
+	default:
+		return nil, ErrMalformPacket
+	}
+
+	if err = c.sendLocalFile(string(data[1:]), r); err != nil {
+		return nil, err
+	}
+	return c.readOK()
+}
+
 func (c *Conn) Begin() error {
 	_, err := c.exec("BEGIN")
 	return errors.Trace(err)
@@ -255,6 +340,11 @@ func (c *Conn) GetConnectionID() uint32 {
 	return c.connectionID
 }
 
+// GetWarnings returns the warning count of the last command.
+func (c *Conn) GetWarnings() uint16 {
+	return c.warnings
+}
+
 func (c *Conn) GetStatus() uint16 {
 	return c.status
 }
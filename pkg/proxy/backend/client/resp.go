@@ -11,6 +11,7 @@ import (
 	. "github.com/siddontang/go-mysql/mysql"
 	"github.com/siddontang/go-mysql/utils"
 	"github.com/siddontang/go/hack"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
 )
 
 func (c *Conn) readUntilEOF() (err error) {
@@ -52,8 +53,8 @@ func (c *Conn) handleOKPacket(data []byte) (*Result, error) {
 		pos += 2
 
 		//todo:strict_mode, check warnings as error
-		//Warnings := binary.LittleEndian.Uint16(data[pos:])
-		//pos += 2
+		c.warnings = binary.LittleEndian.Uint16(data[pos:])
+		pos += 2
 	} else if c.capability&CLIENT_TRANSACTIONS > 0 {
 		r.Status = binary.LittleEndian.Uint16(data[pos:])
 		c.status = r.Status
@@ -68,6 +69,7 @@ func (c *Conn) handleOKPacket(data []byte) (*Result, error) {
 
 func (c *Conn) handleErrorPacket(data []byte) error {
 	e := new(MyError)
+	c.warnings = 0
 
 	var pos = 1
 
@@ -309,8 +311,8 @@ func (c *Conn) readResultRows(result *Result, isBinary bool) (err error) {
 		// EOF Packet
 		if c.isEOFPacket(data) {
 			if c.capability&CLIENT_PROTOCOL_41 > 0 {
-				//result.Warnings = binary.LittleEndian.Uint16(data[1:])
 				//todo add strict_mode, warning will be treat as error
+				c.warnings = binary.LittleEndian.Uint16(data[1:])
 				result.Status = binary.LittleEndian.Uint16(data[3:])
 				c.status = result.Status
 			}
@@ -341,3 +343,112 @@ func (c *Conn) readResultRows(result *Result, isBinary bool) (err error) {
 
 	return nil
 }
+
+// readResultStream reads the result like readResult, but the rows are passed to w instead of buffered in the result.
+// The rows of text and binary protocol are passed as they are, so the protocol is not needed here.
+func (c *Conn) readResultStream(w driver.ResultWriter) (*Result, error) {
+	firstPkgBuf, err := c.ReadPacketReuseMem(utils.ByteSliceGet(16)[:0])
+	defer utils.ByteSlicePut(firstPkgBuf)
+
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if firstPkgBuf[0] == OK_HEADER {
+		return c.handleOKPacket(firstPkgBuf)
+	} else if firstPkgBuf[0] == ERR_HEADER {
+		return nil, c.handleErrorPacket(append([]byte{}, firstPkgBuf...))
+	} else if firstPkgBuf[0] == LocalInFile_HEADER {
+		// the file is only sent by ExecuteLoadData, finish the request with an empty file so that the conn can be reused.
+		if err := c.WritePacket(make([]byte, 4)); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if _, err := c.readOK(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return nil, ErrMalformPacket
+	}
+
+	count, _, n := LengthEncodedInt(firstPkgBuf)
+	if n-len(firstPkgBuf) != 0 {
+		return nil, ErrMalformPacket
+	}
+
+	result := &Result{
+		Resultset: NewResultset(int(count)),
+	}
+
+	if err := c.readResultColumns(result); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err := w.WriteColumns(result.Fields); err != nil {
+		return nil, c.abortCommand(err)
+	}
+
+	if err := c.readResultRowsStream(result, w); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (c *Conn) readResultRowsStream(result *Result, w driver.ResultWriter) (err error) {
+	var data []byte
+
+	for {
+		// the buffer is reused by each row, the writer should copy the row if it keeps it.
+		data, err = c.ReadPacketReuseMem(data[:0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		// EOF Packet
+		if c.isEOFPacket(data) {
+			if c.capability&CLIENT_PROTOCOL_41 > 0 {
+				c.warnings = binary.LittleEndian.Uint16(data[1:])
+				result.Status = binary.LittleEndian.Uint16(data[3:])
+				c.status = result.Status
+			}
+			return nil
+		}
+
+		if data[0] == ERR_HEADER {
+			return c.handleErrorPacket(append([]byte{}, data...))
+		}
+
+		if err = w.WriteRow(data); err != nil {
+			return c.abortCommand(err)
+		}
+	}
+}
+
+// abortCommand is called when the client side of a streamed command fails, such as writing the resultset
+// or reading the local file. The rest of the command is not exchanged with the backend,
+// so the conn is reported as bad and must not be reused.
+func (c *Conn) abortCommand(err error) error {
+	return errors.Wrapf(ErrBadConn, "abort command: %v", err)
+}
+
+// sendLocalFile reads the file requested by the backend from r and sends it to the backend,
+// an empty packet is sent at the end of the file.
+func (c *Conn) sendLocalFile(filename string, r driver.LocalFileReader) error {
+	if err := r.RequestFile(filename); err != nil {
+		return c.abortCommand(err)
+	}
+
+	buf := make([]byte, 4)
+	for {
+		data, err := r.ReadFilePacket()
+		if err != nil {
+			return c.abortCommand(err)
+		}
+		buf = append(buf[:4], data...)
+		if err = c.WritePacket(buf); err != nil {
+			return errors.Trace(err)
+		}
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
@@ -242,6 +242,22 @@ func (c *Conn) StmtExecuteForward(data []byte) (*Result, error) {
 	return c.readResult(true)
 }
 
+// StmtExecuteForwardStream is the same as StmtExecuteForward, except that the rows are passed to w as they are read.
+func (c *Conn) StmtExecuteForwardStream(data []byte, w driver.ResultWriter) (*Result, error) {
+	writeData := make([]byte, 4, len(data)+5)
+	writeData = append(writeData, COM_STMT_EXECUTE)
+	writeData = append(writeData, data...)
+	c.ResetSequence()
+
+	if err := c.WritePacket(writeData); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return c.readResultStream(w)
+}
+
 func (c *Conn) StmtClosePrepare(stmtId int) error {
+	if c.stmts != nil {
+		c.stmts.remove(uint32(stmtId))
+	}
 	return c.writeCommandUint32(COM_STMT_CLOSE, uint32(stmtId))
 }
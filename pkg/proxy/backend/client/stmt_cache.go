@@ -0,0 +1,104 @@
+package client
+
+import (
+	"container/list"
+
+	"github.com/pingcap/errors"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+)
+
+const (
+	// DefaultStmtCacheCapacity is the max number of stmts prepared on a backend conn.
+	DefaultStmtCacheCapacity = 256
+)
+
+type stmtCacheKey struct {
+	db  string
+	sql string
+}
+
+// stmtCache is a LRU cache of the stmts prepared on a backend conn.
+// Prepared stmts are bound to the conn, so the cache lives and dies with the conn.
+type stmtCache struct {
+	capacity int
+	ll       *list.List
+	items    map[stmtCacheKey]*list.Element
+}
+
+type stmtCacheEntry struct {
+	key  stmtCacheKey
+	stmt *Stmt
+}
+
+func newStmtCache(capacity int) *stmtCache {
+	return &stmtCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[stmtCacheKey]*list.Element),
+	}
+}
+
+func (s *stmtCache) get(key stmtCacheKey) (*Stmt, bool) {
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(*stmtCacheEntry).stmt, true
+}
+
+// put adds the stmt to the cache, and returns the stmt evicted if the cache is full.
+func (s *stmtCache) put(key stmtCacheKey, stmt *Stmt) *Stmt {
+	if e, ok := s.items[key]; ok {
+		s.ll.MoveToFront(e)
+		e.Value.(*stmtCacheEntry).stmt = stmt
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&stmtCacheEntry{key: key, stmt: stmt})
+	if s.ll.Len() <= s.capacity {
+		return nil
+	}
+	oldest := s.ll.Back()
+	s.ll.Remove(oldest)
+	entry := oldest.Value.(*stmtCacheEntry)
+	delete(s.items, entry.key)
+	return entry.stmt
+}
+
+func (s *stmtCache) remove(stmtId uint32) {
+	for key, e := range s.items {
+		if e.Value.(*stmtCacheEntry).stmt.id == stmtId {
+			s.ll.Remove(e)
+			delete(s.items, key)
+			return
+		}
+	}
+}
+
+func (s *stmtCache) len() int {
+	return s.ll.Len()
+}
+
+// StmtPrepareCached returns the stmt of sql prepared in current db.
+// The stmt is prepared on the first call, and reused until it is evicted or the conn is closed.
+func (c *Conn) StmtPrepareCached(query string) (driver.Stmt, error) {
+	if c.stmts == nil {
+		c.stmts = newStmtCache(DefaultStmtCacheCapacity)
+	}
+
+	key := stmtCacheKey{db: c.db, sql: query}
+	if stmt, ok := c.stmts.get(key); ok {
+		return stmt, nil
+	}
+
+	stmt, err := c.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if evicted := c.stmts.put(key, stmt); evicted != nil {
+		if err := evicted.Close(); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return stmt, nil
+}
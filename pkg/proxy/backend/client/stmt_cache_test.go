@@ -0,0 +1,34 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStmtCache(t *testing.T) {
+	cache := newStmtCache(2)
+	key1 := stmtCacheKey{db: "db", sql: "select 1"}
+	key2 := stmtCacheKey{db: "db", sql: "select 2"}
+	key3 := stmtCacheKey{db: "db2", sql: "select 1"}
+
+	require.Nil(t, cache.put(key1, &Stmt{id: 1}))
+	require.Nil(t, cache.put(key2, &Stmt{id: 2}))
+
+	// key1 becomes the most recently used
+	stmt, ok := cache.get(key1)
+	require.True(t, ok)
+	require.Equal(t, 1, stmt.ID())
+
+	evicted := cache.put(key3, &Stmt{id: 3})
+	require.NotNil(t, evicted)
+	require.Equal(t, 2, evicted.ID())
+	_, ok = cache.get(key2)
+	require.False(t, ok)
+	require.Equal(t, 2, cache.len())
+
+	cache.remove(3)
+	_, ok = cache.get(key3)
+	require.False(t, ok)
+	require.Equal(t, 1, cache.len())
+}
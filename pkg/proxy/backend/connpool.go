@@ -3,13 +3,16 @@ package backend
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tidb-incubator/weir/pkg/proxy/backend/client"
 	"github.com/tidb-incubator/weir/pkg/proxy/constant"
 	"github.com/tidb-incubator/weir/pkg/proxy/driver"
 	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
 	"github.com/tidb-incubator/weir/pkg/util/pool"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/ast"
@@ -18,31 +21,69 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// the conns are recycled at a random time in [0.8, 1] * MaxLifetime, so that they do not expire at once.
+	maxLifetimeJitter = 0.2
+	warmUpTimeout     = 30 * time.Second
+	// the pool can be resized in place up to Capacity * poolMaxCapacityFactor
+	poolMaxCapacityFactor = 4
+	minIdleCheckInterval  = time.Second
+)
+
 type ConnPoolConfig struct {
 	Config
 	Capacity    int
 	IdleTimeout time.Duration
+	// MinIdle is the number of conns created at init, and kept by creating conns in the background
+	// when some fail to be re-created after idle timeout or recycle.
+	MinIdle int
+	// MaxLifetime is the max duration a conn is reused, 0 means no limit.
+	MaxLifetime time.Duration
+	// MaxWait is the max duration to wait for an available conn, 0 means waiting until ctx is done.
+	MaxWait time.Duration
 }
 
 type Config struct {
 	Addr     string
 	UserName string
 	Password string
+	// ConnectTimeout covers dial and handshake, client.DefaultConnectTimeout is used if it is 0.
+	ConnectTimeout time.Duration
+	// EnableCompression uses the compressed protocol if the backend supports it.
+	EnableCompression bool
+	// CompressionAlgorithm is CompressionZlib or CompressionZstd, CompressionZlib is used if it is empty.
+	CompressionAlgorithm string
 }
 
+// the algorithms of the compressed protocol, zlib is used if the backend does not support zstd.
+const (
+	CompressionZlib = "zlib"
+	CompressionZstd = "zstd"
+)
+
 type ConnPool struct {
-	ns   string
-	cfg  *ConnPoolConfig
-	pool *pool.ResourcePool
+	ns      string
+	cfg     *ConnPoolConfig // immutable, replaced as a whole by Reconfigure
+	cfgLock sync.RWMutex
+	pool    *pool.ResourcePool
+
+	// resizes are applied by a single goroutine, which always resizes to the latest capacity.
+	resizeLock  sync.Mutex
+	resizing    bool
+	resizeToCap int
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
 }
 
 type backendPooledConnWrapper struct {
 	*client.Conn
-	ns       string
-	addr     string
-	username string
-	pool     *pool.ResourcePool
-	sysvars  map[string]*ast.VariableAssignment
+	ns         string
+	addr       string
+	username   string
+	pool       *pool.ResourcePool
+	sysvars    map[string]*ast.VariableAssignment
+	expireTime time.Time // zero means never expire
 }
 
 // this struct is only used for fitting pool.Resource interface
@@ -52,8 +93,9 @@ type noErrorCloseConnWrapper struct {
 
 func NewConnPool(ns string, cfg *ConnPoolConfig) *ConnPool {
 	return &ConnPool{
-		ns:  ns,
-		cfg: cfg,
+		ns:      ns,
+		cfg:     cfg,
+		closeCh: make(chan struct{}),
 	}
 }
 
@@ -70,27 +112,53 @@ func newConnWrapper(pool *pool.ResourcePool, conn *client.Conn, ns, addr, userna
 
 func (c *ConnPool) Init() error {
 	connFactory := func(context.Context) (pool.Resource, error) {
-		// TODO: add connect timeout
-		conn, err := client.Connect(c.cfg.Addr, c.cfg.UserName, c.cfg.Password, "")
+		conn, err := c.connect()
 		if err != nil {
 			return nil, err
 		}
-		return &noErrorCloseConnWrapper{newConnWrapper(c.pool, conn, c.ns, c.cfg.Addr, c.cfg.UserName)}, nil
+		cfg := c.getConfig()
+		cw := newConnWrapper(c.pool, conn, c.ns, cfg.Addr, cfg.UserName)
+		cw.expireTime = c.nextExpireTime()
+		return &noErrorCloseConnWrapper{cw}, nil
+	}
+	logWait := func(start time.Time) {
+		metrics.BackendPoolWaitDurationHistogram.WithLabelValues(c.ns, c.getConfig().Addr).Observe(time.Since(start).Seconds())
 	}
 
-	c.pool = pool.NewResourcePool(connFactory, c.cfg.Capacity, c.cfg.Capacity, c.cfg.IdleTimeout, 0, nil)
+	c.pool = pool.NewResourcePool(connFactory, c.cfg.Capacity, c.cfg.Capacity*poolMaxCapacityFactor, c.cfg.IdleTimeout, 0, logWait)
+	// Init is called with the backend lock held, so the conns are created in the background.
+	go c.warmUp()
+	go c.keepMinIdle()
 	return nil
 }
 
 func (c *ConnPool) GetConn(ctx context.Context) (driver.PooledBackendConn, error) {
-	rs, err := c.pool.Get(ctx)
+	cfg := c.getConfig()
+	waitCtx := ctx
+	if cfg.MaxWait > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, cfg.MaxWait)
+		defer cancel()
+	}
+	rs, err := c.pool.Get(waitCtx)
 	if err != nil {
+		if err == pool.ErrTimeout {
+			metrics.BackendPoolWaitTimeoutCounter.WithLabelValues(c.ns, cfg.Addr).Inc()
+		}
 		return nil, err
 	}
+	if c.pool.Available() <= 0 {
+		metrics.BackendPoolExhaustedCounter.WithLabelValues(c.ns, cfg.Addr).Inc()
+	}
 
-	recordCurrentBackendMetrics(c.ns, c.cfg.Addr, c.pool)
+	recordCurrentBackendMetrics(c.ns, cfg.Addr, c.pool)
 
 	conn := rs.(*noErrorCloseConnWrapper).backendPooledConnWrapper
+	if conn.isExpired() {
+		if err := c.recycle(conn); err != nil {
+			return nil, errors.WithMessage(err, "recycle expired conn error")
+		}
+	}
 	if err := conn.syncSessionVariables(ctx); err != nil {
 		return nil, errors.WithMessage(err, "sync sysvar error")
 	}
@@ -98,7 +166,181 @@ func (c *ConnPool) GetConn(ctx context.Context) (driver.PooledBackendConn, error
 	return conn, nil
 }
 
+// Reconfigure applies the pool size, idle timeout and the other options in place.
+// It returns false if the pool can not be changed in place and should be replaced,
+// i.e. the credentials or the compression are changed or the capacity exceeds the max capacity.
+func (c *ConnPool) Reconfigure(cfg *ConnPoolConfig) bool {
+	c.cfgLock.Lock()
+	defer c.cfgLock.Unlock()
+	old := c.cfg
+	if cfg.Addr != old.Addr || cfg.UserName != old.UserName || cfg.Password != old.Password ||
+		cfg.EnableCompression != old.EnableCompression || cfg.CompressionAlgorithm != old.CompressionAlgorithm {
+		return false
+	}
+	if cfg.Capacity > int(c.pool.MaxCap()) {
+		return false
+	}
+	// the idle timer is only created when the pool is created with idle timeout
+	if cfg.IdleTimeout != old.IdleTimeout && old.IdleTimeout == 0 {
+		return false
+	}
+
+	if cfg.IdleTimeout != old.IdleTimeout {
+		c.pool.SetIdleTimeout(cfg.IdleTimeout)
+	}
+	if cfg.Capacity != old.Capacity {
+		c.resize(cfg.Capacity)
+	}
+	newCfg := *cfg
+	c.cfg = &newCfg
+	return true
+}
+
+// resize sets the capacity in the background, since shrinking waits for the borrowed conns to be put back.
+func (c *ConnPool) resize(capacity int) {
+	c.resizeLock.Lock()
+	defer c.resizeLock.Unlock()
+	c.resizeToCap = capacity
+	if !c.resizing {
+		c.resizing = true
+		go c.resizeLoop()
+	}
+}
+
+func (c *ConnPool) resizeLoop() {
+	for {
+		c.resizeLock.Lock()
+		capacity := c.resizeToCap
+		if int64(capacity) == c.pool.Capacity() {
+			c.resizing = false
+			c.resizeLock.Unlock()
+			return
+		}
+		c.resizeLock.Unlock()
+
+		if err := c.pool.SetCapacity(capacity); err != nil {
+			logutil.BgLogger().Warn("resize conn pool error", zap.String("namespace", c.ns),
+				zap.String("addr", c.getConfig().Addr), zap.Int("capacity", capacity), zap.Error(err))
+			c.resizeLock.Lock()
+			c.resizing = false
+			c.resizeLock.Unlock()
+			return
+		}
+	}
+}
+
+func (c *ConnPool) getConfig() *ConnPoolConfig {
+	c.cfgLock.RLock()
+	defer c.cfgLock.RUnlock()
+	return c.cfg
+}
+
+func (c *ConnPool) connect() (*client.Conn, error) {
+	cfg := c.getConfig()
+	timeout := cfg.ConnectTimeout
+	if timeout <= 0 {
+		timeout = client.DefaultConnectTimeout
+	}
+	var options []func(*client.Conn)
+	if cfg.EnableCompression {
+		if cfg.CompressionAlgorithm == CompressionZstd {
+			options = append(options, client.WithZstdCompression(compress.DefaultZstdLevel, c.observeCompression))
+		} else {
+			options = append(options, client.WithCompression(c.observeCompression))
+		}
+	}
+	return client.ConnectWithTimeout(cfg.Addr, cfg.UserName, cfg.Password, "", timeout, options...)
+}
+
+func (c *ConnPool) observeCompression(uncompressed, compressed int) {
+	metrics.BackendCompressionBytesCounter.WithLabelValues(c.ns, metrics.CompressionUncompressed).Add(float64(uncompressed))
+	metrics.BackendCompressionBytesCounter.WithLabelValues(c.ns, metrics.CompressionCompressed).Add(float64(compressed))
+}
+
+// warmUp creates MinIdle conns and puts them back, failures are ignored since the conns are created lazily.
+func (c *ConnPool) warmUp() {
+	cfg := c.getConfig()
+	minIdle := cfg.MinIdle
+	if minIdle > cfg.Capacity {
+		minIdle = cfg.Capacity
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+	defer cancel()
+	resources := make([]pool.Resource, 0, minIdle)
+	for i := 0; i < minIdle; i++ {
+		rs, err := c.pool.Get(ctx)
+		if err != nil {
+			logutil.BgLogger().Warn("warm up conn pool error", zap.String("namespace", c.ns),
+				zap.String("addr", cfg.Addr), zap.Int("created", len(resources)), zap.Error(err))
+			break
+		}
+		resources = append(resources, rs)
+	}
+	for _, rs := range resources {
+		c.pool.Put(rs)
+	}
+}
+
+// keepMinIdle warms up the pool again if the created conns are less than MinIdle. The pool re-creates
+// the conns closed by idle timeout or recycle at once, but the ones failed to be re-created,
+// e.g. when the backend restarts, are only created when they are borrowed.
+func (c *ConnPool) keepMinIdle() {
+	ticker := time.NewTicker(minIdleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-ticker.C:
+		}
+		cfg := c.getConfig()
+		minIdle := cfg.MinIdle
+		if minIdle > cfg.Capacity {
+			minIdle = cfg.Capacity
+		}
+		if minIdle > 0 && c.pool.Active() < int64(minIdle) {
+			c.warmUp()
+		}
+	}
+}
+
+// recycle replaces the underlying conn of the expired conn in place. If it fails, the conn is put back with ErrorClose.
+func (c *ConnPool) recycle(cw *backendPooledConnWrapper) error {
+	if err := cw.Conn.Close(); err != nil {
+		logutil.BgLogger().Debug("close expired backend conn error", zap.String("addr", cw.addr), zap.Error(err))
+	}
+	conn, err := c.connect()
+	if err != nil {
+		cw.pool.Put(nil)
+		recordCurrentBackendMetrics(cw.ns, cw.addr, cw.pool)
+		return err
+	}
+	cw.Conn = conn
+	cw.sysvars = make(map[string]*ast.VariableAssignment)
+	cw.expireTime = c.nextExpireTime()
+	metrics.BackendEventCounter.WithLabelValues(c.ns, metrics.BackendEventConnRecycled).Inc()
+	return nil
+}
+
+func (c *ConnPool) nextExpireTime() time.Time {
+	maxLifetime := c.getConfig().MaxLifetime
+	if maxLifetime <= 0 {
+		return time.Time{}
+	}
+	jitter := time.Duration(rand.Int63n(int64(float64(maxLifetime)*maxLifetimeJitter) + 1))
+	return time.Now().Add(maxLifetime - jitter)
+}
+
+// InUse returns the number of borrowed conns.
+func (c *ConnPool) InUse() int64 {
+	return c.pool.InUse()
+}
+
 func (c *ConnPool) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+	})
 	c.pool.Close()
 	return nil
 }
@@ -122,6 +364,10 @@ func (cw *backendPooledConnWrapper) ErrorClose() error {
 	return nil
 }
 
+func (cw *backendPooledConnWrapper) isExpired() bool {
+	return !cw.expireTime.IsZero() && time.Now().After(cw.expireTime)
+}
+
 func (cw *backendPooledConnWrapper) Close() error {
 	return cw.Conn.Close()
 }
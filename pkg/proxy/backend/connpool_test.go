@@ -0,0 +1,264 @@
+package backend
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/siddontang/go-mysql/server"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/util/pool"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+)
+
+// startFakeServer starts a mysql server which accepts any query, and counts the accepted conns.
+func startFakeServer(t *testing.T, handshake bool) (string, *sync2.AtomicInt64, func()) {
+	return startRejectableFakeServer(t, handshake, &sync2.AtomicBool{})
+}
+
+// startRejectableFakeServer is the same as startFakeServer, but closes the new conns while reject is set.
+func startRejectableFakeServer(t *testing.T, handshake bool, reject *sync2.AtomicBool) (string, *sync2.AtomicInt64, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	accepted := &sync2.AtomicInt64{}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if reject.Get() {
+				c.Close()
+				continue
+			}
+			accepted.Add(1)
+			if !handshake {
+				continue
+			}
+			go func() {
+				conn, err := server.NewConn(c, "root", "", server.EmptyHandler{})
+				if err != nil {
+					return
+				}
+				for conn.HandleCommand() == nil {
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), accepted, func() { l.Close() }
+}
+
+func createTestConnPool(t *testing.T, addr string, fn func(cfg *ConnPoolConfig)) *ConnPool {
+	cfg := &ConnPoolConfig{
+		Config:   Config{Addr: addr, UserName: "root"},
+		Capacity: 2,
+	}
+	fn(cfg)
+	connPool := NewConnPool("test_ns", cfg)
+	require.NoError(t, connPool.Init())
+	return connPool
+}
+
+func TestConnPool_WarmUp(t *testing.T) {
+	addr, accepted, closeFn := startFakeServer(t, true)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.Capacity = 3
+		cfg.MinIdle = 2
+	})
+	defer connPool.Close()
+	require.Eventually(t, func() bool {
+		return connPool.pool.Active() == 2 && connPool.InUse() == 0
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(2), accepted.Get())
+}
+
+func TestConnPool_KeepMinIdle(t *testing.T) {
+	reject := &sync2.AtomicBool{}
+	addr, accepted, closeFn := startRejectableFakeServer(t, true, reject)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.MinIdle = 2
+	})
+	defer connPool.Close()
+	require.Eventually(t, func() bool {
+		return connPool.pool.Active() == 2 && connPool.InUse() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// the conn fails to be re-created while the backend is down
+	reject.Set(true)
+	conn, err := connPool.GetConn(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, conn.ErrorClose())
+	require.Equal(t, int64(1), connPool.pool.Active())
+
+	reject.Set(false)
+	require.Eventually(t, func() bool {
+		return connPool.pool.Active() == 2 && connPool.InUse() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(3), accepted.Get())
+}
+
+func TestConnPool_MaxLifetime(t *testing.T) {
+	addr, accepted, closeFn := startFakeServer(t, true)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.Capacity = 1
+		cfg.MaxLifetime = 100 * time.Millisecond
+	})
+	defer connPool.Close()
+
+	conn, err := connPool.GetConn(context.Background())
+	require.NoError(t, err)
+	conn.PutBack()
+	conn, err = connPool.GetConn(context.Background())
+	require.NoError(t, err)
+	conn.PutBack()
+	require.Equal(t, int64(1), accepted.Get())
+
+	time.Sleep(150 * time.Millisecond)
+	conn, err = connPool.GetConn(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, conn.Ping())
+	conn.PutBack()
+	require.Equal(t, int64(2), accepted.Get())
+	require.Equal(t, int64(1), connPool.pool.Active())
+}
+
+func TestConnPool_MaxWait(t *testing.T) {
+	addr, _, closeFn := startFakeServer(t, true)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.Capacity = 1
+		cfg.MaxWait = 50 * time.Millisecond
+	})
+	defer connPool.Close()
+
+	conn, err := connPool.GetConn(context.Background())
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = connPool.GetConn(context.Background())
+	require.Equal(t, pool.ErrTimeout, err)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	conn.PutBack()
+}
+
+func TestConnPool_ConnectTimeout(t *testing.T) {
+	// the server accepts conns but never sends handshake
+	addr, _, closeFn := startFakeServer(t, false)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.ConnectTimeout = 100 * time.Millisecond
+	})
+	defer connPool.Close()
+
+	start := time.Now()
+	_, err := connPool.GetConn(context.Background())
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestConnPool_Reconfigure(t *testing.T) {
+	addr, _, closeFn := startFakeServer(t, true)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.Capacity = 2
+		cfg.IdleTimeout = time.Minute
+	})
+	defer connPool.Close()
+
+	newCfg := *connPool.getConfig()
+	newCfg.Capacity = 4
+	newCfg.IdleTimeout = time.Hour
+	newCfg.MaxWait = time.Second
+	require.True(t, connPool.Reconfigure(&newCfg))
+	require.Eventually(t, func() bool {
+		return connPool.pool.Capacity() == 4
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, time.Hour, connPool.pool.IdleTimeout())
+	require.Equal(t, time.Second, connPool.getConfig().MaxWait)
+
+	// shrinking waits for the borrowed conns
+	conns := make([]driver.PooledBackendConn, 0, 4)
+	for i := 0; i < 4; i++ {
+		conn, err := connPool.GetConn(context.Background())
+		require.NoError(t, err)
+		conns = append(conns, conn)
+	}
+	newCfg.Capacity = 1
+	require.True(t, connPool.Reconfigure(&newCfg))
+	for _, conn := range conns {
+		conn.PutBack()
+	}
+	require.Eventually(t, func() bool {
+		return connPool.pool.Capacity() == 1 && connPool.pool.Active() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	exceedCfg := newCfg
+	exceedCfg.Capacity = 100
+	require.False(t, connPool.Reconfigure(&exceedCfg))
+	passwordCfg := newCfg
+	passwordCfg.Password = "123456"
+	require.False(t, connPool.Reconfigure(&passwordCfg))
+}
+
+func TestConnPool_ReconfigureTwice(t *testing.T) {
+	addr, _, closeFn := startFakeServer(t, true)
+	defer closeFn()
+
+	connPool := createTestConnPool(t, addr, func(cfg *ConnPoolConfig) {
+		cfg.Capacity = 4
+	})
+	defer connPool.Close()
+
+	// the first shrinking is blocked by the borrowed conns, and the pool ends with the latest capacity
+	conns := make([]driver.PooledBackendConn, 0, 4)
+	for i := 0; i < 4; i++ {
+		conn, err := connPool.GetConn(context.Background())
+		require.NoError(t, err)
+		conns = append(conns, conn)
+	}
+	newCfg := *connPool.getConfig()
+	newCfg.Capacity = 1
+	require.True(t, connPool.Reconfigure(&newCfg))
+	newCfg.Capacity = 3
+	require.True(t, connPool.Reconfigure(&newCfg))
+	for _, conn := range conns {
+		conn.PutBack()
+	}
+	require.Eventually(t, func() bool {
+		connPool.resizeLock.Lock()
+		defer connPool.resizeLock.Unlock()
+		return !connPool.resizing
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(3), connPool.pool.Capacity())
+	require.Equal(t, 3, connPool.getConfig().Capacity)
+
+	newCfg.Capacity = 2
+	require.True(t, connPool.Reconfigure(&newCfg))
+	newCfg.Capacity = 4
+	require.True(t, connPool.Reconfigure(&newCfg))
+	require.Eventually(t, func() bool {
+		connPool.resizeLock.Lock()
+		defer connPool.resizeLock.Unlock()
+		return !connPool.resizing
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(4), connPool.pool.Capacity())
+}
+
+func TestConnPool_ReconfigureIdleTimeout(t *testing.T) {
+	connPool := createTestConnPool(t, "127.0.0.1:4000", func(cfg *ConnPoolConfig) {})
+	defer connPool.Close()
+
+	newCfg := *connPool.getConfig()
+	newCfg.IdleTimeout = time.Minute
+	require.False(t, connPool.Reconfigure(&newCfg))
+}
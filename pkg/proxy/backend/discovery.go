@@ -0,0 +1,26 @@
+package backend
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	DiscoveryTypeStatic = "static"
+	DiscoveryTypePD     = "pd"
+	DiscoveryTypeDNS    = "dns"
+	DiscoveryTypeSRV    = "srv"
+)
+
+var (
+	ErrInvalidDiscoveryType = errors.New("invalid discovery type")
+)
+
+// Discovery discovers the backend instance addresses dynamically.
+type Discovery interface {
+	// GetInstances returns the current instance addresses.
+	GetInstances(ctx context.Context) ([]string, error)
+	// Watch calls onUpdate with the full instance addresses when they change, until ctx is done.
+	Watch(ctx context.Context, onUpdate func(addrs []string))
+	Close()
+}
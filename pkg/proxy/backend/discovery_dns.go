@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb/util/logutil"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDNSDiscoveryRefreshInterval = 10 * time.Second
+)
+
+// Resolver resolves the DNS records, *net.Resolver implements it.
+// It can be replaced by a local stand-in in tests.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSDiscovery discovers instances by re-resolving a DNS name on an interval,
+// such as the headless service of tidb pods in Kubernetes.
+// The A/AAAA records are used with the configured port, or the SRV records are used with their own ports.
+type DNSDiscovery struct {
+	resolver Resolver
+	name     string
+	port     int
+	srv      bool
+	interval time.Duration
+}
+
+func NewDNSDiscovery(resolver Resolver, name string, port int, interval time.Duration) *DNSDiscovery {
+	return newDNSDiscovery(resolver, name, port, false, interval)
+}
+
+func NewSRVDiscovery(resolver Resolver, name string, interval time.Duration) *DNSDiscovery {
+	return newDNSDiscovery(resolver, name, 0, true, interval)
+}
+
+func newDNSDiscovery(resolver Resolver, name string, port int, srv bool, interval time.Duration) *DNSDiscovery {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if interval <= 0 {
+		interval = defaultDNSDiscoveryRefreshInterval
+	}
+	return &DNSDiscovery{
+		resolver: resolver,
+		name:     name,
+		port:     port,
+		srv:      srv,
+		interval: interval,
+	}
+}
+
+// GetInstances returns the sorted and deduplicated addresses resolved from the name.
+func (d *DNSDiscovery) GetInstances(ctx context.Context) ([]string, error) {
+	addrSet := make(map[string]struct{})
+	if d.srv {
+		// lookup the name directly, e.g. _mysql._tcp.tidb-peer.tidb.svc
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			addrSet[net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))] = struct{}{}
+		}
+	} else {
+		hosts, err := d.resolver.LookupHost(ctx, d.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			addrSet[net.JoinHostPort(host, strconv.Itoa(d.port))] = struct{}{}
+		}
+	}
+
+	addrs := make([]string, 0, len(addrSet))
+	for addr := range addrSet {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func (d *DNSDiscovery) Watch(ctx context.Context, onUpdate func(addrs []string)) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	var lastAddrs []string
+	for {
+		addrs, err := d.GetInstances(ctx)
+		if err != nil {
+			logutil.BgLogger().Warn("resolve backend instances error", zap.String("name", d.name), zap.Error(err))
+		} else if !isStringSliceEqual(lastAddrs, addrs) {
+			onUpdate(addrs)
+			lastAddrs = addrs
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *DNSDiscovery) Close() {
+}
@@ -0,0 +1,97 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct {
+	lock  sync.Mutex
+	hosts []string
+	srvs  []*net.SRV
+	err   error
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.hosts, r.err
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return name, r.srvs, r.err
+}
+
+func (r *fakeResolver) set(hosts []string, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.hosts, r.err = hosts, err
+}
+
+func TestDNSDiscovery_GetInstances(t *testing.T) {
+	resolver := &fakeResolver{hosts: []string{"10.0.0.2", "10.0.0.1", "10.0.0.2"}}
+	discovery := NewDNSDiscovery(resolver, "tidb-peer", 4000, time.Second)
+	addrs, err := discovery.GetInstances(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:4000", "10.0.0.2:4000"}, addrs)
+
+	resolver.set(nil, errors.New("no such host"))
+	_, err = discovery.GetInstances(context.Background())
+	require.Error(t, err)
+}
+
+func TestSRVDiscovery_GetInstances(t *testing.T) {
+	resolver := &fakeResolver{srvs: []*net.SRV{
+		{Target: "tidb-1.tidb-peer.svc.", Port: 4000},
+		{Target: "tidb-0.tidb-peer.svc.", Port: 4000},
+	}}
+	discovery := NewSRVDiscovery(resolver, "_mysql._tcp.tidb-peer.svc", time.Second)
+	addrs, err := discovery.GetInstances(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"tidb-0.tidb-peer.svc:4000", "tidb-1.tidb-peer.svc:4000"}, addrs)
+}
+
+func TestBackendImpl_DNSDiscovery(t *testing.T) {
+	resolver := &fakeResolver{hosts: []string{"127.0.0.1", "127.0.0.2"}}
+	cfg := &BackendConfig{
+		Capacity:     1,
+		SelectorType: SelectorTypeRandom,
+		Discovery:    NewDNSDiscovery(resolver, "tidb-peer", 4000, 10*time.Millisecond),
+	}
+	b := NewBackendImpl("test_ns", cfg)
+	require.NoError(t, b.Init())
+	defer b.Close()
+	require.ElementsMatch(t, []string{"127.0.0.1:4000", "127.0.0.2:4000"}, b.GetInstances())
+
+	resolver.set([]string{"127.0.0.2", "127.0.0.3"}, nil)
+	require.Eventually(t, func() bool {
+		addrs := b.GetInstances()
+		return len(addrs) == 2 && addrs[0] == "127.0.0.2:4000" && addrs[1] == "127.0.0.3:4000"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// resolve error and empty result keep the current instances
+	resolver.set(nil, errors.New("no such host"))
+	time.Sleep(50 * time.Millisecond)
+	resolver.set(nil, nil)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, []string{"127.0.0.2:4000", "127.0.0.3:4000"}, b.GetInstances())
+
+	b.lock.RLock()
+	_, ok := b.connPools["127.0.0.1:4000"]
+	require.False(t, ok)
+	require.Len(t, b.connPools, 2)
+	b.lock.RUnlock()
+
+	// the discovered instances can not be changed by hand
+	require.Equal(t, ErrDiscoveryEnabled, b.AddInstance("127.0.0.1:4000"))
+	require.Equal(t, ErrDiscoveryEnabled, b.RemoveInstance("127.0.0.2:4000"))
+	require.Equal(t, ErrDiscoveryEnabled, b.DrainInstance("127.0.0.2:4000"))
+}
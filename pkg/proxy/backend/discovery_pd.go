@@ -0,0 +1,150 @@
+package backend
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	"go.etcd.io/etcd/clientv3"
+	"go.uber.org/zap"
+)
+
+const (
+	// tidb-server registers its topology to PD etcd with the keys:
+	// /topology/tidb/<addr>/info: the server info, without lease
+	// /topology/tidb/<addr>/ttl: the alive timestamp, kept alive by a lease
+	tidbTopologyPrefix = "/topology/tidb/"
+	tidbTopologyInfo   = "info"
+	tidbTopologyTTL    = "ttl"
+
+	pdDiscoveryDialTimeout   = 3 * time.Second
+	pdDiscoveryRetryInterval = 3 * time.Second
+)
+
+// PDDiscovery discovers alive tidb-servers from the topology keys in PD etcd.
+type PDDiscovery struct {
+	etcdClient *clientv3.Client
+}
+
+func CreatePDDiscovery(pdAddrs []string) (*PDDiscovery, error) {
+	etcdClient, err := clientv3.New(clientv3.Config{
+		Endpoints:   pdAddrs,
+		DialTimeout: pdDiscoveryDialTimeout,
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "create pd etcd client error")
+	}
+	return NewPDDiscovery(etcdClient), nil
+}
+
+func NewPDDiscovery(etcdClient *clientv3.Client) *PDDiscovery {
+	return &PDDiscovery{
+		etcdClient: etcdClient,
+	}
+}
+
+func (d *PDDiscovery) GetInstances(ctx context.Context) ([]string, error) {
+	addrs, _, err := d.getInstances(ctx)
+	return addrs, err
+}
+
+func (d *PDDiscovery) Watch(ctx context.Context, onUpdate func(addrs []string)) {
+	var lastAddrs []string
+	for {
+		addrs, revision, err := d.getInstances(ctx)
+		if err != nil {
+			logutil.BgLogger().Warn("get tidb topology error", zap.Error(err))
+		} else {
+			if !isStringSliceEqual(lastAddrs, addrs) {
+				onUpdate(addrs)
+				lastAddrs = addrs
+			}
+			// block until the topology is changed, then get the full topology again
+			d.waitForChange(ctx, revision+1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pdDiscoveryRetryInterval):
+			}
+		}
+	}
+}
+
+func (d *PDDiscovery) Close() {
+	if err := d.etcdClient.Close(); err != nil {
+		logutil.BgLogger().Error("close pd etcd client error", zap.Error(err))
+	}
+}
+
+func (d *PDDiscovery) waitForChange(ctx context.Context, revision int64) {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchCh := d.etcdClient.Watch(watchCtx, tidbTopologyPrefix, clientv3.WithPrefix(), clientv3.WithRev(revision))
+	for resp := range watchCh {
+		if resp.Err() != nil {
+			logutil.BgLogger().Warn("watch tidb topology error", zap.Error(resp.Err()))
+			return
+		}
+		if len(resp.Events) > 0 {
+			return
+		}
+	}
+}
+
+// getInstances returns the sorted addresses of the tidb-servers which have both info and ttl keys,
+// and the etcd revision of the result.
+func (d *PDDiscovery) getInstances(ctx context.Context) ([]string, int64, error) {
+	resp, err := d.etcdClient.Get(ctx, tidbTopologyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	infos := make(map[string]struct{})
+	ttls := make(map[string]struct{})
+	for _, kv := range resp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), tidbTopologyPrefix)
+		idx := strings.LastIndex(key, "/")
+		if idx <= 0 {
+			continue
+		}
+		addr, suffix := key[:idx], key[idx+1:]
+		switch suffix {
+		case tidbTopologyInfo:
+			infos[addr] = struct{}{}
+		case tidbTopologyTTL:
+			ttls[addr] = struct{}{}
+		}
+	}
+
+	var addrs []string
+	for addr := range infos {
+		if _, ok := ttls[addr]; ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, resp.Header.Revision, nil
+}
+
+func isStringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
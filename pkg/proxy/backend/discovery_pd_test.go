@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/etcdtest"
+	"go.etcd.io/etcd/clientv3"
+)
+
+func TestMain(m *testing.M) {
+	metrics.RegisterProxyMetrics("test_cluster")
+	os.Exit(m.Run())
+}
+
+func putTiDBTopology(t *testing.T, client *clientv3.Client, addr string, alive bool) {
+	ctx := context.Background()
+	_, err := client.Put(ctx, tidbTopologyPrefix+addr+"/info", `{"version":"5.0.0"}`)
+	require.NoError(t, err)
+	if alive {
+		_, err = client.Put(ctx, tidbTopologyPrefix+addr+"/ttl", fmt.Sprint(time.Now().UnixNano()))
+		require.NoError(t, err)
+	}
+}
+
+func TestPDDiscovery_GetInstances(t *testing.T) {
+	_, client, closeFn := etcdtest.StartEmbedEtcd(t)
+	defer closeFn()
+
+	putTiDBTopology(t, client, "127.0.0.1:4000", true)
+	putTiDBTopology(t, client, "127.0.0.1:4001", true)
+	putTiDBTopology(t, client, "127.0.0.1:4002", false)
+
+	discovery := NewPDDiscovery(client)
+	addrs, err := discovery.GetInstances(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1:4000", "127.0.0.1:4001"}, addrs)
+}
+
+func TestBackendImpl_PDDiscovery(t *testing.T) {
+	_, client, closeFn := etcdtest.StartEmbedEtcd(t)
+	defer closeFn()
+
+	putTiDBTopology(t, client, "127.0.0.1:4000", true)
+	putTiDBTopology(t, client, "127.0.0.1:4001", true)
+
+	cfg := &BackendConfig{
+		Capacity:     1,
+		SelectorType: SelectorTypeRandom,
+		Discovery:    NewPDDiscovery(client),
+	}
+	b := NewBackendImpl("test_ns", cfg)
+	require.NoError(t, b.Init())
+	defer b.Close()
+	require.ElementsMatch(t, []string{"127.0.0.1:4000", "127.0.0.1:4001"}, b.GetInstances())
+
+	putTiDBTopology(t, client, "127.0.0.1:4002", true)
+	require.Eventually(t, func() bool {
+		return len(b.GetInstances()) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err := client.Delete(context.Background(), tidbTopologyPrefix+"127.0.0.1:4000/ttl")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		addrs := b.GetInstances()
+		return len(addrs) == 2 && addrs[0] == "127.0.0.1:4001" && addrs[1] == "127.0.0.1:4002"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	b.lock.RLock()
+	_, ok := b.connPools["127.0.0.1:4000"]
+	require.False(t, ok)
+	require.Len(t, b.connPools, 2)
+	b.lock.RUnlock()
+}
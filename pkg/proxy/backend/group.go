@@ -0,0 +1,365 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/rand2"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("backend group not found")
+	ErrGroupRequired  = errors.New("backend group is required")
+	ErrInvalidWeights = errors.New("invalid backend group weights")
+)
+
+// GroupConfig is a backend group, which is a cluster with its own instances.
+type GroupConfig struct {
+	Name    string
+	Weight  int
+	Backend *BackendConfig
+}
+
+// GroupBackend splits the traffic between several backend groups by weight. A backend conn is borrowed
+// at the start of a transaction or an autocommit statement, so a session moves to another group
+// only at the transaction boundary, and the new weights take effect at the next boundary of each session.
+type GroupBackend struct {
+	ns     string
+	groups []*backendGroup // immutable, in the order of config
+	// weights is a []int in the order of groups, copied on write so that the groups are selected without lock.
+	weights     atomic.Value
+	weightsLock sync.Mutex // serializes the updates of weights
+	// cfgWeights are the weights in the config, guarded by weightsLock. The weights set by SetWeights
+	// are kept by UpdateGroups unless the weights in the config are changed.
+	cfgWeights []int
+	rd         *rand2.Rand
+	closed     sync2.AtomicBool
+}
+
+type backendGroup struct {
+	name    string
+	backend *BackendImpl
+}
+
+func NewGroupBackend(ns string, cfgs []*GroupConfig) *GroupBackend {
+	b := &GroupBackend{
+		ns:     ns,
+		rd:     rand2.New(rand.NewSource(time.Now().UnixNano())),
+		closed: sync2.NewAtomicBool(false),
+	}
+	weights := make([]int, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		b.groups = append(b.groups, &backendGroup{name: cfg.Name, backend: NewBackendImpl(ns, cfg.Backend)})
+		weights = append(weights, cfg.Weight)
+	}
+	b.cfgWeights = weights
+	b.storeWeights(weights)
+	return b
+}
+
+// Init inits the backends of all groups, the inited ones are closed if any of them fails.
+func (b *GroupBackend) Init() error {
+	for i, g := range b.groups {
+		if err := g.backend.Init(); err != nil {
+			for _, inited := range b.groups[:i] {
+				inited.backend.Close()
+			}
+			// the discoveries of the groups not inited are closed here, the inited ones are closed with the backend.
+			for _, rest := range b.groups[i:] {
+				if rest.backend.cfg.Discovery != nil {
+					rest.backend.cfg.Discovery.Close()
+				}
+			}
+			return errors.WithMessage(err, fmt.Sprintf("init backend group %s error", g.name))
+		}
+	}
+	return nil
+}
+
+func (b *GroupBackend) storeWeights(weights []int) {
+	b.weights.Store(weights)
+	for i, g := range b.groups {
+		metrics.BackendGroupWeightGauge.WithLabelValues(b.ns, g.name).Set(float64(weights[i]))
+	}
+}
+
+func (b *GroupBackend) loadWeights() []int {
+	return b.weights.Load().([]int)
+}
+
+// GetWeights returns the current weights of the groups.
+func (b *GroupBackend) GetWeights() map[string]int {
+	weights := b.loadWeights()
+	ret := make(map[string]int, len(b.groups))
+	for i, g := range b.groups {
+		ret[g.name] = weights[i]
+	}
+	return ret
+}
+
+// SetWeights updates the weights of the groups in place, the groups not in weights are not changed.
+func (b *GroupBackend) SetWeights(weights map[string]int) error {
+	if b.closed.Get() {
+		return ErrBackendClosed
+	}
+	for name, weight := range weights {
+		if _, ok := b.getGroup(name); !ok {
+			return errors.WithMessage(ErrGroupNotFound, name)
+		}
+		if weight < 0 {
+			return errors.WithMessage(ErrInvalidWeights, fmt.Sprintf("weight of %s is negative", name))
+		}
+	}
+
+	b.weightsLock.Lock()
+	defer b.weightsLock.Unlock()
+	newWeights := append([]int(nil), b.loadWeights()...)
+	totalWeight := 0
+	for i, g := range b.groups {
+		if weight, ok := weights[g.name]; ok {
+			newWeights[i] = weight
+		}
+		totalWeight += newWeights[i]
+	}
+	if totalWeight == 0 {
+		return errors.WithMessage(ErrInvalidWeights, "total weight is 0")
+	}
+	b.storeWeights(newWeights)
+	logutil.BgLogger().Info("backend group weights updated", zap.String("namespace", b.ns), zap.Any("weights", b.GetWeights()))
+	return nil
+}
+
+// GetGroup returns the backend of a group, so that its instances can be changed.
+func (b *GroupBackend) GetGroup(name string) (*BackendImpl, error) {
+	g, ok := b.getGroup(name)
+	if !ok {
+		return nil, ErrGroupNotFound
+	}
+	return g.backend, nil
+}
+
+func (b *GroupBackend) getGroup(name string) (*backendGroup, bool) {
+	for _, g := range b.groups {
+		if g.name == name {
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+// selectGroup selects a group randomly by weight.
+func (b *GroupBackend) selectGroup() (*backendGroup, error) {
+	weights := b.loadWeights()
+	totalWeight := 0
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return nil, ErrNoInstanceToSelect
+	}
+	n := int(b.rd.Int63n(int64(totalWeight)))
+	for i, weight := range weights {
+		if n < weight {
+			return b.groups[i], nil
+		}
+		n -= weight
+	}
+	return b.groups[len(b.groups)-1], nil
+}
+
+func (b *GroupBackend) GetPooledConn(ctx context.Context) (driver.PooledBackendConn, error) {
+	if b.closed.Get() {
+		return nil, ErrBackendClosed
+	}
+	g, err := b.selectGroup()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := g.backend.GetPooledConn(ctx)
+	if err != nil {
+		metrics.BackendGroupQueryCounter.WithLabelValues(b.ns, g.name, metrics.LblError).Inc()
+		return nil, err
+	}
+	return &groupConn{PooledBackendConn: conn, ns: b.ns, group: g.name}, nil
+}
+
+// AddInstance requires a group, call it on the backend returned by GetGroup instead.
+func (b *GroupBackend) AddInstance(addr string) error {
+	return ErrGroupRequired
+}
+
+// RemoveInstance removes the instance from the group it belongs to.
+func (b *GroupBackend) RemoveInstance(addr string) error {
+	g, ok := b.groupOfInstance(addr)
+	if !ok {
+		return ErrBackendNotFound
+	}
+	return g.backend.RemoveInstance(addr)
+}
+
+// DrainInstance drains the instance in the group it belongs to,
+// a whole group is drained by setting its weight to 0.
+func (b *GroupBackend) DrainInstance(addr string) error {
+	g, ok := b.groupOfInstance(addr)
+	if !ok {
+		return ErrBackendNotFound
+	}
+	return g.backend.DrainInstance(addr)
+}
+
+func (b *GroupBackend) groupOfInstance(addr string) (*backendGroup, bool) {
+	for _, g := range b.groups {
+		g.backend.lock.RLock()
+		_, ok := g.backend.connPools[addr]
+		g.backend.lock.RUnlock()
+		if ok {
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+func (b *GroupBackend) GetInstanceStatus() []*InstanceStatus {
+	var ret []*InstanceStatus
+	for _, g := range b.groups {
+		for _, status := range g.backend.GetInstanceStatus() {
+			status.Group = g.name
+			ret = append(ret, status)
+		}
+	}
+	return ret
+}
+
+// UpdateConfig returns ErrNeedRebuild, since the groups are updated by UpdateGroups.
+func (b *GroupBackend) UpdateConfig(cfg *BackendConfig) error {
+	return ErrNeedRebuild
+}
+
+// UpdateGroups applies the new config of the groups in place. The weights are reset to the config only if
+// the weights in the config are changed, so that the weights set by SetWeights survive the reloads of other options.
+// It returns ErrNeedRebuild if the groups are added, removed or reordered.
+// The configs are checked before any group is updated, so no group is updated if it returns an error.
+func (b *GroupBackend) UpdateGroups(cfgs []*GroupConfig) error {
+	if b.closed.Get() {
+		return ErrBackendClosed
+	}
+	if len(cfgs) != len(b.groups) {
+		return ErrNeedRebuild
+	}
+	for i, cfg := range cfgs {
+		if cfg.Name != b.groups[i].name {
+			return ErrNeedRebuild
+		}
+	}
+
+	for i, cfg := range cfgs {
+		if err := b.groups[i].backend.checkConfig(cfg.Backend); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("update backend group %s error", cfg.Name))
+		}
+	}
+
+	b.weightsLock.Lock()
+	defer b.weightsLock.Unlock()
+	weights := make([]int, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		// it fails only if the backend is closed concurrently.
+		if err := b.groups[i].backend.UpdateConfig(cfg.Backend); err != nil {
+			return errors.WithMessage(err, fmt.Sprintf("update backend group %s error", cfg.Name))
+		}
+		weights = append(weights, cfg.Weight)
+	}
+	if !equalWeights(weights, b.cfgWeights) {
+		b.cfgWeights = weights
+		b.storeWeights(weights)
+	}
+	return nil
+}
+
+func equalWeights(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *GroupBackend) Close() {
+	if !b.closed.CompareAndSwap(false, true) {
+		return
+	}
+	for _, g := range b.groups {
+		g.backend.Close()
+		metrics.BackendGroupWeightGauge.DeleteLabelValues(b.ns, g.name)
+	}
+}
+
+// groupConn records the result and latency of the statements for each group,
+// so that the error rates of the groups can be compared.
+type groupConn struct {
+	driver.PooledBackendConn
+	ns    string
+	group string
+}
+
+func (c *groupConn) observe(startTime time.Time, err error) {
+	metrics.BackendGroupQueryCounter.WithLabelValues(c.ns, c.group, metrics.RetLabel(err)).Inc()
+	metrics.BackendGroupQueryDurationHistogram.WithLabelValues(c.ns, c.group).Observe(time.Since(startTime).Seconds())
+}
+
+func (c *groupConn) Execute(command string, args ...interface{}) (*gomysql.Result, error) {
+	startTime := time.Now()
+	ret, err := c.PooledBackendConn.Execute(command, args...)
+	c.observe(startTime, err)
+	return ret, err
+}
+
+func (c *groupConn) StmtExecuteForward(data []byte) (*gomysql.Result, error) {
+	startTime := time.Now()
+	ret, err := c.PooledBackendConn.StmtExecuteForward(data)
+	c.observe(startTime, err)
+	return ret, err
+}
+
+func (c *groupConn) ExecuteStream(command string, w driver.ResultWriter) (*gomysql.Result, error) {
+	startTime := time.Now()
+	ret, err := c.PooledBackendConn.ExecuteStream(command, w)
+	c.observe(startTime, err)
+	return ret, err
+}
+
+func (c *groupConn) StmtExecuteForwardStream(data []byte, w driver.ResultWriter) (*gomysql.Result, error) {
+	startTime := time.Now()
+	ret, err := c.PooledBackendConn.StmtExecuteForwardStream(data, w)
+	c.observe(startTime, err)
+	return ret, err
+}
+
+func (c *groupConn) ExecuteLoadData(command string, r driver.LocalFileReader) (*gomysql.Result, error) {
+	startTime := time.Now()
+	ret, err := c.PooledBackendConn.ExecuteLoadData(command, r)
+	c.observe(startTime, err)
+	return ret, err
+}
+
+// Close closes the underlying conn, which is used to cut off the borrowed conns of a closing namespace.
+func (c *groupConn) Close() error {
+	if closer, ok := c.PooledBackendConn.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
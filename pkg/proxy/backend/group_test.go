@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestGroupBackend(t *testing.T) *GroupBackend {
+	newCfg := func(addrs ...string) *BackendConfig {
+		addrSet := make(map[string]struct{})
+		for _, addr := range addrs {
+			addrSet[addr] = struct{}{}
+		}
+		return &BackendConfig{Addrs: addrSet, Capacity: 1, SelectorType: SelectorTypeRandom}
+	}
+	b := NewGroupBackend("test_ns", []*GroupConfig{
+		{Name: "old", Weight: 100, Backend: newCfg("127.0.0.1:4000", "127.0.0.1:4001")},
+		{Name: "new", Weight: 0, Backend: newCfg("127.0.0.1:5000")},
+	})
+	require.NoError(t, b.Init())
+	return b
+}
+
+func TestGroupBackend_SelectGroup(t *testing.T) {
+	b := createTestGroupBackend(t)
+	defer b.Close()
+
+	for i := 0; i < 100; i++ {
+		g, err := b.selectGroup()
+		require.NoError(t, err)
+		require.Equal(t, "old", g.name)
+	}
+
+	require.NoError(t, b.SetWeights(map[string]int{"old": 0, "new": 1}))
+	for i := 0; i < 100; i++ {
+		g, err := b.selectGroup()
+		require.NoError(t, err)
+		require.Equal(t, "new", g.name)
+	}
+
+	require.NoError(t, b.SetWeights(map[string]int{"old": 1}))
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		g, err := b.selectGroup()
+		require.NoError(t, err)
+		counts[g.name]++
+	}
+	require.InDelta(t, 500, counts["old"], 150)
+	require.Equal(t, map[string]int{"old": 1, "new": 1}, b.GetWeights())
+}
+
+func TestGroupBackend_SetWeights(t *testing.T) {
+	b := createTestGroupBackend(t)
+	defer b.Close()
+
+	require.Equal(t, ErrGroupNotFound, errors.Cause(b.SetWeights(map[string]int{"unknown": 1})))
+	require.Equal(t, ErrInvalidWeights, errors.Cause(b.SetWeights(map[string]int{"new": -1})))
+	require.Equal(t, ErrInvalidWeights, errors.Cause(b.SetWeights(map[string]int{"old": 0})))
+	// the weights are not changed by the failed updates
+	require.Equal(t, map[string]int{"old": 100, "new": 0}, b.GetWeights())
+}
+
+func TestGroupBackend_Instances(t *testing.T) {
+	b := createTestGroupBackend(t)
+	defer b.Close()
+
+	require.Equal(t, ErrGroupRequired, b.AddInstance("127.0.0.1:5001"))
+	newGroup, err := b.GetGroup("new")
+	require.NoError(t, err)
+	require.NoError(t, newGroup.AddInstance("127.0.0.1:5001"))
+	_, err = b.GetGroup("unknown")
+	require.Equal(t, ErrGroupNotFound, err)
+
+	require.NoError(t, b.RemoveInstance("127.0.0.1:5001"))
+	require.NoError(t, b.RemoveInstance("127.0.0.1:4001"))
+	require.Equal(t, ErrLastBackend, b.DrainInstance("127.0.0.1:4000"))
+	require.Equal(t, ErrBackendNotFound, b.DrainInstance("127.0.0.1:6000"))
+
+	groups := make(map[string]string)
+	for _, status := range b.GetInstanceStatus() {
+		groups[status.Addr] = status.Group
+	}
+	require.Equal(t, map[string]string{"127.0.0.1:4000": "old", "127.0.0.1:5000": "new"}, groups)
+}
+
+func TestGroupBackend_UpdateGroups(t *testing.T) {
+	b := createTestGroupBackend(t)
+	defer b.Close()
+
+	oldGroup, err := b.GetGroup("old")
+	require.NoError(t, err)
+	oldCfg := *oldGroup.cfg
+	newGroup, err := b.GetGroup("new")
+	require.NoError(t, err)
+	newCfg := *newGroup.cfg
+	newCfg.Addrs = map[string]struct{}{"127.0.0.1:5001": {}}
+
+	require.Equal(t, ErrNeedRebuild, b.UpdateGroups([]*GroupConfig{{Name: "old", Weight: 1, Backend: &oldCfg}}))
+	require.Equal(t, ErrNeedRebuild, b.UpdateGroups([]*GroupConfig{
+		{Name: "new", Weight: 1, Backend: &newCfg},
+		{Name: "old", Weight: 1, Backend: &oldCfg},
+	}))
+
+	require.NoError(t, b.UpdateGroups([]*GroupConfig{
+		{Name: "old", Weight: 50, Backend: &oldCfg},
+		{Name: "new", Weight: 50, Backend: &newCfg},
+	}))
+	require.Equal(t, map[string]int{"old": 50, "new": 50}, b.GetWeights())
+	require.Equal(t, []string{"127.0.0.1:5001"}, newGroup.GetInstances())
+	require.Equal(t, ErrNeedRebuild, b.UpdateConfig(&oldCfg))
+
+	// the weights set by API are kept if the weights in the config are not changed.
+	require.NoError(t, b.SetWeights(map[string]int{"old": 10, "new": 90}))
+	newCfg.Capacity = 2
+	require.NoError(t, b.UpdateGroups([]*GroupConfig{
+		{Name: "old", Weight: 50, Backend: &oldCfg},
+		{Name: "new", Weight: 50, Backend: &newCfg},
+	}))
+	require.Equal(t, map[string]int{"old": 10, "new": 90}, b.GetWeights())
+	require.Equal(t, 2, newGroup.cfg.Capacity)
+	require.NoError(t, b.UpdateGroups([]*GroupConfig{
+		{Name: "old", Weight: 0, Backend: &oldCfg},
+		{Name: "new", Weight: 100, Backend: &newCfg},
+	}))
+	require.Equal(t, map[string]int{"old": 0, "new": 100}, b.GetWeights())
+
+	// no group is updated if any group fails.
+	updatedCfg := oldCfg
+	updatedCfg.Capacity = 2
+	badCfg := newCfg
+	badCfg.Password = "changed"
+	require.Equal(t, ErrNeedRebuild, errors.Cause(b.UpdateGroups([]*GroupConfig{
+		{Name: "old", Weight: 50, Backend: &updatedCfg},
+		{Name: "new", Weight: 50, Backend: &badCfg},
+	})))
+	require.Equal(t, 1, oldGroup.cfg.Capacity)
+	require.Equal(t, map[string]int{"old": 0, "new": 100}, b.GetWeights())
+}
@@ -3,3 +3,9 @@ package constant
 const ContextKeyPrefix = "__w_"
 
 const ContextKeySessionVariable = ContextKeyPrefix + "session_sysvars"
+
+const ContextKeyResultWriter = ContextKeyPrefix + "result_writer"
+
+const ContextKeyLocalFileReader = ContextKeyPrefix + "local_file_reader"
+
+const ContextKeyReadLastInsertID = ContextKeyPrefix + "read_last_insert_id"
@@ -3,12 +3,17 @@ package driver
 import (
 	"context"
 	"database/sql/driver"
+	"fmt"
 	"sync"
+	"sync/atomic"
 
+	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb/util/logutil"
 	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
 	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	wast "github.com/tidb-incubator/weir/pkg/util/ast"
 	utilerrors "github.com/tidb-incubator/weir/pkg/util/errors"
 	"go.uber.org/zap"
 )
@@ -16,25 +21,69 @@ import (
 type BackendConnManager struct {
 	fsm   *FSM
 	state FSMState
+	// sharedState is a copy of state, which can be read by other goroutines without waiting for the running command.
+	sharedState int32
 
 	ns Namespace
 
 	mu      sync.Mutex
 	txnConn PooledBackendConn
 
-	// TODO: use stmt id set
-	isPrepared bool
+	// stmts are prepared by the client, they are prepared on the backend conns on demand,
+	// so that the session does not hold a backend conn after prepare.
+	stmts      map[int]*proxyStmt
+	lastStmtId uint32
+
+	// lastInsertID is the last auto increment id of the session. The INSERT and the statement reading
+	// LAST_INSERT_ID() may run on different pooled conns, so it is restored on the conn before the reading statement.
+	lastInsertID uint64
+	// warnings are read from the pooled conn which executes the last statement before the conn is put back,
+	// since SHOW WARNINGS only sees the diagnostics of the conn it runs on.
+	warnings []backendWarning
+	// rowCount and foundRows are ROW_COUNT() and FOUND_ROWS() of the last statement, which are kept in the conn
+	// executing it, so the bare SELECT reading them is answered by proxy if the session has no attached conn.
+	rowCount  int64
+	foundRows uint64
+}
+
+// rowCountResultWriter counts the rows streamed to the client for FOUND_ROWS().
+type rowCountResultWriter struct {
+	ResultWriter
+	rows uint64
+}
+
+func (w *rowCountResultWriter) WriteRow(data []byte) error {
+	w.rows++
+	return w.ResultWriter.WriteRow(data)
+}
+
+// backendWarning is a row of SHOW WARNINGS.
+type backendWarning struct {
+	level   string
+	code    uint64
+	message string
 }
 
 func NewBackendConnManager(fsm *FSM, ns Namespace) *BackendConnManager {
 	return &BackendConnManager{
-		fsm:        fsm,
-		state:      stateInitial,
-		ns:         ns,
-		isPrepared: false,
+		fsm:         fsm,
+		state:       stateInitial,
+		sharedState: int32(stateInitial),
+		ns:          ns,
+		stmts:       make(map[int]*proxyStmt),
 	}
 }
 
+func (f *BackendConnManager) setState(state FSMState) {
+	f.state = state
+	atomic.StoreInt32(&f.sharedState, int32(state))
+}
+
+// IsInTransaction reports whether the session is in a transaction, it does not wait for the running command.
+func (f *BackendConnManager) IsInTransaction() bool {
+	return FSMState(atomic.LoadInt32(&f.sharedState)).IsInTransaction()
+}
+
 func (f *BackendConnManager) MergeStatus(svw *SessionVarsWrapper) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -47,11 +96,20 @@ func (f *BackendConnManager) Query(ctx context.Context, db, sql string) (*gomysq
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	ctx, counter := withRowCounter(ctx)
 	ret, err := f.fsm.Call(ctx, EventQuery, f, db, sql)
 	if err != nil {
+		// the attached conn is broken in the middle of a command, such as an aborted LOAD DATA LOCAL INFILE,
+		// so it can not be used any more, and the transaction and session state on it are lost.
+		if f.txnConn != nil && isConnError(err) {
+			f.discardAttachedConn()
+		}
 		return nil, err
 	}
-	return ret.(*gomysql.Result), nil
+	result := ret.(*gomysql.Result)
+	f.recordInsertID(result)
+	f.recordRowCounts(result, counter)
+	return result, nil
 }
 
 func (f *BackendConnManager) SetAutoCommit(ctx context.Context, autocommit bool) error {
@@ -98,6 +156,7 @@ func (f *BackendConnManager) StmtExecuteForward(ctx context.Context, stmtId int,
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	ctx, counter := withRowCounter(ctx)
 	ret, err := f.fsm.Call(ctx, EventStmtForwardData, f, stmtId, data)
 	if err != nil {
 		return nil, err
@@ -105,7 +164,10 @@ func (f *BackendConnManager) StmtExecuteForward(ctx context.Context, stmtId int,
 	if ret == nil {
 		return nil, nil
 	}
-	return ret.(*gomysql.Result), nil
+	result := ret.(*gomysql.Result)
+	f.recordInsertID(result)
+	f.recordRowCounts(result, counter)
+	return result, nil
 }
 
 func (f *BackendConnManager) StmtClose(ctx context.Context, stmtId int) error {
@@ -116,17 +178,162 @@ func (f *BackendConnManager) StmtClose(ctx context.Context, stmtId int) error {
 	return err
 }
 
+// Pin attaches a backend conn to the session until the session is reset or closed,
+// since the statement depends on the state of backend conn.
+func (f *BackendConnManager) Pin(ctx context.Context, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// the lock of lock read is released at the end of transaction, the attached conn is enough
+	if reason == wast.PinReasonLockRead && f.state.IsInTransaction() {
+		return nil
+	}
+	if f.state.IsPinned() {
+		return nil
+	}
+
+	if _, err := f.fsm.Call(ctx, EventPin, f); err != nil {
+		return err
+	}
+	metrics.QueryCtxPinnedConnGauge.WithLabelValues(f.ns.Name()).Inc()
+	logutil.BgLogger().Debug("session pinned to backend conn", zap.String("namespace", f.ns.Name()), zap.String("reason", reason))
+	return nil
+}
+
+// ResetSession clears the session state. The attached conn is closed rather than put back,
+// since the state on it, such as transaction, locks and variables, can not be cleared reliably.
+func (f *BackendConnManager) ResetSession(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reset()
+	return nil
+}
+
 // TODO(eastfisher): is it possible to use FSM to manage close?
 func (f *BackendConnManager) Close() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	f.reset()
+	return nil
+}
+
+func (f *BackendConnManager) reset() {
+	f.discardAttachedConn()
+	f.stmts = make(map[int]*proxyStmt)
+	f.lastInsertID = 0
+	f.warnings = nil
+	f.rowCount = 0
+	f.foundRows = 0
+}
+
+// LastWarnings returns the warnings of the last statement executed on a pooled conn.
+// It returns false if the session has an attached conn, where SHOW WARNINGS is executed as usual.
+func (f *BackendConnManager) LastWarnings() ([]backendWarning, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.txnConn != nil {
+		return nil, false
+	}
+	return f.warnings, true
+}
+
+// ReadRowCounts returns ROW_COUNT() and FOUND_ROWS() of the last statement for the bare SELECT reading them,
+// which becomes the last statement. It returns false if the session has an attached conn, where the SELECT
+// is executed as usual.
+func (f *BackendConnManager) ReadRowCounts() (int64, uint64, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.txnConn != nil {
+		return 0, 0, false
+	}
+	rowCount, foundRows := f.rowCount, f.foundRows
+	f.rowCount, f.foundRows = -1, 1
+	return rowCount, foundRows, true
+}
+
+// withRowCounter counts the streamed rows if the resultset is streamed to the client.
+func withRowCounter(ctx context.Context) (context.Context, *rowCountResultWriter) {
+	w, ok := getResultWriter(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	counter := &rowCountResultWriter{ResultWriter: w}
+	return context.WithValue(ctx, constant.ContextKeyResultWriter, counter), counter
+}
+
+// recordRowCounts keeps ROW_COUNT() and FOUND_ROWS() the same as MySQL, ROW_COUNT() is -1 for a resultset,
+// and FOUND_ROWS() is kept for the statements without a resultset.
+func (f *BackendConnManager) recordRowCounts(result *gomysql.Result, counter *rowCountResultWriter) {
+	if result.Resultset == nil {
+		f.rowCount = int64(result.AffectedRows)
+		return
+	}
+	f.rowCount = -1
+	f.foundRows = uint64(len(result.RowDatas))
+	if counter != nil {
+		f.foundRows += counter.rows
+	}
+}
+
+func (f *BackendConnManager) recordInsertID(result *gomysql.Result) {
+	if result.InsertId != 0 {
+		f.lastInsertID = result.InsertId
+	}
+}
+
+// restoreLastInsertID sets LAST_INSERT_ID() of the conn to the one of the session if the statement reads it.
+func (f *BackendConnManager) restoreLastInsertID(ctx context.Context, conn BackendConn) error {
+	if read, _ := ctx.Value(constant.ContextKeyReadLastInsertID).(bool); !read {
+		return nil
+	}
+	_, err := conn.Execute(fmt.Sprintf("SELECT LAST_INSERT_ID(%d)", f.lastInsertID))
+	return err
+}
+
+// recordWarnings keeps the warnings of the statement executed on the pooled conn.
+// SHOW WARNINGS is only executed if the statement has warnings, and the error of the statement is kept as is.
+func (f *BackendConnManager) recordWarnings(conn BackendConn, err error) {
+	f.warnings = nil
+	if err != nil {
+		if myErr, ok := errors.Cause(err).(*gomysql.MyError); ok {
+			f.warnings = []backendWarning{{level: "Error", code: uint64(myErr.Code), message: myErr.Message}}
+		}
+		return
+	}
+	if conn.GetWarnings() == 0 {
+		return
+	}
+
+	result, err := conn.Execute("SHOW WARNINGS")
+	if err != nil {
+		logutil.BgLogger().Warn("show warnings error", zap.String("namespace", f.ns.Name()), zap.Error(err))
+		return
+	}
+	warnings := make([]backendWarning, 0, result.RowNumber())
+	for i := 0; i < result.RowNumber(); i++ {
+		level, _ := result.GetString(i, 0)
+		code, _ := result.GetUint(i, 1)
+		message, _ := result.GetString(i, 2)
+		warnings = append(warnings, backendWarning{level: level, code: code, message: message})
+	}
+	f.warnings = warnings
+}
+
+// discardAttachedConn closes the attached conn and goes back to the initial state.
+// The stmts are kept since they are prepared lazily on the backend conns.
+func (f *BackendConnManager) discardAttachedConn() {
 	if f.txnConn != nil {
 		errClosePooledBackendConn(f.txnConn, f.ns.Name())
 	}
-	f.state = stateInitial
+	if f.state.IsPinned() {
+		metrics.QueryCtxPinnedConnGauge.WithLabelValues(f.ns.Name()).Dec()
+	}
+	f.setState(stateInitial)
 	f.unsetAttachedConn()
-	return nil
 }
 
 func (f *BackendConnManager) queryWithoutTxn(ctx context.Context, db, sql string) (*gomysql.Result, error) {
@@ -150,17 +357,42 @@ func (f *BackendConnManager) queryWithoutTxn(ctx context.Context, db, sql string
 	if err = conn.UseDB(db); err != nil {
 		return nil, err
 	}
+	if err = f.restoreLastInsertID(ctx, conn); err != nil {
+		return nil, err
+	}
 
 	var ret *gomysql.Result
-	ret, err = conn.Execute(sql)
+	ret, err = executeBackendQuery(ctx, conn, sql)
+	f.recordWarnings(conn, err)
 	return ret, err
 }
 
 func (f *BackendConnManager) queryInTxn(ctx context.Context, db, sql string) (*gomysql.Result, error) {
+	f.warnings = nil
 	if err := f.txnConn.UseDB(db); err != nil {
 		return nil, err
 	}
-	return f.txnConn.Execute(sql)
+	if err := f.restoreLastInsertID(ctx, f.txnConn); err != nil {
+		return nil, err
+	}
+	return executeBackendQuery(ctx, f.txnConn, sql)
+}
+
+// executeBackendQuery streams the resultset to the client if there is a ResultWriter in ctx,
+// the conn is not released until the last packet is read.
+func executeBackendQuery(ctx context.Context, conn BackendConn, sql string) (*gomysql.Result, error) {
+	if r, ok := ctx.Value(loadDataReaderKey{}).(LocalFileReader); ok {
+		return conn.ExecuteLoadData(sql, r)
+	}
+	if w, ok := getResultWriter(ctx); ok {
+		return conn.ExecuteStream(sql, w)
+	}
+	return conn.Execute(sql)
+}
+
+func getResultWriter(ctx context.Context) (ResultWriter, bool) {
+	w, ok := ctx.Value(constant.ContextKeyResultWriter).(ResultWriter)
+	return w, ok
 }
 
 func (f *BackendConnManager) releaseAttachedConn(err error) {
@@ -16,10 +16,10 @@ const (
 	State1 FSMState = 0x01 // Transaction |            |
 	State2 FSMState = 0x02 //   		  | AutoCommit |
 	State3 FSMState = 0x03 // Transaction | AutoCommit |
-	State4 FSMState = 0x04 //             |            | Prepare
-	State5 FSMState = 0x05 // Transaction |            | Prepare
-	State6 FSMState = 0x06 //             | AutoCommit | Prepare
-	State7 FSMState = 0x07 // Transaction | AutoCommit | Prepare
+	State4 FSMState = 0x04 //             |            | Pinned
+	State5 FSMState = 0x05 // Transaction |            | Pinned
+	State6 FSMState = 0x06 //             | AutoCommit | Pinned
+	State7 FSMState = 0x07 // Transaction | AutoCommit | Pinned
 
 	StateUnknown FSMState = -1
 )
@@ -27,7 +27,7 @@ const (
 const (
 	FSMStateFlagInTransaction = 0x01
 	FSMStateFlagIsAutoCommit  = 0x02
-	FSMStateFlagInPrepare     = 0x04
+	FSMStateFlagIsPinned      = 0x04
 )
 
 const (
@@ -46,6 +46,9 @@ const (
 	EventStmtPrepare
 	EventStmtForwardData // execute, send_long_data
 	EventStmtClose
+
+	// the session depends on the state of backend conn, so the conn is never released
+	EventPin
 )
 
 var ErrFsmActionNowAllowed = errors.New("fsm action not allowed")
@@ -107,9 +110,10 @@ func (q *FSM) Init() {
 	q.MustRegisterHandler(State0, State1, EventBegin, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventBegin))
 	q.MustRegisterHandler(State0, State1, EventQuery, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
 	q.MustRegisterHandler(State0, State2, EventEnableAutoCommit, true, FSMHandlerFunc(fsmHandler_PostReleaseConn_EventEnableAutoCommit))
-	q.MustRegisterHandler(State0, State4, EventStmtPrepare, false, FSMStmtPrepareHandlerFunc(fsmHandler_NoPrepare_WithAttachedConn_EventStmtPrepare))
-	q.MustRegisterHandler(State0, State0, EventStmtForwardData, true, FSMHandlerFunc(errHandler)) // TODO(eastfisher): test
-	q.MustRegisterHandler(State0, State0, EventStmtClose, true, FSMHandlerFunc(noopHandler))      // TODO(eastfisher): test
+	q.MustRegisterHandler(State0, State0, EventStmtPrepare, false, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State0, State1, EventStmtForwardData, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State0, State0, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State0, State4, EventPin, false, FSMHandlerFunc(noopHandler))
 
 	q.MustRegisterHandler(State1, State1, EventDisableAutoCommit, true, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State1, State1, EventBegin, false, FSMHandlerFunc(noopHandler))
@@ -118,70 +122,71 @@ func (q *FSM) Init() {
 	// TODO(eastfisher): upper layer should recognize network error and then close queryctx.
 	q.MustRegisterHandler(State1, State0, EventCommitOrRollback, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventCommitOrRollback))
 	q.MustRegisterHandler(State1, State3, EventEnableAutoCommit, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventEnableAutoCommit))
-	q.MustRegisterHandler(State1, State5, EventStmtPrepare, false, FSMStmtPrepareHandlerFunc(fsmHandler_NoPrepare_WithAttachedConn_EventStmtPrepare))
-	q.MustRegisterHandler(State1, State1, EventStmtForwardData, true, FSMHandlerFunc(errHandler)) // TODO(eastfisher): test // ERROR 1243 (HY000): Unknown prepared statement handler (10) given to mysqld_stmt_execute
-	q.MustRegisterHandler(State1, State1, EventStmtClose, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State1, State1, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State1, State1, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State1, State1, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State1, State5, EventPin, false, FSMHandlerFunc(noopHandler))
 
 	q.MustRegisterHandler(State2, State2, EventEnableAutoCommit, false, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State2, State2, EventCommitOrRollback, false, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State2, State2, EventQuery, false, FSMHandlerFunc(fsmHandler_ConnPool_EventQuery))
 	q.MustRegisterHandler(State2, State0, EventDisableAutoCommit, false, FSMHandlerFunc(fsmHandler_PreFetchConn_EventDisableAutoCommit))
 	q.MustRegisterHandler(State2, State3, EventBegin, false, FSMHandlerFunc(fsmHandler_PreFetchConn_EventBegin))
-	q.MustRegisterHandler(State2, State6, EventStmtPrepare, false, FSMStmtPrepareHandlerFunc(fsmHandler_NoPrepare_PreFetchConn_EventStmtPrepare))
-	q.MustRegisterHandler(State2, State2, EventStmtForwardData, true, FSMHandlerFunc(errHandler)) // TODO(eastfisher): test
-	q.MustRegisterHandler(State2, State2, EventStmtClose, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State2, State2, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_ConnPool_EventStmtPrepare))
+	q.MustRegisterHandler(State2, State2, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_ConnPool_EventStmtForwardData))
+	q.MustRegisterHandler(State2, State2, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State2, State6, EventPin, false, FSMHandlerFunc(fsmHandler_PreFetchConn_EventPin))
 
 	q.MustRegisterHandler(State3, State3, EventEnableAutoCommit, false, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State3, State3, EventBegin, false, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State3, State3, EventQuery, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
 	q.MustRegisterHandler(State3, State1, EventDisableAutoCommit, false, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventDisableAutoCommit))
 	q.MustRegisterHandler(State3, State2, EventCommitOrRollback, true, FSMHandlerFunc(fsmHandler_PostReleaseConn_EventCommitOrRollback))
-	q.MustRegisterHandler(State3, State7, EventStmtPrepare, false, FSMStmtPrepareHandlerFunc(fsmHandler_NoPrepare_WithAttachedConn_EventStmtPrepare))
-	q.MustRegisterHandler(State3, State3, EventStmtForwardData, true, FSMHandlerFunc(errHandler)) // TODO(eastfisher): test
-	q.MustRegisterHandler(State3, State3, EventStmtClose, true, FSMHandlerFunc(noopHandler))
-
-	q.MustRegisterHandler(State4, State4, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_IsPrepare_EventStmtPrepare))
-	q.MustRegisterHandler(State4, State5, EventStmtForwardData, false, FSMHandlerFunc(fsmHandler_IsPrepare_EventStmtForwardData))
-	q.MustRegisterHandler(State4, State0, EventStmtClose, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventStmtClose))
-	//q.MustRegisterHandler(State4, State4, EventStmtClose, true, nil)  // FIXME(eastfisher): stmt close success may change to State4 or State0
-	q.MustRegisterHandler(State4, State5, EventBegin, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventBegin))
-	q.MustRegisterHandler(State4, State4, EventCommitOrRollback, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State3, State3, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State3, State3, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State3, State3, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State3, State7, EventPin, false, FSMHandlerFunc(noopHandler))
+
+	// in pinned states, txnConn must be non nil and is never released
 	q.MustRegisterHandler(State4, State4, EventDisableAutoCommit, true, FSMHandlerFunc(noopHandler))
-	q.MustRegisterHandler(State4, State6, EventEnableAutoCommit, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventEnableAutoCommit))
+	q.MustRegisterHandler(State4, State4, EventCommitOrRollback, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State4, State5, EventBegin, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventBegin))
 	q.MustRegisterHandler(State4, State5, EventQuery, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
+	q.MustRegisterHandler(State4, State6, EventEnableAutoCommit, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventEnableAutoCommit))
+	q.MustRegisterHandler(State4, State4, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State4, State5, EventStmtForwardData, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State4, State4, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State4, State4, EventPin, true, FSMHandlerFunc(noopHandler))
 
-	q.MustRegisterHandler(State5, State5, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_IsPrepare_EventStmtPrepare))
-	q.MustRegisterHandler(State5, State5, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_IsPrepare_EventStmtForwardData))
-	q.MustRegisterHandler(State5, State1, EventStmtClose, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventStmtClose))
+	q.MustRegisterHandler(State5, State5, EventDisableAutoCommit, true, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State5, State5, EventBegin, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State5, State5, EventQuery, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
 	q.MustRegisterHandler(State5, State4, EventCommitOrRollback, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventCommitOrRollback))
-	q.MustRegisterHandler(State5, State5, EventDisableAutoCommit, true, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State5, State7, EventEnableAutoCommit, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventEnableAutoCommit))
-	q.MustRegisterHandler(State5, State5, EventQuery, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
+	q.MustRegisterHandler(State5, State5, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State5, State5, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State5, State5, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State5, State5, EventPin, true, FSMHandlerFunc(noopHandler))
 
-	q.MustRegisterHandler(State6, State6, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_IsPrepare_EventStmtPrepare))
-	q.MustRegisterHandler(State6, State6, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_IsPrepare_EventStmtForwardData))
-	q.MustRegisterHandler(State6, State2, EventStmtClose, true, FSMHandlerFunc(fsmHandler_ReleaseConn_EventStmtClose))
-	q.MustRegisterHandler(State6, State7, EventBegin, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventBegin))
-	q.MustRegisterHandler(State6, State6, EventCommitOrRollback, true, FSMHandlerFunc(noopHandler))
-	q.MustRegisterHandler(State6, State4, EventDisableAutoCommit, false, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventDisableAutoCommit))
 	q.MustRegisterHandler(State6, State6, EventEnableAutoCommit, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State6, State6, EventCommitOrRollback, true, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State6, State6, EventQuery, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
+	q.MustRegisterHandler(State6, State4, EventDisableAutoCommit, false, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventDisableAutoCommit))
+	q.MustRegisterHandler(State6, State7, EventBegin, false, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventBegin))
+	q.MustRegisterHandler(State6, State6, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State6, State6, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State6, State6, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State6, State6, EventPin, true, FSMHandlerFunc(noopHandler))
 
-	q.MustRegisterHandler(State7, State7, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_IsPrepare_EventStmtPrepare))
-	q.MustRegisterHandler(State7, State7, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_IsPrepare_EventStmtForwardData))
-	q.MustRegisterHandler(State7, State3, EventStmtClose, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventStmtClose))
-	q.MustRegisterHandler(State7, State7, EventBegin, true, FSMHandlerFunc(noopHandler))
-	q.MustRegisterHandler(State7, State6, EventCommitOrRollback, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventCommitOrRollback))
-	q.MustRegisterHandler(State7, State5, EventDisableAutoCommit, false, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventDisableAutoCommit))
 	q.MustRegisterHandler(State7, State7, EventEnableAutoCommit, true, FSMHandlerFunc(noopHandler))
+	q.MustRegisterHandler(State7, State7, EventBegin, true, FSMHandlerFunc(noopHandler))
 	q.MustRegisterHandler(State7, State7, EventQuery, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventQuery))
-}
-
-func fsmHandler_IsPrepare_EventStmtForwardData(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
-	_ = args[0].(int) // stmtId
-	data := args[1].([]byte)
-	return b.txnConn.StmtExecuteForward(data)
+	q.MustRegisterHandler(State7, State5, EventDisableAutoCommit, false, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventDisableAutoCommit))
+	q.MustRegisterHandler(State7, State6, EventCommitOrRollback, true, FSMHandlerFunc(fsmHandler_NotReleaseConn_EventCommitOrRollback))
+	q.MustRegisterHandler(State7, State7, EventStmtPrepare, true, FSMStmtPrepareHandlerFunc(fsmHandler_WithAttachedConn_EventStmtPrepare))
+	q.MustRegisterHandler(State7, State7, EventStmtForwardData, true, FSMHandlerFunc(fsmHandler_WithAttachedConn_EventStmtForwardData))
+	q.MustRegisterHandler(State7, State7, EventStmtClose, true, FSMHandlerFunc(fsmHandler_EventStmtClose))
+	q.MustRegisterHandler(State7, State7, EventPin, true, FSMHandlerFunc(noopHandler))
 }
 
 func (q *FSM) MustRegisterHandler(state FSMState, newState FSMState, event FSMEvent, mustChangeState bool, handler FSMHandler) {
@@ -209,7 +214,7 @@ func (q *FSM) Call(ctx context.Context, event FSMEvent, conn *BackendConnManager
 	}
 	ret, err := action.Handler.Handle(conn, ctx, args...)
 	if action.MustChangeState || err == nil {
-		conn.state = action.NewState
+		conn.setState(action.NewState)
 	}
 	return ret, err
 }
@@ -291,6 +296,15 @@ func fsmHandler_PreFetchConn_EventBegin(b *BackendConnManager, ctx context.Conte
 	return nil, nil
 }
 
+func fsmHandler_PreFetchConn_EventPin(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
+	conn, err := b.ns.GetPooledConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.setAttachedConn(conn)
+	return nil, nil
+}
+
 func fsmHandler_NotReleaseConn_EventDisableAutoCommit(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
 	err := b.txnConn.SetAutoCommit(false)
 	return nil, err
@@ -316,70 +330,35 @@ func fsmHandler_PostReleaseConn_EventCommitOrRollback(b *BackendConnManager, ctx
 	return nil, err
 }
 
-// TODO(eastfisher): currently we don't change db
-func fsmHandler_NoPrepare_WithAttachedConn_EventStmtPrepare(b *BackendConnManager, ctx context.Context, args ...interface{}) (Stmt, error) {
-	stmt, err := fsmHandler_IsPrepare_EventStmtPrepare(b, ctx, args...)
-	if err != nil {
-		return nil, err
-	}
-
-	b.isPrepared = true
-	return stmt, nil
-}
-
-func fsmHandler_NoPrepare_PreFetchConn_EventStmtPrepare(b *BackendConnManager, ctx context.Context, args ...interface{}) (Stmt, error) {
-	conn, err := b.ns.GetPooledConn(ctx)
-	if err != nil {
-		return nil, err
-	}
-
+func fsmHandler_WithAttachedConn_EventStmtPrepare(b *BackendConnManager, ctx context.Context, args ...interface{}) (Stmt, error) {
 	db := args[0].(string)
 	sql := args[1].(string)
-
-	if err = conn.UseDB(db); err != nil {
-		errClosePooledBackendConn(conn, b.ns.Name())
-		return nil, err
-	}
-	stmt, err := conn.StmtPrepare(sql)
-	if err != nil {
-		errClosePooledBackendConn(conn, b.ns.Name())
-		return nil, err
-	}
-	b.setAttachedConn(conn)
-	b.isPrepared = true
-	return stmt, nil
+	return b.stmtPrepareInTxn(ctx, db, sql)
 }
 
-func fsmHandler_IsPrepare_EventStmtPrepare(b *BackendConnManager, ctx context.Context, args ...interface{}) (Stmt, error) {
+func fsmHandler_ConnPool_EventStmtPrepare(b *BackendConnManager, ctx context.Context, args ...interface{}) (Stmt, error) {
 	db := args[0].(string)
 	sql := args[1].(string)
-
-	if err := b.txnConn.UseDB(db); err != nil {
-		return nil, err
-	}
-
-	stmt, err := b.txnConn.StmtPrepare(sql)
-	if err != nil {
-		return nil, err
-	}
-
-	return stmt, nil
+	return b.stmtPrepareWithoutTxn(ctx, db, sql)
 }
 
-func fsmHandler_NotReleaseConn_EventStmtClose(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
+func fsmHandler_WithAttachedConn_EventStmtForwardData(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
 	stmtId := args[0].(int)
-	err := b.txnConn.StmtClosePrepare(stmtId)
+	data := args[1].([]byte)
+	return b.stmtExecuteInTxn(ctx, stmtId, data)
+}
 
-	b.isPrepared = false
-	return nil, err
+func fsmHandler_ConnPool_EventStmtForwardData(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
+	stmtId := args[0].(int)
+	data := args[1].([]byte)
+	return b.stmtExecuteWithoutTxn(ctx, stmtId, data)
 }
 
-func fsmHandler_ReleaseConn_EventStmtClose(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
+// the stmts prepared on backend conns are kept in the stmt cache of the conns, so we only forget it here.
+func fsmHandler_EventStmtClose(b *BackendConnManager, ctx context.Context, args ...interface{}) (*mysql.Result, error) {
 	stmtId := args[0].(int)
-	err := b.txnConn.StmtClosePrepare(stmtId)
-	b.releaseAttachedConn(err)
-	b.isPrepared = false
-	return nil, err
+	delete(b.stmts, stmtId)
+	return nil, nil
 }
 
 func (f FSMState) IsAutoCommit() bool {
@@ -390,6 +369,6 @@ func (f FSMState) IsInTransaction() bool {
 	return (f & FSMStateFlagInTransaction) != 0
 }
 
-func (f FSMState) IsPrepare() bool {
-	return (f & FSMStateFlagInPrepare) != 0
+func (f FSMState) IsPinned() bool {
+	return (f & FSMStateFlagIsPinned) != 0
 }
@@ -0,0 +1,219 @@
+package driver
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/util/logutil"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"go.uber.org/zap"
+)
+
+const (
+	// stmt id (4) + flags (1) + iteration count (4)
+	stmtExecuteHeaderLen = 9
+	// maxPreparedStmtCount is the max number of stmts a session keeps, the same as the default
+	// max_prepared_stmt_count of MySQL, so that a client leaking stmts does not exhaust the memory.
+	maxPreparedStmtCount = 16382
+)
+
+// proxyStmt is a stmt prepared by the client. It is not bound to any backend conn,
+// but prepared lazily on the backend conn used by each execution.
+type proxyStmt struct {
+	id        int
+	db        string
+	sql       string
+	paramNum  int
+	columnNum int
+
+	// paramTypes is sent by the client only in the first execution (new-params-bound-flag is 1),
+	// so we keep it for the executions on the backend conns which have not seen it.
+	paramTypes []byte
+}
+
+func (s *proxyStmt) ID() int {
+	return s.id
+}
+
+func (s *proxyStmt) ParamNum() int {
+	return s.paramNum
+}
+
+func (s *proxyStmt) ColumnNum() int {
+	return s.columnNum
+}
+
+// rewriteExecuteData replaces the stmt id in COM_STMT_EXECUTE payload with the backend stmt id,
+// and fills the param types if the client does not send them.
+func (s *proxyStmt) rewriteExecuteData(data []byte, backendStmtId int) ([]byte, error) {
+	if len(data) < stmtExecuteHeaderLen {
+		return nil, mysql.ErrMalformPacket
+	}
+
+	if s.paramNum == 0 {
+		ret := make([]byte, len(data))
+		copy(ret, data)
+		binary.LittleEndian.PutUint32(ret, uint32(backendStmtId))
+		return ret, nil
+	}
+
+	boundFlagPos := stmtExecuteHeaderLen + (s.paramNum+7)>>3
+	if len(data) < boundFlagPos+1 {
+		return nil, mysql.ErrMalformPacket
+	}
+
+	if data[boundFlagPos] == 1 {
+		typesEnd := boundFlagPos + 1 + s.paramNum<<1
+		if len(data) < typesEnd {
+			return nil, mysql.ErrMalformPacket
+		}
+		s.paramTypes = append(s.paramTypes[:0], data[boundFlagPos+1:typesEnd]...)
+
+		ret := make([]byte, len(data))
+		copy(ret, data)
+		binary.LittleEndian.PutUint32(ret, uint32(backendStmtId))
+		return ret, nil
+	}
+
+	if s.paramTypes == nil {
+		return nil, mysql.ErrMalformPacket
+	}
+	ret := make([]byte, 0, len(data)+len(s.paramTypes))
+	ret = append(ret, data[:boundFlagPos]...)
+	ret = append(ret, 1)
+	ret = append(ret, s.paramTypes...)
+	ret = append(ret, data[boundFlagPos+1:]...)
+	binary.LittleEndian.PutUint32(ret, uint32(backendStmtId))
+	return ret, nil
+}
+
+func (f *BackendConnManager) addStmt(db, sql string, backendStmt Stmt) Stmt {
+	f.lastStmtId++
+	stmt := &proxyStmt{
+		id:        int(f.lastStmtId),
+		db:        db,
+		sql:       sql,
+		paramNum:  backendStmt.ParamNum(),
+		columnNum: backendStmt.ColumnNum(),
+	}
+	f.stmts[stmt.id] = stmt
+	return stmt
+}
+
+func (f *BackendConnManager) checkStmtCount() error {
+	if len(f.stmts) >= maxPreparedStmtCount {
+		return mysql.NewErrf(mysql.ErrMaxPreparedStmtCountReached,
+			"Can't create more than max_prepared_stmt_count statements (current value: %d)", maxPreparedStmtCount)
+	}
+	return nil
+}
+
+func (f *BackendConnManager) getStmt(stmtId int) (*proxyStmt, error) {
+	stmt, ok := f.stmts[stmtId]
+	if !ok {
+		return nil, mysql.NewErrf(mysql.ErrUnknownStmtHandler, "Unknown prepared statement handler (%d) given to %s", stmtId, "mysqld_stmt_execute")
+	}
+	return stmt, nil
+}
+
+func (f *BackendConnManager) stmtPrepareWithoutTxn(ctx context.Context, db, sql string) (Stmt, error) {
+	if err := f.checkStmtCount(); err != nil {
+		return nil, err
+	}
+	var err error
+	conn, err := f.ns.GetPooledConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		f.putBackPooledConn(conn, err)
+	}()
+
+	var backendStmt Stmt
+	backendStmt, err = prepareBackendStmt(conn, db, sql)
+	if err != nil {
+		return nil, err
+	}
+	return f.addStmt(db, sql, backendStmt), nil
+}
+
+func (f *BackendConnManager) stmtPrepareInTxn(ctx context.Context, db, sql string) (Stmt, error) {
+	if err := f.checkStmtCount(); err != nil {
+		return nil, err
+	}
+	backendStmt, err := prepareBackendStmt(f.txnConn, db, sql)
+	if err != nil {
+		return nil, err
+	}
+	return f.addStmt(db, sql, backendStmt), nil
+}
+
+func (f *BackendConnManager) stmtExecuteWithoutTxn(ctx context.Context, stmtId int, data []byte) (*gomysql.Result, error) {
+	stmt, err := f.getStmt(stmtId)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := f.ns.GetPooledConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		f.putBackPooledConn(conn, err)
+	}()
+
+	if err = f.restoreLastInsertID(ctx, conn); err != nil {
+		return nil, err
+	}
+	var ret *gomysql.Result
+	ret, err = executeBackendStmt(ctx, conn, stmt, data)
+	f.recordWarnings(conn, err)
+	return ret, err
+}
+
+func (f *BackendConnManager) stmtExecuteInTxn(ctx context.Context, stmtId int, data []byte) (*gomysql.Result, error) {
+	f.warnings = nil
+	stmt, err := f.getStmt(stmtId)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.restoreLastInsertID(ctx, f.txnConn); err != nil {
+		return nil, err
+	}
+	return executeBackendStmt(ctx, f.txnConn, stmt, data)
+}
+
+func (f *BackendConnManager) putBackPooledConn(conn PooledBackendConn, err error) {
+	if err != nil && isConnError(err) {
+		if errClose := conn.ErrorClose(); errClose != nil {
+			logutil.BgLogger().Error("close backend conn error", zap.Error(errClose))
+		}
+	} else {
+		conn.PutBack()
+	}
+}
+
+func prepareBackendStmt(conn BackendConn, db, sql string) (Stmt, error) {
+	if err := conn.UseDB(db); err != nil {
+		return nil, err
+	}
+	return conn.StmtPrepareCached(sql)
+}
+
+func executeBackendStmt(ctx context.Context, conn BackendConn, stmt *proxyStmt, data []byte) (*gomysql.Result, error) {
+	backendStmt, err := prepareBackendStmt(conn, stmt.db, stmt.sql)
+	if err != nil {
+		return nil, err
+	}
+	data, err = stmt.rewriteExecuteData(data, backendStmt.ID())
+	if err != nil {
+		return nil, err
+	}
+	if w, ok := getResultWriter(ctx); ok {
+		return conn.StmtExecuteForwardStream(data, w)
+	}
+	return conn.StmtExecuteForward(data)
+}
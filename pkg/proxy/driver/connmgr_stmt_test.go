@@ -0,0 +1,54 @@
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyStmt_RewriteExecuteData(t *testing.T) {
+	stmt := &proxyStmt{id: 1, paramNum: 2}
+
+	// null bitmap, new-params-bound-flag, param types, param values
+	bound := []byte{1, 0, 0, 0, 0, 1, 0, 0, 0, 0x00, 1, 0x08, 0x00, 0x01, 0x00, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	data, err := stmt.rewriteExecuteData(bound, 100)
+	require.NoError(t, err)
+	require.Equal(t, byte(100), data[0])
+	require.Equal(t, bound[4:], data[4:])
+	require.Equal(t, []byte{0x08, 0x00, 0x01, 0x00}, stmt.paramTypes)
+	// the client data is not modified
+	require.Equal(t, byte(1), bound[0])
+
+	// param types are filled for the backend stmt which has not seen them
+	unbound := []byte{1, 0, 0, 0, 0, 1, 0, 0, 0, 0x00, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	data, err = stmt.rewriteExecuteData(unbound, 200)
+	require.NoError(t, err)
+	expected := []byte{200, 0, 0, 0, 0, 1, 0, 0, 0, 0x00, 1, 0x08, 0x00, 0x01, 0x00, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	require.Equal(t, expected, data)
+
+	// param types are never sent
+	_, err = (&proxyStmt{id: 2, paramNum: 2}).rewriteExecuteData(unbound, 200)
+	require.Equal(t, mysql.ErrMalformPacket, err)
+
+	_, err = stmt.rewriteExecuteData([]byte{1, 0, 0, 0, 0, 1, 0, 0, 0}, 200)
+	require.Equal(t, mysql.ErrMalformPacket, err)
+	_, err = stmt.rewriteExecuteData([]byte{1, 0, 0, 0}, 200)
+	require.Equal(t, mysql.ErrMalformPacket, err)
+}
+
+func TestBackendConnManager_MaxPreparedStmtCount(t *testing.T) {
+	mgr := NewBackendConnManager(getGlobalFSM(), nil)
+	for i := 0; i < maxPreparedStmtCount-1; i++ {
+		mgr.stmts[i] = &proxyStmt{id: i}
+	}
+	require.NoError(t, mgr.checkStmtCount())
+
+	mgr.stmts[maxPreparedStmtCount] = &proxyStmt{id: maxPreparedStmtCount}
+	_, err := mgr.stmtPrepareInTxn(context.Background(), "test_db", "SELECT 1")
+	require.Error(t, err)
+	sqlErr, ok := err.(*mysql.SQLError)
+	require.True(t, ok)
+	require.Equal(t, uint16(mysql.ErrMaxPreparedStmtCountReached), sqlErr.Code)
+}
@@ -6,18 +6,25 @@ import (
 	"testing"
 
 	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
 )
 
 const (
 	testDB     = "test_db"
 	testSQL    = "SELECT * FROM test_tbl"
 	testStmtID = 1
+
+	testBackendStmtID = 100
 )
 
 var queryResult = &gomysql.Result{}
-var stmtExecData = []byte("exec")
+
+// stmt id, flags, iteration count
+var stmtExecData = []byte{testStmtID, 0, 0, 0, 0, 1, 0, 0, 0}
+var backendStmtExecData = []byte{testBackendStmtID, 0, 0, 0, 0, 1, 0, 0, 0}
 var connmgrMockError = errors.New("mock error")
 
 type BackendConnManagerTestSuite struct {
@@ -36,9 +43,10 @@ func (b *BackendConnManagerTestSuite) SetupTest() {
 	b.mockConn = new(MockPooledBackendConn)
 	b.mockNs = new(MockNamespace)
 	b.mockStmt = new(MockStmt)
-	b.mockStmt.On("ID").Return(testStmtID)
+	b.mockStmt.On("ID").Return(testBackendStmtID)
 	b.mockNs.On("Name").Return("mock_namespace")
 	b.mockConn.On("UseDB", testDB).Return(nil)
+	b.mockConn.On("GetWarnings").Return(uint16(0))
 	b.mockMgr = NewBackendConnManager(getGlobalFSM(), b.mockNs)
 }
 
@@ -49,41 +57,22 @@ func (b *BackendConnManagerTestSuite) TearDownSuite() {
 }
 
 func (b *BackendConnManagerTestSuite) prepareConnMgrStatus(state FSMState) {
-	b.mockMgr.state = state
-	if !b.mockMgr.state.IsAutoCommit() || b.mockMgr.state.IsInTransaction() || b.mockMgr.state.IsPrepare() {
+	b.mockMgr.setState(state)
+	if !b.mockMgr.state.IsAutoCommit() || b.mockMgr.state.IsInTransaction() {
 		b.mockMgr.txnConn = b.mockConn
 	}
-	if b.mockMgr.state.IsPrepare() {
-		b.mockMgr.isPrepared = true
-	}
 }
 
 func (b *BackendConnManagerTestSuite) assertConnMgrStatusCorrect(state FSMState) {
 	switch state {
 	case State0:
 		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.False(b.T(), b.mockMgr.isPrepared)
 	case State1:
 		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.False(b.T(), b.mockMgr.isPrepared)
 	case State2:
 		require.Nil(b.T(), b.mockMgr.txnConn)
-		require.False(b.T(), b.mockMgr.isPrepared)
 	case State3:
 		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.False(b.T(), b.mockMgr.isPrepared)
-	case State4:
-		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.True(b.T(), b.mockMgr.isPrepared)
-	case State5:
-		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.True(b.T(), b.mockMgr.isPrepared)
-	case State6:
-		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.True(b.T(), b.mockMgr.isPrepared)
-	case State7:
-		require.NotNil(b.T(), b.mockMgr.txnConn)
-		require.True(b.T(), b.mockMgr.isPrepared)
 	default:
 		b.T().FailNow()
 	}
@@ -236,116 +225,6 @@ func (b *BackendConnManagerTestSuite) Test_State3_Begin_Success() {
 	tc.Run()
 }
 
-// same with State0
-func (b *BackendConnManagerTestSuite) Test_State4_Begin_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Begin").Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.Begin(ctx)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "Begin")
-		},
-	}
-
-	tc.Run()
-}
-
-// same with State0
-func (b *BackendConnManagerTestSuite) Test_State4_Begin_Error() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Begin").Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.Begin(ctx)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "Begin")
-		},
-	}
-
-	tc.Run()
-}
-
-// same with State1
-func (b *BackendConnManagerTestSuite) Test_State5_Begin_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.Begin(ctx)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
-}
-
-// same with State0
-func (b *BackendConnManagerTestSuite) Test_State6_Begin_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Begin").Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.Begin(ctx)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "Begin")
-		},
-	}
-
-	tc.Run()
-}
-
-// same with State0
-func (b *BackendConnManagerTestSuite) Test_State6_Begin_Error() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Begin").Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.Begin(ctx)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "Begin")
-		},
-	}
-
-	tc.Run()
-}
-
-// same with State3
-func (b *BackendConnManagerTestSuite) Test_State7_Begin_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.Begin(ctx)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
-}
-
 func (b *BackendConnManagerTestSuite) Test_State0_Query_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
@@ -455,223 +334,91 @@ func (b *BackendConnManagerTestSuite) Test_State2_Query_Success() {
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State2_Query_Error_GetPooledConn() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State2,
-		TargetState:  State2,
-		Prepare: func(ctx context.Context) {
-			b.mockNs.On("GetPooledConn", ctx).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.Nil(b.T(), ret)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockNs.AssertCalled(b.T(), "GetPooledConn", ctx)
-		},
-	}
+type mockResultWriter struct{}
 
-	tc.Run()
-}
+func (mockResultWriter) WriteColumns(fields []*gomysql.Field) error { return nil }
+func (mockResultWriter) WriteRow(data []byte) error                 { return nil }
 
-func (b *BackendConnManagerTestSuite) Test_State2_Query_Error_Execute() {
+func (b *BackendConnManagerTestSuite) Test_State2_Query_Stream_Success() {
+	w := mockResultWriter{}
+	// the rows are counted for FOUND_ROWS() by wrapping the ResultWriter.
+	countedWriter := mock.MatchedBy(func(rw ResultWriter) bool {
+		counter, ok := rw.(*rowCountResultWriter)
+		return ok && counter.ResultWriter == w
+	})
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
 		CurrentState: State2,
 		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
-			b.mockNs.On("GetPooledConn", ctx).Return(b.mockConn, nil).Once()
+			b.mockNs.On("GetPooledConn", mock.Anything).Return(b.mockConn, nil).Once()
 			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(nil, connmgrMockError).Once()
+			b.mockConn.On("ExecuteStream", testSQL, countedWriter).Return(queryResult, nil).Once()
 			b.mockConn.On("PutBack").Return(nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.Nil(b.T(), ret)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockNs.AssertCalled(b.T(), "GetPooledConn", ctx)
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
-			b.mockConn.AssertCalled(b.T(), "PutBack")
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State3_Query_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State3,
-		TargetState:  State3,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(queryResult, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.NotNil(b.T(), ret)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State3_Query_Error_Execute() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State3,
-		TargetState:  State3,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.Nil(b.T(), ret)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State4_Query_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(queryResult, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.NotNil(b.T(), ret)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State4_Query_Error_Execute() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.Nil(b.T(), ret)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_Query_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(queryResult, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
+			ctx = context.WithValue(ctx, constant.ContextKeyResultWriter, w)
 			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
 			require.NotNil(b.T(), ret)
 			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
+			b.mockConn.AssertCalled(b.T(), "ExecuteStream", testSQL, countedWriter)
+			b.mockConn.AssertNotCalled(b.T(), "Execute", testSQL)
+			b.mockConn.AssertCalled(b.T(), "PutBack")
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State5_Query_Error_Execute() {
+func (b *BackendConnManagerTestSuite) Test_State2_Query_Error_GetPooledConn() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
+		CurrentState: State2,
+		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(nil, connmgrMockError).Once()
+			b.mockNs.On("GetPooledConn", ctx).Return(nil, connmgrMockError).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
 			require.Nil(b.T(), ret)
 			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_Query_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("UseDB", testDB).Return(nil).Once()
-			b.mockConn.On("Execute", testSQL).Return(queryResult, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
-			require.NotNil(b.T(), ret)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
-			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
+			b.mockNs.AssertCalled(b.T(), "GetPooledConn", ctx)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State6_Query_Error_Execute() {
+func (b *BackendConnManagerTestSuite) Test_State2_Query_Error_Execute() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
+		CurrentState: State2,
+		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
+			b.mockNs.On("GetPooledConn", ctx).Return(b.mockConn, nil).Once()
 			b.mockConn.On("UseDB", testDB).Return(nil).Once()
 			b.mockConn.On("Execute", testSQL).Return(nil, connmgrMockError).Once()
+			b.mockConn.On("PutBack").Return(nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			ret, err := b.mockMgr.Query(ctx, testDB, testSQL)
 			require.Nil(b.T(), ret)
 			require.EqualError(b.T(), err, connmgrMockError.Error())
+			b.mockNs.AssertCalled(b.T(), "GetPooledConn", ctx)
 			b.mockConn.AssertCalled(b.T(), "UseDB", testDB)
 			b.mockConn.AssertCalled(b.T(), "Execute", testSQL)
+			b.mockConn.AssertCalled(b.T(), "PutBack")
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State7_Query_Success() {
+func (b *BackendConnManagerTestSuite) Test_State3_Query_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
+		CurrentState: State3,
+		TargetState:  State3,
 		Prepare: func(ctx context.Context) {
 			b.mockConn.On("UseDB", testDB).Return(nil).Once()
 			b.mockConn.On("Execute", testSQL).Return(queryResult, nil).Once()
@@ -688,11 +435,11 @@ func (b *BackendConnManagerTestSuite) Test_State7_Query_Success() {
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State7_Query_Error_Execute() {
+func (b *BackendConnManagerTestSuite) Test_State3_Query_Error_Execute() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
+		CurrentState: State3,
+		TargetState:  State3,
 		Prepare: func(ctx context.Context) {
 			b.mockConn.On("UseDB", testDB).Return(nil).Once()
 			b.mockConn.On("Execute", testSQL).Return(nil, connmgrMockError).Once()
@@ -861,111 +608,7 @@ func (b *BackendConnManagerTestSuite) Test_State3_Rollback_Error_Rollback() {
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State4_Commit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.CommitOrRollback(ctx, true)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_Commit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Commit").Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.CommitOrRollback(ctx, true)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "Commit")
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_Commit_Error_Commit() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Commit").Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.CommitOrRollback(ctx, true)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "Commit")
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_Commit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.CommitOrRollback(ctx, true)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_Commit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Commit").Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.CommitOrRollback(ctx, true)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "Commit")
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_Commit_Error_Commit() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("Commit").Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.CommitOrRollback(ctx, true)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "Commit")
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State0_DisableAutoCommit_Success() {
+func (b *BackendConnManagerTestSuite) Test_State0_DisableAutoCommit_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
 		CurrentState: State0,
@@ -1093,110 +736,6 @@ func (b *BackendConnManagerTestSuite) Test_State3_DisableAutoCommit_Error_SetAut
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State4_DisableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, false)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_DisableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, false)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_DisableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", false).Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, false)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", false)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_DisableAutoCommit_Error_SetAutoCommit() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", false).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, false)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", false)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_DisableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", false).Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, false)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", false)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_DisableAutoCommit_Error_SetAutoCommit() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", false).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, false)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", false)
-		},
-	}
-
-	tc.Run()
-}
-
 func (b *BackendConnManagerTestSuite) Test_State0_EnableAutoCommit_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
@@ -1305,123 +844,34 @@ func (b *BackendConnManagerTestSuite) Test_State3_EnableAutoCommit_Success() {
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State4_EnableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", true).Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, true)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", true)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State4_EnableAutoCommit_Error_SetAutoCommit() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", true).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, true)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", true)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_EnableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", true).Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, true)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", true)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_EnableAutoCommit_Error_SetAutoCommit() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("SetAutoCommit", true).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, true)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "SetAutoCommit", true)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_EnableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, true)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
+func (b *BackendConnManagerTestSuite) prepareStmt() *proxyStmt {
+	stmt := &proxyStmt{id: testStmtID, db: testDB, sql: testSQL}
+	b.mockMgr.stmts[stmt.id] = stmt
+	return stmt
 }
 
-func (b *BackendConnManagerTestSuite) Test_State7_EnableAutoCommit_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.SetAutoCommit(ctx, true)
-			require.NoError(b.T(), err)
-		},
-	}
-
-	tc.Run()
+func (b *BackendConnManagerTestSuite) mockBackendStmtPrepare() {
+	b.mockStmt.On("ParamNum").Return(0)
+	b.mockStmt.On("ColumnNum").Return(1)
+	b.mockConn.On("StmtPrepareCached", testSQL).Return(b.mockStmt, nil)
 }
 
+// prepare in autocommit=0 cannot start a new transaction
 func (b *BackendConnManagerTestSuite) Test_State0_StmtPrepare_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
 		CurrentState: State0,
-		TargetState:  State4,
+		TargetState:  State0,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
+			b.mockBackendStmtPrepare()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
 			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
+			require.Equal(b.T(), 1, stmt.ID())
+			require.Equal(b.T(), 1, stmt.ColumnNum())
+			require.Contains(b.T(), b.mockMgr.stmts, stmt.ID())
+			b.mockConn.AssertCalled(b.T(), "StmtPrepareCached", testSQL)
 		},
 	}
 
@@ -1434,12 +884,12 @@ func (b *BackendConnManagerTestSuite) Test_State0_StmtPrepare_Error_StmtPrepare(
 		CurrentState: State0,
 		TargetState:  State0,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
+			b.mockConn.On("StmtPrepareCached", testSQL).Return(nil, connmgrMockError).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
 			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
+			require.Len(b.T(), b.mockMgr.stmts, 0)
 		},
 	}
 
@@ -1450,54 +900,39 @@ func (b *BackendConnManagerTestSuite) Test_State1_StmtPrepare_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
 		CurrentState: State1,
-		TargetState:  State5,
+		TargetState:  State1,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
+			b.mockBackendStmtPrepare()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
 			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State1_StmtPrepare_Error_StmtPrepare() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State1,
-		TargetState:  State1,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
+			require.Contains(b.T(), b.mockMgr.stmts, stmt.ID())
+			b.mockConn.AssertCalled(b.T(), "StmtPrepareCached", testSQL)
 		},
 	}
 
 	tc.Run()
 }
 
+// prepare in autocommit=1 does not hold the backend conn
 func (b *BackendConnManagerTestSuite) Test_State2_StmtPrepare_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
 		CurrentState: State2,
-		TargetState:  State6,
+		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
 			b.mockNs.On("GetPooledConn", ctx).Return(b.mockConn, nil).Once()
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("PutBack").Return().Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
 			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
+			require.Contains(b.T(), b.mockMgr.stmts, stmt.ID())
 			b.mockNs.AssertCalled(b.T(), "GetPooledConn", ctx)
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
+			b.mockConn.AssertCalled(b.T(), "StmtPrepareCached", testSQL)
+			b.mockConn.AssertCalled(b.T(), "PutBack")
 		},
 	}
 
@@ -1529,14 +964,14 @@ func (b *BackendConnManagerTestSuite) Test_State2_StmtPrepare_Error_StmtPrepare(
 		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
 			b.mockNs.On("GetPooledConn", ctx).Return(b.mockConn, nil).Once()
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
+			b.mockConn.On("StmtPrepareCached", testSQL).Return(nil, gomysql.ErrBadConn).Once()
 			b.mockConn.On("ErrorClose").Return(nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
+			require.Equal(b.T(), gomysql.ErrBadConn, err)
 			b.mockNs.AssertCalled(b.T(), "GetPooledConn", ctx)
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
+			b.mockConn.AssertCalled(b.T(), "StmtPrepareCached", testSQL)
 			b.mockConn.AssertCalled(b.T(), "ErrorClose")
 		},
 	}
@@ -1545,449 +980,204 @@ func (b *BackendConnManagerTestSuite) Test_State2_StmtPrepare_Error_StmtPrepare(
 }
 
 func (b *BackendConnManagerTestSuite) Test_State3_StmtPrepare_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State3,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State3_StmtPrepare_Error_StmtPrepare() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
 		CurrentState: State3,
 		TargetState:  State3,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-// prepare in autocommit=0 cannot start a new transaction
-func (b *BackendConnManagerTestSuite) Test_State4_StmtPrepare_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
+			b.mockBackendStmtPrepare()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
 			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
+			require.Contains(b.T(), b.mockMgr.stmts, stmt.ID())
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State4_StmtPrepare_Error_StmtPrepare() {
+// execute in autocommit=0 starts a new transaction, the same as query
+func (b *BackendConnManagerTestSuite) Test_State0_StmtExecute_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_StmtPrepare_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_StmtPrepare_Error_StmtPrepare() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_StmtPrepare_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(b.mockStmt, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			stmt, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.NoError(b.T(), err)
-			require.Equal(b.T(), testStmtID, stmt.ID())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_StmtPrepare_Error_StmtPrepare() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtPrepare", testSQL).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			_, err := b.mockMgr.StmtPrepare(ctx, testDB, testSQL)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtPrepare", testSQL)
-		},
-	}
-
-	tc.Run()
-}
-
-// run StmtExecute in State0 to State3 will return fsm action not allowed error
-// so we skip these cases
-func (b *BackendConnManagerTestSuite) Test_State4_StmtExecute_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State5,
+		CurrentState: State0,
+		TargetState:  State1,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(queryResult, nil).Once()
+			b.prepareStmt()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("StmtExecuteForward", backendStmtExecData).Return(queryResult, nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			ret, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
 			require.NoError(b.T(), err)
 			require.NotNil(b.T(), ret)
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
+			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", backendStmtExecData)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State4_StmtExecute_Error_StmtExecuteForward() {
+func (b *BackendConnManagerTestSuite) Test_State1_StmtExecute_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State4,
-		TargetState:  State4,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(nil, connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			_, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State5_StmtExecute_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
+		CurrentState: State1,
+		TargetState:  State1,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(queryResult, nil).Once()
+			b.prepareStmt()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("StmtExecuteForward", backendStmtExecData).Return(queryResult, nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			ret, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
 			require.NoError(b.T(), err)
 			require.NotNil(b.T(), ret)
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
+			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", backendStmtExecData)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State5_StmtExecute_Error_StmtExecuteForward() {
+func (b *BackendConnManagerTestSuite) Test_State1_StmtExecute_Error_StmtExecuteForward() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State5,
-		TargetState:  State5,
+		CurrentState: State1,
+		TargetState:  State1,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(nil, connmgrMockError).Once()
+			b.prepareStmt()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("StmtExecuteForward", backendStmtExecData).Return(nil, connmgrMockError).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			_, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
 			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State6_StmtExecute_Success() {
+// the stmt is prepared on the pooled conn, and the conn is put back after execute
+func (b *BackendConnManagerTestSuite) Test_State2_StmtExecute_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
+		CurrentState: State2,
+		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(queryResult, nil).Once()
+			b.prepareStmt()
+			b.mockNs.On("GetPooledConn", ctx).Return(b.mockConn, nil).Once()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("StmtExecuteForward", backendStmtExecData).Return(queryResult, nil).Once()
+			b.mockConn.On("PutBack").Return().Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			ret, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
 			require.NoError(b.T(), err)
 			require.NotNil(b.T(), ret)
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
+			b.mockConn.AssertCalled(b.T(), "StmtPrepareCached", testSQL)
+			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", backendStmtExecData)
+			b.mockConn.AssertCalled(b.T(), "PutBack")
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State6_StmtExecute_Error_StmtExecuteForward() {
+func (b *BackendConnManagerTestSuite) Test_State2_StmtExecute_Error_UnknownStmt() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State6,
-		TargetState:  State6,
+		CurrentState: State2,
+		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(nil, connmgrMockError).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			_, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_StmtExecute_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(queryResult, nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			ret, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
-			require.NoError(b.T(), err)
-			require.NotNil(b.T(), ret)
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
+			require.Error(b.T(), err)
+			b.mockNs.AssertNotCalled(b.T(), "GetPooledConn", ctx)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State7_StmtExecute_Error_StmtExecuteForward() {
+func (b *BackendConnManagerTestSuite) Test_State2_StmtExecute_Error_StmtExecuteForward() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State7,
-		TargetState:  State7,
+		CurrentState: State2,
+		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtExecuteForward", stmtExecData).Return(nil, connmgrMockError).Once()
+			b.prepareStmt()
+			b.mockNs.On("GetPooledConn", ctx).Return(b.mockConn, nil).Once()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("StmtExecuteForward", backendStmtExecData).Return(nil, gomysql.ErrBadConn).Once()
+			b.mockConn.On("ErrorClose").Return(nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			_, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtExecuteForward", stmtExecData)
-		},
-	}
-
-	tc.Run()
-}
-
-// run StmtExecute in State0 to State3 will return fsm action not allowed error
-// so we skip these cases
-func (b *BackendConnManagerTestSuite) Test_State4_StmtClose_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State0,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.StmtClose(ctx, testStmtID)
-			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
-		},
-	}
-
-	tc.Run()
-}
-
-// currently we force close all prepared statements
-func (b *BackendConnManagerTestSuite) Test_State4_StmtClose_Error_StmtClosePrepare() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State4,
-		TargetState:  State0,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.StmtClose(ctx, testStmtID)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
+			require.Equal(b.T(), gomysql.ErrBadConn, err)
+			b.mockConn.AssertCalled(b.T(), "ErrorClose")
+			b.mockConn.AssertNotCalled(b.T(), "PutBack")
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State5_StmtClose_Success() {
+func (b *BackendConnManagerTestSuite) Test_State3_StmtExecute_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State5,
-		TargetState:  State1,
+		CurrentState: State3,
+		TargetState:  State3,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(nil).Once()
+			b.prepareStmt()
+			b.mockBackendStmtPrepare()
+			b.mockConn.On("StmtExecuteForward", backendStmtExecData).Return(queryResult, nil).Once()
 		},
 		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.StmtClose(ctx, testStmtID)
+			ret, err := b.mockMgr.StmtExecuteForward(ctx, testStmtID, stmtExecData)
 			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
+			require.NotNil(b.T(), ret)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State5_StmtClose_Error_StmtClosePrepare() {
+// close only forgets the stmt, the backend stmt is kept in the stmt cache of backend conn
+func (b *BackendConnManagerTestSuite) Test_State1_StmtClose_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State5,
+		CurrentState: State1,
 		TargetState:  State1,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.StmtClose(ctx, testStmtID)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State6_StmtClose_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State6,
-		TargetState:  State2,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(nil).Once()
-			b.mockConn.On("PutBack").Return(nil).Once()
+			b.prepareStmt()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			err := b.mockMgr.StmtClose(ctx, testStmtID)
 			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
-			b.mockConn.AssertCalled(b.T(), "PutBack")
+			require.Len(b.T(), b.mockMgr.stmts, 0)
+			b.mockConn.AssertNotCalled(b.T(), "StmtClosePrepare", testStmtID)
 		},
 	}
 
 	tc.Run()
 }
 
-func (b *BackendConnManagerTestSuite) Test_State6_StmtClose_Error_StmtClosePrepare() {
+func (b *BackendConnManagerTestSuite) Test_State2_StmtClose_Success() {
 	tc := &BackendConnManagerTestCase{
 		suite:        b,
-		CurrentState: State6,
+		CurrentState: State2,
 		TargetState:  State2,
 		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(connmgrMockError).Once()
-			b.mockConn.On("ErrorClose").Return(nil).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.StmtClose(ctx, testStmtID)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
-			b.mockConn.AssertCalled(b.T(), "ErrorClose")
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_StmtClose_Success() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State3,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(nil).Once()
+			b.prepareStmt()
 		},
 		RunAndAssert: func(ctx context.Context) {
 			err := b.mockMgr.StmtClose(ctx, testStmtID)
 			require.NoError(b.T(), err)
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
-		},
-	}
-
-	tc.Run()
-}
-
-func (b *BackendConnManagerTestSuite) Test_State7_StmtClose_Error_StmtClose() {
-	tc := &BackendConnManagerTestCase{
-		suite:        b,
-		CurrentState: State7,
-		TargetState:  State3,
-		Prepare: func(ctx context.Context) {
-			b.mockConn.On("StmtClosePrepare", testStmtID).Return(connmgrMockError).Once()
-		},
-		RunAndAssert: func(ctx context.Context) {
-			err := b.mockMgr.StmtClose(ctx, testStmtID)
-			require.EqualError(b.T(), err, connmgrMockError.Error())
-			b.mockConn.AssertCalled(b.T(), "StmtClosePrepare", testStmtID)
+			require.Len(b.T(), b.mockMgr.stmts, 0)
+			b.mockNs.AssertNotCalled(b.T(), "GetPooledConn", ctx)
 		},
 	}
 
@@ -1997,3 +1187,12 @@ func (b *BackendConnManagerTestSuite) Test_State7_StmtClose_Error_StmtClose() {
 func TestBackendConnManagerTestSuite(t *testing.T) {
 	suite.Run(t, new(BackendConnManagerTestSuite))
 }
+
+func TestBackendConnManager_IsInTransaction(t *testing.T) {
+	mgr := NewBackendConnManager(getGlobalFSM(), nil)
+	require.False(t, mgr.IsInTransaction())
+	mgr.setState(State3)
+	require.True(t, mgr.IsInTransaction())
+	mgr.setState(State6)
+	require.False(t, mgr.IsInTransaction())
+}
@@ -2,12 +2,14 @@ package driver
 
 import (
 	"context"
+	"time"
 
 	"github.com/siddontang/go-mysql/mysql"
 )
 
 type NamespaceManager interface {
 	Auth(username string, pwd, salt []byte) (Namespace, bool)
+	AuthNamespace(namespace, username string, pwd, salt []byte) (Namespace, bool)
 }
 
 type Namespace interface {
@@ -17,11 +19,19 @@ type Namespace interface {
 	IsDeniedSQL(sqlFeature uint32) bool
 	IsAllowedSQL(sqlFeature uint32) bool
 	IsDeniedHost(host string) bool
+	IsLocalInfileAllowed() bool
+	GetLocalInfileMaxSize() int64
 	GetPooledConn(context.Context) (PooledBackendConn, error)
-	IncrConnCount()
-	DescConnCount()
+	// AcquireConn takes a client conn slot of the namespace and user, it may wait for the conn limits.
+	AcquireConn(ctx context.Context, username string) error
+	ReleaseConn(username string)
+	// Closed reports whether the namespace is removed, the sessions on it can not execute any statement.
+	Closed() bool
 	GetBreaker() (Breaker, error)
 	GetRateLimiter() RateLimiter
+	GetConcurrencyLimiter() ConcurrencyLimiter
+	// GetShadow returns nil if the statements are not mirrored.
+	GetShadow() Shadow
 }
 
 type Breaker interface {
@@ -40,6 +50,22 @@ type RateLimiter interface {
 	Limit(ctx context.Context, key string) error
 }
 
+type ConcurrencyLimiter interface {
+	Scope() string
+	Acquire(ctx context.Context, key string) error
+	Release(key string, latency time.Duration)
+}
+
+// Shadow mirrors the statements executed in the primary backend to a shadow backend,
+// it is asynchronous and never blocks or fails the client.
+type Shadow interface {
+	// Sample reports whether the statement is mirrored, the writes are mirrored only if allowed.
+	Sample(isWrite bool) bool
+	CompareResult() bool
+	// Mirror queues the statement, it is dropped if the queue is full.
+	Mirror(q *ShadowQuery)
+}
+
 type PooledBackendConn interface {
 	// PutBack put conn back to pool
 	PutBack()
@@ -64,7 +90,16 @@ type BackendConn interface {
 	Commit() error
 	Rollback() error
 	StmtPrepare(sql string) (Stmt, error)
+	// StmtPrepareCached returns the stmt of sql prepared in current db,
+	// the stmt is reused by the later calls until it is evicted from the cache of the conn.
+	StmtPrepareCached(sql string) (Stmt, error)
 	StmtExecuteForward(data []byte) (*mysql.Result, error)
+	// ExecuteStream and StmtExecuteForwardStream pass the rows of the resultset to the ResultWriter
+	// as they are read, the returned result only contains the fields and status.
+	ExecuteStream(command string, w ResultWriter) (*mysql.Result, error)
+	StmtExecuteForwardStream(data []byte, w ResultWriter) (*mysql.Result, error)
+	// ExecuteLoadData executes LOAD DATA LOCAL INFILE and sends the file read from r to the backend.
+	ExecuteLoadData(command string, r LocalFileReader) (*mysql.Result, error)
 	StmtClosePrepare(stmtId int) error
 	SetCharset(charset string) error
 	FieldList(table string, wildcard string) ([]*mysql.Field, error)
@@ -74,6 +109,8 @@ type BackendConn interface {
 	GetCharset() string
 	GetConnectionID() uint32
 	GetStatus() uint16
+	// GetWarnings returns the warning count of the last command.
+	GetWarnings() uint16
 }
 
 type Stmt interface {
@@ -81,3 +118,18 @@ type Stmt interface {
 	ParamNum() int
 	ColumnNum() int
 }
+
+// ResultWriter writes the resultset read from backend to the client,
+// so that a large resultset is not buffered in proxy.
+type ResultWriter interface {
+	WriteColumns(fields []*mysql.Field) error
+	// WriteRow writes a row packet, data is reused after WriteRow returns.
+	WriteRow(data []byte) error
+}
+
+// LocalFileReader reads the file of LOAD DATA LOCAL INFILE from the client.
+type LocalFileReader interface {
+	RequestFile(filename string) error
+	// ReadFilePacket reads a packet of the file, an empty packet means the end of file.
+	ReadFilePacket() ([]byte, error)
+}
@@ -16,6 +16,6 @@ func NewDriverImpl(nsmgr NamespaceManager) *DriverImpl {
 	}
 }
 
-func (d *DriverImpl) OpenCtx(connID uint64, capability uint32, collation uint8, dbname string, tlsState *tls.ConnectionState) (server.QueryCtx, error) {
-	return NewQueryCtxImpl(d.nsmgr, connID), nil
+func (d *DriverImpl) OpenCtx(connID uint64, capability uint32, collation uint8, dbname string, tlsState *tls.ConnectionState, namespace string) (server.QueryCtx, error) {
+	return NewQueryCtxImpl(d.nsmgr, connID, namespace), nil
 }
@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"context"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/mysql"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
+)
+
+// loadDataReaderKey is set only for the LOAD DATA LOCAL INFILE allowed by the namespace,
+// while the LocalFileReader set by the server with constant.ContextKeyLocalFileReader is present for every query.
+type loadDataReaderKey struct{}
+
+// limitedLocalFileReader fails the LOAD DATA LOCAL INFILE if the file exceeds maxSize.
+type limitedLocalFileReader struct {
+	LocalFileReader
+	maxSize  int64
+	size     int64
+	exceeded bool
+}
+
+func (r *limitedLocalFileReader) ReadFilePacket() ([]byte, error) {
+	data, err := r.LocalFileReader.ReadFilePacket()
+	if err != nil || r.maxSize <= 0 {
+		return data, err
+	}
+
+	r.size += int64(len(data))
+	if r.size <= r.maxSize {
+		return data, nil
+	}
+
+	// read the rest of the file, so that the client is able to receive the error.
+	for len(data) > 0 {
+		if data, err = r.LocalFileReader.ReadFilePacket(); err != nil {
+			return nil, err
+		}
+	}
+	r.exceeded = true
+	return nil, r.errTooLarge()
+}
+
+func (r *limitedLocalFileReader) errTooLarge() error {
+	return mysql.NewErrf(mysql.ErrNotAllowedCommand, "LOAD DATA LOCAL INFILE file exceeds the max size %d", r.maxSize)
+}
+
+func (q *QueryCtxImpl) loadData(ctx context.Context, sql string, stmt *ast.LoadDataStmt) (*gomysql.Result, error) {
+	if !stmt.IsLocal {
+		return q.executeInBackend(ctx, sql, stmt)
+	}
+
+	reader, ok := ctx.Value(constant.ContextKeyLocalFileReader).(LocalFileReader)
+	if !ok || !q.ns.IsLocalInfileAllowed() {
+		return nil, mysql.NewErrf(mysql.ErrNotAllowedCommand, "LOAD DATA LOCAL INFILE is not allowed")
+	}
+
+	r := &limitedLocalFileReader{LocalFileReader: reader, maxSize: q.ns.GetLocalInfileMaxSize()}
+	ret, err := q.executeInBackend(context.WithValue(ctx, loadDataReaderKey{}, r), sql, stmt)
+	if err != nil && r.exceeded {
+		// the backend conn is closed so that the partial file is not committed
+		return nil, r.errTooLarge()
+	}
+	return ret, err
+}
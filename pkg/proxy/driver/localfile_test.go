@@ -0,0 +1,66 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockLocalFileReader struct {
+	packets  [][]byte
+	filename string
+}
+
+func (r *mockLocalFileReader) RequestFile(filename string) error {
+	r.filename = filename
+	return nil
+}
+
+func (r *mockLocalFileReader) ReadFilePacket() ([]byte, error) {
+	data := r.packets[0]
+	r.packets = r.packets[1:]
+	return data, nil
+}
+
+func newMockLocalFileReader() *mockLocalFileReader {
+	return &mockLocalFileReader{
+		packets: [][]byte{[]byte("1,a\n"), []byte("2,b\n"), []byte("3,c\n"), {}},
+	}
+}
+
+func readLocalFile(r LocalFileReader) (int, error) {
+	size := 0
+	for {
+		data, err := r.ReadFilePacket()
+		if err != nil {
+			return size, err
+		}
+		if len(data) == 0 {
+			return size, nil
+		}
+		size += len(data)
+	}
+}
+
+func TestLimitedLocalFileReader(t *testing.T) {
+	// no limit
+	r := &limitedLocalFileReader{LocalFileReader: newMockLocalFileReader()}
+	size, err := readLocalFile(r)
+	require.NoError(t, err)
+	require.Equal(t, 12, size)
+	require.False(t, r.exceeded)
+
+	r = &limitedLocalFileReader{LocalFileReader: newMockLocalFileReader(), maxSize: 12}
+	size, err = readLocalFile(r)
+	require.NoError(t, err)
+	require.Equal(t, 12, size)
+
+	// the rest of the file is read from the client when the limit is exceeded
+	mr := newMockLocalFileReader()
+	r = &limitedLocalFileReader{LocalFileReader: mr, maxSize: 6}
+	size, err = readLocalFile(r)
+	require.Error(t, err)
+	require.Equal(t, 4, size)
+	require.True(t, r.exceeded)
+	require.Empty(t, mr.packets)
+}
@@ -25,11 +25,19 @@ func (_m *MockNamespace) IsDeniedHost(host string) bool {
 	panic("implement me")
 }
 
-func (_m *MockNamespace) IncrConnCount() {
+func (_m *MockNamespace) IsLocalInfileAllowed() bool {
 	panic("implement me")
 }
 
-func (_m *MockNamespace) DescConnCount() {
+func (_m *MockNamespace) GetLocalInfileMaxSize() int64 {
+	panic("implement me")
+}
+
+func (_m *MockNamespace) AcquireConn(ctx context.Context, username string) error {
+	panic("implement me")
+}
+
+func (_m *MockNamespace) ReleaseConn(username string) {
 	panic("implement me")
 }
 
@@ -41,6 +49,14 @@ func (_m *MockNamespace) GetRateLimiter() RateLimiter {
 	panic("implement me")
 }
 
+func (_m *MockNamespace) GetConcurrencyLimiter() ConcurrencyLimiter {
+	panic("implement me")
+}
+
+func (_m *MockNamespace) GetShadow() Shadow {
+	panic("implement me")
+}
+
 // GetPooledConn provides a mock function with given fields: _a0
 func (_m *MockNamespace) GetPooledConn(_a0 context.Context) (PooledBackendConn, error) {
 	ret := _m.Called(_a0)
@@ -78,6 +94,20 @@ func (_m *MockNamespace) IsDatabaseAllowed(db string) bool {
 	return r0
 }
 
+// Closed provides a mock function with given fields:
+func (_m *MockNamespace) Closed() bool {
+	ret := _m.Called()
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func() bool); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
 // ListDatabases provides a mock function with given fields:
 func (_m *MockNamespace) ListDatabases() []string {
 	ret := _m.Called()
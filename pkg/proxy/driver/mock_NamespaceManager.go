@@ -31,3 +31,26 @@ func (_m *MockNamespaceManager) Auth(username string, pwd []byte, salt []byte) (
 
 	return r0, r1
 }
+
+// AuthNamespace provides a mock function with given fields: namespace, username, pwd, salt
+func (_m *MockNamespaceManager) AuthNamespace(namespace string, username string, pwd []byte, salt []byte) (Namespace, bool) {
+	ret := _m.Called(namespace, username, pwd, salt)
+
+	var r0 Namespace
+	if rf, ok := ret.Get(0).(func(string, string, []byte, []byte) Namespace); ok {
+		r0 = rf(namespace, username, pwd, salt)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(Namespace)
+		}
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(string, string, []byte, []byte) bool); ok {
+		r1 = rf(namespace, username, pwd, salt)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
@@ -80,6 +80,52 @@ func (_m *MockSimpleBackendConn) Execute(command string, args ...interface{}) (*
 	return r0, r1
 }
 
+// ExecuteLoadData provides a mock function with given fields: command, r
+func (_m *MockSimpleBackendConn) ExecuteLoadData(command string, r LocalFileReader) (*mysql.Result, error) {
+	ret := _m.Called(command, r)
+
+	var r0 *mysql.Result
+	if rf, ok := ret.Get(0).(func(string, LocalFileReader) *mysql.Result); ok {
+		r0 = rf(command, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mysql.Result)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, LocalFileReader) error); ok {
+		r1 = rf(command, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExecuteStream provides a mock function with given fields: command, w
+func (_m *MockSimpleBackendConn) ExecuteStream(command string, w ResultWriter) (*mysql.Result, error) {
+	ret := _m.Called(command, w)
+
+	var r0 *mysql.Result
+	if rf, ok := ret.Get(0).(func(string, ResultWriter) *mysql.Result); ok {
+		r0 = rf(command, w)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mysql.Result)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, ResultWriter) error); ok {
+		r1 = rf(command, w)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FieldList provides a mock function with given fields: table, wildcard
 func (_m *MockSimpleBackendConn) FieldList(table string, wildcard string) ([]*mysql.Field, error) {
 	ret := _m.Called(table, wildcard)
@@ -159,6 +205,20 @@ func (_m *MockSimpleBackendConn) GetStatus() uint16 {
 	return r0
 }
 
+// GetWarnings provides a mock function with given fields:
+func (_m *MockSimpleBackendConn) GetWarnings() uint16 {
+	ret := _m.Called()
+
+	var r0 uint16
+	if rf, ok := ret.Get(0).(func() uint16); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(uint16)
+	}
+
+	return r0
+}
+
 // IsAutoCommit provides a mock function with given fields:
 func (_m *MockSimpleBackendConn) IsAutoCommit() bool {
 	ret := _m.Called()
@@ -280,6 +340,29 @@ func (_m *MockSimpleBackendConn) StmtExecuteForward(data []byte) (*mysql.Result,
 	return r0, r1
 }
 
+// StmtExecuteForwardStream provides a mock function with given fields: data, w
+func (_m *MockSimpleBackendConn) StmtExecuteForwardStream(data []byte, w ResultWriter) (*mysql.Result, error) {
+	ret := _m.Called(data, w)
+
+	var r0 *mysql.Result
+	if rf, ok := ret.Get(0).(func([]byte, ResultWriter) *mysql.Result); ok {
+		r0 = rf(data, w)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mysql.Result)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte, ResultWriter) error); ok {
+		r1 = rf(data, w)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // StmtPrepare provides a mock function with given fields: sql
 func (_m *MockSimpleBackendConn) StmtPrepare(sql string) (Stmt, error) {
 	ret := _m.Called(sql)
@@ -303,6 +386,29 @@ func (_m *MockSimpleBackendConn) StmtPrepare(sql string) (Stmt, error) {
 	return r0, r1
 }
 
+// StmtPrepareCached provides a mock function with given fields: sql
+func (_m *MockSimpleBackendConn) StmtPrepareCached(sql string) (Stmt, error) {
+	ret := _m.Called(sql)
+
+	var r0 Stmt
+	if rf, ok := ret.Get(0).(func(string) Stmt); ok {
+		r0 = rf(sql)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(Stmt)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(sql)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UseDB provides a mock function with given fields: dbName
 func (_m *MockSimpleBackendConn) UseDB(dbName string) error {
 	ret := _m.Called(dbName)
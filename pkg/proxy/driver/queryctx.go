@@ -13,6 +13,7 @@ import (
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/util"
 	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
 	"github.com/tidb-incubator/weir/pkg/proxy/server"
 	wast "github.com/tidb-incubator/weir/pkg/util/ast"
 	cb "github.com/tidb-incubator/weir/pkg/util/rate_limit_breaker/circuit_breaker"
@@ -35,22 +36,39 @@ const (
 )
 
 type QueryCtxImpl struct {
-	connId      uint64
-	nsmgr       NamespaceManager
-	ns          Namespace
-	currentDB   string
-	parser      *parser.Parser
-	sessionVars *SessionVarsWrapper
+	connId       uint64
+	nsmgr        NamespaceManager
+	ns           Namespace
+	boundNs      string // the namespace bound to the listener, empty means finding it by the username.
+	username     string
+	connAcquired bool
+	currentDB    string
+	parser       *parser.Parser
+	sessionVars  *SessionVarsWrapper
 
 	connMgr *BackendConnManager
+	// stmtLimitInfos keeps the concurrency limiter key info of the prepared stmts, key: stmt id
+	stmtLimitInfos map[int]*stmtLimitInfo
+	// lastInsertIDStmts are the prepared stmts reading LAST_INSERT_ID(), key: stmt id
+	lastInsertIDStmts map[int]struct{}
 }
 
-func NewQueryCtxImpl(nsmgr NamespaceManager, connId uint64) *QueryCtxImpl {
+// stmtLimitInfo is extracted in COM_STMT_PREPARE, so that COM_STMT_EXECUTE is limited without parsing the sql again.
+type stmtLimitInfo struct {
+	tableName string
+	sqlDigest uint32
+}
+
+func NewQueryCtxImpl(nsmgr NamespaceManager, connId uint64, boundNs string) *QueryCtxImpl {
 	return &QueryCtxImpl{
 		connId:      connId,
 		nsmgr:       nsmgr,
+		boundNs:     boundNs,
 		parser:      parser.New(),
 		sessionVars: NewSessionVarsWrapper(variable.NewSessionVars()),
+
+		stmtLimitInfos:    make(map[int]*stmtLimitInfo),
+		lastInsertIDStmts: make(map[int]struct{}),
 	}
 }
 
@@ -58,6 +76,14 @@ func (q *QueryCtxImpl) Status() uint16 {
 	return q.sessionVars.Status()
 }
 
+// InTransaction reads the state of BackendConnManager rather than Status, which is updated after the command.
+func (q *QueryCtxImpl) InTransaction() bool {
+	if q.connMgr == nil {
+		return false
+	}
+	return q.connMgr.IsInTransaction()
+}
+
 func (q *QueryCtxImpl) LastInsertID() uint64 {
 	return q.sessionVars.LastInsertID()
 }
@@ -105,6 +131,9 @@ func (q *QueryCtxImpl) CurrentDB() string {
 }
 
 func (q *QueryCtxImpl) Execute(ctx context.Context, sql string) (*gomysql.Result, error) {
+	if err := q.checkNamespaceClosed(); err != nil {
+		return nil, err
+	}
 	charsetInfo, collation := q.sessionVars.GetCharsetInfo()
 	stmt, err := q.parser.ParseOneStmt(sql, charsetInfo, collation)
 	if err != nil {
@@ -129,6 +158,14 @@ func (q *QueryCtxImpl) Execute(ctx context.Context, sql string) (*gomysql.Result
 		return q.execute(ctx, sql, stmt)
 	}
 
+	if q.isStmtNeedToLimitConcurrency(stmt) {
+		release, err := q.acquireConcurrencyLimiter(ctx, sqlDigest)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
 	if !q.isStmtNeedToCheckCircuitBreaking(stmt) {
 		return q.execute(ctx, sql, stmt)
 	}
@@ -200,10 +237,33 @@ func (q *QueryCtxImpl) SetClientCapability(capability uint32) {
 }
 
 func (q *QueryCtxImpl) Prepare(ctx context.Context, sql string) (stmtId int, columns, params []*server.ColumnInfo, err error) {
+	if err = q.checkNamespaceClosed(); err != nil {
+		return -1, nil, nil, err
+	}
+	// the backend reports the error if the sql can not be parsed here
+	charsetInfo, collation := q.sessionVars.GetCharsetInfo()
+	var limitInfo *stmtLimitInfo
+	var readLastInsertID bool
+	if stmtNode, parseErr := q.parser.ParseOneStmt(sql, charsetInfo, collation); parseErr == nil {
+		if err = q.pinBackendConnIfNeeded(ctx, stmtNode); err != nil {
+			return -1, nil, nil, err
+		}
+		if q.isStmtNeedToLimitConcurrency(stmtNode) {
+			limitInfo = extractStmtLimitInfo(stmtNode)
+		}
+		readLastInsertID = wast.ReadsLastInsertID(stmtNode)
+	}
+
 	stmt, err := q.connMgr.StmtPrepare(ctx, q.currentDB, sql)
 	if err != nil {
 		return -1, nil, nil, err
 	}
+	if limitInfo != nil {
+		q.stmtLimitInfos[stmt.ID()] = limitInfo
+	}
+	if readLastInsertID {
+		q.lastInsertIDStmts[stmt.ID()] = struct{}{}
+	}
 
 	columns = createBinaryPrepareColumns(stmt.ColumnNum())
 	params = createBinaryPrepareParams(stmt.ParamNum())
@@ -211,14 +271,43 @@ func (q *QueryCtxImpl) Prepare(ctx context.Context, sql string) (stmtId int, col
 }
 
 func (q *QueryCtxImpl) StmtExecuteForward(ctx context.Context, stmtId int, data []byte) (*gomysql.Result, error) {
+	if err := q.checkNamespaceClosed(); err != nil {
+		return nil, err
+	}
+	if limitInfo, ok := q.stmtLimitInfos[stmtId]; ok {
+		ctx = wast.CtxWithAstTableName(ctx, limitInfo.tableName)
+		release, err := q.acquireConcurrencyLimiter(ctx, limitInfo.sqlDigest)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+	if _, ok := q.lastInsertIDStmts[stmtId]; ok {
+		ctx = context.WithValue(ctx, constant.ContextKeyReadLastInsertID, true)
+	}
 	return q.connMgr.StmtExecuteForward(ctx, stmtId, data)
 }
 
 func (q *QueryCtxImpl) StmtClose(ctx context.Context, stmtId int) error {
+	delete(q.stmtLimitInfos, stmtId)
+	delete(q.lastInsertIDStmts, stmtId)
 	return q.connMgr.StmtClose(ctx, stmtId)
 }
 
+// ResetSession clears the session state for COM_RESET_CONNECTION, the current db is kept as MySQL does.
+func (q *QueryCtxImpl) ResetSession(ctx context.Context) error {
+	err := q.connMgr.ResetSession(ctx)
+	q.stmtLimitInfos = make(map[int]*stmtLimitInfo)
+	q.lastInsertIDStmts = make(map[int]struct{})
+	q.connMgr.MergeStatus(q.sessionVars)
+	q.sessionVars.SetLastInsertID(0)
+	return err
+}
+
 func (q *QueryCtxImpl) FieldList(tableName string) ([]*server.ColumnInfo, error) {
+	if err := q.checkNamespaceClosed(); err != nil {
+		return nil, err
+	}
 	conn, err := q.ns.GetPooledConn(context.Background())
 	if err != nil {
 		return nil, err
@@ -239,8 +328,9 @@ func (q *QueryCtxImpl) FieldList(tableName string) ([]*server.ColumnInfo, error)
 }
 
 func (q *QueryCtxImpl) Close() error {
-	if q.ns != nil {
-		q.ns.DescConnCount()
+	if q.connAcquired {
+		q.ns.ReleaseConn(q.username)
+		q.connAcquired = false
 	}
 	if q.connMgr != nil {
 		return q.connMgr.Close()
@@ -249,16 +339,38 @@ func (q *QueryCtxImpl) Close() error {
 }
 
 func (q *QueryCtxImpl) Auth(user *auth.UserIdentity, pwd []byte, salt []byte) bool {
-	ns, ok := q.nsmgr.Auth(user.Username, pwd, salt)
-	if !ok || ns.IsDeniedHost(user.Hostname){
+	var ns Namespace
+	var ok bool
+	if q.boundNs != "" {
+		ns, ok = q.nsmgr.AuthNamespace(q.boundNs, user.Username, pwd, salt)
+	} else {
+		ns, ok = q.nsmgr.Auth(user.Username, pwd, salt)
+	}
+	if !ok || ns.IsDeniedHost(user.Hostname) {
 		return false
 	}
 	q.ns = ns
+	q.username = user.Username
 	q.initAttachedConnHolder()
-	q.ns.IncrConnCount()
 	return true
 }
 
+func (q *QueryCtxImpl) Namespace() string {
+	if q.ns == nil {
+		return ""
+	}
+	return q.ns.Name()
+}
+
+// AcquireConn checks the conn limits of the namespace and user after auth.
+func (q *QueryCtxImpl) AcquireConn(ctx context.Context) error {
+	if err := q.ns.AcquireConn(ctx, q.username); err != nil {
+		return err
+	}
+	q.connAcquired = true
+	return nil
+}
+
 // TODO(eastfisher): does weir need to support show processlist?
 func (*QueryCtxImpl) ShowProcess() *util.ProcessInfo {
 	return nil
@@ -277,11 +389,35 @@ func (*QueryCtxImpl) SetSessionManager(util.SessionManager) {
 	return
 }
 
+// checkNamespaceClosed returns an error if the namespace of the session is removed,
+// rather than letting the session use the namespace which no longer exists.
+func (q *QueryCtxImpl) checkNamespaceClosed() error {
+	if q.ns.Closed() {
+		return mysql.NewErrf(mysql.ErrUnknown, "Namespace %s is removed", q.ns.Name())
+	}
+	return nil
+}
+
 func (q *QueryCtxImpl) initAttachedConnHolder() {
 	connMgr := NewBackendConnManager(getGlobalFSM(), q.ns)
 	q.connMgr = connMgr
 }
 
+func (q *QueryCtxImpl) isStmtNeedToLimitConcurrency(stmt ast.StmtNode) bool {
+	switch stmt.(type) {
+	case *ast.SelectStmt:
+		return true
+	case *ast.InsertStmt:
+		return true
+	case *ast.UpdateStmt:
+		return true
+	case *ast.DeleteStmt:
+		return true
+	default:
+		return false
+	}
+}
+
 func (q *QueryCtxImpl) isStmtNeedToCheckCircuitBreaking(stmt ast.StmtNode) bool {
 	breaker, err := q.ns.GetBreaker()
 	if err != nil {
@@ -4,9 +4,11 @@ import (
 	"context"
 	"hash/crc32"
 	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/util/logutil"
@@ -60,6 +62,48 @@ func (q *QueryCtxImpl) getRateLimiterKey(ctx context.Context, rateLimiter RateLi
 	}
 }
 
+func (q *QueryCtxImpl) getConcurrencyLimiterKey(ctx context.Context, concurrencyLimiter ConcurrencyLimiter, sqlDigest uint32) (string, bool) {
+	switch concurrencyLimiter.Scope() {
+	case "namespace":
+		return q.ns.Name(), true
+	case "table":
+		firstTableName, _ := wast.GetAstTableNameFromCtx(ctx)
+		return firstTableName, true
+	case "sql":
+		return string(wast.UInt322Bytes(sqlDigest)), true
+	default:
+		return "", false
+	}
+}
+
+// acquireConcurrencyLimiter waits for a slot of the concurrency limiter, release must be called after the statement.
+func (q *QueryCtxImpl) acquireConcurrencyLimiter(ctx context.Context, sqlDigest uint32) (release func(), err error) {
+	concurrencyLimiter := q.ns.GetConcurrencyLimiter()
+	limitKey, ok := q.getConcurrencyLimiterKey(ctx, concurrencyLimiter, sqlDigest)
+	if !ok || limitKey == "" {
+		return func() {}, nil
+	}
+	if err := concurrencyLimiter.Acquire(ctx, limitKey); err != nil {
+		return nil, err
+	}
+	startTime := time.Now()
+	return func() {
+		concurrencyLimiter.Release(limitKey, time.Since(startTime))
+	}, nil
+}
+
+func extractStmtLimitInfo(stmtNode ast.StmtNode) *stmtLimitInfo {
+	tableName := wast.ExtractFirstTableNameFromStmt(stmtNode)
+	visitor, err := wast.ExtractAstVisit(stmtNode)
+	if err != nil {
+		return nil
+	}
+	return &stmtLimitInfo{
+		tableName: tableName,
+		sqlDigest: crc32.ChecksumIEEE([]byte(visitor.SqlFeature())),
+	}
+}
+
 func (q *QueryCtxImpl) extractSqlParadigm(ctx context.Context, sql string) (string, error) {
 	charsetInfo, collation := q.sessionVars.GetCharsetInfo()
 	featureStmt, err := q.parser.ParseOneStmt(sql, charsetInfo, collation)
@@ -76,28 +120,54 @@ func (q *QueryCtxImpl) extractSqlParadigm(ctx context.Context, sql string) (stri
 func (q *QueryCtxImpl) executeStmt(ctx context.Context, sql string, stmtNode ast.StmtNode) (*gomysql.Result, error) {
 	switch stmt := stmtNode.(type) {
 	case *ast.SetStmt:
+		if hasUserVariableAssignment(stmt) {
+			return q.setUserVariable(ctx, sql, stmt)
+		}
 		return nil, q.setVariable(ctx, stmt)
 	case *ast.UseStmt:
 		return nil, q.useDB(ctx, stmt.DBName)
 	case *ast.ShowStmt:
 		return q.executeShowStmt(ctx, sql, stmt)
+	case *ast.LoadDataStmt:
+		return q.loadData(ctx, sql, stmt)
 	case *ast.BeginStmt:
 		return nil, q.begin(ctx)
 	case *ast.CommitStmt:
 		return nil, q.commitOrRollback(ctx, true)
 	case *ast.RollbackStmt:
 		return nil, q.commitOrRollback(ctx, false)
+	case *ast.SelectStmt:
+		if fn, name, ok := wast.GetRowCountFunc(stmt); ok {
+			if rowCount, foundRows, ok := q.connMgr.ReadRowCounts(); ok {
+				return createRowCountResult(fn, name, rowCount, foundRows)
+			}
+		}
+		return q.executeInBackend(ctx, sql, stmtNode)
 	default:
 		return q.executeInBackend(ctx, sql, stmtNode)
 	}
 }
 
+// createRowCountResult returns the result of the bare SELECT FOUND_ROWS() or SELECT ROW_COUNT().
+func createRowCountResult(fn, name string, rowCount int64, foundRows uint64) (*gomysql.Result, error) {
+	var value interface{} = rowCount
+	if fn == ast.FoundRows {
+		value = foundRows
+	}
+	return createTextResult([]string{name}, [][]interface{}{{value}})
+}
+
 func (q *QueryCtxImpl) executeShowStmt(ctx context.Context, sql string, stmt *ast.ShowStmt) (*gomysql.Result, error) {
 	switch stmt.Tp {
 	case ast.ShowDatabases:
 		databases := q.ns.ListDatabases()
 		result, err := createShowDatabasesResult(databases)
 		return result, err
+	case ast.ShowWarnings, ast.ShowErrors:
+		if warnings, ok := q.connMgr.LastWarnings(); ok {
+			return createShowWarningsResult(warnings, stmt.Tp == ast.ShowErrors)
+		}
+		return q.executeInBackend(ctx, sql, stmt)
 	default:
 		return q.executeInBackend(ctx, sql, stmt)
 	}
@@ -108,8 +178,23 @@ func createShowDatabasesResult(dbNames []string) (*gomysql.Result, error) {
 	for _, db := range dbNames {
 		values = append(values, []interface{}{db})
 	}
+	return createTextResult([]string{"Database"}, values)
+}
 
-	rs, err := gomysql.BuildSimpleTextResultset([]string{"Database"}, values)
+// createShowWarningsResult returns the warnings kept by BackendConnManager, only the errors are returned for SHOW ERRORS.
+func createShowWarningsResult(warnings []backendWarning, errorsOnly bool) (*gomysql.Result, error) {
+	values := make([][]interface{}, 0, len(warnings))
+	for _, w := range warnings {
+		if errorsOnly && w.level != "Error" {
+			continue
+		}
+		values = append(values, []interface{}{w.level, w.code, w.message})
+	}
+	return createTextResult([]string{"Level", "Code", "Message"}, values)
+}
+
+func createTextResult(names []string, values [][]interface{}) (*gomysql.Result, error) {
+	rs, err := gomysql.BuildSimpleTextResultset(names, values)
 	if err != nil {
 		return nil, err
 	}
@@ -141,9 +226,22 @@ func createShowDatabasesResult(dbNames []string) (*gomysql.Result, error) {
 }
 
 func (q *QueryCtxImpl) executeInBackend(ctx context.Context, sql string, stmtNode ast.StmtNode) (*gomysql.Result, error) {
+	if err := q.pinBackendConnIfNeeded(ctx, stmtNode); err != nil {
+		return nil, err
+	}
+
 	ctx = context.WithValue(ctx, constant.ContextKeySessionVariable, q.sessionVars.GetAllSystemVars())
+	if wast.ReadsLastInsertID(stmtNode) {
+		ctx = context.WithValue(ctx, constant.ContextKeyReadLastInsertID, true)
+	}
 
-	result, err := q.connMgr.Query(ctx, q.currentDB, sql)
+	var result *gomysql.Result
+	var err error
+	if shadow, ok := q.getShadowToMirror(stmtNode); ok {
+		result, err = q.queryAndMirror(ctx, shadow, sql)
+	} else {
+		result, err = q.connMgr.Query(ctx, q.currentDB, sql)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -158,6 +256,14 @@ func (q *QueryCtxImpl) executeInBackend(ctx context.Context, sql string, stmtNod
 	return result, nil
 }
 
+func (q *QueryCtxImpl) pinBackendConnIfNeeded(ctx context.Context, stmtNode ast.StmtNode) error {
+	reason, ok := wast.GetPinConnReason(stmtNode)
+	if !ok {
+		return nil
+	}
+	return q.connMgr.Pin(ctx, reason)
+}
+
 func (q *QueryCtxImpl) useDB(ctx context.Context, db string) error {
 	if !q.ns.IsDatabaseAllowed(db) {
 		return mysql.NewErrf(mysql.ErrDBaccessDenied, "db %s access denied", db)
@@ -197,6 +303,41 @@ func (q *QueryCtxImpl) setVariable(ctx context.Context, stmt *ast.SetStmt) error
 	return nil
 }
 
+func hasUserVariableAssignment(stmt *ast.SetStmt) bool {
+	for _, v := range stmt.Variables {
+		if wast.IsUserVariableAssignment(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// user variables are kept in the pinned backend conn, while system variables are kept in proxy,
+// so a statement setting both is split. The system variables are set first, since they are checked before set.
+func (q *QueryCtxImpl) setUserVariable(ctx context.Context, sql string, stmt *ast.SetStmt) (*gomysql.Result, error) {
+	var userVars, otherVars []*ast.VariableAssignment
+	for _, v := range stmt.Variables {
+		if wast.IsUserVariableAssignment(v) {
+			userVars = append(userVars, v)
+		} else {
+			otherVars = append(otherVars, v)
+		}
+	}
+	if len(otherVars) == 0 {
+		return q.executeInBackend(ctx, sql, stmt)
+	}
+
+	if err := q.setVariable(ctx, &ast.SetStmt{Variables: otherVars}); err != nil {
+		return nil, err
+	}
+	userStmt := &ast.SetStmt{Variables: userVars}
+	var sb strings.Builder
+	if err := userStmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return nil, err
+	}
+	return q.executeInBackend(ctx, sb.String(), userStmt)
+}
+
 // set other system variables except autocommit
 func (q *QueryCtxImpl) setSysVars(ctx context.Context, vars []*ast.VariableAssignment) error {
 	for _, v := range vars {
@@ -32,3 +32,15 @@ func TestFirstTableNameVisitor_TableName(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractStmtLimitInfo(t *testing.T) {
+	p := parser.New()
+	stmt1, err := p.ParseOneStmt("SELECT * FROM tbl1 WHERE id = ?", "", "")
+	assert.NoError(t, err)
+	info1 := extractStmtLimitInfo(stmt1)
+	assert.Equal(t, "tbl1", info1.tableName)
+
+	stmt2, err := p.ParseOneStmt("select *  from tbl1 where id=?", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, info1.sqlDigest, extractStmtLimitInfo(stmt2).sqlDigest)
+}
@@ -0,0 +1,230 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+)
+
+func TestMain(m *testing.M) {
+	metrics.RegisterProxyMetrics("test_cluster")
+	os.Exit(m.Run())
+}
+
+// testNamespace disables the sql lists, the breaker, the limiters and the shadow of MockNamespace.
+type testNamespace struct {
+	*MockNamespace
+}
+
+func (n *testNamespace) IsDeniedSQL(sqlFeature uint32) bool {
+	return false
+}
+
+func (n *testNamespace) IsAllowedSQL(sqlFeature uint32) bool {
+	return false
+}
+
+func (n *testNamespace) GetBreaker() (Breaker, error) {
+	return nil, errors.New("no breaker")
+}
+
+func (n *testNamespace) GetConcurrencyLimiter() ConcurrencyLimiter {
+	return noopConcurrencyLimiter{}
+}
+
+func (n *testNamespace) GetShadow() Shadow {
+	return nil
+}
+
+type noopConcurrencyLimiter struct{}
+
+func (noopConcurrencyLimiter) Scope() string                         { return "" }
+func (noopConcurrencyLimiter) Acquire(context.Context, string) error { return nil }
+func (noopConcurrencyLimiter) Release(string, time.Duration)         {}
+
+// lastInsertIDConn emulates LAST_INSERT_ID() and SHOW WARNINGS of a backend conn, and records the commands.
+type lastInsertIDConn struct {
+	*MockPooledBackendConn
+	lastInsertID uint64
+	nextID       uint64
+	warnings     uint16
+	commands     []string
+}
+
+func newLastInsertIDConn(lastInsertID, nextID uint64) *lastInsertIDConn {
+	conn := &lastInsertIDConn{
+		MockPooledBackendConn: new(MockPooledBackendConn),
+		lastInsertID:          lastInsertID,
+		nextID:                nextID,
+	}
+	conn.On("UseDB", mock.Anything).Return(nil)
+	conn.On("PutBack").Return()
+	return conn
+}
+
+func (c *lastInsertIDConn) Execute(command string, args ...interface{}) (*gomysql.Result, error) {
+	c.warnings = 0
+	c.commands = append(c.commands, command)
+	switch {
+	case strings.HasPrefix(command, "insert"):
+		c.lastInsertID = c.nextID
+		c.nextID++
+		c.warnings = 1
+		return &gomysql.Result{AffectedRows: 1, InsertId: c.lastInsertID}, nil
+	case strings.HasPrefix(command, "SELECT LAST_INSERT_ID("):
+		if _, err := fmt.Sscanf(command, "SELECT LAST_INSERT_ID(%d)", &c.lastInsertID); err != nil {
+			return nil, err
+		}
+		return createTextResult([]string{"LAST_INSERT_ID()"}, [][]interface{}{{c.lastInsertID}})
+	case command == "select last_insert_id()":
+		return createTextResult([]string{"last_insert_id()"}, [][]interface{}{{c.lastInsertID}})
+	case command == "SHOW WARNINGS":
+		return createTextResult([]string{"Level", "Code", "Message"}, [][]interface{}{{"Warning", uint64(1265), "Data truncated"}})
+	case strings.HasPrefix(command, "update"):
+		return &gomysql.Result{AffectedRows: 3}, nil
+	case command == "select * from t":
+		return createTextResult([]string{"a"}, [][]interface{}{{int64(1)}, {int64(2)}})
+	default:
+		return &gomysql.Result{}, nil
+	}
+}
+
+func (c *lastInsertIDConn) GetWarnings() uint16 {
+	return c.warnings
+}
+
+func createTestQueryCtx(conns ...PooledBackendConn) *QueryCtxImpl {
+	ns := &testNamespace{MockNamespace: new(MockNamespace)}
+	ns.On("Name").Return("test_ns")
+	ns.On("Closed").Return(false)
+	for _, conn := range conns {
+		ns.On("GetPooledConn", mock.Anything).Return(conn, nil).Once()
+	}
+	q := NewQueryCtxImpl(nil, 1, "")
+	q.ns = ns
+	q.initAttachedConnHolder()
+	return q
+}
+
+func TestQueryCtxImpl_NamespaceClosed(t *testing.T) {
+	ctx := context.Background()
+	ns := new(MockNamespace)
+	ns.On("Name").Return("test_ns")
+	ns.On("Closed").Return(true)
+	q := NewQueryCtxImpl(nil, 1, "")
+	q.ns = ns
+	q.initAttachedConnHolder()
+
+	assertClosedErr := func(err error) {
+		sqlErr, ok := err.(*mysql.SQLError)
+		assert.True(t, ok)
+		assert.Equal(t, "Namespace test_ns is removed", sqlErr.Message)
+	}
+	_, err := q.Execute(ctx, "select 1")
+	assertClosedErr(err)
+	stmtId, _, _, err := q.Prepare(ctx, "select ?")
+	assertClosedErr(err)
+	assert.Equal(t, -1, stmtId)
+	_, err = q.StmtExecuteForward(ctx, 1, nil)
+	assertClosedErr(err)
+	_, err = q.FieldList("tbl1")
+	assertClosedErr(err)
+}
+
+func TestQueryCtxImpl_LastInsertID(t *testing.T) {
+	ctx := context.Background()
+	// the INSERT and the SELECT run on different pooled conns, conn2 keeps the id of another session
+	conn1 := newLastInsertIDConn(0, 100)
+	conn2 := newLastInsertIDConn(7, 200)
+	q := createTestQueryCtx(conn1, conn2)
+
+	_, err := q.Execute(ctx, "insert into t (a) values (1)")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), q.LastInsertID())
+	result, err := q.Execute(ctx, "select last_insert_id()")
+	assert.NoError(t, err)
+	id, err := result.GetUint(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), id)
+}
+
+func TestQueryCtxImpl_ShowWarnings(t *testing.T) {
+	ctx := context.Background()
+	conn1 := newLastInsertIDConn(0, 100)
+	conn2 := newLastInsertIDConn(0, 200)
+	q := createTestQueryCtx(conn1, conn2)
+
+	// the warnings are read from the conn of the INSERT, SHOW WARNINGS does not take a conn
+	_, err := q.Execute(ctx, "insert into t (a) values ('abc')")
+	assert.NoError(t, err)
+	result, err := q.Execute(ctx, "show warnings")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.RowNumber())
+	msg, err := result.GetString(0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "Data truncated", msg)
+	result, err = q.Execute(ctx, "show errors")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.RowNumber())
+
+	_, err = q.Execute(ctx, "update t set a = 1")
+	assert.NoError(t, err)
+	result, err = q.Execute(ctx, "show warnings")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, result.RowNumber())
+}
+
+func TestQueryCtxImpl_RowCountAndFoundRows(t *testing.T) {
+	ctx := context.Background()
+	conn1 := newLastInsertIDConn(0, 100)
+	conn2 := newLastInsertIDConn(0, 200)
+	q := createTestQueryCtx(conn1, conn2)
+
+	readInt := func(sql string) int64 {
+		result, err := q.Execute(ctx, sql)
+		assert.NoError(t, err)
+		v, err := result.GetInt(0, 0)
+		assert.NoError(t, err)
+		return v
+	}
+
+	// the values are kept by proxy, the readers do not take a conn
+	_, err := q.Execute(ctx, "update t set a = 1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), readInt("select row_count()"))
+	// the reader is the last statement then
+	assert.Equal(t, int64(-1), readInt("select row_count()"))
+
+	_, err = q.Execute(ctx, "select * from t")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), readInt("select found_rows()"))
+	assert.Equal(t, int64(1), readInt("select found_rows()"))
+	assert.Empty(t, conn2.commands[1:])
+}
+
+func TestQueryCtxImpl_SetUserAndSystemVariables(t *testing.T) {
+	ctx := context.Background()
+	conn := newLastInsertIDConn(0, 100)
+	q := createTestQueryCtx(conn)
+
+	// the user variable is set on the pinned conn, and the system variable is kept by proxy
+	_, err := q.Execute(ctx, "set @a = 1, sql_mode = ''")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SET @`a`=1"}, conn.commands)
+	assert.Contains(t, q.sessionVars.GetAllSystemVars(), "sql_mode")
+
+	// nothing is set if the system variable is invalid
+	_, err = q.Execute(ctx, "set @b = 1, unknown_var = 1")
+	assert.Error(t, err)
+	assert.Len(t, conn.commands, 1)
+}
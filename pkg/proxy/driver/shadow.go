@@ -0,0 +1,104 @@
+package driver
+
+import (
+	"context"
+	"hash/crc32"
+	"time"
+
+	"github.com/pingcap/parser/ast"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
+	wast "github.com/tidb-incubator/weir/pkg/util/ast"
+)
+
+// ShadowQuery is a statement executed in the primary backend, with the result to compare.
+type ShadowQuery struct {
+	DB       string
+	SQL      string
+	Digest   uint32
+	Duration time.Duration
+	Err      error
+
+	// SessionVars are the system variables of the session, which are replayed in the shadow backend conn.
+	SessionVars map[string]*ast.VariableAssignment
+
+	// the result is only set if Shadow.CompareResult is true.
+	AffectedRows uint64
+	Checksum     ResultChecksum
+}
+
+// ResultChecksum sums up the crc32 of the row packets, so that the rows in a different order
+// have the same checksum.
+type ResultChecksum struct {
+	Rows uint64
+	Sum  uint32
+}
+
+func (c *ResultChecksum) AddRow(data []byte) {
+	c.Rows++
+	c.Sum += crc32.ChecksumIEEE(data)
+}
+
+// AddResult adds the rows of a resultset which is not streamed.
+func (c *ResultChecksum) AddResult(result *gomysql.Result) {
+	if result == nil || result.Resultset == nil {
+		return
+	}
+	for _, row := range result.RowDatas {
+		c.AddRow(row)
+	}
+}
+
+// checksumResultWriter computes the checksum of the rows streamed to the client.
+type checksumResultWriter struct {
+	ResultWriter
+	checksum *ResultChecksum
+}
+
+func (w *checksumResultWriter) WriteRow(data []byte) error {
+	w.checksum.AddRow(data)
+	return w.ResultWriter.WriteRow(data)
+}
+
+// getShadowToMirror returns the shadow if the statement is sampled. The statements in transaction
+// are not mirrored, since the shadow backend does not see the uncommitted data. Neither are the statements
+// reading the user variables or the state of the last statement, which are not in the shadow backend conn.
+func (q *QueryCtxImpl) getShadowToMirror(stmtNode ast.StmtNode) (Shadow, bool) {
+	var isWrite bool
+	switch stmtNode.(type) {
+	case *ast.SelectStmt, *ast.UnionStmt:
+	case *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+		isWrite = true
+	default:
+		return nil, false
+	}
+	shadow := q.ns.GetShadow()
+	if shadow == nil || q.connMgr.IsInTransaction() || wast.ReadsSessionState(stmtNode) || !shadow.Sample(isWrite) {
+		return nil, false
+	}
+	return shadow, true
+}
+
+// queryAndMirror executes the statement in the primary backend, then mirrors it to the shadow.
+func (q *QueryCtxImpl) queryAndMirror(ctx context.Context, shadow Shadow, sql string) (*gomysql.Result, error) {
+	query := &ShadowQuery{DB: q.currentDB, SQL: sql, SessionVars: q.sessionVars.GetAllSystemVars()}
+	compare := shadow.CompareResult()
+	if w, ok := getResultWriter(ctx); ok && compare {
+		ctx = context.WithValue(ctx, constant.ContextKeyResultWriter, &checksumResultWriter{ResultWriter: w, checksum: &query.Checksum})
+	}
+
+	startTime := time.Now()
+	result, err := q.connMgr.Query(ctx, q.currentDB, sql)
+	query.Duration = time.Since(startTime)
+	query.Err = err
+
+	if sqlParadigm, paradigmErr := q.extractSqlParadigm(ctx, sql); paradigmErr == nil {
+		query.Digest = crc32.ChecksumIEEE([]byte(sqlParadigm))
+	}
+	if compare && result != nil {
+		query.AffectedRows = result.AffectedRows
+		query.Checksum.AddResult(result)
+	}
+	shadow.Mirror(query)
+	return result, err
+}
@@ -7,6 +7,12 @@ const (
 	BackendEventInited  = "inited"
 	BackendEventClosing = "closing"
 	BackendEventClosed  = "closed"
+
+	BackendEventInstanceAdded    = "instance_added"
+	BackendEventInstanceRemoved  = "instance_removed"
+	BackendEventInstanceDraining = "instance_draining"
+	BackendEventInstanceDrained  = "instance_drained"
+	BackendEventConnRecycled     = "conn_recycled"
 )
 
 var (
@@ -26,6 +32,14 @@ var (
 			Help:      "Counter of backend query count.",
 		}, []string{LblCluster, LblNamespace, LblBackendAddr})
 
+	BackendCompressionBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "compression_bytes_total",
+			Help:      "Counter of bytes before and after compression between proxy and backend.",
+		}, []string{LblCluster, LblNamespace, LblType})
+
 	BackendConnInUseGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: ModuleWeirProxy,
@@ -33,4 +47,54 @@ var (
 			Name:      "b_conn_in_use",
 			Help:      "Number of backend conn in use.",
 		}, []string{LblCluster, LblNamespace, LblBackendAddr})
+
+	BackendPoolWaitDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "pool_wait_duration_seconds",
+			Help:      "Bucketed histogram of waiting time (s) for an available backend conn.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20), // 0.5ms ~ 524s
+		}, []string{LblCluster, LblNamespace, LblBackendAddr})
+
+	BackendPoolExhaustedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "pool_exhausted_total",
+			Help:      "Counter of backend conn pool exhausted.",
+		}, []string{LblCluster, LblNamespace, LblBackendAddr})
+
+	BackendPoolWaitTimeoutCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "pool_wait_timeout_total",
+			Help:      "Counter of waiting for an available backend conn timeout.",
+		}, []string{LblCluster, LblNamespace, LblBackendAddr})
+
+	BackendGroupQueryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "group_query_total",
+			Help:      "Counter of statements executed in each backend group.",
+		}, []string{LblCluster, LblNamespace, LblGroup, LblResult})
+
+	BackendGroupQueryDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "group_query_duration_seconds",
+			Help:      "Bucketed histogram of processing time (s) of statements in each backend group.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20), // 0.5ms ~ 524s
+		}, []string{LblCluster, LblNamespace, LblGroup})
+
+	BackendGroupWeightGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelBackend,
+			Name:      "group_weight",
+			Help:      "Routing weight of each backend group.",
+		}, []string{LblCluster, LblNamespace, LblGroup})
 )
@@ -14,6 +14,8 @@ const (
 	LabelQueryCtx  = "queryctx"
 	LabelBackend   = "backend"
 	LabelSession   = "session"
+	LabelNamespace = "namespace"
+	LabelShadow    = "shadow"
 	LabelDomain    = "domain"
 	LabelDDLOwner  = "ddl-owner"
 	LabelDDL       = "ddl"
@@ -53,6 +55,8 @@ func RegisterProxyMetrics(cluster string) {
 	prometheus.MustRegister(ExecuteErrorCounter)
 	ConnGauge = ConnGauge.MustCurryWith(curryingLabelsWithLblCluster)
 	prometheus.MustRegister(ConnGauge)
+	CompressionBytesCounter = CompressionBytesCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(CompressionBytesCounter)
 
 	// query ctx metrics
 	QueryCtxQueryCounter = QueryCtxQueryCounter.MustCurryWith(curryingLabelsWithLblCluster)
@@ -63,10 +67,22 @@ func RegisterProxyMetrics(cluster string) {
 	prometheus.MustRegister(QueryCtxQueryDurationHistogram)
 	QueryCtxGauge = QueryCtxGauge.MustCurryWith(curryingLabelsWithLblCluster)
 	prometheus.MustRegister(QueryCtxGauge)
+	QueryCtxUserGauge = QueryCtxUserGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(QueryCtxUserGauge)
+	QueryCtxConnQueueGauge = QueryCtxConnQueueGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(QueryCtxConnQueueGauge)
+	QueryCtxConnRejectedCounter = QueryCtxConnRejectedCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(QueryCtxConnRejectedCounter)
 	QueryCtxAttachedConnGauge = QueryCtxAttachedConnGauge.MustCurryWith(curryingLabelsWithLblCluster)
 	prometheus.MustRegister(QueryCtxAttachedConnGauge)
+	QueryCtxPinnedConnGauge = QueryCtxPinnedConnGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(QueryCtxPinnedConnGauge)
 	QueryCtxTransactionDuration = QueryCtxTransactionDuration.MustCurryWith(curryingLabelsWithLblCluster).(*prometheus.HistogramVec)
 	prometheus.MustRegister(QueryCtxTransactionDuration)
+	QueryCtxConcurrencyQueueGauge = QueryCtxConcurrencyQueueGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(QueryCtxConcurrencyQueueGauge)
+	QueryCtxConcurrencyRejectedCounter = QueryCtxConcurrencyRejectedCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(QueryCtxConcurrencyRejectedCounter)
 
 	// backend metrics
 	BackendEventCounter = BackendEventCounter.MustCurryWith(curryingLabelsWithLblCluster)
@@ -75,4 +91,42 @@ func RegisterProxyMetrics(cluster string) {
 	prometheus.MustRegister(BackendQueryCounter)
 	BackendConnInUseGauge = BackendConnInUseGauge.MustCurryWith(curryingLabelsWithLblCluster)
 	prometheus.MustRegister(BackendConnInUseGauge)
+	BackendCompressionBytesCounter = BackendCompressionBytesCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(BackendCompressionBytesCounter)
+	BackendPoolWaitDurationHistogram = BackendPoolWaitDurationHistogram.MustCurryWith(curryingLabelsWithLblCluster).(*prometheus.HistogramVec)
+	prometheus.MustRegister(BackendPoolWaitDurationHistogram)
+	BackendPoolExhaustedCounter = BackendPoolExhaustedCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(BackendPoolExhaustedCounter)
+	BackendPoolWaitTimeoutCounter = BackendPoolWaitTimeoutCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(BackendPoolWaitTimeoutCounter)
+	BackendGroupQueryCounter = BackendGroupQueryCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(BackendGroupQueryCounter)
+	BackendGroupQueryDurationHistogram = BackendGroupQueryDurationHistogram.MustCurryWith(curryingLabelsWithLblCluster).(*prometheus.HistogramVec)
+	prometheus.MustRegister(BackendGroupQueryDurationHistogram)
+	BackendGroupWeightGauge = BackendGroupWeightGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(BackendGroupWeightGauge)
+
+	// namespace metrics
+	NamespaceClosingGauge = NamespaceClosingGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(NamespaceClosingGauge)
+	NamespaceCloseCutOffCounter = NamespaceCloseCutOffCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(NamespaceCloseCutOffCounter)
+	NamespacePausedGauge = NamespacePausedGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(NamespacePausedGauge)
+	NamespacePauseQueueGauge = NamespacePauseQueueGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(NamespacePauseQueueGauge)
+	NamespacePauseTimeoutCounter = NamespacePauseTimeoutCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(NamespacePauseTimeoutCounter)
+
+	// shadow metrics
+	ShadowQueryCounter = ShadowQueryCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(ShadowQueryCounter)
+	ShadowQueryDurationHistogram = ShadowQueryDurationHistogram.MustCurryWith(curryingLabelsWithLblCluster).(*prometheus.HistogramVec)
+	prometheus.MustRegister(ShadowQueryDurationHistogram)
+	ShadowMismatchCounter = ShadowMismatchCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(ShadowMismatchCounter)
+	ShadowDroppedCounter = ShadowDroppedCounter.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(ShadowDroppedCounter)
+	ShadowQueueGauge = ShadowQueueGauge.MustCurryWith(curryingLabelsWithLblCluster)
+	prometheus.MustRegister(ShadowQueueGauge)
 }
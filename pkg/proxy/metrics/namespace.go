@@ -0,0 +1,45 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	NamespaceClosingGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelNamespace,
+			Name:      "closing",
+			Help:      "Number of old namespaces waiting for in-flight work to close.",
+		}, []string{LblCluster, LblNamespace})
+
+	NamespaceCloseCutOffCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelNamespace,
+			Name:      "close_cut_off_total",
+			Help:      "Counter of in-flight sessions cut off when closing namespace timeout.",
+		}, []string{LblCluster, LblNamespace})
+
+	NamespacePausedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelNamespace,
+			Name:      "paused",
+			Help:      "Whether the namespace is paused, 1 means paused.",
+		}, []string{LblCluster, LblNamespace})
+
+	NamespacePauseQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelNamespace,
+			Name:      "pause_queue_depth",
+			Help:      "Number of statements waiting for the paused namespace to resume.",
+		}, []string{LblCluster, LblNamespace})
+
+	NamespacePauseTimeoutCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelNamespace,
+			Name:      "pause_timeout_total",
+			Help:      "Counter of statements failed since the namespace is not resumed in time.",
+		}, []string{LblCluster, LblNamespace})
+)
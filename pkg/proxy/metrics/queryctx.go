@@ -39,6 +39,15 @@ const (
 	StmtNameComment  = "comment"
 )
 
+const (
+	ConcurrencyRejectQueueFull = "queue_full"
+	ConcurrencyRejectTimeout   = "timeout"
+	ConcurrencyRejectCanceled  = "canceled"
+
+	ConnRejectQueueFull = "queue_full"
+	ConnRejectTimeout   = "timeout"
+)
+
 var (
 	QueryCtxQueryCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -73,6 +82,30 @@ var (
 			Help:      "Number of queryctx (equals to client connection).",
 		}, []string{LblCluster, LblNamespace})
 
+	QueryCtxUserGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelQueryCtx,
+			Name:      "queryctx_user",
+			Help:      "Number of queryctx (equals to client connection) of user.",
+		}, []string{LblCluster, LblNamespace, LblUser})
+
+	QueryCtxConnQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelQueryCtx,
+			Name:      "connection_queue_depth",
+			Help:      "Number of client connections waiting for the connection limit.",
+		}, []string{LblCluster, LblNamespace})
+
+	QueryCtxConnRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelQueryCtx,
+			Name:      "connection_rejected_total",
+			Help:      "Counter of client connections rejected by connection limit.",
+		}, []string{LblCluster, LblNamespace, LblType})
+
 	QueryCtxAttachedConnGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: ModuleWeirProxy,
@@ -81,6 +114,14 @@ var (
 			Help:      "Number of attached backend connections.",
 		}, []string{LblCluster, LblNamespace})
 
+	QueryCtxPinnedConnGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelQueryCtx,
+			Name:      "pinned_sessions",
+			Help:      "Number of sessions pinned to a backend connection by session-scoped features.",
+		}, []string{LblCluster, LblNamespace})
+
 	QueryCtxTransactionDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: "tidb",
@@ -89,6 +130,22 @@ var (
 			Help:      "Bucketed histogram of a transaction execution duration, including retry.",
 			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 28), // 1ms ~ 1.5days
 		}, []string{LblCluster, LblNamespace, LblDb, LblSQLType})
+
+	QueryCtxConcurrencyQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelQueryCtx,
+			Name:      "concurrency_queue_depth",
+			Help:      "Number of queries waiting for a concurrency slot.",
+		}, []string{LblCluster, LblNamespace})
+
+	QueryCtxConcurrencyRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelQueryCtx,
+			Name:      "concurrency_rejected_total",
+			Help:      "Counter of queries rejected by concurrency limiter.",
+		}, []string{LblCluster, LblNamespace, LblType})
 )
 
 func GetStmtType(stmt ast.StmtNode) AstStmtType {
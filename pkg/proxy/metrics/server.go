@@ -42,6 +42,16 @@ var (
 			Help:      "Number of connections.",
 		}, []string{LblCluster})
 
+	// CompressionBytesCounter measures the bytes of the compressed protocol between client and proxy,
+	// the saved bytes is the difference of the uncompressed and compressed bytes.
+	CompressionBytesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelServer,
+			Name:      "compression_bytes_total",
+			Help:      "Counter of bytes before and after compression.",
+		}, []string{LblCluster, LblType})
+
 	EventStart        = "start"
 	EventGracefulDown = "graceful_shutdown"
 	// EventKill occurs when the server.Kill() function is called.
@@ -49,6 +59,11 @@ var (
 	EventClose = "close"
 )
 
+const (
+	CompressionUncompressed = "uncompressed"
+	CompressionCompressed   = "compressed"
+)
+
 // ExecuteErrorToLabel converts an execute error to label.
 func ExecuteErrorToLabel(err error) string {
 	err = errors.Cause(err)
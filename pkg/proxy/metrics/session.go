@@ -25,6 +25,10 @@ const (
 	LblGet         = "get"
 	LblNamespace   = "namespace"
 	LblCluster     = "cluster"
+	LblUser        = "user"
+	LblDigest      = "digest"
+	LblTarget      = "target"
 
 	LblBackendAddr = "backend_addr"
+	LblGroup       = "group"
 )
@@ -0,0 +1,59 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const (
+	ShadowTargetPrimary = "primary"
+	ShadowTargetShadow  = "shadow"
+
+	ShadowMismatchError        = "error"
+	ShadowMismatchRows         = "rows"
+	ShadowMismatchChecksum     = "checksum"
+	ShadowMismatchAffectedRows = "affected_rows"
+
+	// ShadowDigestOther labels the digests beyond the ones labeled by themselves.
+	ShadowDigestOther = "other"
+)
+
+var (
+	ShadowQueryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelShadow,
+			Name:      "query_total",
+			Help:      "Counter of statements mirrored to shadow backend.",
+		}, []string{LblCluster, LblNamespace, LblDigest, LblResult})
+
+	ShadowQueryDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelShadow,
+			Name:      "query_duration_seconds",
+			Help:      "Bucketed histogram of processing time (s) of mirrored statements in primary and shadow backend.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 20), // 0.5ms ~ 524s
+		}, []string{LblCluster, LblNamespace, LblDigest, LblTarget})
+
+	ShadowMismatchCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelShadow,
+			Name:      "mismatch_total",
+			Help:      "Counter of mirrored statements whose result differs from primary backend.",
+		}, []string{LblCluster, LblNamespace, LblDigest, LblType})
+
+	ShadowDroppedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelShadow,
+			Name:      "dropped_total",
+			Help:      "Counter of statements not mirrored since the shadow queue is full.",
+		}, []string{LblCluster, LblNamespace})
+
+	ShadowQueueGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: ModuleWeirProxy,
+			Subsystem: LabelShadow,
+			Name:      "queue_depth",
+			Help:      "Number of statements waiting to be mirrored to shadow backend.",
+		}, []string{LblCluster, LblNamespace})
+)
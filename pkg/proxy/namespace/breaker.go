@@ -6,6 +6,7 @@ import (
 	rb "github.com/tidb-incubator/weir/pkg/util/rate_limit_breaker"
 	cb "github.com/tidb-incubator/weir/pkg/util/rate_limit_breaker/circuit_breaker"
 	"github.com/tidb-incubator/weir/pkg/util/timer"
+	"github.com/tidb-incubator/weir/pkg/validation"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -67,19 +68,6 @@ func (this *Breaker) GetBreaker() (driver.Breaker, error) {
 	return this.bm, nil
 }
 
-func checkBreakerConfig(s *config.StrategyInfo) error {
-	if s.FailureRatethreshold < 0 || s.FailureRatethreshold > 100 {
-		return ErrInvalidFailureRateThreshold
-	}
-	if s.OpenStatusDurationMs <= 0 {
-		return ErrInvalidopenStatusDurationMs
-	}
-	if s.SqlTimeoutMs <= 0 {
-		return ErrInvalidSqlTimeout
-	}
-	return nil
-}
-
 func getHashFactor(num int) uint64 {
 	HashFactor := 1
 	for num > 0 {
@@ -98,7 +86,7 @@ func NewBreakerManager(br *config.BreakerInfo) (*BreakerManager, error) {
 
 	sort.Sort(StrategySlice(br.Strategies))
 	for idx, strategy := range br.Strategies {
-		if err := checkBreakerConfig(&strategy); err != nil {
+		if err := validation.ValidateBreakerStrategy(&strategy); err != nil {
 			return nil, err
 		}
 		strategies[idx] = strategyInfo{
@@ -1,7 +1,9 @@
 package namespace
 
 import (
+	"context"
 	"hash/crc32"
+	"net"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -9,16 +11,25 @@ import (
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/tidb-incubator/weir/pkg/proxy/backend"
 	"github.com/tidb-incubator/weir/pkg/proxy/driver"
-	wast "github.com/tidb-incubator/weir/pkg/util/ast"
 	"github.com/tidb-incubator/weir/pkg/util/datastructure"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+	"github.com/tidb-incubator/weir/pkg/validation"
 )
 
 type NamespaceImpl struct {
-	name string
-	Br   driver.Breaker
+	name     string
+	revision int64
+	Br       driver.Breaker
 	Backend
 	Frontend
-	rateLimiter *NamespaceRateLimiter
+	rateLimiter        *NamespaceRateLimiter
+	concurrencyLimiter *NamespaceConcurrencyLimiter
+	conns              *connTracker
+	shadow             *Shadow
+
+	backendCfg  *config.BackendNamespace
+	ownsBackend sync2.AtomicBool // false if the backend is handed over to the reloaded namespace
+	reload      *backendReload   // set if the backend of current namespace is reused on reload
 }
 
 func BuildNamespace(cfg *config.Namespace) (Namespace, error) {
@@ -26,14 +37,27 @@ func BuildNamespace(cfg *config.Namespace) (Namespace, error) {
 	if err != nil {
 		return nil, errors.WithMessage(err, "build backend error")
 	}
+	ns, err := buildNamespaceWithBackend(cfg, be)
+	if err != nil {
+		be.Close()
+		return nil, err
+	}
+	ns.ownsBackend.Set(true)
+	return ns, nil
+}
+
+func buildNamespaceWithBackend(cfg *config.Namespace, be Backend) (*NamespaceImpl, error) {
 	fe, err := BuildFrontend(&cfg.Frontend)
 	if err != nil {
 		return nil, errors.WithMessage(err, "build frontend error")
 	}
 	wrapper := &NamespaceImpl{
-		name:     cfg.Namespace,
-		Backend:  be,
-		Frontend: fe,
+		name:       cfg.Namespace,
+		revision:   cfg.Revision,
+		Backend:    be,
+		Frontend:   fe,
+		conns:      newConnTracker(),
+		backendCfg: &cfg.Backend,
 	}
 	brm, err := NewBreaker(&cfg.Breaker)
 	if err != nil {
@@ -48,6 +72,17 @@ func BuildNamespace(cfg *config.Namespace) (Namespace, error) {
 	rateLimiter := NewNamespaceRateLimiter(cfg.RateLimiter.Scope, cfg.RateLimiter.QPS)
 	wrapper.rateLimiter = rateLimiter
 
+	if err := validation.ValidateConcurrencyLimiter(&cfg.ConcurrencyLimiter); err != nil {
+		return nil, err
+	}
+	wrapper.concurrencyLimiter = NewNamespaceConcurrencyLimiter(cfg.Namespace, &cfg.ConcurrencyLimiter)
+
+	shadow, err := BuildShadow(cfg.Namespace, &cfg.Shadow)
+	if err != nil {
+		return nil, errors.WithMessage(err, "build shadow error")
+	}
+	wrapper.shadow = shadow
+
 	return wrapper, nil
 }
 
@@ -55,6 +90,10 @@ func (n *NamespaceImpl) Name() string {
 	return n.name
 }
 
+func (n *NamespaceImpl) Revision() int64 {
+	return n.revision
+}
+
 func (n *NamespaceImpl) GetBreaker() (driver.Breaker, error) {
 	return n.Br, nil
 }
@@ -63,23 +102,101 @@ func (n *NamespaceImpl) GetRateLimiter() driver.RateLimiter {
 	return n.rateLimiter
 }
 
+func (n *NamespaceImpl) GetConcurrencyLimiter() driver.ConcurrencyLimiter {
+	return n.concurrencyLimiter
+}
+
+// GetShadow returns nil rather than a typed nil if the shadow is not enabled.
+func (n *NamespaceImpl) GetShadow() driver.Shadow {
+	if n.shadow == nil {
+		return nil
+	}
+	return n.shadow
+}
+
+func (n *NamespaceImpl) GetPooledConn(ctx context.Context) (driver.PooledBackendConn, error) {
+	return n.conns.GetPooledConn(ctx, n.Backend)
+}
+
+func (n *NamespaceImpl) InUse() int {
+	return n.conns.InUse()
+}
+
+func (n *NamespaceImpl) GetBackend() Backend {
+	return n.Backend
+}
+
 func BuildBackend(ns string, cfg *config.BackendNamespace) (Backend, error) {
+	if len(cfg.Groups) > 0 {
+		return buildGroupBackend(ns, cfg)
+	}
 	bcfg, err := parseBackendConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	discovery, err := createDiscovery(&cfg.Discovery)
+	if err != nil {
+		return nil, err
+	}
+	bcfg.Discovery = discovery
+
 	b := backend.NewBackendImpl(ns, bcfg)
 	if err := b.Init(); err != nil {
+		if discovery != nil {
+			discovery.Close()
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func buildGroupBackend(ns string, cfg *config.BackendNamespace) (Backend, error) {
+	groupCfgs, err := parseGroupConfigs(cfg)
+	if err != nil {
 		return nil, err
 	}
+	for i := range cfg.Groups {
+		discovery, err := createDiscovery(&cfg.Groups[i].Discovery)
+		if err != nil {
+			for _, created := range groupCfgs[:i] {
+				if created.Backend.Discovery != nil {
+					created.Backend.Discovery.Close()
+				}
+			}
+			return nil, err
+		}
+		groupCfgs[i].Backend.Discovery = discovery
+	}
 
+	b := backend.NewGroupBackend(ns, groupCfgs)
+	if err := b.Init(); err != nil {
+		return nil, err
+	}
 	return b, nil
 }
 
+func createDiscovery(cfg *config.DiscoveryInfo) (backend.Discovery, error) {
+	switch cfg.Type {
+	case "", backend.DiscoveryTypeStatic:
+		return nil, nil
+	case backend.DiscoveryTypePD:
+		return backend.CreatePDDiscovery(cfg.Addrs)
+	case backend.DiscoveryTypeDNS:
+		return backend.NewDNSDiscovery(net.DefaultResolver, cfg.Name, cfg.Port, time.Duration(cfg.RefreshIntervalMs)*time.Millisecond), nil
+	case backend.DiscoveryTypeSRV:
+		return backend.NewSRVDiscovery(net.DefaultResolver, cfg.Name, time.Duration(cfg.RefreshIntervalMs)*time.Millisecond), nil
+	default:
+		return nil, backend.ErrInvalidDiscoveryType
+	}
+}
+
 func BuildFrontend(cfg *config.FrontendNamespace) (Frontend, error) {
 	fns := &FrontendNamespace{
-		allowedDBs: cfg.AllowedDBs,
+		allowedDBs:         cfg.AllowedDBs,
+		allowLocalInfile:   cfg.AllowLocalInfile,
+		localInfileMaxSize: cfg.LocalInfileMaxSize,
 	}
 	fns.allowedDBSet = datastructure.StringSliceToSet(cfg.AllowedDBs)
 	fns.deniedHostSet = datastructure.StringSliceToSet(cfg.DeniedIPs)
@@ -89,51 +206,38 @@ func BuildFrontend(cfg *config.FrontendNamespace) (Frontend, error) {
 		userPasswds[u.Username] = u.Password
 	}
 	fns.userPasswd = userPasswds
+	fns.connLimits, fns.userMaxConns = newConnLimits(cfg)
 
 	sqlBlacklist := make(map[uint32]SQLInfo)
 	fns.sqlBlacklist = sqlBlacklist
 
 	p := parser.New()
 	for _, deniedSQL := range cfg.SQLBlackList {
-		stmtNodes, _, err := p.Parse(deniedSQL.SQL, "", "")
+		sqlFeature, err := validation.ParseSQLFeature(p, deniedSQL.SQL)
 		if err != nil {
 			return nil, err
 		}
-		if len(stmtNodes) != 1 {
-			return nil, nil
-		}
-		v, err := wast.ExtractAstVisit(stmtNodes[0])
-		if err != nil {
-			return nil, err
-		}
-		fns.sqlBlacklist[crc32.ChecksumIEEE([]byte(v.SqlFeature()))] = SQLInfo{SQL: deniedSQL.SQL}
+		fns.sqlBlacklist[crc32.ChecksumIEEE([]byte(sqlFeature))] = SQLInfo{SQL: deniedSQL.SQL}
 	}
 
 	sqlWhitelist := make(map[uint32]SQLInfo)
 	fns.sqlWhitelist = sqlWhitelist
 	for _, allowedSQL := range cfg.SQLWhiteList {
-		stmtNodes, _, err := p.Parse(allowedSQL.SQL, "", "")
-		if err != nil {
-			return nil, err
-		}
-		if len(stmtNodes) != 1 {
-			return nil, nil
-		}
-		v, err := wast.ExtractAstVisit(stmtNodes[0])
+		sqlFeature, err := validation.ParseSQLFeature(p, allowedSQL.SQL)
 		if err != nil {
 			return nil, err
 		}
-		fns.sqlWhitelist[crc32.ChecksumIEEE([]byte(v.SqlFeature()))] = SQLInfo{SQL: allowedSQL.SQL}
+		fns.sqlWhitelist[crc32.ChecksumIEEE([]byte(sqlFeature))] = SQLInfo{SQL: allowedSQL.SQL}
 	}
 
 	return fns, nil
 }
 
 func parseBackendConfig(cfg *config.BackendNamespace) (*backend.BackendConfig, error) {
-	selectorType, valid := backend.SelectorNameToType(cfg.SelectorType)
-	if !valid {
-		return nil, ErrInvalidSelectorType
+	if err := validation.ValidateBackend(cfg); err != nil {
+		return nil, err
 	}
+	selectorType, _ := backend.SelectorNameToType(cfg.SelectorType)
 
 	addrs := make(map[string]struct{})
 	for _, ins := range cfg.Instances {
@@ -141,25 +245,38 @@ func parseBackendConfig(cfg *config.BackendNamespace) (*backend.BackendConfig, e
 	}
 
 	bcfg := &backend.BackendConfig{
-		Addrs:        addrs,
-		UserName:     cfg.Username,
-		Password:     cfg.Password,
-		Capacity:     cfg.PoolSize,
-		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
-		SelectorType: selectorType,
+		Addrs:          addrs,
+		UserName:       cfg.Username,
+		Password:       cfg.Password,
+		Capacity:       cfg.PoolSize,
+		IdleTimeout:    time.Duration(cfg.IdleTimeout) * time.Second,
+		ConnectTimeout: time.Duration(cfg.ConnectTimeoutMs) * time.Millisecond,
+		MinIdle:        cfg.MinIdle,
+		MaxLifetime:    time.Duration(cfg.MaxLifetime) * time.Second,
+		MaxWait:        time.Duration(cfg.MaxWaitMs) * time.Millisecond,
+		SelectorType:   selectorType,
+
+		EnableCompression:    cfg.EnableCompression,
+		CompressionAlgorithm: cfg.CompressionAlgorithm,
 	}
 	return bcfg, nil
 }
 
-func DefaultAsyncCloseNamespace(ns Namespace) error {
-	nsWrapper, ok := ns.(*NamespaceImpl)
-	if !ok {
-		return errors.Errorf("invalid namespace type: %T", ns)
+// parseGroupConfigs returns the config of each group, which shares the pool options and credentials.
+func parseGroupConfigs(cfg *config.BackendNamespace) ([]*backend.GroupConfig, error) {
+	bcfg, err := parseBackendConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	groupCfgs := make([]*backend.GroupConfig, 0, len(cfg.Groups))
+	for _, g := range cfg.Groups {
+		gcfg := *bcfg
+		gcfg.Addrs = make(map[string]struct{})
+		for _, ins := range g.Instances {
+			gcfg.Addrs[ins] = struct{}{}
+		}
+		groupCfgs = append(groupCfgs, &backend.GroupConfig{Name: g.Name, Weight: g.Weight, Backend: &gcfg})
 	}
-	go func() {
-		time.Sleep(30 * time.Second)
-		//nsWrapper.BreakerHolder.CloseBreaker()
-		nsWrapper.Backend.Close()
-	}()
-	return nil
+	return groupCfgs, nil
 }
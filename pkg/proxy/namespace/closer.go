@@ -0,0 +1,153 @@
+package namespace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultNamespaceCloseTimeout = 30 * time.Second
+	namespaceCloseCheckInterval  = 100 * time.Millisecond
+)
+
+// connTracker tracks the backend conns borrowed from a backend, including the conns attached to
+// transactions, so that the backend can be closed after the in-flight work is done. The sessions
+// and transactions are tracked by the conns they hold. The tracker goes with the backend, so the
+// namespace reusing the backend on reload also waits for the conns borrowed before the reload.
+type connTracker struct {
+	lock  sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+type trackedConn struct {
+	driver.PooledBackendConn
+	tracker *connTracker
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		conns: make(map[*trackedConn]struct{}),
+	}
+}
+
+func (t *connTracker) GetPooledConn(ctx context.Context, b Backend) (driver.PooledBackendConn, error) {
+	conn, err := b.GetPooledConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{PooledBackendConn: conn, tracker: t}
+	t.lock.Lock()
+	t.conns[tc] = struct{}{}
+	t.lock.Unlock()
+	return tc, nil
+}
+
+func (t *connTracker) InUse() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.conns)
+}
+
+// CutOff closes the underlying conns which are still borrowed, and returns the number of them.
+// The sessions get an error on the next use of the conn and put it back with ErrorClose.
+func (t *connTracker) CutOff() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for tc := range t.conns {
+		if closer, ok := tc.PooledBackendConn.(interface{ Close() error }); ok {
+			if err := closer.Close(); err != nil {
+				logutil.BgLogger().Warn("cut off backend conn error", zap.Error(err))
+			}
+		}
+	}
+	return len(t.conns)
+}
+
+func (t *connTracker) release(tc *trackedConn) {
+	t.lock.Lock()
+	delete(t.conns, tc)
+	t.lock.Unlock()
+}
+
+func (c *trackedConn) PutBack() {
+	c.tracker.release(c)
+	c.PooledBackendConn.PutBack()
+}
+
+func (c *trackedConn) ErrorClose() error {
+	c.tracker.release(c)
+	return c.PooledBackendConn.ErrorClose()
+}
+
+// DefaultAsyncCloseNamespace closes the namespace in background with DefaultNamespaceCloseTimeout.
+func DefaultAsyncCloseNamespace(ns Namespace) error {
+	return CreateAsyncNamespaceCloser(DefaultNamespaceCloseTimeout)(ns)
+}
+
+// CreateAsyncNamespaceCloser returns a NamespaceCloser which closes the namespace in background,
+// once all the borrowed conns are put back or the timeout is reached.
+// The conns still borrowed at the timeout are cut off.
+func CreateAsyncNamespaceCloser(timeout time.Duration) NamespaceCloser {
+	if timeout <= 0 {
+		timeout = DefaultNamespaceCloseTimeout
+	}
+	return func(ns Namespace) error {
+		nsImpl, ok := ns.(*NamespaceImpl)
+		if !ok {
+			return errors.Errorf("invalid namespace type: %T", ns)
+		}
+		go closeNamespaceGracefully(nsImpl, timeout)
+		return nil
+	}
+}
+
+func closeNamespaceGracefully(ns *NamespaceImpl, timeout time.Duration) {
+	// the shadow is not reused by the reloaded namespace
+	if ns.shadow != nil {
+		ns.shadow.Close()
+	}
+
+	// the backend and the conns borrowed from it are taken over by the reloaded namespace,
+	// which shares the conn tracker
+	if !ns.ownsBackend.Get() {
+		logutil.BgLogger().Info("namespace closed, backend is reused", zap.String("namespace", ns.name), zap.Int64("revision", ns.revision))
+		return
+	}
+
+	metrics.NamespaceClosingGauge.WithLabelValues(ns.name).Inc()
+	defer metrics.NamespaceClosingGauge.WithLabelValues(ns.name).Dec()
+
+	if !waitForConnsPutBack(ns.conns, timeout) {
+		cutOff := ns.conns.CutOff()
+		metrics.NamespaceCloseCutOffCounter.WithLabelValues(ns.name).Add(float64(cutOff))
+		logutil.BgLogger().Warn("close namespace timeout, cut off in-flight sessions",
+			zap.String("namespace", ns.name), zap.Int64("revision", ns.revision), zap.Int("count", cutOff))
+	}
+
+	ns.Backend.Close()
+	logutil.BgLogger().Info("namespace closed", zap.String("namespace", ns.name), zap.Int64("revision", ns.revision))
+}
+
+// waitForConnsPutBack returns false if there are still borrowed conns when timeout.
+func waitForConnsPutBack(conns *connTracker, timeout time.Duration) bool {
+	ticker := time.NewTicker(namespaceCloseCheckInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for conns.InUse() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package namespace
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/proxy/backend"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+)
+
+type fakeBackend struct {
+	Backend
+	closed  sync2.AtomicBool
+	updated *backend.BackendConfig
+}
+
+type fakePooledConn struct {
+	driver.PooledBackendConn
+	lock   sync.Mutex
+	cutOff bool
+}
+
+func (f *fakeBackend) GetPooledConn(context.Context) (driver.PooledBackendConn, error) {
+	return &fakePooledConn{}, nil
+}
+
+func (f *fakeBackend) Close() {
+	f.closed.Set(true)
+}
+
+func (f *fakeBackend) UpdateConfig(cfg *backend.BackendConfig) error {
+	f.updated = cfg
+	return nil
+}
+
+func (c *fakePooledConn) PutBack() {}
+
+func (c *fakePooledConn) ErrorClose() error {
+	return nil
+}
+
+func (c *fakePooledConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cutOff = true
+	return nil
+}
+
+func createTestNamespaceImpl() (*NamespaceImpl, *fakeBackend) {
+	b := &fakeBackend{}
+	ns := &NamespaceImpl{name: "test_ns", Backend: b, conns: newConnTracker()}
+	ns.ownsBackend.Set(true)
+	return ns, b
+}
+
+func TestAsyncNamespaceCloser_WaitForPutBack(t *testing.T) {
+	ns, b := createTestNamespaceImpl()
+	conn1, err := ns.GetPooledConn(context.Background())
+	require.NoError(t, err)
+	conn2, err := ns.GetPooledConn(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, CreateAsyncNamespaceCloser(10*time.Second)(ns))
+	conn1.PutBack()
+	time.Sleep(3 * namespaceCloseCheckInterval)
+	require.False(t, b.closed.Get())
+
+	require.NoError(t, conn2.ErrorClose())
+	require.Eventually(t, b.closed.Get, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 0, ns.conns.InUse())
+}
+
+func TestAsyncNamespaceCloser_CutOff(t *testing.T) {
+	ns, b := createTestNamespaceImpl()
+	conn, err := ns.GetPooledConn(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, CreateAsyncNamespaceCloser(200*time.Millisecond)(ns))
+	require.Eventually(t, b.closed.Get, 5*time.Second, 10*time.Millisecond)
+
+	fakeConn := conn.(*trackedConn).PooledBackendConn.(*fakePooledConn)
+	fakeConn.lock.Lock()
+	require.True(t, fakeConn.cutOff)
+	fakeConn.lock.Unlock()
+
+	// the session puts back the broken conn later
+	require.NoError(t, conn.ErrorClose())
+	require.Equal(t, 0, ns.conns.InUse())
+}
+
+func TestAsyncNamespaceCloser_InvalidNamespace(t *testing.T) {
+	require.Error(t, DefaultAsyncCloseNamespace(&fakeNamespace{name: "test_ns"}))
+}
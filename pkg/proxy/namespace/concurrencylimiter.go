@@ -0,0 +1,145 @@
+package namespace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/rate_limit_breaker/concurrency_limit"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+)
+
+const (
+	defaultConcurrencyQueueTimeout = time.Second
+	// the limiters of table and sql scopes are created on demand, the idle ones are evicted
+	// so that the limiters of the digests seen only once do not pile up.
+	limiterIdleTimeout   = 10 * time.Minute
+	limiterEvictInterval = time.Minute
+)
+
+type NamespaceConcurrencyLimiter struct {
+	ns    string
+	scope string
+	cfg   concurrency_limit.Config
+
+	limitersLock sync.Mutex
+	limiters     map[string]*limiterEntry
+	lastEvict    time.Time
+	waiting      sync2.AtomicInt64
+}
+
+type limiterEntry struct {
+	limiter  *concurrency_limit.ConcurrencyLimiter
+	refs     int // the running and waiting statements, the entry is not evicted until it is 0
+	lastUsed time.Time
+}
+
+func NewNamespaceConcurrencyLimiter(ns string, info *config.ConcurrencyLimiterInfo) *NamespaceConcurrencyLimiter {
+	queueTimeout := time.Duration(info.QueueTimeoutMs) * time.Millisecond
+	if queueTimeout <= 0 {
+		queueTimeout = defaultConcurrencyQueueTimeout
+	}
+	return &NamespaceConcurrencyLimiter{
+		ns:    ns,
+		scope: info.Scope,
+		cfg: concurrency_limit.Config{
+			MaxConcurrency:   info.MaxConcurrency,
+			MaxQueueSize:     info.MaxQueueSize,
+			QueueTimeout:     queueTimeout,
+			Adaptive:         info.Adaptive,
+			MinConcurrency:   info.MinConcurrency,
+			LatencyThreshold: time.Duration(info.LatencyThresholdMs) * time.Millisecond,
+		},
+		limiters:  make(map[string]*limiterEntry),
+		lastEvict: time.Now(),
+	}
+}
+
+func (n *NamespaceConcurrencyLimiter) Scope() string {
+	return n.scope
+}
+
+// Acquire waits for a slot of key, it stops waiting if ctx is canceled, e.g. the session is killed.
+func (n *NamespaceConcurrencyLimiter) Acquire(ctx context.Context, key string) error {
+	if n.cfg.MaxConcurrency <= 0 {
+		return nil
+	}
+
+	entry := n.refLimiter(key)
+	if entry.limiter.TryAcquire() {
+		return nil
+	}
+
+	metrics.QueryCtxConcurrencyQueueGauge.WithLabelValues(n.ns).Set(float64(n.waiting.Add(1)))
+	err := entry.limiter.AcquireContext(ctx)
+	metrics.QueryCtxConcurrencyQueueGauge.WithLabelValues(n.ns).Set(float64(n.waiting.Add(-1)))
+	if err == nil {
+		return nil
+	}
+
+	n.unrefLimiter(entry)
+	switch err {
+	case concurrency_limit.ErrQueueFull:
+		metrics.QueryCtxConcurrencyRejectedCounter.WithLabelValues(n.ns, metrics.ConcurrencyRejectQueueFull).Inc()
+		return mysql.NewErrf(mysql.ErrConCount, "Too many concurrent statements of namespace %s, wait queue is full", n.ns)
+	case concurrency_limit.ErrQueueTimeout:
+		metrics.QueryCtxConcurrencyRejectedCounter.WithLabelValues(n.ns, metrics.ConcurrencyRejectTimeout).Inc()
+		return mysql.NewErrf(mysql.ErrConCount, "Too many concurrent statements of namespace %s, wait timeout", n.ns)
+	default:
+		metrics.QueryCtxConcurrencyRejectedCounter.WithLabelValues(n.ns, metrics.ConcurrencyRejectCanceled).Inc()
+		return err
+	}
+}
+
+func (n *NamespaceConcurrencyLimiter) Release(key string, latency time.Duration) {
+	if n.cfg.MaxConcurrency <= 0 {
+		return
+	}
+
+	n.limitersLock.Lock()
+	entry, ok := n.limiters[key]
+	n.limitersLock.Unlock()
+	if !ok {
+		return
+	}
+	entry.limiter.Release(latency)
+	n.unrefLimiter(entry)
+}
+
+// refLimiter returns the limiter of key and holds it until unrefLimiter.
+func (n *NamespaceConcurrencyLimiter) refLimiter(key string) *limiterEntry {
+	n.limitersLock.Lock()
+	defer n.limitersLock.Unlock()
+
+	now := time.Now()
+	if now.Sub(n.lastEvict) >= limiterEvictInterval {
+		n.evictIdleLimitersLocked(now)
+	}
+	entry, ok := n.limiters[key]
+	if !ok {
+		entry = &limiterEntry{limiter: concurrency_limit.NewConcurrencyLimiter(n.cfg)}
+		n.limiters[key] = entry
+	}
+	entry.refs++
+	entry.lastUsed = now
+	return entry
+}
+
+func (n *NamespaceConcurrencyLimiter) unrefLimiter(entry *limiterEntry) {
+	n.limitersLock.Lock()
+	defer n.limitersLock.Unlock()
+	entry.refs--
+	entry.lastUsed = time.Now()
+}
+
+func (n *NamespaceConcurrencyLimiter) evictIdleLimitersLocked(now time.Time) {
+	n.lastEvict = now
+	for key, entry := range n.limiters {
+		if entry.refs == 0 && now.Sub(entry.lastUsed) >= limiterIdleTimeout {
+			delete(n.limiters, key)
+		}
+	}
+}
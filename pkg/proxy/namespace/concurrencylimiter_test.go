@@ -0,0 +1,100 @@
+package namespace
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+)
+
+func TestMain(m *testing.M) {
+	metrics.RegisterProxyMetrics("test_cluster")
+	os.Exit(m.Run())
+}
+
+func TestNamespaceConcurrencyLimiter_Acquire(t *testing.T) {
+	ctx := context.Background()
+	key1 := "hello"
+	key2 := "world"
+	limiter := NewNamespaceConcurrencyLimiter("test_ns", &config.ConcurrencyLimiterInfo{
+		Scope:          "namespace",
+		MaxConcurrency: 1,
+		MaxQueueSize:   0,
+	})
+
+	require.NoError(t, limiter.Acquire(ctx, key1))
+	err := limiter.Acquire(ctx, key1)
+	sqlErr, ok := err.(*mysql.SQLError)
+	require.True(t, ok)
+	require.Equal(t, uint16(mysql.ErrConCount), sqlErr.Code)
+	require.NoError(t, limiter.Acquire(ctx, key2))
+	limiter.Release(key1, time.Millisecond)
+	require.NoError(t, limiter.Acquire(ctx, key1))
+}
+
+func TestNamespaceConcurrencyLimiter_ZeroMaxConcurrency(t *testing.T) {
+	ctx := context.Background()
+	key1 := "hello"
+	limiter := NewNamespaceConcurrencyLimiter("test_ns", &config.ConcurrencyLimiterInfo{Scope: "namespace"})
+	require.NoError(t, limiter.Acquire(ctx, key1))
+	require.NoError(t, limiter.Acquire(ctx, key1))
+}
+
+func TestNamespaceConcurrencyLimiter_Wait(t *testing.T) {
+	key := "hello"
+	limiter := NewNamespaceConcurrencyLimiter("test_ns", &config.ConcurrencyLimiterInfo{
+		Scope:          "table",
+		MaxConcurrency: 1,
+		MaxQueueSize:   1,
+		QueueTimeoutMs: 60000,
+	})
+
+	// the statements that get a slot at once are not counted as waiting
+	require.NoError(t, limiter.Acquire(context.Background(), key))
+	require.Equal(t, int64(0), limiter.waiting.Get())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Acquire(ctx, key)
+	}()
+	require.Eventually(t, func() bool { return limiter.waiting.Get() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.Equal(t, context.Canceled, <-done)
+	require.Equal(t, int64(0), limiter.waiting.Get())
+
+	limiter.Release(key, time.Millisecond)
+	require.Equal(t, 0, limiter.limiters[key].refs)
+}
+
+func TestNamespaceConcurrencyLimiter_EvictIdleLimiters(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewNamespaceConcurrencyLimiter("test_ns", &config.ConcurrencyLimiterInfo{
+		Scope:          "sql",
+		MaxConcurrency: 1,
+	})
+
+	require.NoError(t, limiter.Acquire(ctx, "running"))
+	require.NoError(t, limiter.Acquire(ctx, "idle"))
+	limiter.Release("idle", time.Millisecond)
+	require.NoError(t, limiter.Acquire(ctx, "recent"))
+	limiter.Release("recent", time.Millisecond)
+
+	idleTime := time.Now().Add(-limiterIdleTimeout)
+	limiter.limiters["running"].lastUsed = idleTime
+	limiter.limiters["idle"].lastUsed = idleTime
+	limiter.lastEvict = time.Now().Add(-limiterEvictInterval)
+
+	// the running limiter is kept, so that its slot is released to the same limiter
+	require.NoError(t, limiter.Acquire(ctx, "new"))
+	require.Len(t, limiter.limiters, 3)
+	require.NotContains(t, limiter.limiters, "idle")
+	require.Error(t, limiter.Acquire(ctx, "running"))
+	limiter.Release("running", time.Millisecond)
+	require.NoError(t, limiter.Acquire(ctx, "running"))
+}
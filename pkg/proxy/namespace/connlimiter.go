@@ -0,0 +1,152 @@
+package namespace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+)
+
+const (
+	defaultConnectionQueueTimeout = time.Second
+)
+
+// ConnLimits are the client conn limits of a user in namespace, 0 means unlimited.
+type ConnLimits struct {
+	MaxConnections     int
+	UserMaxConnections int
+	QueueSize          int
+	QueueTimeout       time.Duration
+}
+
+func newConnLimits(cfg *config.FrontendNamespace) (ConnLimits, map[string]int) {
+	limits := ConnLimits{
+		MaxConnections: cfg.MaxConnections,
+		QueueSize:      cfg.ConnectionQueueSize,
+		QueueTimeout:   time.Duration(cfg.ConnectionQueueTimeoutMs) * time.Millisecond,
+	}
+	if limits.QueueTimeout <= 0 {
+		limits.QueueTimeout = defaultConnectionQueueTimeout
+	}
+	userMaxConns := make(map[string]int)
+	for _, u := range cfg.Users {
+		if u.MaxConnections > 0 {
+			userMaxConns[u.Username] = u.MaxConnections
+		}
+	}
+	return limits, userMaxConns
+}
+
+// connLimiter counts the client conns of a namespace and its users. It is kept by NamespaceManager
+// across reloads since the conns live longer than a namespace config, and the limits are read from
+// the current config, so that a reload takes effect on the new conns.
+type connLimiter struct {
+	ns string
+
+	mu       sync.Mutex
+	total    int
+	users    map[string]int
+	waiting  int
+	released chan struct{} // closed when a conn is released, to wake up the waiting conns
+}
+
+func newConnLimiter(ns string) *connLimiter {
+	return &connLimiter{
+		ns:       ns,
+		users:    make(map[string]int),
+		released: make(chan struct{}),
+	}
+}
+
+// acquire takes a slot of the namespace and user, or waits in the queue until a slot is released.
+// The conn is rejected with ER_CON_COUNT_ERROR if the queue is full or it waits too long.
+func (l *connLimiter) acquire(ctx context.Context, username string, getLimits func() ConnLimits) error {
+	l.mu.Lock()
+	limits := getLimits()
+	if l.allowLocked(username, limits) {
+		l.addLocked(username, 1)
+		l.mu.Unlock()
+		return nil
+	}
+	if l.waiting >= limits.QueueSize {
+		err := l.limitErrorLocked(username, limits)
+		l.mu.Unlock()
+		metrics.QueryCtxConnRejectedCounter.WithLabelValues(l.ns, metrics.ConnRejectQueueFull).Inc()
+		return err
+	}
+	l.setWaitingLocked(l.waiting + 1)
+
+	timer := time.NewTimer(limits.QueueTimeout)
+	defer timer.Stop()
+	for {
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-timer.C:
+			l.mu.Lock()
+			l.setWaitingLocked(l.waiting - 1)
+			err := l.limitErrorLocked(username, getLimits())
+			l.mu.Unlock()
+			metrics.QueryCtxConnRejectedCounter.WithLabelValues(l.ns, metrics.ConnRejectTimeout).Inc()
+			return err
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.setWaitingLocked(l.waiting - 1)
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+
+		l.mu.Lock()
+		if l.allowLocked(username, getLimits()) {
+			l.setWaitingLocked(l.waiting - 1)
+			l.addLocked(username, 1)
+			l.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+func (l *connLimiter) release(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.addLocked(username, -1)
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+func (l *connLimiter) allowLocked(username string, limits ConnLimits) bool {
+	if limits.MaxConnections > 0 && l.total >= limits.MaxConnections {
+		return false
+	}
+	if limits.UserMaxConnections > 0 && l.users[username] >= limits.UserMaxConnections {
+		return false
+	}
+	return true
+}
+
+func (l *connLimiter) addLocked(username string, delta int) {
+	l.total += delta
+	l.users[username] += delta
+	metrics.QueryCtxGauge.WithLabelValues(l.ns).Set(float64(l.total))
+	metrics.QueryCtxUserGauge.WithLabelValues(l.ns, username).Set(float64(l.users[username]))
+	if l.users[username] == 0 {
+		delete(l.users, username)
+	}
+}
+
+func (l *connLimiter) setWaitingLocked(waiting int) {
+	l.waiting = waiting
+	metrics.QueryCtxConnQueueGauge.WithLabelValues(l.ns).Set(float64(waiting))
+}
+
+func (l *connLimiter) limitErrorLocked(username string, limits ConnLimits) error {
+	if limits.UserMaxConnections > 0 && l.users[username] >= limits.UserMaxConnections {
+		return mysql.NewErrf(mysql.ErrConCount, "Too many connections of user %s", username)
+	}
+	return mysql.NewErrf(mysql.ErrConCount, "Too many connections of namespace %s", l.ns)
+}
@@ -0,0 +1,104 @@
+package namespace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func requireConnCountErr(t *testing.T, err error) {
+	sqlErr, ok := err.(*mysql.SQLError)
+	require.True(t, ok)
+	require.Equal(t, uint16(mysql.ErrConCount), sqlErr.Code)
+}
+
+func TestNewConnLimits(t *testing.T) {
+	limits, userMaxConns := newConnLimits(&config.FrontendNamespace{
+		MaxConnections:           10,
+		ConnectionQueueSize:      2,
+		ConnectionQueueTimeoutMs: 0,
+		Users: []config.FrontendUserInfo{
+			{Username: "u1", MaxConnections: 3},
+			{Username: "u2"},
+		},
+	})
+	require.Equal(t, 10, limits.MaxConnections)
+	require.Equal(t, 2, limits.QueueSize)
+	require.Equal(t, defaultConnectionQueueTimeout, limits.QueueTimeout)
+	require.Equal(t, map[string]int{"u1": 3}, userMaxConns)
+}
+
+func TestConnLimiter_Limits(t *testing.T) {
+	ctx := context.Background()
+	l := newConnLimiter("test_ns")
+	limits := ConnLimits{MaxConnections: 2, QueueTimeout: time.Millisecond}
+	getLimits := func() ConnLimits { return limits }
+
+	// unlimited
+	require.NoError(t, l.acquire(ctx, "u1", func() ConnLimits { return ConnLimits{} }))
+	l.release("u1")
+
+	require.NoError(t, l.acquire(ctx, "u1", getLimits))
+	require.NoError(t, l.acquire(ctx, "u2", getLimits))
+	requireConnCountErr(t, l.acquire(ctx, "u1", getLimits))
+	l.release("u2")
+	require.NoError(t, l.acquire(ctx, "u1", getLimits))
+
+	limits.UserMaxConnections = 2
+	limits.MaxConnections = 0
+	requireConnCountErr(t, l.acquire(ctx, "u1", getLimits))
+	require.NoError(t, l.acquire(ctx, "u2", getLimits))
+	l.release("u1")
+	l.release("u1")
+	l.release("u2")
+	require.Zero(t, l.total)
+	require.Empty(t, l.users)
+}
+
+func TestConnLimiter_Queue(t *testing.T) {
+	ctx := context.Background()
+	l := newConnLimiter("test_ns")
+	getLimits := func() ConnLimits {
+		return ConnLimits{MaxConnections: 1, QueueSize: 1, QueueTimeout: 5 * time.Second}
+	}
+	require.NoError(t, l.acquire(ctx, "u1", getLimits))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- l.acquire(ctx, "u2", getLimits)
+	}()
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.waiting == 1
+	}, time.Second, time.Millisecond)
+
+	// the queue is full
+	requireConnCountErr(t, l.acquire(ctx, "u3", getLimits))
+
+	l.release("u1")
+	require.NoError(t, <-errCh)
+	require.Zero(t, l.waiting)
+	require.Equal(t, 1, l.users["u2"])
+}
+
+func TestConnLimiter_QueueTimeout(t *testing.T) {
+	l := newConnLimiter("test_ns")
+	getLimits := func() ConnLimits {
+		return ConnLimits{MaxConnections: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond}
+	}
+	require.NoError(t, l.acquire(context.Background(), "u1", getLimits))
+	requireConnCountErr(t, l.acquire(context.Background(), "u2", getLimits))
+	require.Zero(t, l.waiting)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, l.acquire(ctx, "u2", func() ConnLimits {
+		return ConnLimits{MaxConnections: 1, QueueSize: 1, QueueTimeout: time.Minute}
+	}))
+	require.Zero(t, l.waiting)
+}
@@ -3,21 +3,31 @@ package namespace
 import (
 	"context"
 
+	"github.com/tidb-incubator/weir/pkg/proxy/backend"
 	"github.com/tidb-incubator/weir/pkg/proxy/driver"
 )
 
 type Namespace interface {
 	Name() string
+	Revision() int64
 	Auth(username string, passwdBytes []byte, salt []byte) bool
 	IsDatabaseAllowed(db string) bool
 	ListDatabases() []string
 	IsDeniedSQL(sqlFeature uint32) bool
 	IsAllowedSQL(sqlFeature uint32) bool
 	IsDeniedHost(host string) bool
+	IsLocalInfileAllowed() bool
+	GetLocalInfileMaxSize() int64
+	GetConnLimits(username string) ConnLimits
 	GetPooledConn(context.Context) (driver.PooledBackendConn, error)
+	// InUse returns the number of borrowed backend conns, including the ones attached to transactions.
+	InUse() int
 	Close()
 	GetBreaker() (driver.Breaker, error)
 	GetRateLimiter() driver.RateLimiter
+	GetConcurrencyLimiter() driver.ConcurrencyLimiter
+	GetShadow() driver.Shadow
+	GetBackend() Backend
 }
 
 type Frontend interface {
@@ -27,9 +37,17 @@ type Frontend interface {
 	IsDeniedSQL(sqlFeature uint32) bool
 	IsAllowedSQL(sqlFeature uint32) bool
 	IsDeniedHost(host string) bool
+	IsLocalInfileAllowed() bool
+	GetLocalInfileMaxSize() int64
+	GetConnLimits(username string) ConnLimits
 }
 
 type Backend interface {
 	Close()
 	GetPooledConn(context.Context) (driver.PooledBackendConn, error)
+	AddInstance(addr string) error
+	RemoveInstance(addr string) error
+	DrainInstance(addr string) error
+	GetInstanceStatus() []*backend.InstanceStatus
+	UpdateConfig(cfg *backend.BackendConfig) error
 }
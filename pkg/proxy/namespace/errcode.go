@@ -2,16 +2,22 @@ package namespace
 
 import (
 	"github.com/pingcap/errors"
+	"github.com/tidb-incubator/weir/pkg/validation"
 )
 
 var (
-	ErrDuplicatedUser      = errors.New("duplicated user")
-	ErrInvalidSelectorType = errors.New("invalid selector type")
+	ErrDuplicatedUser      = validation.ErrDuplicatedUser
+	ErrInvalidSelectorType = validation.ErrInvalidSelectorType
 
 	ErrNilBreakerName              = errors.New("breaker name nil")
-	ErrInvalidFailureRateThreshold = errors.New("invalid FailureRateThreshold")
-	ErrInvalidopenStatusDurationMs = errors.New("invalid OpenStatusDurationMs")
-	ErrInvalidSqlTimeout           = errors.New("invalid sql timeout")
+	ErrInvalidFailureRateThreshold = validation.ErrInvalidFailureRateThreshold
+	ErrInvalidopenStatusDurationMs = validation.ErrInvalidopenStatusDurationMs
+	ErrInvalidSqlTimeout           = validation.ErrInvalidSqlTimeout
 
-	ErrInvalidScope = errors.New("invalid scope")
+	ErrInvalidScope = validation.ErrInvalidScope
+
+	ErrInvalidConcurrencyLimit = validation.ErrInvalidConcurrencyLimit
+
+	ErrNamespaceNotFound  = errors.New("namespace not found")
+	ErrNamespaceNotPaused = errors.New("namespace is not paused")
 )
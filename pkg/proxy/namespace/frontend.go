@@ -17,6 +17,10 @@ type FrontendNamespace struct {
 	sqlBlacklist map[uint32]SQLInfo
 	sqlWhitelist map[uint32]SQLInfo
 	deniedHostSet map[string]struct{}
+	allowLocalInfile   bool
+	localInfileMaxSize int64
+	connLimits         ConnLimits
+	userMaxConns       map[string]int
 }
 
 func (n *FrontendNamespace) Auth(username string, passwdBytes []byte, salt []byte) bool {
@@ -53,3 +57,17 @@ func (n *FrontendNamespace) IsDeniedHost(host string) bool {
 	_, ok := n.deniedHostSet[host]
 	return ok
 }
+
+func (n *FrontendNamespace) IsLocalInfileAllowed() bool {
+	return n.allowLocalInfile
+}
+
+func (n *FrontendNamespace) GetLocalInfileMaxSize() int64 {
+	return n.localInfileMaxSize
+}
+
+func (n *FrontendNamespace) GetConnLimits(username string) ConnLimits {
+	limits := n.connLimits
+	limits.UserMaxConnections = n.userMaxConns[username]
+	return limits
+}
@@ -2,6 +2,7 @@ package namespace
 
 import (
 	"sync"
+	"time"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/util/logutil"
@@ -20,13 +21,22 @@ type NamespaceManager struct {
 
 	reloadLock     sync.Mutex
 	reloadPrepared map[string]bool
+
+	connLimiterLock sync.Mutex
+	connLimiters    map[string]*connLimiter // key: namespace
+
+	pauserLock sync.Mutex
+	pausers    map[string]*pauser // key: namespace
 }
 
 type NamespaceBuilder func(cfg *config.Namespace) (Namespace, error)
 type NamespaceCloser func(ns Namespace) error
 
-func CreateNamespaceManager(cfgs []*config.Namespace, builder NamespaceBuilder, closer NamespaceCloser) (*NamespaceManager, error) {
-	users, err := CreateUserNamespaceMapper(cfgs)
+// CreateNamespaceManager creates the manager of namespaces, a user can be owned by several namespaces in boundNamespaces,
+// which are bound to listeners.
+func CreateNamespaceManager(cfgs []*config.Namespace, boundNamespaces map[string]struct{}, builder NamespaceBuilder,
+	closer NamespaceCloser) (*NamespaceManager, error) {
+	users, err := CreateUserNamespaceMapper(cfgs, boundNamespaces)
 	if err != nil {
 		return nil, errors.WithMessage(err, "create UserNamespaceMapper error")
 	}
@@ -45,6 +55,8 @@ func NewNamespaceManager(users *UserNamespaceMapper, nss *NamespaceHolder, build
 		build:          builder,
 		close:          closer,
 		reloadPrepared: make(map[string]bool),
+		connLimiters:   make(map[string]*connLimiter),
+		pausers:        make(map[string]*pauser),
 	}
 	mgr.users[0] = users
 	mgr.nss[0] = nss
@@ -58,13 +70,83 @@ func (n *NamespaceManager) Auth(username string, pwd, salt []byte) (driver.Names
 	}
 
 	wrapper := &NamespaceWrapper{
-		nsmgr: n,
-		name:  nsName,
+		nsmgr:  n,
+		name:   nsName,
+		pauser: n.getPauser(nsName),
 	}
 
 	return wrapper, wrapper.mustGetCurrentNamespace().Auth(username, pwd, salt)
 }
 
+// AuthNamespace authenticates the user in the given namespace, which is bound to the listener of the conn.
+func (n *NamespaceManager) AuthNamespace(namespace, username string, pwd, salt []byte) (driver.Namespace, bool) {
+	ns, ok := n.getCurrentNamespaces().Get(namespace)
+	if !ok {
+		return nil, false
+	}
+
+	wrapper := &NamespaceWrapper{
+		nsmgr:  n,
+		name:   namespace,
+		pauser: n.getPauser(namespace),
+	}
+
+	return wrapper, ns.Auth(username, pwd, salt)
+}
+
+// getConnLimiter returns the conn limiter of namespace, which is created on demand and never removed,
+// since the conns of a removed namespace may still be open.
+func (n *NamespaceManager) getConnLimiter(namespace string) *connLimiter {
+	n.connLimiterLock.Lock()
+	defer n.connLimiterLock.Unlock()
+	l, ok := n.connLimiters[namespace]
+	if !ok {
+		l = newConnLimiter(namespace)
+		n.connLimiters[namespace] = l
+	}
+	return l
+}
+
+// getPauser returns the pauser of namespace, which is created on demand and kept across reloads.
+func (n *NamespaceManager) getPauser(namespace string) *pauser {
+	n.pauserLock.Lock()
+	defer n.pauserLock.Unlock()
+	p, ok := n.pausers[namespace]
+	if !ok {
+		p = newPauser(namespace)
+		n.pausers[namespace] = p
+	}
+	return p
+}
+
+// PauseNamespace holds the new statements of idle and autocommit sessions for at most timeout each,
+// while the in-flight transactions go on. The backend can be swapped by reloading the namespace
+// when they are done, and the held statements run on the new backend after ResumeNamespace.
+func (n *NamespaceManager) PauseNamespace(namespace string, timeout time.Duration) error {
+	if _, ok := n.getCurrentNamespaces().Get(namespace); !ok {
+		return ErrNamespaceNotFound
+	}
+	n.getPauser(namespace).pause(timeout)
+	return nil
+}
+
+func (n *NamespaceManager) ResumeNamespace(namespace string) error {
+	if !n.getPauser(namespace).resume() {
+		return ErrNamespaceNotPaused
+	}
+	return nil
+}
+
+func (n *NamespaceManager) GetPauseStatus(namespace string) (PauseStatus, error) {
+	ns, ok := n.getCurrentNamespaces().Get(namespace)
+	if !ok {
+		return PauseStatus{}, ErrNamespaceNotFound
+	}
+	status := n.getPauser(namespace).status()
+	status.InUse = ns.InUse()
+	return status, nil
+}
+
 func (n *NamespaceManager) PrepareReloadNamespace(namespace string, cfg *config.Namespace) error {
 	n.reloadLock.Lock()
 	defer n.reloadLock.Unlock()
@@ -75,7 +157,7 @@ func (n *NamespaceManager) PrepareReloadNamespace(namespace string, cfg *config.
 		return errors.WithMessage(err, "add namespace users error")
 	}
 
-	newNs, err := n.build(cfg)
+	newNs, err := n.buildReloadNamespace(namespace, cfg)
 	if err != nil {
 		return errors.WithMessage(err, "build namespace error")
 	}
@@ -99,7 +181,49 @@ func (n *NamespaceManager) CommitReloadNamespaces(namespaces []string) error {
 		}
 	}
 
+	currentNss := n.getCurrentNamespaces()
+	_, preparedNss := n.getOther()
 	n.toggle()
+
+	// close the replaced namespaces, after the backends are handed over to the new ones
+	for namespace := range n.reloadPrepared {
+		newNs, _ := preparedNss.Get(namespace)
+		if reloadable, ok := newNs.(reloadableNamespace); ok {
+			reloadable.commitReload()
+		}
+		oldNs, ok := currentNss.Get(namespace)
+		if !ok || oldNs == newNs {
+			continue
+		}
+		if err := n.close(oldNs); err != nil {
+			logutil.BgLogger().Error("close replaced namespace error", zap.Error(err), zap.String("namespace", namespace))
+		}
+	}
+	n.reloadPrepared = make(map[string]bool)
+	return nil
+}
+
+// AbortReloadNamespace discards the prepared namespaces and closes the newly built one.
+func (n *NamespaceManager) AbortReloadNamespace(namespace string) error {
+	n.reloadLock.Lock()
+	defer n.reloadLock.Unlock()
+
+	if !n.reloadPrepared[namespace] {
+		return errors.Errorf("namespace is not prepared: %s", namespace)
+	}
+
+	if _, otherNss := n.getOther(); otherNss != nil {
+		preparedNs, ok := otherNss.Get(namespace)
+		currentNs, _ := n.getCurrentNamespaces().Get(namespace)
+		if ok && preparedNs != currentNs {
+			if err := n.close(preparedNs); err != nil {
+				logutil.BgLogger().Error("close prepared namespace error", zap.Error(err), zap.String("namespace", namespace))
+			}
+		}
+	}
+
+	n.setOther(nil, nil)
+	n.reloadPrepared = make(map[string]bool)
 	return nil
 }
 
@@ -120,6 +244,36 @@ func (n *NamespaceManager) RemoveNamespace(name string) {
 	}
 
 	nss.Delete(name)
+	// wake up the held statements rather than letting them wait for the pause timeout,
+	// they find the namespace removed and fail with ErrNamespaceNotFound.
+	n.getPauser(name).resume()
+}
+
+// buildReloadNamespace reuses the backend of current namespace if possible, otherwise builds a new namespace.
+func (n *NamespaceManager) buildReloadNamespace(namespace string, cfg *config.Namespace) (Namespace, error) {
+	if currentNs, ok := n.getCurrentNamespaces().Get(namespace); ok {
+		if reloadable, ok := currentNs.(reloadableNamespace); ok {
+			newNs, reused, err := reloadable.prepareReload(cfg)
+			if reused {
+				return newNs, err
+			}
+		}
+	}
+	return n.build(cfg)
+}
+
+// GetBackend returns the backend of current namespace, which can be changed in place.
+func (n *NamespaceManager) GetBackend(name string) (Backend, bool) {
+	ns, ok := n.getCurrentNamespaces().Get(name)
+	if !ok {
+		return nil, false
+	}
+	return ns.GetBackend(), true
+}
+
+// GetNamespaceRevisions return the config revisions of running namespaces
+func (n *NamespaceManager) GetNamespaceRevisions() map[string]int64 {
+	return n.getCurrentNamespaces().GetRevisions()
 }
 
 func (n *NamespaceManager) getNamespaceByUsername(username string) (string, bool) {
@@ -141,6 +295,11 @@ func (n *NamespaceManager) getCurrentNamespaces() *NamespaceHolder {
 	return n.nss[current]
 }
 
+func (n *NamespaceManager) getOther() (*UserNamespaceMapper, *NamespaceHolder) {
+	_, other, _ := n.switchIndex.Get()
+	return n.users[other], n.nss[other]
+}
+
 func (n *NamespaceManager) setOther(users *UserNamespaceMapper, nss *NamespaceHolder) {
 	_, other, _ := n.switchIndex.Get()
 	n.users[other] = users
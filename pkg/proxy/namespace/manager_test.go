@@ -0,0 +1,147 @@
+package namespace
+
+import (
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+type fakeNamespace struct {
+	Namespace
+	name  string
+	users []config.FrontendUserInfo
+}
+
+func (f *fakeNamespace) Name() string {
+	return f.name
+}
+
+func (f *fakeNamespace) InUse() int {
+	return 0
+}
+
+func (f *fakeNamespace) Auth(username string, passwdBytes []byte, salt []byte) bool {
+	for _, user := range f.users {
+		if user.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+func createTestNamespaceManager(t *testing.T, closed *[]Namespace) *NamespaceManager {
+	builder := func(cfg *config.Namespace) (Namespace, error) {
+		return &fakeNamespace{name: cfg.Namespace, users: cfg.Frontend.Users}, nil
+	}
+	closer := func(ns Namespace) error {
+		*closed = append(*closed, ns)
+		return nil
+	}
+	cfgs := []*config.Namespace{
+		{
+			Namespace: "test_ns",
+			Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+		},
+	}
+	boundNamespaces := map[string]struct{}{"test_ns": {}, "other_ns": {}}
+	mgr, err := CreateNamespaceManager(cfgs, boundNamespaces, builder, closer)
+	require.NoError(t, err)
+	return mgr
+}
+
+func TestNamespaceManager_AbortReloadNamespace(t *testing.T) {
+	var closed []Namespace
+	mgr := createTestNamespaceManager(t, &closed)
+	oldNs, ok := mgr.getCurrentNamespaces().Get("test_ns")
+	require.True(t, ok)
+
+	require.Error(t, mgr.AbortReloadNamespace("test_ns"))
+
+	cfg := &config.Namespace{
+		Namespace: "test_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "world"}}},
+	}
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", cfg))
+	require.NoError(t, mgr.AbortReloadNamespace("test_ns"))
+	require.Len(t, closed, 1)
+	require.NotSame(t, oldNs, closed[0])
+
+	// current namespace is not changed, and commit is rejected after abort
+	currentNs, ok := mgr.getCurrentNamespaces().Get("test_ns")
+	require.True(t, ok)
+	require.Same(t, oldNs, currentNs)
+	_, ok = mgr.getNamespaceByUsername("hello")
+	require.True(t, ok)
+	_, ok = mgr.getNamespaceByUsername("world")
+	require.False(t, ok)
+	require.Error(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+}
+
+func TestNamespaceManager_CommitReloadNamespaces(t *testing.T) {
+	var closed []Namespace
+	mgr := createTestNamespaceManager(t, &closed)
+
+	cfg := &config.Namespace{
+		Namespace: "test_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "world"}}},
+	}
+	oldNs, ok := mgr.getCurrentNamespaces().Get("test_ns")
+	require.True(t, ok)
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", cfg))
+	require.Len(t, closed, 0)
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+	_, ok = mgr.getNamespaceByUsername("world")
+	require.True(t, ok)
+
+	// the replaced namespace is closed
+	require.Len(t, closed, 1)
+	require.Same(t, oldNs, closed[0])
+
+	// prepared state is cleared after commit
+	require.Error(t, mgr.AbortReloadNamespace("test_ns"))
+	require.Error(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+}
+
+func TestNamespaceManager_AuthNamespace(t *testing.T) {
+	var closed []Namespace
+	mgr := createTestNamespaceManager(t, &closed)
+
+	// the user is owned by two namespaces, so it can only connect to the listeners bound to one of them
+	cfg := &config.Namespace{
+		Namespace: "other_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+	}
+	require.NoError(t, mgr.PrepareReloadNamespace("other_ns", cfg))
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"other_ns"}))
+
+	_, ok := mgr.Auth("hello", nil, nil)
+	require.False(t, ok)
+	ns, ok := mgr.AuthNamespace("other_ns", "hello", nil, nil)
+	require.True(t, ok)
+	require.Equal(t, "other_ns", ns.Name())
+	_, ok = mgr.AuthNamespace("test_ns", "world", nil, nil)
+	require.False(t, ok)
+	_, ok = mgr.AuthNamespace("unknown_ns", "hello", nil, nil)
+	require.False(t, ok)
+
+	// the user is unique again after the other namespace removes it
+	cfg.Frontend.Users = []config.FrontendUserInfo{{Username: "world"}}
+	require.NoError(t, mgr.PrepareReloadNamespace("other_ns", cfg))
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"other_ns"}))
+	nsName, ok := mgr.getNamespaceByUsername("hello")
+	require.True(t, ok)
+	require.Equal(t, "test_ns", nsName)
+
+	// a user can not be owned by a namespace not bound to any listener, or it can connect to no namespace
+	unbound := &config.Namespace{
+		Namespace: "unbound_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+	}
+	require.Equal(t, ErrDuplicatedUser, errors.Cause(mgr.PrepareReloadNamespace("unbound_ns", unbound)))
+
+	// a user can not appear twice in a namespace
+	cfg.Frontend.Users = []config.FrontendUserInfo{{Username: "world"}, {Username: "world"}}
+	require.Error(t, mgr.PrepareReloadNamespace("other_ns", cfg))
+}
@@ -3,12 +3,10 @@ package namespace
 import (
 	"context"
 	"fmt"
-	"sync/atomic"
 
 	"github.com/pingcap/errors"
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/tidb-incubator/weir/pkg/proxy/driver"
-	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
 )
 
 type NamespaceHolder struct {
@@ -16,9 +14,9 @@ type NamespaceHolder struct {
 }
 
 type NamespaceWrapper struct {
-	nsmgr       *NamespaceManager
-	name        string
-	connCounter int64
+	nsmgr  *NamespaceManager
+	name   string
+	pauser *pauser // cached since it is checked by every new statement
 }
 
 func CreateNamespaceHolder(cfgs []*config.Namespace, build NamespaceBuilder) (*NamespaceHolder, error) {
@@ -51,6 +49,14 @@ func (n *NamespaceHolder) Delete(name string) {
 	delete(n.nss, name)
 }
 
+func (n *NamespaceHolder) GetRevisions() map[string]int64 {
+	revisions := make(map[string]int64, len(n.nss))
+	for name, ns := range n.nss {
+		revisions[name] = ns.Revision()
+	}
+	return revisions
+}
+
 func (n *NamespaceHolder) Clone() *NamespaceHolder {
 	nss := make(map[string]Namespace)
 	for name, ns := range n.nss {
@@ -85,18 +91,41 @@ func (n *NamespaceWrapper) IsDeniedHost(host string) bool {
 	return n.mustGetCurrentNamespace().IsDeniedHost(host)
 }
 
+func (n *NamespaceWrapper) IsLocalInfileAllowed() bool {
+	return n.mustGetCurrentNamespace().IsLocalInfileAllowed()
+}
+
+func (n *NamespaceWrapper) GetLocalInfileMaxSize() int64 {
+	return n.mustGetCurrentNamespace().GetLocalInfileMaxSize()
+}
+
+// GetPooledConn is called only if the session has no attached conn, so the new statements and
+// transactions wait while the namespace is paused, and get the conn from the namespace resumed.
+// It returns ErrNamespaceNotFound if the namespace is removed while waiting.
 func (n *NamespaceWrapper) GetPooledConn(ctx context.Context) (driver.PooledBackendConn, error) {
-	return n.mustGetCurrentNamespace().GetPooledConn(ctx)
+	if err := n.pauser.wait(ctx); err != nil {
+		return nil, err
+	}
+	ns, ok := n.nsmgr.getCurrentNamespaces().Get(n.name)
+	if !ok {
+		return nil, ErrNamespaceNotFound
+	}
+	return ns.GetPooledConn(ctx)
 }
 
-func (n *NamespaceWrapper) IncrConnCount() {
-	currCnt := atomic.AddInt64(&n.connCounter, 1)
-	metrics.QueryCtxGauge.WithLabelValues(n.name).Set(float64(currCnt))
+func (n *NamespaceWrapper) AcquireConn(ctx context.Context, username string) error {
+	return n.nsmgr.getConnLimiter(n.name).acquire(ctx, username, func() ConnLimits {
+		// the namespace removed while waiting does not limit the conn, which fails at the next query.
+		ns, ok := n.nsmgr.getCurrentNamespaces().Get(n.name)
+		if !ok {
+			return ConnLimits{}
+		}
+		return ns.GetConnLimits(username)
+	})
 }
 
-func (n *NamespaceWrapper) DescConnCount() {
-	currCnt := atomic.AddInt64(&n.connCounter, -1)
-	metrics.QueryCtxGauge.WithLabelValues(n.name).Set(float64(currCnt))
+func (n *NamespaceWrapper) ReleaseConn(username string) {
+	n.nsmgr.getConnLimiter(n.name).release(username)
 }
 
 func (n *NamespaceWrapper) Closed() bool {
@@ -112,6 +141,14 @@ func (n *NamespaceWrapper) GetRateLimiter() driver.RateLimiter {
 	return n.mustGetCurrentNamespace().GetRateLimiter()
 }
 
+func (n *NamespaceWrapper) GetConcurrencyLimiter() driver.ConcurrencyLimiter {
+	return n.mustGetCurrentNamespace().GetConcurrencyLimiter()
+}
+
+func (n *NamespaceWrapper) GetShadow() driver.Shadow {
+	return n.mustGetCurrentNamespace().GetShadow()
+}
+
 func (n *NamespaceWrapper) mustGetCurrentNamespace() Namespace {
 	ns, ok := n.nsmgr.getCurrentNamespaces().Get(n.name)
 	if !ok {
@@ -0,0 +1,129 @@
+package namespace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+)
+
+const (
+	defaultPauseTimeout = 30 * time.Second
+)
+
+// PauseStatus is the pause state of a namespace. InUse is the number of backend conns borrowed from
+// current namespace, including the ones attached to transactions, the backend can be swapped once it is 0.
+type PauseStatus struct {
+	Paused   bool       `json:"paused"`
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+	Timeout  string     `json:"timeout,omitempty"`
+	Waiting  int        `json:"waiting"`
+	InUse    int        `json:"in_use"`
+}
+
+// pauser holds the new statements of a namespace while it is paused, so that the backend can be
+// swapped without failing the clients. It is kept by NamespaceManager across reloads, since the
+// backend is swapped by reloading the namespace, and the statements go on with the reloaded one.
+type pauser struct {
+	ns     string
+	paused sync2.AtomicBool // checked without lock before waiting
+
+	mu       sync.Mutex
+	resumed  chan struct{} // closed on resume to wake up the waiting statements
+	timeout  time.Duration
+	pausedAt time.Time
+	waiting  int
+}
+
+func newPauser(ns string) *pauser {
+	return &pauser{
+		ns:     ns,
+		paused: sync2.NewAtomicBool(false),
+	}
+}
+
+// pause holds the new statements for at most timeout each, pausing a paused namespace updates the timeout.
+func (p *pauser) pause(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultPauseTimeout
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timeout = timeout
+	if p.resumed != nil {
+		return
+	}
+	p.resumed = make(chan struct{})
+	p.pausedAt = time.Now()
+	p.paused.Set(true)
+	metrics.NamespacePausedGauge.WithLabelValues(p.ns).Set(1)
+}
+
+// resume wakes up the waiting statements, it returns false if the namespace is not paused.
+func (p *pauser) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		return false
+	}
+	close(p.resumed)
+	p.resumed = nil
+	p.paused.Set(false)
+	metrics.NamespacePausedGauge.WithLabelValues(p.ns).Set(0)
+	return true
+}
+
+// wait blocks while the namespace is paused. The statement fails if the namespace is not resumed in timeout.
+func (p *pauser) wait(ctx context.Context) error {
+	if !p.paused.Get() {
+		return nil
+	}
+	p.mu.Lock()
+	resumed, timeout := p.resumed, p.timeout
+	if resumed == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.setWaitingLocked(p.waiting + 1)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.setWaitingLocked(p.waiting - 1)
+		p.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-resumed:
+		return nil
+	case <-timer.C:
+		metrics.NamespacePauseTimeoutCounter.WithLabelValues(p.ns).Inc()
+		return mysql.NewErrf(mysql.ErrUnknown, "Namespace %s is paused, wait timeout", p.ns)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pauser) setWaitingLocked(waiting int) {
+	p.waiting = waiting
+	metrics.NamespacePauseQueueGauge.WithLabelValues(p.ns).Set(float64(waiting))
+}
+
+func (p *pauser) status() PauseStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := PauseStatus{
+		Paused:  p.resumed != nil,
+		Waiting: p.waiting,
+	}
+	if s.Paused {
+		pausedAt := p.pausedAt
+		s.PausedAt = &pausedAt
+		s.Timeout = p.timeout.String()
+	}
+	return s
+}
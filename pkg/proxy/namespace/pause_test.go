@@ -0,0 +1,158 @@
+package namespace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+)
+
+func TestPauser_Wait(t *testing.T) {
+	ctx := context.Background()
+	p := newPauser("test_ns")
+	require.NoError(t, p.wait(ctx))
+	require.False(t, p.resume())
+
+	p.pause(time.Second)
+	done := make(chan error, 1)
+	go func() {
+		done <- p.wait(ctx)
+	}()
+	require.Eventually(t, func() bool { return p.status().Waiting == 1 }, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("wait returned while paused")
+	default:
+	}
+
+	require.True(t, p.resume())
+	require.NoError(t, <-done)
+	require.Equal(t, PauseStatus{}, p.status())
+	require.NoError(t, p.wait(ctx))
+}
+
+func TestPauser_Timeout(t *testing.T) {
+	p := newPauser("test_ns")
+	p.pause(time.Millisecond)
+	err := p.wait(context.Background())
+	sqlErr, ok := err.(*mysql.SQLError)
+	require.True(t, ok)
+	require.Equal(t, uint16(mysql.ErrUnknown), sqlErr.Code)
+	require.Equal(t, 0, p.status().Waiting)
+
+	// pausing a paused namespace updates the timeout
+	p.pause(0)
+	status := p.status()
+	require.True(t, status.Paused)
+	require.Equal(t, defaultPauseTimeout.String(), status.Timeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, p.wait(ctx))
+}
+
+func TestNamespaceManager_PauseNamespace(t *testing.T) {
+	var closed []Namespace
+	mgr := createTestNamespaceManager(t, &closed)
+
+	require.Equal(t, ErrNamespaceNotFound, mgr.PauseNamespace("unknown", time.Second))
+	require.Equal(t, ErrNamespaceNotPaused, mgr.ResumeNamespace("test_ns"))
+	_, err := mgr.GetPauseStatus("unknown")
+	require.Equal(t, ErrNamespaceNotFound, err)
+
+	require.NoError(t, mgr.PauseNamespace("test_ns", time.Second))
+	status, err := mgr.GetPauseStatus("test_ns")
+	require.NoError(t, err)
+	require.True(t, status.Paused)
+	require.Equal(t, "1s", status.Timeout)
+
+	// the sessions share the pauser of namespace
+	ns, _ := mgr.Auth("hello", nil, nil)
+	require.Same(t, mgr.getPauser("test_ns"), ns.(*NamespaceWrapper).pauser)
+	require.NoError(t, mgr.ResumeNamespace("test_ns"))
+	status, err = mgr.GetPauseStatus("test_ns")
+	require.NoError(t, err)
+	require.False(t, status.Paused)
+}
+
+// connNamespace returns its own conn, so that the namespace a conn comes from can be told.
+type connNamespace struct {
+	fakeNamespace
+	conn *fakePooledConn
+}
+
+func (n *connNamespace) GetPooledConn(context.Context) (driver.PooledBackendConn, error) {
+	return n.conn, nil
+}
+
+func createConnNamespaceManager(t *testing.T) *NamespaceManager {
+	builder := func(cfg *config.Namespace) (Namespace, error) {
+		return &connNamespace{fakeNamespace: fakeNamespace{name: cfg.Namespace, users: cfg.Frontend.Users}, conn: &fakePooledConn{}}, nil
+	}
+	closer := func(ns Namespace) error {
+		return nil
+	}
+	cfgs := []*config.Namespace{
+		{
+			Namespace: "test_ns",
+			Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+		},
+	}
+	mgr, err := CreateNamespaceManager(cfgs, nil, builder, closer)
+	require.NoError(t, err)
+	return mgr
+}
+
+func TestNamespaceManager_PauseAndReload(t *testing.T) {
+	mgr := createConnNamespaceManager(t)
+	ns, ok := mgr.Auth("hello", nil, nil)
+	require.True(t, ok)
+
+	require.NoError(t, mgr.PauseNamespace("test_ns", 10*time.Second))
+	type result struct {
+		conn driver.PooledBackendConn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := ns.(*NamespaceWrapper).GetPooledConn(context.Background())
+		done <- result{conn, err}
+	}()
+	require.Eventually(t, func() bool { return mgr.getPauser("test_ns").status().Waiting == 1 }, time.Second, time.Millisecond)
+
+	cfg := &config.Namespace{
+		Namespace: "test_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+	}
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", cfg))
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+	reloadedNs, ok := mgr.getCurrentNamespaces().Get("test_ns")
+	require.True(t, ok)
+
+	require.NoError(t, mgr.ResumeNamespace("test_ns"))
+	ret := <-done
+	require.NoError(t, ret.err)
+	require.Same(t, reloadedNs.(*connNamespace).conn, ret.conn)
+}
+
+func TestNamespaceManager_PauseAndRemove(t *testing.T) {
+	mgr := createConnNamespaceManager(t)
+	ns, ok := mgr.Auth("hello", nil, nil)
+	require.True(t, ok)
+
+	require.NoError(t, mgr.PauseNamespace("test_ns", 10*time.Second))
+	done := make(chan error, 1)
+	go func() {
+		_, err := ns.(*NamespaceWrapper).GetPooledConn(context.Background())
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return mgr.getPauser("test_ns").status().Waiting == 1 }, time.Second, time.Millisecond)
+
+	// the held statement fails rather than using the removed namespace.
+	mgr.RemoveNamespace("test_ns")
+	require.Equal(t, ErrNamespaceNotFound, <-done)
+}
@@ -0,0 +1,93 @@
+package namespace
+
+import (
+	"reflect"
+
+	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/backend"
+	"go.uber.org/zap"
+)
+
+// reloadableNamespace can be reloaded without rebuilding the backend.
+type reloadableNamespace interface {
+	// prepareReload returns false if the namespace should be rebuilt.
+	prepareReload(cfg *config.Namespace) (Namespace, bool, error)
+	// commitReload is called on the prepared namespace when it becomes current.
+	commitReload()
+}
+
+// backendReload is the backend config to apply to the reused backend on commit.
+type backendReload struct {
+	from *NamespaceImpl
+	cfg  *backend.BackendConfig
+	// groups is set instead of cfg if the backend is split into groups.
+	groups []*backend.GroupConfig
+}
+
+// prepareReload builds the new namespace with the live backend of n, if only the pool options,
+// selector, instances and group weights are changed. The backend config is applied in commitReload,
+// so that the live backend is not changed if the reload is aborted.
+func (n *NamespaceImpl) prepareReload(cfg *config.Namespace) (Namespace, bool, error) {
+	if n.backendCfg == nil || !n.ownsBackend.Get() || !canUpdateBackendInPlace(n.backendCfg, &cfg.Backend) {
+		return nil, false, nil
+	}
+
+	reload := &backendReload{from: n}
+	var err error
+	if len(cfg.Backend.Groups) > 0 {
+		if _, ok := n.Backend.(*backend.GroupBackend); !ok {
+			return nil, false, nil
+		}
+		reload.groups, err = parseGroupConfigs(&cfg.Backend)
+	} else {
+		reload.cfg, err = parseBackendConfig(&cfg.Backend)
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	ns, err := buildNamespaceWithBackend(cfg, n.Backend)
+	if err != nil {
+		return nil, true, err
+	}
+	// the conns borrowed from the old namespace are waited for when the new one closes the backend
+	ns.conns = n.conns
+	ns.reload = reload
+	return ns, true, nil
+}
+
+func (n *NamespaceImpl) commitReload() {
+	if n.reload == nil {
+		return
+	}
+	var err error
+	if n.reload.groups != nil {
+		err = n.Backend.(*backend.GroupBackend).UpdateGroups(n.reload.groups)
+	} else {
+		err = n.Backend.UpdateConfig(n.reload.cfg)
+	}
+	if err != nil {
+		logutil.BgLogger().Error("update backend config error", zap.String("namespace", n.name), zap.Error(err))
+	}
+	n.reload.from.ownsBackend.Set(false)
+	n.ownsBackend.Set(true)
+	n.reload = nil
+}
+
+// canUpdateBackendInPlace returns true if the credentials and the discovery are not changed.
+// The backend groups can not be added, removed or reordered in place.
+func canUpdateBackendInPlace(oldCfg, newCfg *config.BackendNamespace) bool {
+	if oldCfg.Username != newCfg.Username ||
+		oldCfg.Password != newCfg.Password ||
+		!reflect.DeepEqual(oldCfg.Discovery, newCfg.Discovery) ||
+		len(oldCfg.Groups) != len(newCfg.Groups) {
+		return false
+	}
+	for i := range oldCfg.Groups {
+		if oldCfg.Groups[i].Name != newCfg.Groups[i].Name ||
+			!reflect.DeepEqual(oldCfg.Groups[i].Discovery, newCfg.Groups[i].Discovery) {
+			return false
+		}
+	}
+	return true
+}
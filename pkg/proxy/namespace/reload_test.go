@@ -0,0 +1,141 @@
+package namespace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func createTestReloadNamespaceConfig(poolSize int, password string) *config.Namespace {
+	return &config.Namespace{
+		Namespace: "test_ns",
+		Frontend:  config.FrontendNamespace{Users: []config.FrontendUserInfo{{Username: "hello"}}},
+		Backend: config.BackendNamespace{
+			Username:     "root",
+			Password:     password,
+			Instances:    []string{"127.0.0.1:4000"},
+			SelectorType: "random",
+			PoolSize:     poolSize,
+		},
+	}
+}
+
+// createTestReloadNamespaceManager creates a manager with a NamespaceImpl on fakeBackend,
+// and the rebuilt namespaces are fakeNamespace.
+func createTestReloadNamespaceManager(t *testing.T, closed *[]Namespace) (*NamespaceManager, *NamespaceImpl, *fakeBackend) {
+	cfg := createTestReloadNamespaceConfig(10, "")
+	b := &fakeBackend{}
+	ns, err := buildNamespaceWithBackend(cfg, b)
+	require.NoError(t, err)
+	ns.ownsBackend.Set(true)
+
+	users, err := CreateUserNamespaceMapper([]*config.Namespace{cfg}, nil)
+	require.NoError(t, err)
+	nss := &NamespaceHolder{nss: map[string]Namespace{"test_ns": ns}}
+	builder := func(cfg *config.Namespace) (Namespace, error) {
+		return &fakeNamespace{name: cfg.Namespace}, nil
+	}
+	closer := func(ns Namespace) error {
+		*closed = append(*closed, ns)
+		return nil
+	}
+	return NewNamespaceManager(users, nss, builder, closer), ns, b
+}
+
+func TestNamespaceManager_ReloadReuseBackend(t *testing.T) {
+	var closed []Namespace
+	mgr, oldNs, b := createTestReloadNamespaceManager(t, &closed)
+
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", createTestReloadNamespaceConfig(20, "")))
+	_, preparedNss := mgr.getOther()
+	preparedNs, ok := preparedNss.Get("test_ns")
+	require.True(t, ok)
+	newNs, ok := preparedNs.(*NamespaceImpl)
+	require.True(t, ok)
+	require.Same(t, b, newNs.GetBackend())
+	// the live backend is not changed before commit
+	require.Nil(t, b.updated)
+
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+	require.NotNil(t, b.updated)
+	require.Equal(t, 20, b.updated.Capacity)
+	require.False(t, oldNs.ownsBackend.Get())
+	require.True(t, newNs.ownsBackend.Get())
+	require.Len(t, closed, 1)
+	require.Same(t, oldNs, closed[0])
+
+	// the closed namespace does not close the reused backend
+	require.NoError(t, DefaultAsyncCloseNamespace(oldNs))
+	require.False(t, b.closed.Get())
+}
+
+func TestNamespaceManager_ReloadKeepBorrowedConns(t *testing.T) {
+	var closed []Namespace
+	mgr, oldNs, b := createTestReloadNamespaceManager(t, &closed)
+	conn, err := oldNs.GetPooledConn(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", createTestReloadNamespaceConfig(20, "")))
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+	newNs, ok := mgr.getCurrentNamespaces().Get("test_ns")
+	require.True(t, ok)
+	require.Equal(t, 1, newNs.(*NamespaceImpl).InUse())
+
+	// the new namespace waits for the conn borrowed from the old one before closing the backend
+	require.NoError(t, CreateAsyncNamespaceCloser(10*time.Second)(newNs))
+	time.Sleep(3 * namespaceCloseCheckInterval)
+	require.False(t, b.closed.Get())
+	conn.PutBack()
+	require.Eventually(t, b.closed.Get, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNamespaceManager_AbortReloadReuseBackend(t *testing.T) {
+	var closed []Namespace
+	mgr, oldNs, b := createTestReloadNamespaceManager(t, &closed)
+
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", createTestReloadNamespaceConfig(20, "")))
+	require.NoError(t, mgr.AbortReloadNamespace("test_ns"))
+	require.Nil(t, b.updated)
+	require.True(t, oldNs.ownsBackend.Get())
+	require.Len(t, closed, 1)
+	require.NotSame(t, oldNs, closed[0])
+}
+
+func TestNamespaceManager_ReloadRebuildBackend(t *testing.T) {
+	var closed []Namespace
+	mgr, oldNs, b := createTestReloadNamespaceManager(t, &closed)
+
+	require.NoError(t, mgr.PrepareReloadNamespace("test_ns", createTestReloadNamespaceConfig(10, "123456")))
+	require.NoError(t, mgr.CommitReloadNamespaces([]string{"test_ns"}))
+	currentNs, ok := mgr.getCurrentNamespaces().Get("test_ns")
+	require.True(t, ok)
+	_, ok = currentNs.(*fakeNamespace)
+	require.True(t, ok)
+	require.Nil(t, b.updated)
+	require.True(t, oldNs.ownsBackend.Get())
+	require.Len(t, closed, 1)
+	require.Same(t, oldNs, closed[0])
+}
+
+func TestCanUpdateBackendGroupsInPlace(t *testing.T) {
+	newCfg := func(groups ...config.BackendGroup) *config.BackendNamespace {
+		return &config.BackendNamespace{Username: "root", SelectorType: "random", Groups: groups}
+	}
+	oldCfg := newCfg(config.BackendGroup{Name: "old", Weight: 100}, config.BackendGroup{Name: "new"})
+
+	// the weights and instances are updated in place
+	require.True(t, canUpdateBackendInPlace(oldCfg, newCfg(
+		config.BackendGroup{Name: "old", Weight: 50, Instances: []string{"127.0.0.1:4000"}},
+		config.BackendGroup{Name: "new", Weight: 50},
+	)))
+	require.False(t, canUpdateBackendInPlace(oldCfg, newCfg(config.BackendGroup{Name: "old", Weight: 100})))
+	require.False(t, canUpdateBackendInPlace(oldCfg, newCfg(config.BackendGroup{Name: "new"}, config.BackendGroup{Name: "old", Weight: 100})))
+	require.False(t, canUpdateBackendInPlace(oldCfg, newCfg(
+		config.BackendGroup{Name: "old", Weight: 100},
+		config.BackendGroup{Name: "new", Discovery: config.DiscoveryInfo{Type: "pd", Addrs: []string{"127.0.0.1:2379"}}},
+	)))
+	require.False(t, canUpdateBackendInPlace(&config.BackendNamespace{Username: "root"}, oldCfg))
+}
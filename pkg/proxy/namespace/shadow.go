@@ -0,0 +1,253 @@
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+	"github.com/tidb-incubator/weir/pkg/validation"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultShadowQueueSize = 1024
+	defaultShadowTimeout   = 5 * time.Second
+
+	// the metrics and logs of the shadow backend are labeled with namespace + shadowBackendSuffix.
+	shadowBackendSuffix = "_shadow"
+	// the digests labeled in the metrics are capped, the others are labeled metrics.ShadowDigestOther.
+	maxShadowDigests = 100
+)
+
+// Shadow mirrors the sampled statements to the shadow backend in background workers, the number of
+// workers equals to the pool size of the shadow backend. The statements are dropped if the queue is full,
+// so that the client is never blocked by a slow shadow backend.
+type Shadow struct {
+	ns         string
+	backend    Backend
+	sampleRate float64
+	allowWrite bool
+	compare    bool
+	timeout    time.Duration
+
+	// digests are the first maxShadowDigests digests mirrored, which are labeled in the metrics.
+	digests     map[string]struct{}
+	digestsLock sync.Mutex
+
+	queries   chan *driver.ShadowQuery
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// BuildShadow returns nil if the shadow is not enabled.
+func BuildShadow(ns string, cfg *config.ShadowInfo) (*Shadow, error) {
+	if !cfg.Enable {
+		return nil, nil
+	}
+	if err := validation.ValidateShadow(cfg); err != nil {
+		return nil, err
+	}
+	be, err := BuildBackend(ns+shadowBackendSuffix, &cfg.Backend)
+	if err != nil {
+		return nil, errors.WithMessage(err, "build shadow backend error")
+	}
+
+	queueSize := cfg.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultShadowQueueSize
+	}
+	timeout := time.Duration(cfg.TimeoutMs) * time.Millisecond
+	if timeout == 0 {
+		timeout = defaultShadowTimeout
+	}
+	s := &Shadow{
+		ns:         ns,
+		backend:    be,
+		sampleRate: cfg.SampleRate,
+		allowWrite: cfg.AllowWrite,
+		compare:    cfg.CompareResult,
+		timeout:    timeout,
+		queries:    make(chan *driver.ShadowQuery, queueSize),
+		closeCh:    make(chan struct{}),
+	}
+
+	workers := cfg.Backend.PoolSize
+	if workers <= 0 {
+		workers = 1
+	}
+	s.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.run()
+	}
+	return s, nil
+}
+
+func (s *Shadow) Sample(isWrite bool) bool {
+	if isWrite && !s.allowWrite {
+		return false
+	}
+	return rand.Float64() < s.sampleRate
+}
+
+func (s *Shadow) CompareResult() bool {
+	return s.compare
+}
+
+func (s *Shadow) Mirror(q *driver.ShadowQuery) {
+	select {
+	case s.queries <- q:
+		metrics.ShadowQueueGauge.WithLabelValues(s.ns).Inc()
+	default:
+		metrics.ShadowDroppedCounter.WithLabelValues(s.ns).Inc()
+	}
+}
+
+// Close stops the workers after the in-flight statements are done, the queued statements are dropped.
+func (s *Shadow) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+		s.wg.Wait()
+		for dropped := false; !dropped; {
+			select {
+			case <-s.queries:
+				metrics.ShadowQueueGauge.WithLabelValues(s.ns).Dec()
+			default:
+				dropped = true
+			}
+		}
+		s.backend.Close()
+	})
+}
+
+func (s *Shadow) run() {
+	defer s.wg.Done()
+	for {
+		select {
+		case q := <-s.queries:
+			metrics.ShadowQueueGauge.WithLabelValues(s.ns).Dec()
+			s.mirror(q)
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+func (s *Shadow) mirror(q *driver.ShadowQuery) {
+	startTime := time.Now()
+	result, err := s.execute(q)
+	duration := time.Since(startTime)
+
+	digest := fmt.Sprintf("%08x", q.Digest)
+	label := s.digestLabel(digest)
+	metrics.ShadowQueryCounter.WithLabelValues(s.ns, label, metrics.RetLabel(err)).Inc()
+	metrics.ShadowQueryDurationHistogram.WithLabelValues(s.ns, label, metrics.ShadowTargetPrimary).Observe(q.Duration.Seconds())
+	metrics.ShadowQueryDurationHistogram.WithLabelValues(s.ns, label, metrics.ShadowTargetShadow).Observe(duration.Seconds())
+
+	if mismatch := s.compareResult(q, result, err); mismatch != "" {
+		metrics.ShadowMismatchCounter.WithLabelValues(s.ns, label, mismatch).Inc()
+		logutil.BgLogger().Warn("shadow result mismatch", zap.String("namespace", s.ns), zap.String("digest", digest),
+			zap.String("type", mismatch), zap.String("sql", q.SQL), zap.NamedError("primary_error", q.Err), zap.Error(err))
+	}
+}
+
+// digestLabel returns the metric label of the digest, so that the cardinality of the metrics is bounded
+// no matter how many digests are mirrored. The mismatch log always has the full digest.
+func (s *Shadow) digestLabel(digest string) string {
+	s.digestsLock.Lock()
+	defer s.digestsLock.Unlock()
+	if _, ok := s.digests[digest]; ok {
+		return digest
+	}
+	if len(s.digests) >= maxShadowDigests {
+		return metrics.ShadowDigestOther
+	}
+	if s.digests == nil {
+		s.digests = make(map[string]struct{})
+	}
+	s.digests[digest] = struct{}{}
+	return digest
+}
+
+// execute runs the statement in a pooled conn of the shadow backend, the conn is closed if it runs out of time.
+// The system variables of the session are set in the conn by the pool, the same as the primary backend.
+func (s *Shadow) execute(q *driver.ShadowQuery) (*gomysql.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if q.SessionVars != nil {
+		ctx = context.WithValue(ctx, constant.ContextKeySessionVariable, q.SessionVars)
+	}
+	conn, err := s.backend.GetPooledConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// finished is set by whichever of the timer and the statement finishes first, so that the conn closed
+	// by the timer is never put back, even if the statement returns before the timer is stopped.
+	var finished sync2.AtomicBool
+	timer := time.AfterFunc(s.timeout, func() {
+		if !finished.CompareAndSwap(false, true) {
+			return
+		}
+		if closer, ok := conn.(interface{ Close() error }); ok {
+			closer.Close()
+		}
+	})
+	result, err := s.query(conn, q)
+	timer.Stop()
+	if timedOut := !finished.CompareAndSwap(false, true); timedOut {
+		// the conn is closed already, ErrorClose only releases it from the pool.
+		conn.ErrorClose()
+		if err == nil {
+			err = context.DeadlineExceeded
+		}
+		return nil, err
+	}
+	if err != nil {
+		if errClose := conn.ErrorClose(); errClose != nil {
+			logutil.BgLogger().Warn("close shadow backend conn error", zap.String("namespace", s.ns), zap.Error(errClose))
+		}
+		return nil, err
+	}
+	conn.PutBack()
+	return result, nil
+}
+
+func (s *Shadow) query(conn driver.PooledBackendConn, q *driver.ShadowQuery) (*gomysql.Result, error) {
+	if err := conn.UseDB(q.DB); err != nil {
+		return nil, err
+	}
+	return conn.Execute(q.SQL)
+}
+
+// compareResult returns the mismatch type, or empty if the results are the same.
+func (s *Shadow) compareResult(q *driver.ShadowQuery, result *gomysql.Result, err error) string {
+	if (q.Err == nil) != (err == nil) {
+		return metrics.ShadowMismatchError
+	}
+	if !s.compare || err != nil {
+		return ""
+	}
+	if q.AffectedRows != result.AffectedRows {
+		return metrics.ShadowMismatchAffectedRows
+	}
+	var checksum driver.ResultChecksum
+	checksum.AddResult(result)
+	if q.Checksum.Rows != checksum.Rows {
+		return metrics.ShadowMismatchRows
+	}
+	if q.Checksum.Sum != checksum.Sum {
+		return metrics.ShadowMismatchChecksum
+	}
+	return ""
+}
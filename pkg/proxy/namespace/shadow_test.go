@@ -0,0 +1,167 @@
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/ast"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
+	"github.com/tidb-incubator/weir/pkg/proxy/driver"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+)
+
+func TestBuildShadowDisabled(t *testing.T) {
+	s, err := BuildShadow("test_ns", &config.ShadowInfo{SampleRate: 1})
+	require.NoError(t, err)
+	require.Nil(t, s)
+
+	_, err = BuildShadow("test_ns", &config.ShadowInfo{Enable: true, Backend: config.BackendNamespace{SelectorType: "random"}})
+	require.Error(t, err)
+}
+
+func TestShadowSample(t *testing.T) {
+	s := &Shadow{ns: "test_ns", sampleRate: 1}
+	require.True(t, s.Sample(false))
+	require.False(t, s.Sample(true))
+	s.allowWrite = true
+	require.True(t, s.Sample(true))
+	s.sampleRate = 0
+	require.False(t, s.Sample(false))
+}
+
+func TestShadowMirrorQueueFull(t *testing.T) {
+	s := &Shadow{ns: "test_ns", queries: make(chan *driver.ShadowQuery, 1)}
+	s.Mirror(&driver.ShadowQuery{SQL: "select 1"})
+	// the statement is dropped rather than blocking the caller
+	s.Mirror(&driver.ShadowQuery{SQL: "select 2"})
+	require.Len(t, s.queries, 1)
+	require.Equal(t, "select 1", (<-s.queries).SQL)
+}
+
+func TestShadowCompareResult(t *testing.T) {
+	rows := []gomysql.RowData{[]byte("\x011"), []byte("\x012")}
+	newResult := func(rows ...gomysql.RowData) *gomysql.Result {
+		return &gomysql.Result{Resultset: &gomysql.Resultset{RowDatas: rows}}
+	}
+	q := &driver.ShadowQuery{}
+	q.Checksum.AddResult(newResult(rows...))
+
+	s := &Shadow{ns: "test_ns"}
+	require.Empty(t, s.compareResult(q, newResult(), nil))
+	require.Equal(t, metrics.ShadowMismatchError, s.compareResult(q, nil, errors.New("shadow error")))
+
+	s.compare = true
+	// the order of rows does not matter
+	require.Empty(t, s.compareResult(q, newResult(rows[1], rows[0]), nil))
+	require.Equal(t, metrics.ShadowMismatchRows, s.compareResult(q, newResult(rows[0]), nil))
+	require.Equal(t, metrics.ShadowMismatchChecksum, s.compareResult(q, newResult(rows[0], []byte("\x013")), nil))
+	require.Equal(t, metrics.ShadowMismatchAffectedRows, s.compareResult(&driver.ShadowQuery{AffectedRows: 1}, &gomysql.Result{}, nil))
+
+	q = &driver.ShadowQuery{Err: errors.New("primary error")}
+	require.Equal(t, metrics.ShadowMismatchError, s.compareResult(q, newResult(), nil))
+	require.Empty(t, s.compareResult(q, nil, errors.New("shadow error")))
+}
+
+func TestShadowDigestLabel(t *testing.T) {
+	s := &Shadow{ns: "test_ns"}
+	for i := 0; i < maxShadowDigests; i++ {
+		digest := fmt.Sprintf("%08x", i)
+		require.Equal(t, digest, s.digestLabel(digest))
+	}
+	require.Equal(t, metrics.ShadowDigestOther, s.digestLabel("ffffffff"))
+	// the digests labeled already keep their labels.
+	require.Equal(t, "00000000", s.digestLabel("00000000"))
+}
+
+// slowShadowConn blocks the statement until it is closed.
+type slowShadowConn struct {
+	driver.PooledBackendConn
+	closeCh    chan struct{}
+	closeOnce  sync.Once
+	putBack    sync2.AtomicBool
+	errorClose sync2.AtomicBool
+}
+
+func (c *slowShadowConn) UseDB(string) error {
+	return nil
+}
+
+func (c *slowShadowConn) Execute(string, ...interface{}) (*gomysql.Result, error) {
+	<-c.closeCh
+	return &gomysql.Result{}, nil
+}
+
+func (c *slowShadowConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closeCh) })
+	return nil
+}
+
+func (c *slowShadowConn) PutBack() {
+	c.putBack.Set(true)
+}
+
+func (c *slowShadowConn) ErrorClose() error {
+	c.errorClose.Set(true)
+	return c.Close()
+}
+
+type slowShadowBackend struct {
+	Backend
+	conn *slowShadowConn
+}
+
+func (b *slowShadowBackend) GetPooledConn(context.Context) (driver.PooledBackendConn, error) {
+	return b.conn, nil
+}
+
+func TestShadowExecuteTimeout(t *testing.T) {
+	conn := &slowShadowConn{closeCh: make(chan struct{})}
+	s := &Shadow{ns: "test_ns", backend: &slowShadowBackend{conn: conn}, timeout: 10 * time.Millisecond}
+	// the statement returns successfully after the conn is closed by the timer, but the conn is not put back.
+	_, err := s.execute(&driver.ShadowQuery{SQL: "select 1"})
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, conn.errorClose.Get())
+	require.False(t, conn.putBack.Get())
+}
+
+type fastShadowConn struct {
+	driver.PooledBackendConn
+}
+
+func (c *fastShadowConn) UseDB(string) error {
+	return nil
+}
+
+func (c *fastShadowConn) Execute(string, ...interface{}) (*gomysql.Result, error) {
+	return &gomysql.Result{}, nil
+}
+
+func (c *fastShadowConn) PutBack() {}
+
+// sysVarsShadowBackend records the system variables to set in the conn.
+type sysVarsShadowBackend struct {
+	Backend
+	sysVars interface{}
+}
+
+func (b *sysVarsShadowBackend) GetPooledConn(ctx context.Context) (driver.PooledBackendConn, error) {
+	b.sysVars = ctx.Value(constant.ContextKeySessionVariable)
+	return &fastShadowConn{}, nil
+}
+
+func TestShadowExecuteWithSessionVars(t *testing.T) {
+	be := &sysVarsShadowBackend{}
+	s := &Shadow{ns: "test_ns", backend: be, timeout: time.Second}
+	sysVars := map[string]*ast.VariableAssignment{"sql_mode": {Name: "sql_mode", IsSystem: true}}
+	_, err := s.execute(&driver.ShadowQuery{SQL: "select 1", SessionVars: sysVars})
+	require.NoError(t, err)
+	require.Equal(t, sysVars, be.sysVars)
+}
@@ -5,57 +5,77 @@ import (
 
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/pingcap/errors"
+	"github.com/tidb-incubator/weir/pkg/validation"
 )
 
+// UserNamespaceMapper maps a username to the namespaces owning it.
+// A username can be owned by several namespaces bound to listeners, it can only connect to the listeners bound to them.
 type UserNamespaceMapper struct {
-	userToNamespace map[string]string
+	userToNamespace map[string][]string
+	boundNamespaces map[string]struct{}
 }
 
-func CreateUserNamespaceMapper(namespaces []*config.Namespace) (*UserNamespaceMapper, error) {
-	mapper := make(map[string]string)
+func CreateUserNamespaceMapper(namespaces []*config.Namespace, boundNamespaces map[string]struct{}) (*UserNamespaceMapper, error) {
+	if err := validation.CheckDuplicatedUsers(namespaces, boundNamespaces); err != nil {
+		return nil, err
+	}
+
+	mapper := make(map[string][]string)
 	for _, ns := range namespaces {
-		frontendNamespace := ns.Frontend
-		for _, user := range frontendNamespace.Users {
-			originNamespace, ok := mapper[user.Username]
-			if ok {
-				return nil, errors.WithMessage(ErrDuplicatedUser,
-					fmt.Sprintf("user: %s, namespace: %s, %s", user.Username, originNamespace, ns.Namespace))
-			}
-			mapper[user.Username] = ns.Namespace
+		for _, user := range ns.Frontend.Users {
+			mapper[user.Username] = append(mapper[user.Username], ns.Namespace)
 		}
 	}
 
-	ret := &UserNamespaceMapper{userToNamespace: mapper}
+	ret := &UserNamespaceMapper{userToNamespace: mapper, boundNamespaces: boundNamespaces}
 	return ret, nil
 }
 
+// GetUserNamespace returns the namespace of the username, it fails if the username is owned by several namespaces.
 func (u *UserNamespaceMapper) GetUserNamespace(username string) (string, bool) {
-	ns, ok := u.userToNamespace[username]
-	return ns, ok
+	nss := u.userToNamespace[username]
+	if len(nss) != 1 {
+		return "", false
+	}
+	return nss[0], true
 }
 
 func (u *UserNamespaceMapper) Clone() *UserNamespaceMapper {
-	ret := make(map[string]string)
+	ret := make(map[string][]string)
 	for k, v := range u.userToNamespace {
-		ret[k] = v
+		ret[k] = append([]string(nil), v...)
 	}
-	return &UserNamespaceMapper{userToNamespace: ret}
+	return &UserNamespaceMapper{userToNamespace: ret, boundNamespaces: u.boundNamespaces}
 }
 
 func (u *UserNamespaceMapper) RemoveNamespaceUsers(ns string) {
-	for k, namespace := range u.userToNamespace {
-		if ns == namespace {
+	for k, namespaces := range u.userToNamespace {
+		remained := namespaces[:0]
+		for _, namespace := range namespaces {
+			if namespace != ns {
+				remained = append(remained, namespace)
+			}
+		}
+		if len(remained) == 0 {
 			delete(u.userToNamespace, k)
+		} else {
+			u.userToNamespace[k] = remained
 		}
 	}
 }
 
 func (u *UserNamespaceMapper) AddNamespaceUsers(ns string, cfg *config.FrontendNamespace) error {
 	for _, userInfo := range cfg.Users {
-		if originNamespace, ok := u.userToNamespace[userInfo.Username]; ok {
-			return errors.WithMessage(ErrDuplicatedUser, fmt.Sprintf("namespace: %s", originNamespace))
+		for _, namespace := range u.userToNamespace[userInfo.Username] {
+			if namespace == ns {
+				return errors.WithMessage(ErrDuplicatedUser, fmt.Sprintf("namespace: %s", ns))
+			}
+		}
+		namespaces := append(u.userToNamespace[userInfo.Username], ns)
+		if err := validation.CheckSharedUser(userInfo.Username, namespaces, u.boundNamespaces); err != nil {
+			return err
 		}
-		u.userToNamespace[userInfo.Username] = ns
+		u.userToNamespace[userInfo.Username] = namespaces
 	}
 	return nil
 }
@@ -1,22 +1,39 @@
 package proxy
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
 	"github.com/tidb-incubator/weir/pkg/config"
 	"github.com/tidb-incubator/weir/pkg/configcenter"
 	"github.com/tidb-incubator/weir/pkg/proxy/driver"
 	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
 	"github.com/tidb-incubator/weir/pkg/proxy/namespace"
 	"github.com/tidb-incubator/weir/pkg/proxy/server"
+	"github.com/tidb-incubator/weir/pkg/util/upgrade"
+	"go.uber.org/zap"
 )
 
+// upgradeReadyTimeout is the max time to wait for the new process to serve on upgrade.
+const upgradeReadyTimeout = 30 * time.Second
+
+var errUpgradeInProgress = errors.New("upgrade is in progress")
+
 type Proxy struct {
 	cfg          *config.Proxy
 	svr          *server.Server
 	apiServer    *HttpApiServer
 	nsmgr        *namespace.NamespaceManager
 	configCenter configcenter.ConfigCenter
+
+	registryLock sync.Mutex
+	registered   *config.ProxyMonitorMetric
+
+	upgrading  int32
+	upgradedCh chan struct{}
 }
 
 func supplementProxyConfig(cfg *config.Proxy) *config.Proxy {
@@ -31,7 +48,8 @@ func supplementProxyConfig(cfg *config.Proxy) *config.Proxy {
 
 func NewProxy(cfg *config.Proxy) *Proxy {
 	return &Proxy{
-		cfg: supplementProxyConfig(cfg),
+		cfg:        supplementProxyConfig(cfg),
+		upgradedCh: make(chan struct{}),
 	}
 }
 
@@ -47,7 +65,8 @@ func (p *Proxy) Init() error {
 	if err != nil {
 		return err
 	}
-	nsmgr, err := namespace.CreateNamespaceManager(nss, namespace.BuildNamespace, namespace.DefaultAsyncCloseNamespace)
+	nsCloser := namespace.CreateAsyncNamespaceCloser(time.Duration(p.cfg.ProxyServer.NamespaceCloseTimeout) * time.Second)
+	nsmgr, err := namespace.CreateNamespaceManager(nss, p.cfg.ProxyServer.GetBoundNamespaces(), namespace.BuildNamespace, nsCloser)
 	if err != nil {
 		return err
 	}
@@ -62,6 +81,7 @@ func (p *Proxy) Init() error {
 	if err != nil {
 		return err
 	}
+	apiServer.upgrade = p.Upgrade
 	p.apiServer = apiServer
 
 	return nil
@@ -73,14 +93,76 @@ func (p *Proxy) Run() error {
 		time.Sleep(200 * time.Millisecond)
 		p.apiServer.Run()
 	}()
+	// the new process registers before the old process of upgrade deregisters.
+	if err := p.register(); err != nil {
+		p.Close()
+		return err
+	}
+	if err := upgrade.Ready(); err != nil {
+		logutil.BgLogger().Warn("notify old process of upgrade failed", zap.Error(err))
+	}
 	return p.svr.Run()
 }
 
+// Upgrade execs the new binary with the listeners, and stops accepting when the new process is serving.
+// The existing sessions are still served, the caller should wait on Upgraded and then Close.
+func (p *Proxy) Upgrade() error {
+	if !atomic.CompareAndSwapInt32(&p.upgrading, 0, 1) {
+		return errUpgradeInProgress
+	}
+	if err := p.startNewProcess(); err != nil {
+		atomic.StoreInt32(&p.upgrading, 0)
+		return err
+	}
+
+	p.svr.HandoffListeners()
+	p.apiServer.Close()
+	p.deregister()
+	close(p.upgradedCh)
+	return nil
+}
+
+func (p *Proxy) startNewProcess() error {
+	files, err := p.svr.ListenerFiles()
+	if err != nil {
+		return err
+	}
+	adminFile, err := p.apiServer.listenerFile()
+	if err != nil {
+		for _, f := range files {
+			f.File.Close()
+		}
+		return err
+	}
+	files = append(files, adminFile)
+	defer func() {
+		for _, f := range files {
+			f.File.Close()
+		}
+	}()
+
+	pid, err := upgrade.Start(files, upgradeReadyTimeout)
+	if err != nil {
+		return err
+	}
+	logutil.BgLogger().Info("new process is serving, stop accepting", zap.Int("pid", pid))
+	return nil
+}
+
+// Upgraded is closed when the new process takes over the listeners.
+func (p *Proxy) Upgraded() <-chan struct{} {
+	return p.upgradedCh
+}
+
+// Close deregisters the proxy first so that cc does not send requests to it any more, then stops accepting
+// and waits for the sessions to finish their transactions, the sessions left are killed after timeout.
 func (p *Proxy) Close() {
+	p.deregister()
 	if p.apiServer != nil {
 		p.apiServer.Close()
 	}
 	if p.svr != nil {
 		p.svr.Close()
+		p.svr.TryGracefulDown()
 	}
 }
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"go.uber.org/zap"
+)
+
+// register adds the proxy to the registry in config center, so that cc can find it.
+func (p *Proxy) register() error {
+	if !p.cfg.Registry.Enable {
+		return nil
+	}
+	info, err := newProxyMonitorMetric(p.cfg)
+	if err != nil {
+		return err
+	}
+	if err := p.configCenter.RegisterProxy(p.cfg.Cluster, info); err != nil {
+		return errors.Annotate(err, "register proxy")
+	}
+	logutil.BgLogger().Info("register proxy", zap.String("token", info.Token), zap.Int("pid", info.Pid))
+
+	p.registryLock.Lock()
+	p.registered = info
+	p.registryLock.Unlock()
+	return nil
+}
+
+// deregister removes the proxy from the registry, it is a no-op if the proxy is not registered.
+func (p *Proxy) deregister() {
+	p.registryLock.Lock()
+	info := p.registered
+	p.registered = nil
+	p.registryLock.Unlock()
+	if info == nil {
+		return
+	}
+	if err := p.configCenter.DeregisterProxy(p.cfg.Cluster, info); err != nil {
+		logutil.BgLogger().Warn("deregister proxy failed", zap.String("token", info.Token), zap.Error(err))
+		return
+	}
+	logutil.BgLogger().Info("deregister proxy", zap.String("token", info.Token), zap.Int("pid", info.Pid))
+}
+
+func newProxyMonitorMetric(cfg *config.Proxy) (*config.ProxyMonitorMetric, error) {
+	ip, adminPort, err := net.SplitHostPort(cfg.AdminServer.Addr)
+	if err != nil {
+		return nil, errors.Annotate(err, "parse admin server addr")
+	}
+	if ip == "" || net.ParseIP(ip).IsUnspecified() {
+		if ip, err = getLocalIP(); err != nil {
+			return nil, err
+		}
+	}
+	// the first tcp listener is registered, the port is empty if there are only unix socket listeners.
+	proxyAddr := cfg.ProxyServer.Addr
+	if len(cfg.ProxyServer.Listeners) > 0 {
+		proxyAddr = ""
+		for _, l := range cfg.ProxyServer.Listeners {
+			if l.Network == "" || l.Network == "tcp" {
+				proxyAddr = l.Addr
+				break
+			}
+		}
+	}
+	var proxyPort string
+	if _, port, err := net.SplitHostPort(proxyAddr); err == nil {
+		proxyPort = port
+	}
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &config.ProxyMonitorMetric{
+		Token:     net.JoinHostPort(ip, adminPort),
+		StartTime: time.Now().Format("2006-01-02 15:04:05"),
+		IP:        ip,
+		AdminPort: adminPort,
+		ProxyPort: proxyPort,
+		Pid:       os.Getpid(),
+		Pwd:       pwd,
+		Sys:       runtime.GOOS,
+	}, nil
+}
+
+// getLocalIP returns the first non-loopback ipv4 address, which is registered if admin server listens on all addresses.
+func getLocalIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+	return "", errors.New("no local ip to register")
+}
@@ -24,12 +24,21 @@ const defaultReaderSize = 16 * 1024
 type bufferedReadConn struct {
 	net.Conn
 	rb *bufio.Reader
+	// remoteAddr is the client address carried by the PROXY protocol header if it is not nil.
+	remoteAddr net.Addr
 }
 
 func (conn bufferedReadConn) Read(b []byte) (n int, err error) {
 	return conn.rb.Read(b)
 }
 
+func (conn bufferedReadConn) RemoteAddr() net.Addr {
+	if conn.remoteAddr != nil {
+		return conn.remoteAddr
+	}
+	return conn.Conn.RemoteAddr()
+}
+
 func newBufferedReadConn(conn net.Conn) *bufferedReadConn {
 	return &bufferedReadConn{
 		Conn: conn,
@@ -80,6 +80,7 @@ type clientConn struct {
 	bufReadConn  *bufferedReadConn // a buffered-read net.Conn or buffered-read tls.Conn.
 	tlsConn      *tls.Conn         // TLS connection, nil if not TLS.
 	server       *Server           // a reference of server instance.
+	listener     *listener         // the listener accepting the connection.
 	capability   uint32            // client capability affects the way server handles client request.
 	connectionID uint32            // atomically allocated by a global variable, unique in process scope.
 	user         string            // user of the client.
@@ -94,6 +95,12 @@ type clientConn struct {
 	status       int32             // dispatching/reading/shutdown/waitshutdown
 	lastCode     uint16            // last error code
 	collation    uint8             // collation used by client, may be different from the collation used by database.
+	zstdLevel    int               // zstd compression level sent by client, only used with zstd compression.
+	lastStmtID   uint32            // the stmt id of last COM_STMT_PREPARE, used by capture.
+	listenerConn int32             // 1 if a connection of the listener is acquired, it is released on close.
+	// cancel cancels the context of the running command when the connection is closed or killed,
+	// so that the command waiting in the proxy, e.g. for a concurrency slot, stops at once.
+	cancel context.CancelFunc
 }
 
 // newClientConn creates a *clientConn object.
@@ -159,10 +166,21 @@ func (cc *clientConn) Run(ctx context.Context) {
 		}
 
 		if !atomic.CompareAndSwapInt32(&cc.status, connStatusReading, connStatusDispatching) {
+			// the idle session notified by graceful shutdown can retry the command on another proxy.
+			if atomic.LoadInt32(&cc.status) == connStatusWaitShutdown && data[0] != mysql.ComQuit {
+				terror.Log(cc.writeError(errServerShutdown))
+			}
+			return
+		}
+
+		// the client can retry the command on another proxy, the transaction is not interrupted.
+		if cc.server.isShuttingDown() && !cc.ctx.InTransaction() && data[0] != mysql.ComQuit {
+			terror.Log(cc.writeError(errServerShutdown))
 			return
 		}
 
 		startTime := time.Now()
+		captured := cc.beginCapture()
 		if err = cc.dispatch(ctx, data); err != nil {
 			if terror.ErrorEqual(err, io.EOF) {
 				cc.addMetrics(data[0], startTime, nil)
@@ -203,7 +221,13 @@ func (cc *clientConn) Run(ctx context.Context) {
 			}
 		}
 		cc.addMetrics(data[0], startTime, err)
-		cc.pkt.sequence = 0
+		cc.endCapture(captured, data, startTime, err)
+		cc.pkt.resetSequence()
+
+		// the transaction ends, close the session.
+		if cc.server.isShuttingDown() && !cc.ctx.InTransaction() {
+			return
+		}
 	}
 }
 
@@ -267,7 +291,7 @@ func (cc *clientConn) setWaitTimeout(ctx context.Context) {
 
 func (cc *clientConn) Close() error {
 	cc.server.rwlock.Lock()
-	delete(cc.server.clients, cc.connectionID)
+	cc.server.removeClientWithoutLock(cc)
 	connections := len(cc.server.clients)
 	cc.server.rwlock.Unlock()
 	return closeConn(cc, connections)
@@ -275,8 +299,13 @@ func (cc *clientConn) Close() error {
 
 func closeConn(cc *clientConn, connections int) error {
 	metrics.ConnGauge.WithLabelValues().Set(float64(connections))
+	if cc.cancel != nil {
+		cc.cancel()
+	}
 	err := cc.bufReadConn.Close()
 	terror.Log(err)
+	cc.releaseListenerConn()
+	cc.captureClose()
 	if cc.ctx != nil {
 		return cc.ctx.Close()
 	}
@@ -284,24 +313,35 @@ func closeConn(cc *clientConn, connections int) error {
 }
 
 func (cc *clientConn) closeWithoutLock() error {
-	delete(cc.server.clients, cc.connectionID)
+	cc.server.removeClientWithoutLock(cc)
 	return closeConn(cc, len(cc.server.clients))
 }
 
-// ShutdownOrNotify will Shutdown this client connection, or do its best to notify.
+// acquireListenerConn reserves a connection of the listener, which is released when the conn is closed.
+func (cc *clientConn) acquireListenerConn() error {
+	if err := cc.listener.acquireConn(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&cc.listenerConn, 1)
+	return nil
+}
+
+func (cc *clientConn) releaseListenerConn() {
+	if atomic.CompareAndSwapInt32(&cc.listenerConn, 1, 0) {
+		cc.listener.releaseConn()
+	}
+}
+
+// ShutdownOrNotify notifies this client connection to close if it is idle and out of transaction,
+// it gets a retryable error on the next command and then exits. Other connections find the server is
+// shutting down after the current command, and exit when the transaction ends, so that the running
+// command and transaction are not interrupted.
 func (cc *clientConn) ShutdownOrNotify() bool {
-	if (cc.ctx.Status() & mysql.ServerStatusInTrans) > 0 {
+	if cc.ctx.InTransaction() {
 		return false
 	}
-	// If the client connection status is reading, it's safe to shutdown it.
-	if atomic.CompareAndSwapInt32(&cc.status, connStatusReading, connStatusShutdown) {
-		return true
-	}
-	// If the client connection status is dispatching, we can't shutdown it immediately,
-	// so set the status to WaitShutdown as a notification, the client will detect it
-	// and then exit.
-	atomic.StoreInt32(&cc.status, connStatusWaitShutdown)
-	return false
+	// If the client connection status is reading, it's safe to notify it.
+	return atomic.CompareAndSwapInt32(&cc.status, connStatusReading, connStatusWaitShutdown)
 }
 
 func (cc *clientConn) String() string {
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"time"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/tidb-incubator/weir/pkg/capture"
+)
+
+// pendingCapture is the session state before a command, which is recorded if the conn is new to the capture.
+type pendingCapture struct {
+	capture *capture.Capture
+	session capture.Session
+}
+
+// beginCapture returns nil if the namespace of the conn is not captured.
+func (cc *clientConn) beginCapture() *pendingCapture {
+	c := cc.server.captures.Get(cc.ctx.Namespace())
+	if c == nil {
+		return nil
+	}
+	return &pendingCapture{
+		capture: c,
+		session: capture.Session{
+			User:      cc.user,
+			DB:        cc.ctx.CurrentDB(),
+			Collation: cc.collation,
+			InTxn:     cc.ctx.InTransaction(),
+		},
+	}
+}
+
+// endCapture records the commands which affect the replay, the error code is set when the error is written.
+func (cc *clientConn) endCapture(p *pendingCapture, data []byte, startTime time.Time, err error) {
+	if p == nil {
+		return
+	}
+	cmd := &capture.Command{
+		Data:      data,
+		StartTime: startTime,
+		Duration:  time.Since(startTime),
+	}
+	switch data[0] {
+	case mysql.ComQuery, mysql.ComInitDB, mysql.ComStmtExecute, mysql.ComStmtClose, mysql.ComResetConnection:
+	case mysql.ComStmtPrepare:
+		if err == nil {
+			cmd.StmtID = cc.lastStmtID
+		}
+	default:
+		return
+	}
+	if err != nil {
+		cmd.ErrCode = cc.lastCode
+	}
+	p.capture.RecordCommand(cc.connectionID, &p.session, cmd)
+}
+
+func (cc *clientConn) captureClose() {
+	if cc.ctx == nil {
+		return
+	}
+	if c := cc.server.captures.Get(cc.ctx.Namespace()); c != nil {
+		c.RecordClose(cc.connectionID)
+	}
+}
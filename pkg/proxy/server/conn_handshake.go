@@ -19,7 +19,6 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"io"
-	"sync/atomic"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/auth"
@@ -27,6 +26,7 @@ import (
 	"github.com/pingcap/parser/terror"
 	"github.com/pingcap/tidb/config"
 	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
 	"go.uber.org/zap"
 )
 
@@ -68,6 +68,16 @@ func (cc *clientConn) handshake(ctx context.Context) error {
 		logutil.Logger(ctx).Debug("flush response to client failed", zap.Error(err))
 		return err
 	}
+	// the compressed protocol starts after the OK packet of the handshake.
+	// zlib is preferred if the client supports both, the same as MySQL.
+	if cc.capability&mysql.ClientCompress > 0 {
+		cc.pkt.enableCompression()
+	} else if cc.capability&compress.ClientZstdCompressionAlgorithm > 0 {
+		if err = cc.pkt.enableZstdCompression(cc.zstdLevel); err != nil {
+			logutil.Logger(ctx).Warn("enable zstd compression failed", zap.Error(err))
+			return err
+		}
+	}
 	return err
 }
 
@@ -108,10 +118,9 @@ func (cc *clientConn) readOptionalSSLRequestAndHandshakeResponse(ctx context.Con
 	}
 
 	if resp.Capability&mysql.ClientSSL > 0 {
-		tlsConfig := (*tls.Config)(atomic.LoadPointer(&cc.server.tlsConfig))
-		if tlsConfig != nil {
+		if cc.listener.tlsConfig != nil {
 			// The packet is a SSLRequest, let's switch to TLS.
-			if err = cc.upgradeToTLS(tlsConfig); err != nil {
+			if err = cc.upgradeToTLS(cc.listener.tlsConfig); err != nil {
 				return err
 			}
 			// Read the following HandshakeResponse packet.
@@ -147,11 +156,12 @@ func (cc *clientConn) readOptionalSSLRequestAndHandshakeResponse(ctx context.Con
 		return err
 	}
 
-	cc.capability = resp.Capability & cc.server.capability
+	cc.capability = resp.Capability & cc.listener.capability
 	cc.user = resp.User
 	cc.dbname = resp.DBName
 	cc.collation = resp.Collation
 	cc.attrs = resp.Attrs
+	cc.zstdLevel = resp.ZstdLevel
 
 	err = cc.openSessionAndDoAuth(resp.Auth)
 	if err != nil {
@@ -177,7 +187,7 @@ func (cc *clientConn) writeInitialHandshake() error {
 	// filler [00]
 	data = append(data, 0)
 	// capability flag lower 2 bytes, using default capability here
-	data = append(data, byte(cc.server.capability), byte(cc.server.capability>>8))
+	data = append(data, byte(cc.listener.capability), byte(cc.listener.capability>>8))
 	// charset
 	if cc.collation == 0 {
 		cc.collation = uint8(mysql.DefaultCollationID)
@@ -187,7 +197,7 @@ func (cc *clientConn) writeInitialHandshake() error {
 	data = dumpUint16(data, mysql.ServerStatusAutocommit)
 	// below 13 byte may not be used
 	// capability flag upper 2 bytes, using default capability here
-	data = append(data, byte(cc.server.capability>>16), byte(cc.server.capability>>24))
+	data = append(data, byte(cc.listener.capability>>16), byte(cc.listener.capability>>24))
 	// length of auth-plugin-data
 	data = append(data, byte(len(cc.salt)+1))
 	// reserved 10 [00]
@@ -286,15 +296,21 @@ func parseHandshakeResponseBody(ctx context.Context, packet *handshakeResponse41
 		if num, null, off := parseLengthEncodedInt(data[offset:]); !null {
 			offset += off
 			row := data[offset : offset+int(num)]
+			offset += int(num)
 			attrs, err := parseAttrs(row)
 			if err != nil {
 				logutil.Logger(ctx).Warn("parse attrs failed", zap.Error(err))
-				return nil
+			} else {
+				packet.Attrs = attrs
 			}
-			packet.Attrs = attrs
 		}
 	}
 
+	if packet.Capability&compress.ClientZstdCompressionAlgorithm > 0 && len(data[offset:]) > 0 {
+		// the default level is used if the level is missing.
+		packet.ZstdLevel = int(data[offset])
+	}
+
 	return nil
 }
 
@@ -371,7 +387,7 @@ func (cc *clientConn) openSessionAndDoAuth(authData []byte) error {
 		tlsStatePtr = &tlsState
 	}
 	var err error
-	cc.ctx, err = cc.server.driver.OpenCtx(uint64(cc.connectionID), cc.capability, cc.collation, cc.dbname, tlsStatePtr)
+	cc.ctx, err = cc.server.driver.OpenCtx(uint64(cc.connectionID), cc.capability, cc.collation, cc.dbname, tlsStatePtr, cc.listener.cfg.Namespace)
 	if err != nil {
 		return err
 	}
@@ -379,6 +395,9 @@ func (cc *clientConn) openSessionAndDoAuth(authData []byte) error {
 	if err = cc.server.checkConnectionCount(); err != nil {
 		return err
 	}
+	if err = cc.acquireListenerConn(); err != nil {
+		return err
+	}
 	hasPassword := "YES"
 	if len(authData) == 0 {
 		hasPassword = "NO"
@@ -391,6 +410,10 @@ func (cc *clientConn) openSessionAndDoAuth(authData []byte) error {
 	if !cc.ctx.Auth(&auth.UserIdentity{Username: cc.user, Hostname: host}, authData, cc.salt) {
 		return errAccessDenied.FastGenByArgs(cc.user, host, hasPassword)
 	}
+	// the namespace and user limits are known after auth
+	if err = cc.ctx.AcquireConn(context.Background()); err != nil {
+		return err
+	}
 	if cc.dbname != "" {
 		err = cc.useDB(context.Background(), cc.dbname)
 		if err != nil {
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
+)
+
+func TestParseHandshakeResponseZstdLevel(t *testing.T) {
+	capability := mysql.ClientProtocol41 | mysql.ClientSecureConnection | mysql.ClientPluginAuth |
+		mysql.ClientConnectAtts | compress.ClientZstdCompressionAlgorithm
+	data := make([]byte, 4+4+1+23)
+	binary.LittleEndian.PutUint32(data, capability)
+	data = append(data, "root\x00"...)
+	// empty auth
+	data = append(data, 0)
+	data = append(data, "mysql_native_password\x00"...)
+	attrs := "\x03key\x05value"
+	data = append(data, byte(len(attrs)))
+	data = append(data, attrs...)
+	data = append(data, 7)
+
+	var resp handshakeResponse41
+	pos, err := parseHandshakeResponseHeader(context.Background(), &resp, data)
+	require.NoError(t, err)
+	require.NoError(t, parseHandshakeResponseBody(context.Background(), &resp, data, pos))
+	require.Equal(t, "root", resp.User)
+	require.Equal(t, map[string]string{"key": "value"}, resp.Attrs)
+	require.Equal(t, 7, resp.ZstdLevel)
+
+	// the level is missing.
+	resp = handshakeResponse41{}
+	data = data[:len(data)-1]
+	require.NoError(t, parseHandshakeResponseBody(context.Background(), &resp, data, pos))
+	require.Equal(t, 0, resp.ZstdLevel)
+}
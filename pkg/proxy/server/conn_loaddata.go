@@ -0,0 +1,15 @@
+package server
+
+// localFileReader reads the file of LOAD DATA LOCAL INFILE from the client,
+// the file is requested by the backend and relayed packet by packet.
+type localFileReader struct {
+	cc *clientConn
+}
+
+func (r *localFileReader) RequestFile(filename string) error {
+	return r.cc.writeReq(filename)
+}
+
+func (r *localFileReader) ReadFilePacket() ([]byte, error) {
+	return r.cc.readPacket()
+}
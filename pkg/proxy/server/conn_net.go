@@ -38,6 +38,7 @@ type handshakeResponse41 struct {
 	DBName     string
 	Auth       []byte
 	Attrs      map[string]string
+	ZstdLevel  int
 }
 
 func (cc *clientConn) readPacket() ([]byte, error) {
@@ -109,6 +110,8 @@ func (cc *clientConn) writeError(e error) error {
 		switch y := e.(type) {
 		case *terror.Error:
 			m = y.ToSQLError()
+		case *mysql.SQLError:
+			m = y
 		default:
 			m = mysql.NewErrf(mysql.ErrUnknown, "%s", e.Error())
 		}
@@ -270,6 +273,21 @@ func (cc *clientConn) doWriteGoMySQLResultset(ctx context.Context, rs *gomysql.R
 	return cc.writeEOF(serverStatus)
 }
 
+// finishResultStream waits for the rows streamed by w, then ends the resultset with an EOF packet,
+// or returns execErr so that an error packet is written if the backend fails in the middle of the resultset.
+func (cc *clientConn) finishResultStream(w *resultStreamWriter, execErr error, serverStatus uint16) error {
+	if err := w.close(); err != nil {
+		return err
+	}
+	if execErr != nil {
+		return execErr
+	}
+	if err := cc.writeEOF(serverStatus); err != nil {
+		return err
+	}
+	return cc.flush()
+}
+
 func convertFieldsToColumnInfos(fields []*gomysql.Field) []*ColumnInfo {
 	var rets []*ColumnInfo
 	for _, f := range fields {
@@ -451,7 +469,7 @@ func (cc *clientConn) PeerHost(hasPassword string) (host string, err error) {
 		return cc.peerHost, nil
 	}
 	host = variable.DefHostname
-	if cc.server.isUnixSocket() {
+	if cc.listener.isUnixSocket() {
 		cc.peerHost = host
 		return
 	}
@@ -27,6 +27,7 @@ import (
 	"github.com/pingcap/tidb/metrics"
 	"github.com/pingcap/tidb/sessionctx/variable"
 	"github.com/pingcap/tidb/util/hack"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
 )
 
 // dispatch handles client request based on command which is the first byte of the data.
@@ -72,7 +73,7 @@ func (cc *clientConn) dispatch(ctx context.Context, data []byte) error {
 	dataStr := string(hack.String(data))
 	switch cmd {
 	case mysql.ComPing, mysql.ComStmtClose, mysql.ComStmtSendLongData, mysql.ComStmtReset,
-		mysql.ComSetOption, mysql.ComChangeUser:
+		mysql.ComSetOption, mysql.ComChangeUser, mysql.ComResetConnection:
 		cc.ctx.SetProcessInfo("", t, cmd, 0)
 	case mysql.ComInitDB:
 		cc.ctx.SetProcessInfo("use "+dataStr, t, cmd, 0)
@@ -121,11 +122,20 @@ func (cc *clientConn) dispatch(ctx context.Context, data []byte) error {
 		return mysql.NewErrf(mysql.ErrUnknown, "command %d not supported now", cmd)
 	case mysql.ComChangeUser:
 		return mysql.NewErrf(mysql.ErrUnknown, "command %d not supported now", cmd)
+	case mysql.ComResetConnection:
+		return cc.handleResetConnection(ctx)
 	default:
 		return mysql.NewErrf(mysql.ErrUnknown, "command %d not supported now", cmd)
 	}
 }
 
+func (cc *clientConn) handleResetConnection(ctx context.Context) error {
+	if err := cc.ctx.ResetSession(ctx); err != nil {
+		return err
+	}
+	return cc.writeOK()
+}
+
 // useDB only save db name in clientConn,
 // but run "use `db`" when execute query in backend.
 func (cc *clientConn) useDB(ctx context.Context, db string) (err error) {
@@ -144,12 +154,21 @@ func (cc *clientConn) useDB(ctx context.Context, db string) (err error) {
 // There is a special query `load data` that does not return result, which is handled differently.
 // Query `load stats` does not return result either.
 func (cc *clientConn) handleQuery(ctx context.Context, sql string) (err error) {
+	w := newResultStreamWriter(cc, cc.server.maxResultBufferSize)
+	ctx = context.WithValue(ctx, constant.ContextKeyResultWriter, w)
+	ctx = context.WithValue(ctx, constant.ContextKeyLocalFileReader, &localFileReader{cc: cc})
 	rss, err := cc.ctx.Execute(ctx, sql)
+	if w.started {
+		err = cc.finishResultStream(w, err, 0)
+	}
 
 	if err != nil {
 		metrics.ExecuteErrorCounter.WithLabelValues(metrics.ExecuteErrorToLabel(err)).Inc()
 		return err
 	}
+	if w.started {
+		return nil
+	}
 	status := atomic.LoadInt32(&cc.status)
 	if rss != nil && (status == connStatusShutdown || status == connStatusWaitShutdown) {
 		// TODO(eastfisher): close ResultSet
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/mysql"
+	"github.com/tidb-incubator/weir/pkg/proxy/constant"
 )
 
 // TODO(eastfisher): fix me when prepare is implemented
@@ -23,6 +24,7 @@ func (cc *clientConn) handleStmtPrepare(ctx context.Context, sql string) error {
 	if err != nil {
 		return err
 	}
+	cc.lastStmtID = uint32(stmtId)
 	data := make([]byte, 4, 128)
 
 	//status ok
@@ -81,7 +83,15 @@ func (cc *clientConn) handleStmtExecute(ctx context.Context, data []byte) error
 	}
 
 	stmtID := binary.LittleEndian.Uint32(data[0:4])
-	ret, err := cc.ctx.StmtExecuteForward(ctx, int(stmtID), data)
+	w := newResultStreamWriter(cc, cc.server.maxResultBufferSize)
+	ret, err := cc.ctx.StmtExecuteForward(context.WithValue(ctx, constant.ContextKeyResultWriter, w), int(stmtID), data)
+	if w.started {
+		var status uint16
+		if ret != nil {
+			status = ret.Status
+		}
+		return cc.finishResultStream(w, err, status)
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"sync"
+
+	gomysql "github.com/siddontang/go-mysql/mysql"
+)
+
+const defaultMaxResultBufferSize = 1024 * 1024
+
+// resultStreamWriter forwards the rows read from backend to the client in a background goroutine.
+// At most maxBufferSize bytes of rows are queued, WriteRow blocks when the queue is full,
+// so a slow client slows down reading from the backend instead of growing the memory of proxy.
+type resultStreamWriter struct {
+	cc            *clientConn
+	maxBufferSize int
+
+	started bool
+	done    chan struct{}
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	rows       [][]byte
+	bufferSize int
+	finished   bool
+	err        error
+}
+
+func newResultStreamWriter(cc *clientConn, maxBufferSize int) *resultStreamWriter {
+	if maxBufferSize <= 0 {
+		maxBufferSize = defaultMaxResultBufferSize
+	}
+	w := &resultStreamWriter{
+		cc:            cc,
+		maxBufferSize: maxBufferSize,
+		done:          make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// WriteColumns is called in the session goroutine before any row, so it writes to the client directly.
+func (w *resultStreamWriter) WriteColumns(fields []*gomysql.Field) error {
+	if err := w.cc.writeColumnInfo(convertFieldsToColumnInfos(fields), 0); err != nil {
+		return err
+	}
+	w.started = true
+	go w.run()
+	return nil
+}
+
+func (w *resultStreamWriter) WriteRow(data []byte) error {
+	// reserve the packet header, data is reused by the backend reader so it must be copied.
+	row := make([]byte, 4+len(data))
+	copy(row[4:], data)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for w.err == nil && w.bufferSize > 0 && w.bufferSize+len(row) > w.maxBufferSize {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	w.rows = append(w.rows, row)
+	w.bufferSize += len(row)
+	w.cond.Broadcast()
+	return nil
+}
+
+// close waits until the queued rows are written to the client and returns the write error if any.
+// The caller should write the EOF or error packet after close.
+func (w *resultStreamWriter) close() error {
+	if !w.started {
+		return nil
+	}
+
+	w.mu.Lock()
+	w.finished = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+
+	<-w.done
+	return w.err
+}
+
+func (w *resultStreamWriter) run() {
+	defer close(w.done)
+
+	for {
+		w.mu.Lock()
+		for len(w.rows) == 0 && !w.finished && w.err == nil {
+			w.cond.Wait()
+		}
+		rows := w.rows
+		w.rows = nil
+		w.mu.Unlock()
+
+		if len(rows) == 0 {
+			return
+		}
+
+		// the size of rows is released after they are written, so the rows being written are also counted.
+		size := 0
+		err := w.writeRows(rows)
+		for _, row := range rows {
+			size += len(row)
+		}
+
+		w.mu.Lock()
+		w.bufferSize -= size
+		w.err = err
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (w *resultStreamWriter) writeRows(rows [][]byte) error {
+	for _, row := range rows {
+		if err := w.cc.writePacket(row); err != nil {
+			return err
+		}
+	}
+	return w.cc.flush()
+}
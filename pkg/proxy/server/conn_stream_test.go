@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pingcap/tidb/util/arena"
+	gomysql "github.com/siddontang/go-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func newTestStreamClientConn(w interface{ Write([]byte) (int, error) }) *clientConn {
+	return &clientConn{
+		pkt:   &packetIO{bufWriter: bufio.NewWriterSize(w, 16)},
+		alloc: arena.NewAllocator(1024),
+	}
+}
+
+func TestResultStreamWriter(t *testing.T) {
+	var out bytes.Buffer
+	cc := newTestStreamClientConn(&out)
+	// the buffer is smaller than two rows, so the backend reader is blocked until the rows are written.
+	w := newResultStreamWriter(cc, 10)
+
+	require.NoError(t, w.WriteColumns([]*gomysql.Field{{Name: []byte("a")}}))
+	require.True(t, w.started)
+	require.NoError(t, cc.flush())
+	headerLen := out.Len()
+
+	row := []byte{0x01, 'x'}
+	for i := 0; i < 100; i++ {
+		row[1] = byte(i)
+		require.NoError(t, w.WriteRow(row))
+	}
+	require.NoError(t, w.close())
+	require.NoError(t, cc.flush())
+	require.Equal(t, 0, w.bufferSize)
+
+	rows := out.Bytes()[headerLen:]
+	require.Equal(t, 100*6, len(rows))
+	for i := 0; i < 100; i++ {
+		// header of a 2 bytes packet, sequence follows the column packets
+		pkt := rows[i*6 : (i+1)*6]
+		require.Equal(t, []byte{0x02, 0x00, 0x00}, pkt[:3])
+		require.Equal(t, []byte{0x01, byte(i)}, pkt[4:])
+	}
+}
+
+func TestResultStreamWriterNotStarted(t *testing.T) {
+	var out bytes.Buffer
+	w := newResultStreamWriter(newTestStreamClientConn(&out), 0)
+	require.Equal(t, defaultMaxResultBufferSize, w.maxBufferSize)
+	require.NoError(t, w.close())
+	require.Equal(t, 0, out.Len())
+}
+
+func TestResultStreamWriterClientError(t *testing.T) {
+	var out bytes.Buffer
+	cc := newTestStreamClientConn(&out)
+	w := newResultStreamWriter(cc, 10)
+	require.NoError(t, w.WriteColumns([]*gomysql.Field{{Name: []byte("a")}}))
+
+	cc.pkt.bufWriter = bufio.NewWriterSize(errWriter{}, 16)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = w.WriteRow([]byte{0x01, 'x'})
+	}
+	require.Error(t, err)
+	require.Error(t, w.close())
+}
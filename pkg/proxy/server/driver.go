@@ -29,8 +29,9 @@ import (
 
 // IDriver opens IContext.
 type IDriver interface {
-	// OpenCtx opens an IContext with connection id, client capability, collation, dbname and optionally the tls state.
-	OpenCtx(connID uint64, capability uint32, collation uint8, dbname string, tlsState *tls.ConnectionState) (QueryCtx, error)
+	// OpenCtx opens an IContext with connection id, client capability, collation, dbname, optionally the tls state
+	// and the namespace bound to the listener, the user is looked up in all namespaces if it is empty.
+	OpenCtx(connID uint64, capability uint32, collation uint8, dbname string, tlsState *tls.ConnectionState, namespace string) (QueryCtx, error)
 }
 
 // QueryCtx is the interface to execute command.
@@ -38,6 +39,9 @@ type QueryCtx interface {
 	// Status returns server status code.
 	Status() uint16
 
+	// InTransaction reports whether the session is in a transaction, it can be called by other goroutines.
+	InTransaction() bool
+
 	// LastInsertID returns last inserted ID.
 	LastInsertID() uint64
 
@@ -83,6 +87,9 @@ type QueryCtx interface {
 
 	StmtClose(ctx context.Context, stmtId int) error
 
+	// ResetSession clears the session state, such as transaction, user variables and prepared statements.
+	ResetSession(ctx context.Context) error
+
 	// FieldList returns columns of a table.
 	FieldList(tableName string) (columns []*ColumnInfo, err error)
 
@@ -92,6 +99,13 @@ type QueryCtx interface {
 	// Auth verifies user's authentication.
 	Auth(user *auth.UserIdentity, auth []byte, salt []byte) bool
 
+	// Namespace returns the namespace of the session, it is empty before auth.
+	Namespace() string
+
+	// AcquireConn checks the connection limits of the namespace and user after auth,
+	// it waits in a queue if the limits are reached and the queue is enabled.
+	AcquireConn(ctx context.Context) error
+
 	// ShowProcess shows the information about the session.
 	ShowProcess() *util.ProcessInfo
 
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser/mysql"
+	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/util/upgrade"
+	"go.uber.org/zap"
+)
+
+const (
+	networkTCP  = "tcp"
+	networkUnix = "unix"
+)
+
+// listener accepts the client conns on one address, the conns share its TLS config,
+// max connections and bound namespace.
+type listener struct {
+	cfg        config.Listener
+	ln         net.Listener
+	tlsConfig  *tls.Config
+	capability uint32
+	connCount  int32
+}
+
+// getListenerConfigs returns the listeners in config, or a tcp listener on ProxyServer.Addr if there is none.
+func getListenerConfigs(cfg *config.ProxyServer) []config.Listener {
+	if len(cfg.Listeners) == 0 {
+		return []config.Listener{{Network: networkTCP, Addr: cfg.Addr}}
+	}
+	cfgs := make([]config.Listener, 0, len(cfg.Listeners))
+	for _, lcfg := range cfg.Listeners {
+		if lcfg.Network == "" {
+			lcfg.Network = networkTCP
+		}
+		cfgs = append(cfgs, lcfg)
+	}
+	return cfgs
+}
+
+func newListener(cfg config.Listener, capability uint32) (*listener, error) {
+	l := &listener{cfg: cfg, capability: capability}
+
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, errors.Annotatef(err, "load tls cert of listener %s", cfg.Addr)
+		}
+		l.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		l.capability |= mysql.ClientSSL
+	}
+
+	switch cfg.Network {
+	case networkTCP, networkUnix:
+	default:
+		return nil, errors.Errorf("unknown network %s of listener %s", cfg.Network, cfg.Addr)
+	}
+
+	// the socket passed by the old process on upgrade is still in use, so it is inherited instead of listened again.
+	ln, err := upgrade.Inherit(cfg.Network, cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if ln == nil {
+		if cfg.Network == networkUnix {
+			if err := removeStaleSocket(cfg.Addr); err != nil {
+				return nil, err
+			}
+		}
+		if ln, err = net.Listen(cfg.Network, cfg.Addr); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	l.ln = ln
+	return l, nil
+}
+
+// removeStaleSocket removes the socket file left by a crashed process, a socket in use is kept.
+func removeStaleSocket(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if conn, err := net.DialTimeout(networkUnix, path, time.Second); err == nil {
+		conn.Close()
+		return errors.Errorf("unix socket %s is in use", path)
+	}
+	logutil.BgLogger().Warn("remove stale unix socket", zap.String("path", path))
+	return errors.Trace(os.Remove(path))
+}
+
+// file returns a duplicated file of the socket to be passed to the new process on upgrade.
+func (l *listener) file() (*os.File, error) {
+	switch ln := l.ln.(type) {
+	case *net.TCPListener:
+		return ln.File()
+	case *net.UnixListener:
+		return ln.File()
+	default:
+		return nil, errors.Errorf("listener %s can not be passed to new process", l.cfg.Addr)
+	}
+}
+
+func (l *listener) isUnixSocket() bool {
+	return l.cfg.Network == networkUnix
+}
+
+// acquireConn reserves a connection of the listener, the check and the increment are atomic
+// so that the concurrent handshakes can not exceed MaxConnections.
+func (l *listener) acquireConn() error {
+	for {
+		conns := atomic.LoadInt32(&l.connCount)
+		if l.cfg.MaxConnections > 0 && conns >= int32(l.cfg.MaxConnections) {
+			logutil.BgLogger().Error("too many connections of listener", zap.String("addr", l.cfg.Addr),
+				zap.Uint32("max connections", l.cfg.MaxConnections), zap.Error(errConCount))
+			return errConCount
+		}
+		if atomic.CompareAndSwapInt32(&l.connCount, conns, conns+1) {
+			return nil
+		}
+	}
+}
+
+func (l *listener) releaseConn() {
+	atomic.AddInt32(&l.connCount, -1)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func TestGetListenerConfigs(t *testing.T) {
+	cfgs := getListenerConfigs(&config.ProxyServer{Addr: "0.0.0.0:6000"})
+	require.Equal(t, []config.Listener{{Network: networkTCP, Addr: "0.0.0.0:6000"}}, cfgs)
+
+	cfgs = getListenerConfigs(&config.ProxyServer{
+		Addr: "0.0.0.0:6000",
+		Listeners: []config.Listener{
+			{Addr: "0.0.0.0:6002", Namespace: "ns1"},
+			{Network: networkUnix, Addr: "/tmp/weir.sock"},
+		},
+	})
+	require.Len(t, cfgs, 2)
+	require.Equal(t, networkTCP, cfgs[0].Network)
+	require.Equal(t, "ns1", cfgs[0].Namespace)
+	require.Equal(t, networkUnix, cfgs[1].Network)
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "weir.sock")
+
+	l, err := newListener(config.Listener{Network: networkUnix, Addr: path, MaxConnections: 1}, defaultCapability)
+	require.NoError(t, err)
+	require.True(t, l.isUnixSocket())
+	require.Zero(t, l.capability&mysql.ClientSSL)
+
+	// the socket in use is not removed
+	_, err = newListener(config.Listener{Network: networkUnix, Addr: path}, defaultCapability)
+	require.Error(t, err)
+
+	require.NoError(t, l.acquireConn())
+	require.Equal(t, errConCount, l.acquireConn())
+	l.releaseConn()
+	require.NoError(t, l.acquireConn())
+	require.NoError(t, l.ln.Close())
+
+	// a stale socket file is removed
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	l, err = newListener(config.Listener{Network: networkUnix, Addr: path}, defaultCapability)
+	require.NoError(t, err)
+	conn, err := net.Dial(networkUnix, path)
+	require.NoError(t, err)
+	conn.Close()
+	require.NoError(t, l.ln.Close())
+}
+
+func TestListenerAcquireConnConcurrently(t *testing.T) {
+	l := &listener{cfg: config.Listener{MaxConnections: 10}}
+	var wg sync.WaitGroup
+	var acquired int32
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.acquireConn() == nil {
+				atomic.AddInt32(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(10), acquired)
+	require.Equal(t, int32(10), l.connCount)
+}
+
+func TestListenerError(t *testing.T) {
+	_, err := newListener(config.Listener{Network: "udp", Addr: "127.0.0.1:0"}, defaultCapability)
+	require.Error(t, err)
+	_, err = newListener(config.Listener{Network: networkTCP, Addr: "127.0.0.1:0",
+		TLS: config.ListenerTLS{CertFile: "not-exist.pem", KeyFile: "not-exist.key"}}, defaultCapability)
+	require.Error(t, err)
+}
+
+func TestHandoffListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "weir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "weir.sock")
+
+	tcpListener, err := newListener(config.Listener{Network: networkTCP, Addr: "127.0.0.1:0"}, defaultCapability)
+	require.NoError(t, err)
+	unixListener, err := newListener(config.Listener{Network: networkUnix, Addr: path}, defaultCapability)
+	require.NoError(t, err)
+	s := &Server{listeners: []*listener{tcpListener, unixListener}}
+
+	files, err := s.ListenerFiles()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	require.Equal(t, networkUnix, files[1].Network)
+	require.Equal(t, path, files[1].Addr)
+
+	// the socket file is kept for the new process, which accepts on the passed file.
+	s.HandoffListeners()
+	require.Nil(t, s.listeners)
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+	ln, err := net.FileListener(files[1].File)
+	require.NoError(t, err)
+	defer ln.Close()
+	conn, err := net.Dial(networkUnix, path)
+	require.NoError(t, err)
+	conn.Close()
+	for _, f := range files {
+		require.NoError(t, f.File.Close())
+	}
+}
@@ -42,6 +42,8 @@ import (
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/mysql"
 	"github.com/pingcap/parser/terror"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
 )
 
 const defaultWriterSize = 16 * 1024
@@ -52,6 +54,9 @@ type packetIO struct {
 	bufWriter   *bufio.Writer
 	sequence    uint8
 	readTimeout time.Duration
+
+	// compressed is set after the handshake if the client uses the compressed protocol.
+	compressed *compress.IO
 }
 
 func newPacketIO(bufReadConn *bufferedReadConn) *packetIO {
@@ -65,6 +70,36 @@ func (p *packetIO) setBufferedReadConn(bufReadConn *bufferedReadConn) {
 	p.bufWriter = bufio.NewWriterSize(bufReadConn, defaultWriterSize)
 }
 
+// enableCompression makes the following packets read and written in the compressed protocol.
+// The packets are still buffered by bufWriter, so that a compressed packet contains as many packets as possible.
+func (p *packetIO) enableCompression() {
+	p.compressed = compress.NewIO(p.bufReadConn, p.bufReadConn, observeCompression)
+	p.bufWriter = bufio.NewWriterSize(p.compressed, defaultWriterSize)
+}
+
+// enableZstdCompression is the same as enableCompression but compresses with zstd at the level sent by the client.
+func (p *packetIO) enableZstdCompression(level int) error {
+	compressed, err := compress.NewZstdIO(p.bufReadConn, p.bufReadConn, level, observeCompression)
+	if err != nil {
+		return err
+	}
+	p.compressed = compressed
+	p.bufWriter = bufio.NewWriterSize(p.compressed, defaultWriterSize)
+	return nil
+}
+
+func observeCompression(uncompressed, compressed int) {
+	metrics.CompressionBytesCounter.WithLabelValues(metrics.CompressionUncompressed).Add(float64(uncompressed))
+	metrics.CompressionBytesCounter.WithLabelValues(metrics.CompressionCompressed).Add(float64(compressed))
+}
+
+func (p *packetIO) resetSequence() {
+	p.sequence = 0
+	if p.compressed != nil {
+		p.compressed.ResetSequence()
+	}
+}
+
 func (p *packetIO) setReadTimeout(timeout time.Duration) {
 	p.readTimeout = timeout
 }
@@ -72,13 +107,22 @@ func (p *packetIO) setReadTimeout(timeout time.Duration) {
 func (p *packetIO) readOnePacket() ([]byte, error) {
 	var header [4]byte
 
-	if _, err := io.ReadFull(p.bufReadConn, header[:]); err != nil {
+	var r io.Reader = p.bufReadConn
+	if p.compressed != nil {
+		r = p.compressed
+	}
+	if _, err := io.ReadFull(r, header[:]); err != nil {
 		return nil, errors.Trace(err)
 	}
 
 	sequence := header[3]
 	if sequence != p.sequence {
-		return nil, errInvalidSequence.GenWithStack("invalid sequence %d != %d", sequence, p.sequence)
+		// MySQL only checks the sequence of compressed packets, and clients may not keep the sequence
+		// of the packets inside continuous, e.g. libmysqlclient syncs it to the compressed sequence.
+		if p.compressed == nil {
+			return nil, errInvalidSequence.GenWithStack("invalid sequence %d != %d", sequence, p.sequence)
+		}
+		p.sequence = sequence
 	}
 
 	p.sequence++
@@ -86,7 +130,7 @@ func (p *packetIO) readOnePacket() ([]byte, error) {
 	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
 
 	data := make([]byte, length)
-	if _, err := io.ReadFull(p.bufReadConn, data); err != nil {
+	if _, err := io.ReadFull(r, data); err != nil {
 		return nil, errors.Trace(err)
 	}
 	return data, nil
@@ -17,12 +17,22 @@ import (
 	"bufio"
 	"bytes"
 	"net"
+	"os"
+	"testing"
 	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/parser/mysql"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/proxy/metrics"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
 )
 
+func TestMain(m *testing.M) {
+	metrics.RegisterProxyMetrics("test_cluster")
+	os.Exit(m.Run())
+}
+
 type PacketIOTestSuite struct {
 }
 
@@ -89,6 +99,55 @@ func (s *PacketIOTestSuite) TestRead(c *C) {
 	c.Assert(bytes[mysql.MaxPayloadLen], DeepEquals, byte(0x0a))
 }
 
+func TestCompressedPacketIO(t *testing.T) {
+	conn := &loopbackConn{}
+	pkt := newPacketIO(newBufferedReadConn(conn))
+	pkt.enableCompression()
+
+	small := []byte{0x00, 0x00, 0x00, 0x00, 0x01}
+	large := append(make([]byte, 4), bytes.Repeat([]byte("weir"), 1024)...)
+	require.NoError(t, pkt.writePacket(append([]byte(nil), small...)))
+	require.NoError(t, pkt.writePacket(append([]byte(nil), large...)))
+	require.NoError(t, pkt.flush())
+	// both packets are sent in one compressed packet.
+	require.Less(t, conn.b.Len(), len(small)+len(large))
+	require.Equal(t, byte(0), conn.b.Bytes()[3])
+
+	pkt.resetSequence()
+	data, err := pkt.readPacket()
+	require.NoError(t, err)
+	require.Equal(t, small[4:], data)
+	data, err = pkt.readPacket()
+	require.NoError(t, err)
+	require.Equal(t, large[4:], data)
+
+	// the sequence of packets inside compressed packets is not checked.
+	pkt.resetSequence()
+	require.NoError(t, pkt.writePacket(append([]byte(nil), small...)))
+	require.NoError(t, pkt.flush())
+	pkt.sequence = 5
+	data, err = pkt.readPacket()
+	require.NoError(t, err)
+	require.Equal(t, small[4:], data)
+	require.Equal(t, uint8(1), pkt.sequence)
+}
+
+func TestZstdCompressedPacketIO(t *testing.T) {
+	conn := &loopbackConn{}
+	pkt := newPacketIO(newBufferedReadConn(conn))
+	require.NoError(t, pkt.enableZstdCompression(compress.DefaultZstdLevel))
+
+	large := append(make([]byte, 4), bytes.Repeat([]byte("weir"), 1024)...)
+	require.NoError(t, pkt.writePacket(append([]byte(nil), large...)))
+	require.NoError(t, pkt.flush())
+	require.Less(t, conn.b.Len(), len(large))
+
+	pkt.resetSequence()
+	data, err := pkt.readPacket()
+	require.NoError(t, err)
+	require.Equal(t, large[4:], data)
+}
+
 type bytesConn struct {
 	b bytes.Buffer
 }
@@ -101,6 +160,15 @@ func (c *bytesConn) Write(b []byte) (n int, err error) {
 	return 0, nil
 }
 
+// loopbackConn reads what is written to it.
+type loopbackConn struct {
+	bytesConn
+}
+
+func (c *loopbackConn) Write(b []byte) (n int, err error) {
+	return c.b.Write(b)
+}
+
 func (c *bytesConn) Close() error {
 	return nil
 }
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// PROXY protocol lets a load balancer in front of proxy pass the address of the client.
+// See https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt
+const (
+	proxyProtocolV1Prefix    = "PROXY "
+	proxyProtocolV1MaxLength = 107
+
+	proxyProtocolV2HeaderLength = 16
+	proxyProtocolV2CmdLocal     = 0x0
+	proxyProtocolV2CmdProxy     = 0x1
+	proxyProtocolV2FamilyTCP4   = 0x1
+	proxyProtocolV2FamilyTCP6   = 0x2
+
+	defaultProxyProtocolHeaderTimeout = 5 * time.Second
+)
+
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyProtocolHeader = errors.New("invalid PROXY protocol header")
+
+func parseTrustedCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parse proxy protocol trusted cidr %s", cidr)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// isProxyProtocolTrusted checks whether the peer is allowed to send the PROXY protocol header.
+func (s *Server) isProxyProtocolTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range s.proxyProtocolTrustedCIDRs {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// readProxyProtocolHeader reads the PROXY protocol header sent by a trusted peer before the handshake,
+// the address carried by the header is used as the remote address of the conn.
+// The header is not read from an untrusted peer, so that a client can not fake its address.
+func (cc *clientConn) readProxyProtocolHeader() error {
+	if !cc.server.proxyProtocolEnabled || !cc.server.isProxyProtocolTrusted(cc.bufReadConn.RemoteAddr()) {
+		return nil
+	}
+
+	if err := cc.bufReadConn.SetReadDeadline(time.Now().Add(defaultProxyProtocolHeaderTimeout)); err != nil {
+		return errors.Trace(err)
+	}
+	addr, err := parseProxyProtocolHeader(cc.bufReadConn.rb)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := cc.bufReadConn.SetReadDeadline(time.Time{}); err != nil {
+		return errors.Trace(err)
+	}
+	if addr != nil {
+		cc.bufReadConn.remoteAddr = addr
+	}
+	return nil
+}
+
+// parseProxyProtocolHeader reads a v1 or v2 header and returns the source address,
+// which is nil if the header does not carry a TCP address, e.g. the health checks of the load balancer.
+func parseProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	// the v2 signature begins with "\r\n\r\n\x00", which is distinguished from the v1 prefix by the first byte.
+	prefix, err := r.Peek(1)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if prefix[0] == proxyProtocolV1Prefix[0] {
+		return parseProxyProtocolV1(r)
+	}
+	return parseProxyProtocolV2(r)
+}
+
+// parseProxyProtocolV1 parses a header like "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n".
+func parseProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, errors.Annotate(errProxyProtocolHeader, err.Error())
+	}
+	if len(line) > proxyProtocolV1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) ||
+		!bytes.HasPrefix(line, []byte(proxyProtocolV1Prefix)) {
+		return nil, errors.Annotate(errProxyProtocolHeader, "malformed v1 header")
+	}
+
+	fields := strings.Split(string(line[len(proxyProtocolV1Prefix):len(line)-2]), " ")
+	switch fields[0] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, errors.Annotatef(errProxyProtocolHeader, "unknown v1 protocol %s", fields[0])
+	}
+	if len(fields) != 5 {
+		return nil, errors.Annotate(errProxyProtocolHeader, "malformed v1 header")
+	}
+	ip := net.ParseIP(fields[1])
+	port, err := strconv.ParseUint(fields[3], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.Annotate(errProxyProtocolHeader, "malformed v1 source address")
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func parseProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, proxyProtocolV2HeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Annotate(errProxyProtocolHeader, err.Error())
+	}
+	if !bytes.Equal(header[:len(proxyProtocolV2Signature)], proxyProtocolV2Signature) {
+		return nil, errors.Annotate(errProxyProtocolHeader, "unknown signature")
+	}
+	if header[12]>>4 != 0x2 {
+		return nil, errors.Annotatef(errProxyProtocolHeader, "unsupported version %d", header[12]>>4)
+	}
+	cmd := header[12] & 0xf
+	family := header[13] >> 4
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.Annotate(errProxyProtocolHeader, err.Error())
+	}
+
+	switch cmd {
+	case proxyProtocolV2CmdLocal:
+		return nil, nil
+	case proxyProtocolV2CmdProxy:
+	default:
+		return nil, errors.Annotatef(errProxyProtocolHeader, "unknown v2 command %d", cmd)
+	}
+	// the addresses are followed by TLVs, which are ignored.
+	switch family {
+	case proxyProtocolV2FamilyTCP4:
+		if len(payload) < 12 {
+			return nil, errors.Annotate(errProxyProtocolHeader, "short v2 ipv4 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case proxyProtocolV2FamilyTCP6:
+		if len(payload) < 36 {
+			return nil, errors.Annotate(errProxyProtocolHeader, "short v2 ipv6 address")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		// unix socket or unspecified
+		return nil, nil
+	}
+}
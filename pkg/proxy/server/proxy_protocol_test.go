@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func proxyProtocolV2Header(cmd, family byte, payload []byte) []byte {
+	header := append([]byte(nil), proxyProtocolV2Signature...)
+	header = append(header, 0x20|cmd, family<<4|0x1, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func TestParseProxyProtocolHeader(t *testing.T) {
+	v4 := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0xdc, 0x04, 0x0f, 0xaa}
+	v6 := make([]byte, 36)
+	copy(v6, net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(v6[32:], 3306)
+
+	tests := []struct {
+		header []byte
+		addr   string
+	}{
+		{[]byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 4000\r\n"), "192.168.0.1:56324"},
+		{[]byte("PROXY TCP6 2001:db8::1 ::1 3306 4000\r\n"), "[2001:db8::1]:3306"},
+		{[]byte("PROXY UNKNOWN\r\n"), ""},
+		{proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyTCP4, v4), "192.168.0.1:56324"},
+		// TLVs after the addresses are ignored
+		{proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyTCP4, append(v4, 0x04, 0, 1, 0)), "192.168.0.1:56324"},
+		{proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyTCP6, v6), "[2001:db8::1]:3306"},
+		{proxyProtocolV2Header(proxyProtocolV2CmdLocal, 0, nil), ""},
+	}
+	for _, test := range tests {
+		// the bytes after the header are kept for the handshake
+		r := bufio.NewReader(bytes.NewReader(append(test.header, 'x')))
+		addr, err := parseProxyProtocolHeader(r)
+		require.NoError(t, err, string(test.header))
+		if test.addr == "" {
+			require.Nil(t, addr)
+		} else {
+			require.Equal(t, test.addr, addr.String())
+		}
+		b, err := r.ReadByte()
+		require.NoError(t, err)
+		require.Equal(t, byte('x'), b)
+	}
+}
+
+func TestParseProxyProtocolHeaderError(t *testing.T) {
+	headers := [][]byte{
+		[]byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324\r\n"),
+		[]byte("PROXY TCP4 192.168.0.x 10.0.0.1 56324 4000\r\n"),
+		[]byte("PROXY UDP4 192.168.0.1 10.0.0.1 56324 4000\r\n"),
+		[]byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 4000\n"),
+		proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyTCP4, []byte{192, 168, 0, 1}),
+		proxyProtocolV2Header(0x2, proxyProtocolV2FamilyTCP4, nil),
+		// a MySQL packet is not a header
+		{0x01, 0x00, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for _, header := range headers {
+		_, err := parseProxyProtocolHeader(bufio.NewReader(bytes.NewReader(header)))
+		require.Equal(t, errProxyProtocolHeader, errors.Cause(err), string(header))
+	}
+}
+
+func TestProxyProtocolTrusted(t *testing.T) {
+	cidrs, err := parseTrustedCIDRs([]string{"10.0.0.0/8", "fd00::/8"})
+	require.NoError(t, err)
+	s := &Server{proxyProtocolEnabled: true, proxyProtocolTrustedCIDRs: cidrs}
+	require.True(t, s.isProxyProtocolTrusted(&net.TCPAddr{IP: net.ParseIP("10.1.2.3")}))
+	require.True(t, s.isProxyProtocolTrusted(&net.TCPAddr{IP: net.ParseIP("fd00::1")}))
+	require.False(t, s.isProxyProtocolTrusted(&net.TCPAddr{IP: net.ParseIP("192.168.0.1")}))
+	require.False(t, s.isProxyProtocolTrusted(&net.UnixAddr{Name: "/tmp/weir.sock"}))
+
+	_, err = parseTrustedCIDRs([]string{"10.0.0.1"})
+	require.Error(t, err)
+
+	conn := newBufferedReadConn(&bytesConn{})
+	require.Nil(t, conn.RemoteAddr())
+	conn.remoteAddr = &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 3306}
+	require.Equal(t, "192.168.0.1:3306", conn.RemoteAddr().String())
+}
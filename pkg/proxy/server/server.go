@@ -20,7 +20,6 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/mysql"
@@ -29,8 +28,11 @@ import (
 	"github.com/pingcap/tidb/metrics"
 	"github.com/pingcap/tidb/util/fastrand"
 	"github.com/pingcap/tidb/util/logutil"
+	"github.com/tidb-incubator/weir/pkg/capture"
 	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/util/compress"
 	"github.com/tidb-incubator/weir/pkg/util/timer"
+	"github.com/tidb-incubator/weir/pkg/util/upgrade"
 	"go.uber.org/zap"
 )
 
@@ -42,6 +44,7 @@ var (
 	errAccessDenied            = terror.ClassServer.New(errno.ErrAccessDenied, errno.MySQLErrName[errno.ErrAccessDenied])
 	errConCount                = terror.ClassServer.New(errno.ErrConCount, errno.MySQLErrName[errno.ErrConCount])
 	errSecureTransportRequired = terror.ClassServer.New(errno.ErrSecureTransportRequired, errno.MySQLErrName[errno.ErrSecureTransportRequired])
+	errServerShutdown          = terror.ClassServer.New(errno.ErrServerShutdown, errno.MySQLErrName[errno.ErrServerShutdown])
 
 	timeWheelUnit       = time.Second * 1
 	timeWheelBucketsNum = 3600
@@ -57,19 +60,36 @@ const defaultCapability = mysql.ClientLongPassword | mysql.ClientLongFlag |
 
 type Server struct {
 	cfg            *config.Proxy
-	tlsConfig      unsafe.Pointer // *tls.Config
 	driver         IDriver
-	listener       net.Listener
+	listeners      []*listener
 	rwlock         sync.RWMutex
 	clients        map[uint32]*clientConn
 	baseConnID     uint32
 	capability     uint32
 	sessionTimeout time.Duration
 	tw             *timer.TimeWheel
+
+	maxResultBufferSize int
+
+	gracefulShutdownTimeout time.Duration
+	inShutdown              int32
+
+	proxyProtocolEnabled      bool
+	proxyProtocolTrustedCIDRs []*net.IPNet
+
+	captures *capture.Manager
 }
 
 // NewServer creates a new Server.
 func NewServer(cfg *config.Proxy, driver IDriver) (*Server, error) {
+	proxyProtocolTrustedCIDRs, err := parseTrustedCIDRs(cfg.ProxyServer.ProxyProtocol.TrustedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ProxyServer.ProxyProtocol.Enable && len(proxyProtocolTrustedCIDRs) == 0 {
+		return nil, errors.New("proxy protocol is enabled without trusted cidrs")
+	}
+
 	tw, err := timer.NewTimeWheel(timeWheelUnit, timeWheelBucketsNum)
 	if err != nil {
 		return nil, err
@@ -83,15 +103,22 @@ func NewServer(cfg *config.Proxy, driver IDriver) (*Server, error) {
 		clients:        make(map[uint32]*clientConn),
 		sessionTimeout: time.Duration(cfg.ProxyServer.SessionTimeout) * time.Second,
 		tw:             tw,
-	}
 
-	// TODO(eastfisher): set tlsConfig
+		maxResultBufferSize: cfg.ProxyServer.MaxResultBufferSize,
+
+		gracefulShutdownTimeout: time.Duration(cfg.ProxyServer.GracefulShutdownTimeout) * time.Second,
+
+		proxyProtocolEnabled:      cfg.ProxyServer.ProxyProtocol.Enable,
+		proxyProtocolTrustedCIDRs: proxyProtocolTrustedCIDRs,
+
+		captures: capture.NewManager(&cfg.ProxyServer.Capture),
+	}
 
 	setSystemTimeZoneVariable()
 
 	s.initCapability()
 
-	if err := s.initListener(); err != nil {
+	if err := s.initListeners(); err != nil {
 		return nil, err
 	}
 
@@ -103,30 +130,53 @@ func NewServer(cfg *config.Proxy, driver IDriver) (*Server, error) {
 	return s, nil
 }
 
+// initCapability initializes the capability shared by all listeners, ClientSSL is added by the listeners with TLS.
 func (s *Server) initCapability() {
 	s.capability = defaultCapability
-	if s.tlsConfig != nil {
-		s.capability |= mysql.ClientSSL
+	if s.cfg.ProxyServer.EnableCompression {
+		s.capability |= mysql.ClientCompress | compress.ClientZstdCompressionAlgorithm
 	}
 }
 
-// TODO(eastfisher): support unix socket and proxy protocol
-func (s *Server) initListener() error {
-	listener, err := net.Listen("tcp", s.cfg.ProxyServer.Addr)
-	if err != nil {
-		return err
+func (s *Server) initListeners() error {
+	for _, cfg := range getListenerConfigs(&s.cfg.ProxyServer) {
+		l, err := newListener(cfg, s.capability)
+		if err != nil {
+			for _, l := range s.listeners {
+				terror.Log(errors.Trace(l.ln.Close()))
+			}
+			s.listeners = nil
+			return err
+		}
+		s.listeners = append(s.listeners, l)
 	}
-	s.listener = listener
 	return nil
 }
 
+// Run accepts the conns of all listeners, it returns when all listeners are closed or any of them fails.
 func (s *Server) Run() error {
 	metrics.ServerEventCounter.WithLabelValues(metrics.EventStart).Inc()
 
 	// TODO(eastfisher): startStatusHTTP()
 
+	errCh := make(chan error, len(s.listeners))
+	for _, l := range s.listeners {
+		go func(l *listener) {
+			errCh <- s.accept(l)
+		}(l)
+	}
+	for range s.listeners {
+		if err := <-errCh; err != nil {
+			s.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) accept(l *listener) error {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := l.ln.Accept()
 		if err != nil {
 			if opErr, ok := err.(*net.OpError); ok {
 				if opErr.Err.Error() == "use of closed network connection" {
@@ -134,13 +184,11 @@ func (s *Server) Run() error {
 				}
 			}
 
-			// TODO(eastfisher): support PROXY protocol
-
-			logutil.BgLogger().Error("accept failed", zap.Error(err))
+			logutil.BgLogger().Error("accept failed", zap.String("addr", l.cfg.Addr), zap.Error(err))
 			return errors.Trace(err)
 		}
 
-		clientConn := s.newConn(conn)
+		clientConn := s.newConn(l, conn)
 		go s.onConn(clientConn)
 	}
 }
@@ -154,7 +202,16 @@ func (s *Server) ConnectionCount() int {
 }
 
 func (s *Server) onConn(conn *clientConn) {
-	ctx := logutil.WithConnID(context.Background(), conn.connectionID)
+	ctx, cancel := context.WithCancel(logutil.WithConnID(context.Background(), conn.connectionID))
+	defer cancel()
+	conn.cancel = cancel
+	if err := conn.readProxyProtocolHeader(); err != nil {
+		logutil.Logger(ctx).Warn("read proxy protocol header failed",
+			zap.Stringer("remoteAddr", conn.bufReadConn.RemoteAddr()), zap.Error(err))
+		metrics.HandShakeErrorCounter.Inc()
+		terror.Log(errors.Trace(conn.Close()))
+		return
+	}
 	if err := conn.handshake(ctx); err != nil {
 		// Some keep alive services will send request to TiDB and disconnect immediately.
 		// So we only record metrics.
@@ -180,8 +237,9 @@ func (s *Server) onConn(conn *clientConn) {
 	conn.Run(ctx)
 }
 
-func (s *Server) newConn(conn net.Conn) *clientConn {
+func (s *Server) newConn(l *listener, conn net.Conn) *clientConn {
 	cc := newClientConn(s)
+	cc.listener = l
 	if s.cfg.Performance.TCPKeepAlive {
 		if tcpConn, ok := conn.(*net.TCPConn); ok {
 			if err := tcpConn.SetKeepAlive(true); err != nil {
@@ -212,9 +270,12 @@ func (s *Server) checkConnectionCount() error {
 	return nil
 }
 
-// TODO(eastfisher): implement this function
-func (s *Server) isUnixSocket() bool {
-	return false
+// removeClientWithoutLock removes a registered client, the caller should hold the lock.
+func (s *Server) removeClientWithoutLock(cc *clientConn) {
+	if _, ok := s.clients[cc.connectionID]; !ok {
+		return
+	}
+	delete(s.clients, cc.connectionID)
 }
 
 // Close closes the server.
@@ -223,14 +284,50 @@ func (s *Server) Close() {
 	s.rwlock.Lock()
 	defer s.rwlock.Unlock()
 
-	if s.listener != nil {
-		err := s.listener.Close()
+	for _, l := range s.listeners {
+		err := l.ln.Close()
 		terror.Log(errors.Trace(err))
-		s.listener = nil
 	}
+	s.listeners = nil
 	metrics.ServerEventCounter.WithLabelValues(metrics.EventClose).Inc()
 }
 
+// ListenerFiles returns the duplicated files of the listeners, which are passed to the new process on upgrade.
+// The caller should close the files.
+func (s *Server) ListenerFiles() ([]upgrade.ListenerFile, error) {
+	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
+
+	files := make([]upgrade.ListenerFile, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		f, err := l.file()
+		if err != nil {
+			for _, lf := range files {
+				terror.Log(errors.Trace(lf.File.Close()))
+			}
+			return nil, errors.Trace(err)
+		}
+		files = append(files, upgrade.ListenerFile{Network: l.cfg.Network, Addr: l.cfg.Addr, File: f})
+	}
+	return files, nil
+}
+
+// HandoffListeners stops accepting after the listeners are inherited by the new process.
+// The unix socket files are kept, they are still listened by the new process.
+func (s *Server) HandoffListeners() {
+	s.rwlock.Lock()
+	defer s.rwlock.Unlock()
+
+	for _, l := range s.listeners {
+		if ln, ok := l.ln.(*net.UnixListener); ok {
+			ln.SetUnlinkOnClose(false)
+		}
+		err := l.ln.Close()
+		terror.Log(errors.Trace(err))
+	}
+	s.listeners = nil
+}
+
 func killConn(conn *clientConn) {
 	sessVars := conn.ctx.GetSessionVars()
 	atomic.StoreUint32(&sessVars.Killed, 1)
@@ -266,11 +363,23 @@ func (s *Server) KillOneConnections(connectionID uint32) {
 	}
 }
 
-var gracefulCloseConnectionsTimeout = 15 * time.Second
+// Captures returns the traffic captures of namespaces.
+func (s *Server) Captures() *capture.Manager {
+	return s.captures
+}
+
+// defaultGracefulShutdownTimeout is used if graceful_shutdown_timeout is not set.
+const defaultGracefulShutdownTimeout = 15 * time.Second
 
 // TryGracefulDown will try to gracefully close all connection first with timeout. if timeout, will close all connection directly.
 func (s *Server) TryGracefulDown() {
-	ctx, cancel := context.WithTimeout(context.Background(), gracefulCloseConnectionsTimeout)
+	// the captures are stopped after the sessions are closed, so that the close events are recorded.
+	defer s.captures.Close()
+	timeout := s.gracefulShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultGracefulShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 	done := make(chan struct{})
 	go func() {
@@ -284,10 +393,12 @@ func (s *Server) TryGracefulDown() {
 	}
 }
 
-// GracefulDown waits all clients to close.
+// GracefulDown waits all clients to close. The new commands of sessions out of transaction, including the idle ones,
+// get a retryable error, the sessions in transaction are closed after commit or rollback.
 func (s *Server) GracefulDown(ctx context.Context, done chan struct{}) {
 	logutil.Logger(ctx).Info("[server] graceful shutdown.")
 	metrics.ServerEventCounter.WithLabelValues(metrics.EventGracefulDown).Inc()
+	atomic.StoreInt32(&s.inShutdown, 1)
 
 	count := s.ConnectionCount()
 	for i := 0; count > 0; i++ {
@@ -311,21 +422,15 @@ func (s *Server) GracefulDown(ctx context.Context, done chan struct{}) {
 	close(done)
 }
 
+func (s *Server) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) == 1
+}
+
+// kickIdleConnection notifies the idle sessions out of transaction, they get a retryable error on the next command.
 func (s *Server) kickIdleConnection() {
-	var conns []*clientConn
 	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
 	for _, cc := range s.clients {
-		if cc.ShutdownOrNotify() {
-			// Shutdowned conn will be closed by us, and notified conn will exist themselves.
-			conns = append(conns, cc)
-		}
-	}
-	s.rwlock.RUnlock()
-
-	for _, cc := range conns {
-		err := cc.Close()
-		if err != nil {
-			logutil.BgLogger().Error("close connection", zap.Error(err))
-		}
+		cc.ShutdownOrNotify()
 	}
 }
@@ -0,0 +1,148 @@
+package ast
+
+import (
+	"github.com/pingcap/parser/ast"
+)
+
+// the reasons why a statement needs to stay on the same backend conn.
+const (
+	PinReasonLockRead       = "lock_read"
+	PinReasonGetLock        = "get_lock"
+	PinReasonTemporaryTable = "temporary_table"
+	PinReasonUserVariable   = "user_variable"
+	PinReasonFoundRows      = "found_rows"
+)
+
+// PinConnVisitor finds the first session-scoped feature used by a statement.
+// Only the statements which produce the state are found, the readers of the state
+// run on the pinned conn already, or are answered by proxy, such as LAST_INSERT_ID(), SHOW WARNINGS,
+// and the bare SELECT FOUND_ROWS() and SELECT ROW_COUNT().
+type PinConnVisitor struct {
+	reason string
+}
+
+func (p *PinConnVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch nn := n.(type) {
+	case *ast.SelectStmt:
+		if nn.LockTp != ast.SelectLockNone {
+			p.reason = PinReasonLockRead
+		} else if nn.SelectStmtOpts != nil && nn.SelectStmtOpts.CalcFoundRows {
+			p.reason = PinReasonFoundRows
+		}
+	case *ast.FuncCallExpr:
+		if nn.FnName.L == ast.GetLock {
+			p.reason = PinReasonGetLock
+		}
+	case *ast.CreateTableStmt:
+		if nn.IsTemporary {
+			p.reason = PinReasonTemporaryTable
+		}
+	case *ast.VariableExpr:
+		if !nn.IsSystem {
+			p.reason = PinReasonUserVariable
+		}
+	case *ast.VariableAssignment:
+		if IsUserVariableAssignment(nn) {
+			p.reason = PinReasonUserVariable
+		}
+	}
+	return n, p.reason != ""
+}
+
+func (p *PinConnVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, p.reason == ""
+}
+
+func (p *PinConnVisitor) Reason() string {
+	return p.reason
+}
+
+// GetPinConnReason returns the reason if the statement depends on the state of backend conn,
+// such as locks, temporary tables and user variables.
+func GetPinConnReason(stmt ast.StmtNode) (string, bool) {
+	visitor := &PinConnVisitor{}
+	stmt.Accept(visitor)
+	return visitor.reason, visitor.reason != ""
+}
+
+// GetRowCountFunc returns the function name and the column name if the statement is a bare
+// `SELECT FOUND_ROWS()` or `SELECT ROW_COUNT()`, whose value is kept in the backend conn
+// which executes the last statement, so that it can be answered by proxy.
+func GetRowCountFunc(stmt ast.StmtNode) (string, string, bool) {
+	sel, ok := stmt.(*ast.SelectStmt)
+	if !ok || sel.From != nil || sel.Where != nil || sel.GroupBy != nil || sel.Having != nil ||
+		sel.OrderBy != nil || sel.Limit != nil || sel.LockTp != ast.SelectLockNone ||
+		sel.Fields == nil || len(sel.Fields.Fields) != 1 {
+		return "", "", false
+	}
+	field := sel.Fields.Fields[0]
+	f, ok := field.Expr.(*ast.FuncCallExpr)
+	if !ok || len(f.Args) != 0 || (f.FnName.L != ast.FoundRows && f.FnName.L != ast.RowCount) {
+		return "", "", false
+	}
+	name := field.AsName.O
+	if name == "" {
+		name = field.Text()
+	}
+	return f.FnName.L, name, true
+}
+
+// LastInsertIDVisitor finds LAST_INSERT_ID() in a statement.
+type LastInsertIDVisitor struct {
+	found bool
+}
+
+func (l *LastInsertIDVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if f, ok := n.(*ast.FuncCallExpr); ok && f.FnName.L == ast.LastInsertId {
+		l.found = true
+	}
+	return n, l.found
+}
+
+func (l *LastInsertIDVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, !l.found
+}
+
+// ReadsLastInsertID returns true if the statement calls LAST_INSERT_ID(), whose value is kept in the backend conn
+// which executes the last INSERT, so it has to be restored on the conn before the statement.
+func ReadsLastInsertID(stmt ast.StmtNode) bool {
+	visitor := &LastInsertIDVisitor{}
+	stmt.Accept(visitor)
+	return visitor.found
+}
+
+// IsUserVariableAssignment returns true for `SET @var = value`.
+func IsUserVariableAssignment(v *ast.VariableAssignment) bool {
+	return !v.IsSystem && v.Name != ast.SetNames && v.Name != ast.SetCharset
+}
+
+// SessionStateVisitor finds the user variables and the functions reading the state of the last statement,
+// which are kept in the backend conn of the session.
+type SessionStateVisitor struct {
+	found bool
+}
+
+func (s *SessionStateVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	switch nn := n.(type) {
+	case *ast.VariableExpr:
+		s.found = !nn.IsSystem
+	case *ast.FuncCallExpr:
+		switch nn.FnName.L {
+		case ast.LastInsertId, ast.FoundRows, ast.RowCount:
+			s.found = true
+		}
+	}
+	return n, s.found
+}
+
+func (s *SessionStateVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
+	return n, !s.found
+}
+
+// ReadsSessionState returns true if the statement reads the user variables or the state of the last statement,
+// the result depends on the backend conn of the session.
+func ReadsSessionState(stmt ast.StmtNode) bool {
+	visitor := &SessionStateVisitor{}
+	stmt.Accept(visitor)
+	return visitor.found
+}
@@ -0,0 +1,115 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPinConnReason(t *testing.T) {
+	cases := []struct {
+		sql    string
+		reason string
+	}{
+		{sql: "select * from t where id = 1", reason: ""},
+		{sql: "insert into t values (1)", reason: ""},
+		{sql: "set autocommit = 0", reason: ""},
+		{sql: "set names utf8mb4", reason: ""},
+		{sql: "select @@version", reason: ""},
+		{sql: "show tables", reason: ""},
+		{sql: "select * from t where id = 1 for update", reason: PinReasonLockRead},
+		{sql: "select * from t where id = 1 lock in share mode", reason: PinReasonLockRead},
+		{sql: "select get_lock('lock1', 10)", reason: PinReasonGetLock},
+		{sql: "create temporary table t1 (id int)", reason: PinReasonTemporaryTable},
+		{sql: "set @x = 1", reason: PinReasonUserVariable},
+		{sql: "select * from t where id = @x", reason: PinReasonUserVariable},
+		{sql: "update t set a = 1 where id in (select id from t2 where b = @x)", reason: PinReasonUserVariable},
+		{sql: "select sql_calc_found_rows * from t limit 10", reason: PinReasonFoundRows},
+		{sql: "select found_rows()", reason: ""},
+		{sql: "select last_insert_id()", reason: ""},
+		{sql: "show warnings", reason: ""},
+		{sql: "show errors", reason: ""},
+	}
+
+	p := parser.New()
+	for _, c := range cases {
+		stmt, err := p.ParseOneStmt(c.sql, "", "")
+		require.NoError(t, err, c.sql)
+		reason, ok := GetPinConnReason(stmt)
+		require.Equal(t, c.reason, reason, c.sql)
+		require.Equal(t, c.reason != "", ok, c.sql)
+	}
+}
+
+func TestReadsLastInsertID(t *testing.T) {
+	cases := []struct {
+		sql   string
+		reads bool
+	}{
+		{sql: "select 1", reads: false},
+		{sql: "insert into t values (1)", reads: false},
+		{sql: "select last_insert_id()", reads: true},
+		{sql: "select LAST_INSERT_ID() + 1 from t", reads: true},
+		{sql: "insert into t2 (parent_id) values (last_insert_id())", reads: true},
+		{sql: "update t set a = 1 where id = last_insert_id()", reads: true},
+	}
+
+	p := parser.New()
+	for _, c := range cases {
+		stmt, err := p.ParseOneStmt(c.sql, "", "")
+		require.NoError(t, err, c.sql)
+		require.Equal(t, c.reads, ReadsLastInsertID(stmt), c.sql)
+	}
+}
+
+func TestGetRowCountFunc(t *testing.T) {
+	cases := []struct {
+		sql  string
+		fn   string
+		name string
+	}{
+		{sql: "select found_rows()", fn: ast.FoundRows, name: "found_rows()"},
+		{sql: "SELECT ROW_COUNT()", fn: ast.RowCount, name: "ROW_COUNT()"},
+		{sql: "select row_count() as n", fn: ast.RowCount, name: "n"},
+		{sql: "select found_rows() + 1", fn: ""},
+		{sql: "select found_rows(), row_count()", fn: ""},
+		{sql: "select found_rows() from t", fn: ""},
+		{sql: "select last_insert_id()", fn: ""},
+		{sql: "insert into t values (row_count())", fn: ""},
+	}
+
+	p := parser.New()
+	for _, c := range cases {
+		stmt, err := p.ParseOneStmt(c.sql, "", "")
+		require.NoError(t, err, c.sql)
+		fn, name, ok := GetRowCountFunc(stmt)
+		require.Equal(t, c.fn, fn, c.sql)
+		require.Equal(t, c.fn != "", ok, c.sql)
+		if ok {
+			require.Equal(t, c.name, name, c.sql)
+		}
+	}
+}
+
+func TestReadsSessionState(t *testing.T) {
+	cases := []struct {
+		sql   string
+		found bool
+	}{
+		{sql: "select * from t where id = @id", found: true},
+		{sql: "insert into t values (last_insert_id())", found: true},
+		{sql: "select found_rows()", found: true},
+		{sql: "update t set a = 1 where b = row_count()", found: true},
+		{sql: "select @@sql_mode", found: false},
+		{sql: "select * from t where id = 1", found: false},
+	}
+
+	p := parser.New()
+	for _, c := range cases {
+		stmt, err := p.ParseOneStmt(c.sql, "", "")
+		require.NoError(t, err, c.sql)
+		require.Equal(t, c.found, ReadsSessionState(stmt), c.sql)
+	}
+}
@@ -0,0 +1,212 @@
+// Package compress implements the compressed protocol of MySQL with zlib (CLIENT_COMPRESS)
+// and zstd (CLIENT_ZSTD_COMPRESSION_ALGORITHM).
+//
+// Every compressed packet has a 7 bytes header: 3 bytes length of the payload, 1 byte compressed sequence
+// and 3 bytes length of the payload before compression, which is 0 if the payload is sent uncompressed.
+// The payload is a stream of normal MySQL packets, so a packet may be split into several compressed packets
+// and a compressed packet may contain several packets.
+// See https://dev.mysql.com/doc/internals/en/compressed-packet-header.html
+package compress
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+
+	"github.com/pingcap/errors"
+)
+
+// ClientZstdCompressionAlgorithm is the capability flag of the compressed protocol with zstd.
+// The compression level follows the connect attributes in the handshake response if it is set.
+const ClientZstdCompressionAlgorithm uint32 = 1 << 26
+
+const (
+	headerSize = 7
+
+	// MinCompressLength is the payload length below which the payload is sent uncompressed, the same as MySQL.
+	MinCompressLength = 50
+
+	// maxPayloadLen is the max length of the uncompressed payload of a compressed packet.
+	maxPayloadLen = 1<<24 - 1
+)
+
+var ErrMalformPacket = errors.New("malformed compressed packet")
+
+// Stats observes the bytes before and after compression of each compressed packet read or written.
+type Stats func(uncompressed, compressed int)
+
+// codec compresses and decompresses the payload of a compressed packet.
+type codec interface {
+	// compress appends the compressed payload to buf.
+	compress(buf *bytes.Buffer, payload []byte) error
+	// decompress reads the compressed payload of length bytes from r and appends the decompressed bytes to buf.
+	decompress(buf *bytes.Buffer, r io.Reader, length, uncompressedLength int) error
+}
+
+// IO reads and writes the payload of compressed packets.
+// Read returns the decompressed stream and Write sends the written bytes as one or more compressed packets,
+// so the caller should buffer the packets to make the compression effective.
+//
+// The compressed sequence is shared by reading and writing like the sequence of normal packets,
+// the caller must call ResetSequence when the sequence of normal packets is reset.
+// The sequence of a compressed packet read is not checked, so the peer is trusted to follow it.
+type IO struct {
+	r     io.Reader
+	w     io.Writer
+	stats Stats
+
+	codec    codec
+	sequence uint8
+
+	readBuf  bytes.Buffer
+	writeBuf bytes.Buffer
+}
+
+// NewIO returns an IO compressing with zlib.
+func NewIO(r io.Reader, w io.Writer, stats Stats) *IO {
+	return &IO{
+		r:     r,
+		w:     w,
+		stats: stats,
+		codec: &zlibCodec{zw: zlib.NewWriter(nil)},
+	}
+}
+
+func (c *IO) ResetSequence() {
+	c.sequence = 0
+}
+
+func (c *IO) Read(p []byte) (int, error) {
+	for c.readBuf.Len() == 0 {
+		if err := c.readCompressedPacket(); err != nil {
+			return 0, err
+		}
+	}
+	return c.readBuf.Read(p)
+}
+
+func (c *IO) readCompressedPacket() error {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return err
+	}
+	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	c.sequence = header[3] + 1
+	uncompressedLength := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+
+	if uncompressedLength == 0 {
+		if _, err := io.CopyN(&c.readBuf, c.r, int64(length)); err != nil {
+			return err
+		}
+		c.observe(length, length)
+		return nil
+	}
+
+	c.readBuf.Grow(uncompressedLength)
+	if err := c.codec.decompress(&c.readBuf, c.r, length, uncompressedLength); err != nil {
+		return err
+	}
+	c.observe(uncompressedLength, length)
+	return nil
+}
+
+func (c *IO) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		payload := p
+		if len(payload) > maxPayloadLen {
+			payload = payload[:maxPayloadLen]
+		}
+		if err := c.writeCompressedPacket(payload); err != nil {
+			return written, err
+		}
+		written += len(payload)
+		p = p[len(payload):]
+	}
+	return written, nil
+}
+
+func (c *IO) writeCompressedPacket(payload []byte) error {
+	c.writeBuf.Reset()
+	var header [headerSize]byte
+	c.writeBuf.Write(header[:])
+
+	uncompressedLength := 0
+	if len(payload) >= MinCompressLength {
+		if err := c.codec.compress(&c.writeBuf, payload); err != nil {
+			return err
+		}
+		uncompressedLength = len(payload)
+	}
+	// send the payload as it is if compression does not save anything.
+	if uncompressedLength == 0 || c.writeBuf.Len()-headerSize >= len(payload) {
+		c.writeBuf.Truncate(headerSize)
+		c.writeBuf.Write(payload)
+		uncompressedLength = 0
+	}
+
+	data := c.writeBuf.Bytes()
+	length := len(data) - headerSize
+	data[0] = byte(length)
+	data[1] = byte(length >> 8)
+	data[2] = byte(length >> 16)
+	data[3] = c.sequence
+	data[4] = byte(uncompressedLength)
+	data[5] = byte(uncompressedLength >> 8)
+	data[6] = byte(uncompressedLength >> 16)
+
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	c.sequence++
+	c.observe(len(payload), length)
+	return nil
+}
+
+func (c *IO) observe(uncompressed, compressed int) {
+	if c.stats != nil {
+		c.stats(uncompressed, compressed)
+	}
+}
+
+type zlibCodec struct {
+	zr io.ReadCloser
+	zw *zlib.Writer
+}
+
+func (z *zlibCodec) compress(buf *bytes.Buffer, payload []byte) error {
+	z.zw.Reset(buf)
+	if _, err := z.zw.Write(payload); err != nil {
+		return err
+	}
+	return z.zw.Close()
+}
+
+func (z *zlibCodec) decompress(buf *bytes.Buffer, r io.Reader, length, uncompressedLength int) error {
+	payload := io.LimitReader(r, int64(length))
+	if err := z.resetReader(payload); err != nil {
+		return err
+	}
+	if n, err := io.CopyN(buf, z.zr, int64(uncompressedLength)); err != nil {
+		return errors.Wrapf(ErrMalformPacket, "decompress %d bytes, %d bytes read: %v", uncompressedLength, n, err)
+	}
+	// consume the zlib checksum and the padding if any, so that the next header is read correctly.
+	_, err := io.Copy(ioutil.Discard, payload)
+	return err
+}
+
+func (z *zlibCodec) resetReader(r io.Reader) error {
+	if z.zr == nil {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return errors.Wrapf(ErrMalformPacket, "read zlib header: %v", err)
+		}
+		z.zr = zr
+		return nil
+	}
+	if err := z.zr.(zlib.Resetter).Reset(r, nil); err != nil {
+		return errors.Wrapf(ErrMalformPacket, "read zlib header: %v", err)
+	}
+	return nil
+}
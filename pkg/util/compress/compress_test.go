@@ -0,0 +1,85 @@
+package compress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var uncompressed, compressed int
+	stats := func(u, c int) {
+		uncompressed += u
+		compressed += c
+	}
+
+	var conn bytes.Buffer
+	w := NewIO(nil, &conn, stats)
+	small := []byte("select 1")
+	large := bytes.Repeat([]byte("weir"), 1024)
+	_, err := w.Write(small)
+	require.NoError(t, err)
+	_, err = w.Write(large)
+	require.NoError(t, err)
+
+	// the small payload is sent as it is.
+	data := conn.Bytes()
+	require.Equal(t, []byte{byte(len(small)), 0, 0, 0, 0, 0, 0}, data[:headerSize])
+	require.Equal(t, small, data[headerSize:headerSize+len(small)])
+	// the large payload is compressed with the next sequence.
+	header := data[headerSize+len(small):]
+	require.Equal(t, byte(1), header[3])
+	require.Equal(t, []byte{0, 0x10, 0}, header[4:7])
+	require.Equal(t, len(small)+len(large), uncompressed)
+	require.Less(t, compressed, uncompressed)
+
+	uncompressed, compressed = 0, 0
+	r := NewIO(&conn, nil, stats)
+	got, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, append(small, large...), got)
+	require.Equal(t, len(small)+len(large), uncompressed)
+	require.Equal(t, uint8(2), r.sequence)
+
+	r.ResetSequence()
+	require.Equal(t, uint8(0), r.sequence)
+}
+
+func TestReadMalformPacket(t *testing.T) {
+	// the uncompressed length is set but the payload is not zlib data.
+	data := []byte{3, 0, 0, 0, 10, 0, 0, 'a', 'b', 'c'}
+	r := NewIO(bytes.NewReader(data), nil, nil)
+	_, err := r.Read(make([]byte, 10))
+	require.Equal(t, ErrMalformPacket, errors.Cause(err))
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	var conn bytes.Buffer
+	w, err := NewZstdIO(nil, &conn, DefaultZstdLevel, nil)
+	require.NoError(t, err)
+	large := bytes.Repeat([]byte("weir"), 1024)
+	_, err = w.Write(large)
+	require.NoError(t, err)
+	_, err = w.Write(large[:100])
+	require.NoError(t, err)
+	require.Less(t, conn.Len(), len(large))
+	require.Equal(t, []byte{0, 0x10, 0}, conn.Bytes()[4:7])
+
+	// the level out of range uses the default level.
+	r, err := NewZstdIO(&conn, nil, 0, nil)
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, append(large, large[:100]...), got)
+	require.Equal(t, uint8(2), r.sequence)
+
+	// the payload is not zstd data.
+	data := []byte{3, 0, 0, 0, 10, 0, 0, 'a', 'b', 'c'}
+	r, err = NewZstdIO(bytes.NewReader(data), nil, DefaultZstdLevel, nil)
+	require.NoError(t, err)
+	_, err = r.Read(make([]byte, 10))
+	require.Equal(t, ErrMalformPacket, errors.Cause(err))
+}
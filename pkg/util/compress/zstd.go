@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/errors"
+)
+
+const (
+	// DefaultZstdLevel is the compression level used if the client does not send a valid one, the same as MySQL.
+	DefaultZstdLevel = 3
+	minZstdLevel     = 1
+	maxZstdLevel     = 22
+)
+
+// the encoders and the decoder are safe for concurrent EncodeAll and DecodeAll, so they are shared by all conns.
+var (
+	zstdLock     sync.Mutex
+	zstdEncoders = make(map[zstd.EncoderLevel]*zstd.Encoder)
+	zstdDecoder  *zstd.Decoder
+)
+
+// NewZstdIO returns an IO compressing with zstd. The level is in [1, 22] as MySQL,
+// DefaultZstdLevel is used if it is out of range.
+func NewZstdIO(r io.Reader, w io.Writer, level int, stats Stats) (*IO, error) {
+	if level < minZstdLevel || level > maxZstdLevel {
+		level = DefaultZstdLevel
+	}
+	encoder, decoder, err := getZstdCoders(zstd.EncoderLevelFromZstd(level))
+	if err != nil {
+		return nil, err
+	}
+	return &IO{
+		r:     r,
+		w:     w,
+		stats: stats,
+		codec: &zstdCodec{encoder: encoder, decoder: decoder},
+	}, nil
+}
+
+func getZstdCoders(level zstd.EncoderLevel) (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdLock.Lock()
+	defer zstdLock.Unlock()
+
+	if zstdDecoder == nil {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(runtime.GOMAXPROCS(0)),
+			zstd.WithDecoderMaxMemory(maxPayloadLen))
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "create zstd decoder error")
+		}
+		zstdDecoder = decoder
+	}
+	encoder, ok := zstdEncoders[level]
+	if !ok {
+		var err error
+		encoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(0)))
+		if err != nil {
+			return nil, nil, errors.WithMessage(err, "create zstd encoder error")
+		}
+		zstdEncoders[level] = encoder
+	}
+	return encoder, zstdDecoder, nil
+}
+
+// zstdCodec compresses every payload as a zstd frame.
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+
+	// the buffers are reused by the packets, reading and writing use different buffers.
+	compressed   []byte
+	decompressed []byte
+	encoded      []byte
+}
+
+func (z *zstdCodec) compress(buf *bytes.Buffer, payload []byte) error {
+	z.encoded = z.encoder.EncodeAll(payload, z.encoded[:0])
+	buf.Write(z.encoded)
+	return nil
+}
+
+func (z *zstdCodec) decompress(buf *bytes.Buffer, r io.Reader, length, uncompressedLength int) error {
+	if cap(z.compressed) < length {
+		z.compressed = make([]byte, length)
+	}
+	z.compressed = z.compressed[:length]
+	if _, err := io.ReadFull(r, z.compressed); err != nil {
+		return err
+	}
+
+	var err error
+	z.decompressed, err = z.decoder.DecodeAll(z.compressed, z.decompressed[:0])
+	if err != nil {
+		return errors.Wrapf(ErrMalformPacket, "decompress %d bytes: %v", uncompressedLength, err)
+	}
+	if len(z.decompressed) != uncompressedLength {
+		return errors.Wrapf(ErrMalformPacket, "decompress %d bytes, %d bytes read", uncompressedLength, len(z.decompressed))
+	}
+	buf.Write(z.decompressed)
+	return nil
+}
@@ -0,0 +1,55 @@
+// Package etcdtest starts an embedded etcd for the tests that need a real etcd.
+package etcdtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+)
+
+func getFreeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	u, err := url.Parse("http://" + l.Addr().String())
+	require.NoError(t, err)
+	return *u
+}
+
+// StartEmbedEtcd starts a single node etcd in a temp dir, the returned func closes the client and etcd.
+func StartEmbedEtcd(t *testing.T) (*embed.Etcd, *clientv3.Client, func()) {
+	dir, err := ioutil.TempDir("", "weir_embed_etcd")
+	require.NoError(t, err)
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	clientURL, peerURL := getFreeURL(t), getFreeURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = fmt.Sprintf("%s=%s", cfg.Name, peerURL.String())
+
+	etcd, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	select {
+	case <-etcd.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("start embed etcd timeout")
+	}
+
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{clientURL.String()}})
+	require.NoError(t, err)
+	return etcd, client, func() {
+		client.Close()
+		etcd.Close()
+		os.RemoveAll(dir)
+	}
+}
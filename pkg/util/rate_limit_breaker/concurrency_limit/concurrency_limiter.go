@@ -0,0 +1,175 @@
+package concurrency_limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tidb-incubator/weir/pkg/util/sync2"
+)
+
+var (
+	ErrQueueFull    = errors.New("concurrency limited: wait queue is full")
+	ErrQueueTimeout = errors.New("concurrency limited: wait timeout")
+)
+
+const (
+	// 自适应模式下, 延迟的平滑系数 (EWMA)
+	latencyEwmaAlpha = 0.1
+	// 自适应模式下, 两次调整并发上限的最小间隔
+	defaultAdjustInterval = time.Second
+)
+
+type Config struct {
+	MaxConcurrency int
+	MaxQueueSize   int
+	QueueTimeout   time.Duration
+
+	// 自适应模式: 后端延迟超过 LatencyThreshold 时逐步收缩并发上限 (不低于 MinConcurrency),
+	// 延迟恢复到阈值一半以下时再逐步放开.
+	Adaptive         bool
+	MinConcurrency   int
+	LatencyThreshold time.Duration
+}
+
+// 基于 sync2.Semaphore 的并发限制器, 带有一个有界的等待队列.
+// 自适应模式通过"扣留"信号量的槽位来收缩并发上限, 归还槽位来放开上限.
+type ConcurrencyLimiter struct {
+	cfg     Config
+	sem     *sync2.Semaphore
+	waiting sync2.AtomicInt64
+
+	mu             sync.Mutex // guard fields below
+	reserved       int        // 已被自适应模式扣留的槽位数
+	pendingShrink  int        // 待扣留的槽位数, 在下一次 Release 时扣留
+	latencyEwma    float64    // 单位: 纳秒
+	lastAdjustTime time.Time
+	adjustInterval time.Duration
+}
+
+func NewConcurrencyLimiter(cfg Config) *ConcurrencyLimiter {
+	if cfg.MinConcurrency <= 0 {
+		cfg.MinConcurrency = 1
+	}
+	if cfg.MinConcurrency > cfg.MaxConcurrency {
+		cfg.MinConcurrency = cfg.MaxConcurrency
+	}
+	return &ConcurrencyLimiter{
+		cfg:            cfg,
+		sem:            sync2.NewSemaphore(cfg.MaxConcurrency, cfg.QueueTimeout),
+		adjustInterval: defaultAdjustInterval,
+	}
+}
+
+// 获取一个执行槽位. 没有空闲槽位时进入等待队列,
+// 队列已满返回 ErrQueueFull, 等待超时返回 ErrQueueTimeout.
+func (c *ConcurrencyLimiter) Acquire() error {
+	return c.AcquireContext(context.Background())
+}
+
+// 同 Acquire, ctx 被取消时停止等待并返回 ctx.Err().
+func (c *ConcurrencyLimiter) AcquireContext(ctx context.Context) error {
+	if c.sem.TryAcquire() {
+		return nil
+	}
+
+	if c.waiting.Add(1) > int64(c.cfg.MaxQueueSize) {
+		c.waiting.Add(-1)
+		return ErrQueueFull
+	}
+	defer c.waiting.Add(-1)
+
+	if !c.sem.AcquireContext(ctx) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrQueueTimeout
+	}
+	return nil
+}
+
+// 尝试获取一个执行槽位, 没有空闲槽位时立即返回 false, 不进入等待队列.
+func (c *ConcurrencyLimiter) TryAcquire() bool {
+	return c.sem.TryAcquire()
+}
+
+// 归还执行槽位, latency 为本次执行耗时, 用于自适应调整.
+func (c *ConcurrencyLimiter) Release(latency time.Duration) {
+	if !c.cfg.Adaptive {
+		c.sem.Release()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.observeLatency(latency)
+	c.adjust()
+
+	if c.pendingShrink > 0 {
+		c.pendingShrink--
+		c.reserved++
+		return
+	}
+	c.sem.Release()
+}
+
+// 当前等待队列长度
+func (c *ConcurrencyLimiter) Waiting() int64 {
+	return c.waiting.Get()
+}
+
+// 当前生效的并发上限
+func (c *ConcurrencyLimiter) Limit() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg.MaxConcurrency - c.reserved - c.pendingShrink
+}
+
+func (c *ConcurrencyLimiter) observeLatency(latency time.Duration) {
+	if c.latencyEwma == 0 {
+		c.latencyEwma = float64(latency)
+		return
+	}
+	c.latencyEwma = c.latencyEwma*(1-latencyEwmaAlpha) + float64(latency)*latencyEwmaAlpha
+}
+
+// 乘性收缩, 加性恢复
+func (c *ConcurrencyLimiter) adjust() {
+	now := time.Now()
+	if now.Sub(c.lastAdjustTime) < c.adjustInterval {
+		return
+	}
+	c.lastAdjustTime = now
+
+	threshold := float64(c.cfg.LatencyThreshold)
+	limit := c.cfg.MaxConcurrency - c.reserved - c.pendingShrink
+
+	if c.latencyEwma > threshold {
+		shrink := limit / 10
+		if shrink < 1 {
+			shrink = 1
+		}
+		if limit-shrink < c.cfg.MinConcurrency {
+			shrink = limit - c.cfg.MinConcurrency
+		}
+		for i := 0; i < shrink; i++ {
+			if c.sem.TryAcquire() {
+				c.reserved++
+			} else {
+				c.pendingShrink++
+			}
+		}
+		return
+	}
+
+	if c.latencyEwma < threshold/2 {
+		if c.pendingShrink > 0 {
+			c.pendingShrink--
+		} else if c.reserved > 0 {
+			c.reserved--
+			c.sem.Release()
+		}
+	}
+}
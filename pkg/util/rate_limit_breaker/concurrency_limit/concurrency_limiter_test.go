@@ -0,0 +1,99 @@
+package concurrency_limit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyLimiter_QueueFull(t *testing.T) {
+	cl := NewConcurrencyLimiter(Config{MaxConcurrency: 1, MaxQueueSize: 0, QueueTimeout: time.Second})
+	assert.Nil(t, cl.Acquire())
+	assert.Equal(t, ErrQueueFull, cl.Acquire())
+	cl.Release(time.Millisecond)
+	assert.Nil(t, cl.Acquire())
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	cl := NewConcurrencyLimiter(Config{MaxConcurrency: 1, MaxQueueSize: 1, QueueTimeout: 10 * time.Millisecond})
+	assert.Nil(t, cl.Acquire())
+	assert.Equal(t, ErrQueueTimeout, cl.Acquire())
+	assert.Equal(t, int64(0), cl.Waiting())
+}
+
+func TestConcurrencyLimiter_WaitInQueue(t *testing.T) {
+	cl := NewConcurrencyLimiter(Config{MaxConcurrency: 1, MaxQueueSize: 1, QueueTimeout: time.Second})
+	assert.Nil(t, cl.Acquire())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, cl.Acquire())
+	}()
+
+	// 等待第二个请求进入等待队列
+	for cl.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// 等待队列已满
+	assert.Equal(t, ErrQueueFull, cl.Acquire())
+
+	cl.Release(time.Millisecond)
+	wg.Wait()
+}
+
+func TestConcurrencyLimiter_Adaptive(t *testing.T) {
+	cl := NewConcurrencyLimiter(Config{
+		MaxConcurrency:   10,
+		MaxQueueSize:     0,
+		Adaptive:         true,
+		MinConcurrency:   8,
+		LatencyThreshold: 100 * time.Millisecond,
+	})
+	cl.adjustInterval = 0
+
+	// 延迟升高, 并发上限逐步收缩, 但不低于 MinConcurrency
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, cl.Acquire())
+		cl.Release(time.Second)
+	}
+	assert.Equal(t, 8, cl.Limit())
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, cl.Acquire())
+	}
+	assert.Equal(t, ErrQueueFull, cl.Acquire())
+	for i := 0; i < 8; i++ {
+		cl.Release(time.Second)
+	}
+
+	// 延迟恢复, 并发上限逐步放开
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, cl.Acquire())
+		cl.Release(time.Millisecond)
+	}
+	assert.Equal(t, 10, cl.Limit())
+}
+
+func TestConcurrencyLimiter_AcquireContext(t *testing.T) {
+	cl := NewConcurrencyLimiter(Config{MaxConcurrency: 1, MaxQueueSize: 1, QueueTimeout: time.Minute})
+	assert.Nil(t, cl.Acquire())
+	assert.False(t, cl.TryAcquire())
+
+	// 等待中的请求在 ctx 取消后立即返回
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for cl.Waiting() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	assert.Equal(t, context.Canceled, cl.AcquireContext(ctx))
+	assert.Equal(t, int64(0), cl.Waiting())
+
+	cl.Release(time.Millisecond)
+	assert.True(t, cl.TryAcquire())
+}
@@ -21,6 +21,7 @@ package sync2
 // cases, you just want a familiar API.
 
 import (
+	"context"
 	"time"
 )
 
@@ -61,6 +62,29 @@ func (sem *Semaphore) Acquire() bool {
 	}
 }
 
+// AcquireContext returns true on successful acquisition, and
+// false on a timeout or the cancel of ctx.
+func (sem *Semaphore) AcquireContext(ctx context.Context) bool {
+	if sem.timeout == 0 {
+		select {
+		case <-sem.slots:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	tm := time.NewTimer(sem.timeout)
+	defer tm.Stop()
+	select {
+	case <-sem.slots:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-tm.C:
+		return false
+	}
+}
+
 // TryAcquire acquires a semaphore if it's immediately available.
 // It returns false otherwise.
 func (sem *Semaphore) TryAcquire() bool {
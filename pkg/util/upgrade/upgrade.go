@@ -0,0 +1,203 @@
+// Package upgrade hands the listening sockets over to a new process, so that the binary can be
+// upgraded without refusing any connection.
+//
+// The old process execs the new binary with the listener fds and a pipe, the new process
+// inherits the listeners on the same addresses instead of listening again, and writes to
+// the pipe when it is serving. Then the old process stops accepting and drains its sessions.
+package upgrade
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/util/logutil"
+	"go.uber.org/zap"
+)
+
+const (
+	envListeners = "WEIR_UPGRADE_LISTENERS"
+	envReadyFD   = "WEIR_UPGRADE_READY_FD"
+
+	// the files in exec.Cmd.ExtraFiles start from fd 3 in the new process.
+	firstExtraFD = 3
+)
+
+// ListenerFile is a listening socket passed to the new process.
+type ListenerFile struct {
+	Network string
+	Addr    string
+	File    *os.File
+}
+
+type inheritedListener struct {
+	Network string  `json:"network"`
+	Addr    string  `json:"addr"`
+	FD      uintptr `json:"fd"`
+}
+
+var (
+	inheritOnce sync.Once
+	inheritLock sync.Mutex
+	inherited   map[string]*os.File // key: network/addr
+	readyFile   *os.File
+)
+
+func listenerKey(network, addr string) string {
+	return network + "/" + addr
+}
+
+// loadInherited reads the fds passed by the old process, the env is cleared so that
+// it is not passed again when this process is upgraded.
+func loadInherited() {
+	inherited = make(map[string]*os.File)
+	if data := os.Getenv(envListeners); data != "" {
+		var ls []inheritedListener
+		if err := json.Unmarshal([]byte(data), &ls); err != nil {
+			logutil.BgLogger().Warn("parse inherited listeners failed", zap.String("env", data), zap.Error(err))
+		}
+		for _, l := range ls {
+			key := listenerKey(l.Network, l.Addr)
+			inherited[key] = os.NewFile(l.FD, key)
+		}
+	}
+	if data := os.Getenv(envReadyFD); data != "" {
+		fd, err := strconv.Atoi(data)
+		if err != nil {
+			logutil.BgLogger().Warn("parse upgrade ready fd failed", zap.String("env", data), zap.Error(err))
+		} else {
+			readyFile = os.NewFile(uintptr(fd), "upgrade-ready")
+		}
+	}
+	os.Unsetenv(envListeners)
+	os.Unsetenv(envReadyFD)
+}
+
+// Inherit returns the listener on the address passed by the old process, or nil if there is none.
+func Inherit(network, addr string) (net.Listener, error) {
+	inheritOnce.Do(loadInherited)
+	inheritLock.Lock()
+	defer inheritLock.Unlock()
+
+	key := listenerKey(network, addr)
+	f, ok := inherited[key]
+	if !ok {
+		return nil, nil
+	}
+	delete(inherited, key)
+	// FileListener dups the fd, so the file is not needed any more.
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Annotatef(err, "inherit listener %s", key)
+	}
+	logutil.BgLogger().Info("inherit listener from old process", zap.String("network", network), zap.String("addr", addr))
+	return ln, nil
+}
+
+// Ready notifies the old process that this process is serving, it is a no-op if the process is not
+// started by upgrade. The inherited listeners that are not used, e.g. removed from config, are closed.
+func Ready() error {
+	inheritOnce.Do(loadInherited)
+	inheritLock.Lock()
+	defer inheritLock.Unlock()
+
+	for key, f := range inherited {
+		logutil.BgLogger().Warn("close unused inherited listener", zap.String("listener", key))
+		f.Close()
+	}
+	inherited = nil
+	if readyFile == nil {
+		return nil
+	}
+	_, err := readyFile.Write([]byte{1})
+	readyFile.Close()
+	readyFile = nil
+	return errors.Trace(err)
+}
+
+// Start execs the binary of this process with the same arguments and the listeners, and waits until
+// the new process is ready. The new process is killed if it is not ready in timeout.
+// The caller still owns the listener files and should close them.
+func Start(listeners []ListenerFile, timeout time.Duration) (int, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer readyR.Close()
+
+	ls := make([]inheritedListener, 0, len(listeners))
+	files := make([]*os.File, 0, len(listeners)+1)
+	for i, l := range listeners {
+		ls = append(ls, inheritedListener{Network: l.Network, Addr: l.Addr, FD: uintptr(firstExtraFD + i)})
+		files = append(files, l.File)
+	}
+	files = append(files, readyW)
+	data, err := json.Marshal(ls)
+	if err != nil {
+		readyW.Close()
+		return 0, errors.Trace(err)
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(upgradeFreeEnv(os.Environ()),
+		envListeners+"="+string(data),
+		envReadyFD+"="+strconv.Itoa(firstExtraFD+len(listeners)))
+	err = cmd.Start()
+	// the write end is only held by the new process, so the read returns EOF if it exits.
+	readyW.Close()
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	pid := cmd.Process.Pid
+	logutil.BgLogger().Info("start new process to upgrade", zap.String("path", path), zap.Int("pid", pid))
+
+	exitCh := make(chan error, 1)
+	go func() {
+		exitCh <- cmd.Wait()
+	}()
+	readyCh := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		readyCh <- err
+	}()
+
+	select {
+	case err = <-readyCh:
+		if err == nil {
+			return pid, nil
+		}
+		err = errors.Annotatef(err, "new process %d is not ready", pid)
+	case err = <-exitCh:
+		return 0, errors.Errorf("new process %d exits before ready: %v", pid, err)
+	case <-time.After(timeout):
+		err = errors.Errorf("new process %d is not ready in %s", pid, timeout)
+	}
+	if killErr := cmd.Process.Kill(); killErr != nil {
+		logutil.BgLogger().Warn("kill new process failed", zap.Int("pid", pid), zap.Error(killErr))
+	}
+	return 0, err
+}
+
+func upgradeFreeEnv(env []string) []string {
+	ret := make([]string, 0, len(env))
+	for _, e := range env {
+		if strings.HasPrefix(e, envListeners+"=") || strings.HasPrefix(e, envReadyFD+"=") {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func resetInherited(t *testing.T, ls []inheritedListener, readyFD uintptr) {
+	data, err := json.Marshal(ls)
+	require.NoError(t, err)
+	require.NoError(t, os.Setenv(envListeners, string(data)))
+	require.NoError(t, os.Setenv(envReadyFD, strconv.Itoa(int(readyFD))))
+	inheritOnce = sync.Once{}
+	inherited = nil
+	readyFile = nil
+}
+
+func TestInheritAndReady(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	f, err := ln.(*net.TCPListener).File()
+	require.NoError(t, err)
+	unused, err := ln.(*net.TCPListener).File()
+	require.NoError(t, err)
+	readyR, readyW, err := os.Pipe()
+	require.NoError(t, err)
+	defer readyR.Close()
+
+	resetInherited(t, []inheritedListener{
+		{Network: "tcp", Addr: addr, FD: f.Fd()},
+		{Network: "tcp", Addr: "127.0.0.1:1", FD: unused.Fd()},
+	}, readyW.Fd())
+	inheritOnce.Do(loadInherited)
+	require.NotNil(t, readyFile)
+	require.Empty(t, os.Getenv(envListeners))
+
+	// the old listener is closed, the conns are accepted by the inherited one.
+	require.NoError(t, ln.Close())
+	inheritedLn, err := Inherit("tcp", addr)
+	require.NoError(t, err)
+	require.NotNil(t, inheritedLn)
+	defer inheritedLn.Close()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	conn.Close()
+	accepted, err := inheritedLn.Accept()
+	require.NoError(t, err)
+	accepted.Close()
+
+	none, err := Inherit("tcp", "127.0.0.1:2")
+	require.NoError(t, err)
+	require.Nil(t, none)
+
+	require.NoError(t, Ready())
+	b := make([]byte, 1)
+	_, err = readyR.Read(b)
+	require.NoError(t, err)
+	require.Nil(t, readyFile)
+	require.Empty(t, inherited)
+}
+
+func TestUpgradeFreeEnv(t *testing.T) {
+	env := upgradeFreeEnv([]string{"PATH=/bin", envListeners + "=[]", envReadyFD + "=4", "WEIR_UPGRADE=1"})
+	require.Equal(t, []string{"PATH=/bin", "WEIR_UPGRADE=1"}, env)
+}
@@ -0,0 +1,290 @@
+// Package validation holds the namespace config checks shared by weirproxy and weirproxy-cc,
+// so that a broken config can be rejected before it is pushed to proxies.
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/parser"
+	"github.com/tidb-incubator/weir/pkg/config"
+	"github.com/tidb-incubator/weir/pkg/proxy/backend"
+	wast "github.com/tidb-incubator/weir/pkg/util/ast"
+)
+
+var (
+	ErrDuplicatedUser      = errors.New("duplicated user")
+	ErrInvalidSelectorType = errors.New("invalid selector type")
+	ErrInvalidDiscovery    = errors.New("invalid discovery")
+	ErrInvalidPoolConfig   = errors.New("invalid pool config")
+	ErrInvalidSQL          = errors.New("invalid sql")
+
+	ErrInvalidCompressionAlgorithm = errors.New("invalid compression algorithm")
+
+	ErrInvalidFailureRateThreshold = errors.New("invalid FailureRateThreshold")
+	ErrInvalidopenStatusDurationMs = errors.New("invalid OpenStatusDurationMs")
+	ErrInvalidSqlTimeout           = errors.New("invalid sql timeout")
+
+	ErrInvalidScope            = errors.New("invalid scope")
+	ErrInvalidConcurrencyLimit = errors.New("invalid concurrency limit")
+	ErrInvalidConnectionLimit  = errors.New("invalid connection limit")
+	ErrInvalidShadow           = errors.New("invalid shadow")
+	ErrInvalidBackendGroup     = errors.New("invalid backend group")
+)
+
+// ValidateNamespaces checks every namespace and the users across namespaces, the users owned by several namespaces
+// are only allowed in boundNamespaces, and returns all the errors found.
+func ValidateNamespaces(cfgs []*config.Namespace, boundNamespaces map[string]struct{}) []error {
+	var errs []error
+	for _, cfg := range cfgs {
+		if err := ValidateNamespace(cfg); err != nil {
+			errs = append(errs, errors.WithMessage(err, fmt.Sprintf("namespace: %s", cfg.Namespace)))
+		}
+	}
+	if err := CheckDuplicatedUsers(cfgs, boundNamespaces); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func ValidateNamespace(cfg *config.Namespace) error {
+	if err := ValidateFrontend(&cfg.Frontend); err != nil {
+		return errors.WithMessage(err, "invalid frontend")
+	}
+	if err := ValidateBackend(&cfg.Backend); err != nil {
+		return errors.WithMessage(err, "invalid backend")
+	}
+	if err := ValidateBreaker(&cfg.Breaker); err != nil {
+		return errors.WithMessage(err, "invalid breaker")
+	}
+	if err := ValidateConcurrencyLimiter(&cfg.ConcurrencyLimiter); err != nil {
+		return errors.WithMessage(err, "invalid concurrency limiter")
+	}
+	if err := ValidateShadow(&cfg.Shadow); err != nil {
+		return errors.WithMessage(err, "invalid shadow")
+	}
+	return nil
+}
+
+func ValidateFrontend(cfg *config.FrontendNamespace) error {
+	if cfg.MaxConnections < 0 || cfg.ConnectionQueueSize < 0 || cfg.ConnectionQueueTimeoutMs < 0 {
+		return ErrInvalidConnectionLimit
+	}
+	for _, u := range cfg.Users {
+		if u.MaxConnections < 0 {
+			return ErrInvalidConnectionLimit
+		}
+	}
+	p := parser.New()
+	for _, deniedSQL := range cfg.SQLBlackList {
+		if _, err := ParseSQLFeature(p, deniedSQL.SQL); err != nil {
+			return err
+		}
+	}
+	for _, allowedSQL := range cfg.SQLWhiteList {
+		if _, err := ParseSQLFeature(p, allowedSQL.SQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseSQLFeature parses a blacklist or whitelist sql, which must be a single statement.
+func ParseSQLFeature(p *parser.Parser, sql string) (string, error) {
+	stmtNodes, _, err := p.Parse(sql, "", "")
+	if err != nil {
+		return "", err
+	}
+	if len(stmtNodes) != 1 {
+		return "", errors.WithMessage(ErrInvalidSQL, fmt.Sprintf("expect one statement: %s", sql))
+	}
+	v, err := wast.ExtractAstVisit(stmtNodes[0])
+	if err != nil {
+		return "", err
+	}
+	return v.SqlFeature(), nil
+}
+
+func ValidateBackend(cfg *config.BackendNamespace) error {
+	if _, valid := backend.SelectorNameToType(cfg.SelectorType); !valid {
+		return ErrInvalidSelectorType
+	}
+	if err := ValidatePool(cfg); err != nil {
+		return err
+	}
+	switch cfg.CompressionAlgorithm {
+	case "", backend.CompressionZlib, backend.CompressionZstd:
+	default:
+		return errors.WithMessage(ErrInvalidCompressionAlgorithm, cfg.CompressionAlgorithm)
+	}
+	if len(cfg.Groups) > 0 {
+		return ValidateBackendGroups(cfg)
+	}
+	return ValidateDiscovery(&cfg.Discovery)
+}
+
+func ValidateBackendGroups(cfg *config.BackendNamespace) error {
+	if len(cfg.Instances) > 0 || cfg.Discovery.Type != "" {
+		return errors.WithMessage(ErrInvalidBackendGroup, "instances and discovery should be configured in groups")
+	}
+	names := make(map[string]struct{}, len(cfg.Groups))
+	totalWeight := 0
+	for i := range cfg.Groups {
+		g := &cfg.Groups[i]
+		if g.Name == "" {
+			return errors.WithMessage(ErrInvalidBackendGroup, "name is empty")
+		}
+		if _, ok := names[g.Name]; ok {
+			return errors.WithMessage(ErrInvalidBackendGroup, fmt.Sprintf("duplicate name: %s", g.Name))
+		}
+		names[g.Name] = struct{}{}
+		if g.Weight < 0 {
+			return errors.WithMessage(ErrInvalidBackendGroup, fmt.Sprintf("weight of %s is negative", g.Name))
+		}
+		totalWeight += g.Weight
+		if err := ValidateDiscovery(&g.Discovery); err != nil {
+			return err
+		}
+	}
+	if totalWeight == 0 {
+		return errors.WithMessage(ErrInvalidBackendGroup, "total weight is 0")
+	}
+	return nil
+}
+
+func ValidatePool(cfg *config.BackendNamespace) error {
+	if cfg.ConnectTimeoutMs < 0 || cfg.MaxLifetime < 0 || cfg.MaxWaitMs < 0 || cfg.IdleTimeout < 0 {
+		return errors.WithMessage(ErrInvalidPoolConfig, "timeout is negative")
+	}
+	if cfg.MinIdle < 0 || cfg.MinIdle > cfg.PoolSize {
+		return errors.WithMessage(ErrInvalidPoolConfig, fmt.Sprintf("min_idle should be in [0, pool_size], got %d", cfg.MinIdle))
+	}
+	return nil
+}
+
+func ValidateDiscovery(cfg *config.DiscoveryInfo) error {
+	switch cfg.Type {
+	case "", backend.DiscoveryTypeStatic:
+		return nil
+	case backend.DiscoveryTypePD:
+		if len(cfg.Addrs) == 0 {
+			return errors.WithMessage(ErrInvalidDiscovery, "pd addrs is empty")
+		}
+		return nil
+	case backend.DiscoveryTypeDNS, backend.DiscoveryTypeSRV:
+		if cfg.Name == "" {
+			return errors.WithMessage(ErrInvalidDiscovery, "name is empty")
+		}
+		if cfg.Type == backend.DiscoveryTypeDNS && (cfg.Port <= 0 || cfg.Port > 65535) {
+			return errors.WithMessage(ErrInvalidDiscovery, fmt.Sprintf("invalid port: %d", cfg.Port))
+		}
+		if cfg.RefreshIntervalMs < 0 {
+			return errors.WithMessage(ErrInvalidDiscovery, "refresh interval is negative")
+		}
+		return nil
+	default:
+		return errors.WithMessage(ErrInvalidDiscovery, fmt.Sprintf("unknown type: %s", cfg.Type))
+	}
+}
+
+func ValidateBreaker(cfg *config.BreakerInfo) error {
+	for i := range cfg.Strategies {
+		if err := ValidateBreakerStrategy(&cfg.Strategies[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidateBreakerStrategy(s *config.StrategyInfo) error {
+	if s.FailureRatethreshold < 0 || s.FailureRatethreshold > 100 {
+		return ErrInvalidFailureRateThreshold
+	}
+	if s.OpenStatusDurationMs <= 0 {
+		return ErrInvalidopenStatusDurationMs
+	}
+	if s.SqlTimeoutMs <= 0 {
+		return ErrInvalidSqlTimeout
+	}
+	return nil
+}
+
+func ValidateConcurrencyLimiter(info *config.ConcurrencyLimiterInfo) error {
+	switch info.Scope {
+	case "", "namespace", "table", "sql":
+	default:
+		return ErrInvalidScope
+	}
+	if info.MaxConcurrency < 0 || info.MaxQueueSize < 0 || info.MinConcurrency < 0 {
+		return ErrInvalidConcurrencyLimit
+	}
+	if info.Adaptive && info.LatencyThresholdMs <= 0 {
+		return ErrInvalidConcurrencyLimit
+	}
+	return nil
+}
+
+func ValidateShadow(cfg *config.ShadowInfo) error {
+	if !cfg.Enable {
+		return nil
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		return errors.WithMessage(ErrInvalidShadow, fmt.Sprintf("sample_rate should be in (0, 1], got %v", cfg.SampleRate))
+	}
+	if cfg.QueueSize < 0 || cfg.TimeoutMs < 0 {
+		return ErrInvalidShadow
+	}
+	return ValidateBackend(&cfg.Backend)
+}
+
+// CheckDuplicatedUsers checks that a user appears only once in a namespace, and a user owned by
+// several namespaces can only be owned by the namespaces bound to listeners, where the user is looked up.
+func CheckDuplicatedUsers(cfgs []*config.Namespace, boundNamespaces map[string]struct{}) error {
+	owners := make(map[string][]string)
+	for _, ns := range cfgs {
+		if err := checkNamespaceUsers(ns); err != nil {
+			return err
+		}
+		for _, user := range ns.Frontend.Users {
+			owners[user.Username] = append(owners[user.Username], ns.Namespace)
+		}
+	}
+	for _, ns := range cfgs {
+		for _, user := range ns.Frontend.Users {
+			if err := CheckSharedUser(user.Username, owners[user.Username], boundNamespaces); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CheckSharedUser checks that a user owned by several namespaces is only owned by the namespaces bound to listeners,
+// otherwise the listeners without a bound namespace can not tell which namespace the user connects to.
+func CheckSharedUser(username string, namespaces []string, boundNamespaces map[string]struct{}) error {
+	if len(namespaces) <= 1 {
+		return nil
+	}
+	for _, ns := range namespaces {
+		if _, ok := boundNamespaces[ns]; !ok {
+			return errors.WithMessage(ErrDuplicatedUser, fmt.Sprintf("user: %s, namespace: %s, "+
+				"a user owned by several namespaces can only be owned by the namespaces bound to listeners",
+				username, strings.Join(namespaces, ", ")))
+		}
+	}
+	return nil
+}
+
+// checkNamespaceUsers checks that a user appears only once in a namespace.
+func checkNamespaceUsers(ns *config.Namespace) error {
+	users := make(map[string]struct{})
+	for _, user := range ns.Frontend.Users {
+		if _, ok := users[user.Username]; ok {
+			return errors.WithMessage(ErrDuplicatedUser,
+				fmt.Sprintf("user: %s, namespace: %s", user.Username, ns.Namespace))
+		}
+		users[user.Username] = struct{}{}
+	}
+	return nil
+}
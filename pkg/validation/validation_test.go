@@ -0,0 +1,124 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/tidb-incubator/weir/pkg/config"
+)
+
+func createValidNamespace(name string, username string) *config.Namespace {
+	return &config.Namespace{
+		Namespace: name,
+		Frontend: config.FrontendNamespace{
+			Users:        []config.FrontendUserInfo{{Username: username}},
+			SQLBlackList: []config.SQLInfo{{SQL: "select * from tbl0"}},
+		},
+		Backend: config.BackendNamespace{SelectorType: "random"},
+		Breaker: config.BreakerInfo{
+			Scope:      "sql",
+			Strategies: []config.StrategyInfo{{FailureRatethreshold: 50, OpenStatusDurationMs: 1000, SqlTimeoutMs: 1000}},
+		},
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	require.NoError(t, ValidateNamespace(createValidNamespace("ns", "hello")))
+
+	ns := createValidNamespace("ns", "hello")
+	ns.Backend.SelectorType = "unknown"
+	require.Equal(t, ErrInvalidSelectorType, errors.Cause(ValidateNamespace(ns)))
+
+	ns = createValidNamespace("ns", "hello")
+	ns.Frontend.SQLBlackList = []config.SQLInfo{{SQL: "select * from"}}
+	require.Error(t, ValidateNamespace(ns))
+
+	ns = createValidNamespace("ns", "hello")
+	ns.Frontend.SQLWhiteList = []config.SQLInfo{{SQL: "select 1; select 2"}}
+	require.Equal(t, ErrInvalidSQL, errors.Cause(ValidateNamespace(ns)))
+
+	ns = createValidNamespace("ns", "hello")
+	ns.Breaker.Strategies[0].FailureRatethreshold = 101
+	require.Equal(t, ErrInvalidFailureRateThreshold, errors.Cause(ValidateNamespace(ns)))
+
+	ns = createValidNamespace("ns", "hello")
+	ns.Frontend.Users[0].MaxConnections = -1
+	require.Equal(t, ErrInvalidConnectionLimit, errors.Cause(ValidateNamespace(ns)))
+}
+
+func TestValidateConcurrencyLimiter(t *testing.T) {
+	require.NoError(t, ValidateConcurrencyLimiter(&config.ConcurrencyLimiterInfo{}))
+	require.NoError(t, ValidateConcurrencyLimiter(&config.ConcurrencyLimiterInfo{Scope: "sql", MaxConcurrency: 10}))
+	require.Equal(t, ErrInvalidScope, ValidateConcurrencyLimiter(&config.ConcurrencyLimiterInfo{Scope: "db"}))
+	require.Equal(t, ErrInvalidConcurrencyLimit, ValidateConcurrencyLimiter(&config.ConcurrencyLimiterInfo{Scope: "table", MaxConcurrency: -1}))
+	require.Equal(t, ErrInvalidConcurrencyLimit, ValidateConcurrencyLimiter(&config.ConcurrencyLimiterInfo{Scope: "table", MaxConcurrency: 10, Adaptive: true}))
+}
+
+func TestValidateShadow(t *testing.T) {
+	require.NoError(t, ValidateShadow(&config.ShadowInfo{SampleRate: 2}))
+	require.NoError(t, ValidateShadow(&config.ShadowInfo{Enable: true, SampleRate: 0.1, Backend: config.BackendNamespace{SelectorType: "random"}}))
+	require.Equal(t, ErrInvalidShadow, errors.Cause(ValidateShadow(&config.ShadowInfo{Enable: true, Backend: config.BackendNamespace{SelectorType: "random"}})))
+	require.Equal(t, ErrInvalidShadow, errors.Cause(ValidateShadow(&config.ShadowInfo{Enable: true, SampleRate: 1.5, Backend: config.BackendNamespace{SelectorType: "random"}})))
+	require.Equal(t, ErrInvalidSelectorType, errors.Cause(ValidateShadow(&config.ShadowInfo{Enable: true, SampleRate: 1})))
+}
+
+func TestValidateDiscovery(t *testing.T) {
+	require.NoError(t, ValidateDiscovery(&config.DiscoveryInfo{}))
+	require.NoError(t, ValidateDiscovery(&config.DiscoveryInfo{Type: "dns", Name: "tidb-peer", Port: 4000}))
+	require.NoError(t, ValidateDiscovery(&config.DiscoveryInfo{Type: "srv", Name: "_mysql._tcp.tidb-peer"}))
+	require.Equal(t, ErrInvalidDiscovery, errors.Cause(ValidateDiscovery(&config.DiscoveryInfo{Type: "pd"})))
+	require.Equal(t, ErrInvalidDiscovery, errors.Cause(ValidateDiscovery(&config.DiscoveryInfo{Type: "dns", Name: "tidb-peer"})))
+	require.Equal(t, ErrInvalidDiscovery, errors.Cause(ValidateDiscovery(&config.DiscoveryInfo{Type: "srv"})))
+	require.Equal(t, ErrInvalidDiscovery, errors.Cause(ValidateDiscovery(&config.DiscoveryInfo{Type: "unknown"})))
+}
+
+func TestValidatePool(t *testing.T) {
+	require.NoError(t, ValidatePool(&config.BackendNamespace{PoolSize: 10, MinIdle: 10, MaxLifetime: 3600, MaxWaitMs: 100}))
+	require.Equal(t, ErrInvalidPoolConfig, errors.Cause(ValidatePool(&config.BackendNamespace{PoolSize: 10, MinIdle: 11})))
+	require.Equal(t, ErrInvalidPoolConfig, errors.Cause(ValidatePool(&config.BackendNamespace{PoolSize: 10, ConnectTimeoutMs: -1})))
+}
+
+func TestValidateCompressionAlgorithm(t *testing.T) {
+	require.NoError(t, ValidateBackend(&config.BackendNamespace{SelectorType: "random", CompressionAlgorithm: "zstd"}))
+	require.NoError(t, ValidateBackend(&config.BackendNamespace{SelectorType: "random", CompressionAlgorithm: "zlib"}))
+	require.Equal(t, ErrInvalidCompressionAlgorithm, errors.Cause(ValidateBackend(&config.BackendNamespace{SelectorType: "random", CompressionAlgorithm: "lz4"})))
+}
+
+func TestValidateBackendGroups(t *testing.T) {
+	newBackend := func(groups ...config.BackendGroup) *config.BackendNamespace {
+		return &config.BackendNamespace{SelectorType: "random", Groups: groups}
+	}
+	require.NoError(t, ValidateBackend(newBackend(config.BackendGroup{Name: "old", Weight: 90}, config.BackendGroup{Name: "new", Weight: 10})))
+	require.NoError(t, ValidateBackend(newBackend(config.BackendGroup{Name: "old", Weight: 100}, config.BackendGroup{Name: "new"})))
+
+	cfg := newBackend(config.BackendGroup{Name: "old", Weight: 1})
+	cfg.Instances = []string{"127.0.0.1:4000"}
+	require.Equal(t, ErrInvalidBackendGroup, errors.Cause(ValidateBackend(cfg)))
+	require.Equal(t, ErrInvalidBackendGroup, errors.Cause(ValidateBackend(newBackend(config.BackendGroup{Weight: 1}))))
+	require.Equal(t, ErrInvalidBackendGroup, errors.Cause(ValidateBackend(newBackend(config.BackendGroup{Name: "old", Weight: 1}, config.BackendGroup{Name: "old", Weight: 1}))))
+	require.Equal(t, ErrInvalidBackendGroup, errors.Cause(ValidateBackend(newBackend(config.BackendGroup{Name: "old", Weight: -1}, config.BackendGroup{Name: "new", Weight: 2}))))
+	require.Equal(t, ErrInvalidBackendGroup, errors.Cause(ValidateBackend(newBackend(config.BackendGroup{Name: "old"}))))
+	require.Equal(t, ErrInvalidDiscovery, errors.Cause(ValidateBackend(newBackend(config.BackendGroup{Name: "old", Weight: 1, Discovery: config.DiscoveryInfo{Type: "pd"}}))))
+}
+
+func TestValidateNamespaces(t *testing.T) {
+	cfgs := []*config.Namespace{createValidNamespace("ns1", "hello"), createValidNamespace("ns2", "world")}
+	require.Len(t, ValidateNamespaces(cfgs, nil), 0)
+
+	// a user can be owned by several namespaces only if all of them are bound to listeners
+	cfgs[1].Frontend.Users = append(cfgs[1].Frontend.Users, config.FrontendUserInfo{Username: "hello"})
+	boundNamespaces := map[string]struct{}{"ns1": {}, "ns2": {}}
+	require.Len(t, ValidateNamespaces(cfgs, boundNamespaces), 0)
+	errs := ValidateNamespaces(cfgs, map[string]struct{}{"ns2": {}})
+	require.Len(t, errs, 1)
+	require.Equal(t, ErrDuplicatedUser, errors.Cause(errs[0]))
+
+	// a user can not appear twice in a namespace
+	cfgs[1].Frontend.Users = append(cfgs[1].Frontend.Users, config.FrontendUserInfo{Username: "hello"})
+	cfgs[1].Backend.SelectorType = ""
+	errs = ValidateNamespaces(cfgs, boundNamespaces)
+	require.Len(t, errs, 2)
+	require.Equal(t, ErrInvalidSelectorType, errors.Cause(errs[0]))
+	require.Equal(t, ErrDuplicatedUser, errors.Cause(errs[1]))
+}